@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// APIKeys maps the SHA-256 of each API key to its name. Only the hashes are kept, so that the file they are loaded from does not hold the keys.
+// API keys should be long random strings, for which a single unsalted hash is enough.
+type APIKeys map[string]string
+
+// HashAPIKey returns the hex encoded SHA-256 of key, as it is written in an API keys file.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the name of key.
+func (k APIKeys) Lookup(key string) (string, bool) {
+	name, ok := k[HashAPIKey(key)]
+	return name, ok
+}
+
+// LoadAPIKeys reads a file with a key on each line, as its name followed by its hash from HashAPIKey, such as
+//
+//	deploy-bot 2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae
+//
+// Blank lines and lines starting with # are ignored.
+func LoadAPIKeys(file string) (APIKeys, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("loading API keys: %w", err)
+	}
+	defer f.Close()
+
+	keys := make(APIKeys)
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("loading API keys: line %d: expected a name and a hash", line)
+		}
+		name, hash := fields[0], strings.ToLower(fields[1])
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("loading API keys: line %d: %q is not a hex encoded SHA-256", line, fields[1])
+		}
+		if names[name] {
+			return nil, fmt.Errorf("loading API keys: line %d: %s is given more than once", line, name)
+		}
+		if _, ok := keys[hash]; ok {
+			return nil, fmt.Errorf("loading API keys: line %d: the key for %s is also %s's", line, name, keys[hash])
+		}
+
+		names[name] = true
+		keys[hash] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("loading API keys: %w", err)
+	}
+	return keys, nil
+}
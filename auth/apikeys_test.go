@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeAPIKeys(t *testing.T, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "api-keys")
+	err := os.WriteFile(file, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestHashAPIKey(t *testing.T) {
+	//printf %s foo | sha256sum
+	if got := HashAPIKey("foo"); got != "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	tt := []struct {
+		name    string
+		content string
+		lookup  map[string]string
+		err     string
+	}{
+		{
+			name:    "keys should be looked up by their hash",
+			content: "# deploys\ndeploy-bot " + HashAPIKey("secret-1") + "\n\n  reader   " + strings.ToUpper(HashAPIKey("secret-2")) + "\n",
+			lookup:  map[string]string{"secret-1": "deploy-bot", "secret-2": "reader", "secret-3": "", HashAPIKey("secret-1"): ""},
+		},
+		{name: "line without a hash should be an error", content: "deploy-bot\n", err: "line 1: expected a name and a hash"},
+		{name: "hash of the wrong length should be an error", content: "deploy-bot abcd\n", err: "not a hex encoded SHA-256"},
+		{name: "repeated name should be an error", content: "a " + HashAPIKey("1") + "\na " + HashAPIKey("2") + "\n", err: "line 2: a is given more than once"},
+		{name: "repeated key should be an error", content: "a " + HashAPIKey("1") + "\nb " + HashAPIKey("1") + "\n", err: "also a's"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			keys, err := LoadAPIKeys(writeAPIKeys(t, tc.content))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("got error %v, expected one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadAPIKeys returned an error: %s", err)
+			}
+			for key, expected := range tc.lookup {
+				name, ok := keys.Lookup(key)
+				if name != expected || ok != (expected != "") {
+					t.Errorf("Lookup(%q) = %q, %v, expected %q", key, name, ok, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeysMissingFile(t *testing.T) {
+	_, err := LoadAPIKeys(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Error("LoadAPIKeys should have failed")
+	}
+}
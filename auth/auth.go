@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"KeyValueDB/certs"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader carries an API key. A key may also be sent as a bearer token in the Authorization header.
+const APIKeyHeader = "X-API-Key"
+
+var (
+	// ErrNoCredentials is returned by Authenticate for a request without an API key, a token or a client certificate.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned, wrapped, by Authenticate for an unknown API key or a token that is not valid.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrNotForwardable is returned by Transport for a request proxied on behalf of a client that sent no API key or token.
+	ErrNotForwardable = errors.New("proxied request has no client credentials")
+)
+
+// Method is how a caller authenticated.
+type Method string
+
+const (
+	MethodAPIKey      Method = "api-key"
+	MethodJWT         Method = "jwt"
+	MethodCertificate Method = "certificate"
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	//The API key's name, the token's subject, or the identity in the client certificate.
+	Name   string
+	Method Method
+
+	//The token's claims, for a caller that sent a JWT.
+	Claims map[string]interface{}
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the caller.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller a request was authenticated as.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Config configures an Authenticator. At least one of APIKeys and KeySet should be set.
+type Config struct {
+	APIKeys APIKeys
+
+	//Keys that JWTs must be signed with.
+	KeySet *KeySet
+
+	//If set, a JWT's iss claim must equal Issuer, and its aud claim must contain Audience.
+	Issuer   string
+	Audience string
+
+	//Accept a client certificate verified by the TLS server as credentials.
+	Certificates bool
+}
+
+// Authenticator checks the credentials requests are sent with.
+type Authenticator struct {
+	cfg Config
+	now func() time.Time
+}
+
+func NewAuthenticator(cfg Config) *Authenticator {
+	return &Authenticator{cfg: cfg, now: time.Now}
+}
+
+// Authenticate returns the caller r was sent by. An API key or token is checked first; without one, the request is
+// authenticated by its client certificate if that is accepted.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	credential := r.Header.Get(APIKeyHeader)
+	if credential == "" {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			credential = strings.TrimSpace(token)
+		}
+	}
+
+	if credential == "" {
+		if id, ok := certs.ClientIdentity(r.Context()); ok && a.cfg.Certificates {
+			return Principal{Name: id.String(), Method: MethodCertificate}, nil
+		}
+		return Principal{}, ErrNoCredentials
+	}
+
+	if looksLikeJWT(credential) && a.cfg.KeySet != nil {
+		claims, err := a.cfg.KeySet.Verify(credential, a.now())
+		if err != nil {
+			return Principal{}, err
+		}
+		err = a.checkClaims(claims)
+		if err != nil {
+			return Principal{}, err
+		}
+		return Principal{Name: claims.Subject(), Method: MethodJWT, Claims: claims}, nil
+	}
+
+	name, ok := a.cfg.APIKeys.Lookup(credential)
+	if !ok {
+		return Principal{}, invalid("unknown API key")
+	}
+	return Principal{Name: name, Method: MethodAPIKey}, nil
+}
+
+func (a *Authenticator) checkClaims(claims Claims) error {
+	if claims.Subject() == "" {
+		return invalid("token has no subject")
+	}
+	if a.cfg.Issuer != "" && claims.string("iss") != a.cfg.Issuer {
+		return invalid("token is from another issuer")
+	}
+	if a.cfg.Audience != "" && !claims.hasAudience(a.cfg.Audience) {
+		return invalid("token is for another audience")
+	}
+	return nil
+}
+
+// Handler serves requests with next once they are authenticated, with the caller in the request context, and answers 401 otherwise.
+func (a *Authenticator) Handler(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			logger.InfoContext(r.Context(), "authentication failed", "err", err, "remote", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kvdb"`)
+			http.Error(w, "error - unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// Transport sends key as the API key of requests made by rt that carry no credentials of their own, such as requests from
+// this node to other nodes. Requests proxied on behalf of a client, with a context from Proxied, keep the client's credentials,
+// and are never sent with the key: one without credentials of its own fails with ErrNotForwardable.
+func Transport(key string, rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return roundTripper(func(r *http.Request) (*http.Response, error) {
+		if r.Header.Get(APIKeyHeader) != "" || r.Header.Get("Authorization") != "" {
+			return rt.RoundTrip(r)
+		}
+		if r.Context().Value(proxiedKey{}) != nil {
+			return nil, ErrNotForwardable
+		}
+		//A RoundTripper must not modify the request it is given.
+		r = r.Clone(r.Context())
+		r.Header.Set(APIKeyHeader, key)
+		return rt.RoundTrip(r)
+	})
+}
+
+type proxiedKey struct{}
+
+// Proxied returns a copy of ctx for requests sent to another node on behalf of the client of an incoming request, which
+// Transport sends only with the client's own credentials.
+func Proxied(ctx context.Context) context.Context {
+	return context.WithValue(ctx, proxiedKey{}, true)
+}
+
+// Forwardable reports whether r can be proxied to another node, which authenticates its client by the API key or token
+// it was sent with. A client authenticated by its certificate cannot be: the other node would see this node's certificate.
+func Forwardable(r *http.Request) bool {
+	p, ok := PrincipalFrom(r.Context())
+	return !ok || p.Method != MethodCertificate
+}
+
+func invalid(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidCredentials, reason)
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
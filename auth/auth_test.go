@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"KeyValueDB/certs"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.DiscardHandler)
+
+func testAuthenticator(t *testing.T, cfg Config) *Authenticator {
+	t.Helper()
+
+	if cfg.APIKeys == nil {
+		cfg.APIKeys = APIKeys{HashAPIKey("secret-key"): "deploy-bot"}
+	}
+	if cfg.KeySet == nil {
+		cfg.KeySet = testKeySet(t)
+	}
+	a := NewAuthenticator(cfg)
+	a.now = func() time.Time { return testNow }
+	return a
+}
+
+func TestAuthenticate(t *testing.T) {
+	token := func(claims map[string]interface{}) string {
+		claims["exp"] = testNow.Add(time.Hour).Unix()
+		return sign(t, map[string]interface{}{"alg": "HS256"}, claims)
+	}
+
+	tt := []struct {
+		name     string
+		cfg      Config
+		header   map[string]string
+		identity string
+		expected Principal
+		err      error
+	}{
+		{
+			name:     "API key header should authenticate",
+			header:   map[string]string{APIKeyHeader: "secret-key"},
+			expected: Principal{Name: "deploy-bot", Method: MethodAPIKey},
+		},
+		{
+			name:     "API key as a bearer token should authenticate",
+			header:   map[string]string{"Authorization": "bearer secret-key"},
+			expected: Principal{Name: "deploy-bot", Method: MethodAPIKey},
+		},
+		{
+			name:     "JWT should authenticate as its subject",
+			header:   map[string]string{"Authorization": "Bearer " + token(map[string]interface{}{"sub": "alice"})},
+			expected: Principal{Name: "alice", Method: MethodJWT},
+		},
+		{
+			name:   "unknown API key should be rejected",
+			header: map[string]string{APIKeyHeader: "guess"},
+			err:    ErrInvalidCredentials,
+		},
+		{
+			name:   "other authorization schemes should be ignored",
+			header: map[string]string{"Authorization": "Basic c2VjcmV0LWtleQ=="},
+			err:    ErrNoCredentials,
+		},
+		{name: "request without credentials should be rejected", err: ErrNoCredentials},
+		{
+			name:   "JWT without a subject should be rejected",
+			header: map[string]string{"Authorization": "Bearer " + token(map[string]interface{}{})},
+			err:    ErrInvalidCredentials,
+		},
+		{
+			name:   "JWT from another issuer should be rejected",
+			cfg:    Config{Issuer: "https://idp.example"},
+			header: map[string]string{"Authorization": "Bearer " + token(map[string]interface{}{"sub": "alice", "iss": "https://evil.example"})},
+			err:    ErrInvalidCredentials,
+		},
+		{
+			name:     "JWT for the configured issuer and audience should authenticate",
+			cfg:      Config{Issuer: "https://idp.example", Audience: "kvdb"},
+			header:   map[string]string{"Authorization": "Bearer " + token(map[string]interface{}{"sub": "alice", "iss": "https://idp.example", "aud": []string{"kvdb"}})},
+			expected: Principal{Name: "alice", Method: MethodJWT},
+		},
+		{
+			name:   "JWT for another audience should be rejected",
+			cfg:    Config{Audience: "kvdb"},
+			header: map[string]string{"Authorization": "Bearer " + token(map[string]interface{}{"sub": "alice", "aud": "other"})},
+			err:    ErrInvalidCredentials,
+		},
+		{
+			name:     "client certificate should authenticate when accepted",
+			cfg:      Config{Certificates: true},
+			identity: "node-2",
+			expected: Principal{Name: "node-2", Method: MethodCertificate},
+		},
+		{
+			name:     "client certificate should not authenticate unless accepted",
+			identity: "node-2",
+			err:      ErrNoCredentials,
+		},
+		{
+			name:     "API key should take precedence over a client certificate",
+			cfg:      Config{Certificates: true},
+			header:   map[string]string{APIKeyHeader: "secret-key"},
+			identity: "node-2",
+			expected: Principal{Name: "deploy-bot", Method: MethodAPIKey},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/key", nil)
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			if tc.identity != "" {
+				r = r.WithContext(certs.WithIdentity(r.Context(), certs.Identity{CommonName: tc.identity}))
+			}
+
+			p, err := testAuthenticator(t, tc.cfg).Authenticate(r)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got error %v, expected %v", err, tc.err)
+			}
+			if p.Name != tc.expected.Name || p.Method != tc.expected.Method {
+				t.Errorf("got principal %+v, expected %+v", p, tc.expected)
+			}
+			if p.Method == MethodJWT && p.Claims["sub"] != p.Name {
+				t.Errorf("claims were not kept: %v", p.Claims)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	a := testAuthenticator(t, Config{})
+	h := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFrom(r.Context())
+		_, _ = io.WriteString(w, p.Name)
+	}), testLogger)
+
+	tt := []struct {
+		name         string
+		key          string
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "authenticated request should be served with its principal", key: "secret-key", expectedCode: http.StatusOK, expectedBody: "deploy-bot"},
+		{name: "request with an unknown key should be 401", key: "guess", expectedCode: http.StatusUnauthorized, expectedBody: "error - unauthorized\n"},
+		{name: "request without credentials should be 401", expectedCode: http.StatusUnauthorized, expectedBody: "error - unauthorized\n"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/key", nil)
+			if tc.key != "" {
+				r.Header.Set(APIKeyHeader, tc.key)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.expectedCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedCode)
+			}
+			if w.Body.String() != tc.expectedBody {
+				t.Errorf("Response body: got %q, want %q", w.Body.String(), tc.expectedBody)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var seen http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: Transport("peer-key", nil)}
+
+	tt := []struct {
+		name     string
+		header   map[string]string
+		proxied  bool
+		expected map[string]string
+		err      error
+	}{
+		{name: "request without credentials should be sent with the key", expected: map[string]string{APIKeyHeader: "peer-key"}},
+		{
+			name:     "request with a client's token should keep it",
+			header:   map[string]string{"Authorization": "Bearer client-token"},
+			expected: map[string]string{"Authorization": "Bearer client-token", APIKeyHeader: ""},
+		},
+		{
+			name:     "request with a client's API key should keep it",
+			header:   map[string]string{APIKeyHeader: "client-key"},
+			expected: map[string]string{APIKeyHeader: "client-key"},
+		},
+		{
+			name:     "proxied request with a client's token should keep it",
+			header:   map[string]string{"Authorization": "Bearer client-token"},
+			proxied:  true,
+			expected: map[string]string{"Authorization": "Bearer client-token", APIKeyHeader: ""},
+		},
+		{name: "proxied request without credentials should not be sent", proxied: true, err: ErrNotForwardable},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			seen = nil
+			ctx := context.Background()
+			if tc.proxied {
+				ctx = Proxied(ctx)
+			}
+			r, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			resp, err := c.Do(r)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) || seen != nil {
+					t.Errorf("got %v, and the request was sent: %t, expected %v", err, seen != nil, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+
+			for k, v := range tc.expected {
+				if seen.Get(k) != v {
+					t.Errorf("%s: got %q, expected %q", k, seen.Get(k), v)
+				}
+			}
+			if len(tc.header) == 0 && r.Header.Get(APIKeyHeader) != "" {
+				t.Error("the caller's request was modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	//How far a token's exp and nbf may be off, allowing for clocks that disagree.
+	clockSkew = 30 * time.Second
+
+	//Weaker keys are refused when the key set is loaded.
+	minHMACKeyBytes = 32
+	minRSAKeyBits   = 2048
+)
+
+// Claims are the claims of a verified JWT, with numbers decoded as json.Number.
+type Claims map[string]interface{}
+
+// Subject returns the sub claim.
+func (c Claims) Subject() string {
+	return c.string("sub")
+}
+
+func (c Claims) string(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Latest NumericDate, in seconds either side of 1970, that fits in a time.Duration of nanoseconds.
+const maxNumericDate = float64(math.MaxInt64 / int64(time.Second))
+
+// time returns a NumericDate claim, and whether it is present. A claim that is not a number, or is too far from now to represent, is an error.
+func (c Claims) time(name string) (time.Time, bool, error) {
+	v, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, invalid(name + " is not a number")
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, invalid(name + " is not a number")
+	}
+	//Checked before converting, since an overflow could turn a date far in the future into one in the past.
+	if f > maxNumericDate || f < -maxNumericDate {
+		return time.Time{}, false, invalid(name + " is out of range")
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true, nil
+}
+
+// hasAudience reports whether aud, which is a string or a list of strings, contains audience.
+func (c Claims) hasAudience(audience string) bool {
+	switch aud := c["aud"].(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jwk is a JSON Web Key, as found in a key set file.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+
+	//A symmetric key, for HS256.
+	K string `json:"k"`
+
+	//The modulus and exponent of an RSA public key, for RS256.
+	N string `json:"n"`
+	E string `json:"e"`
+}
+
+type key struct {
+	id     string
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// KeySet holds the keys that JWTs are verified with: symmetric keys for HS256, and RSA public keys for RS256.
+type KeySet struct {
+	keys []key
+}
+
+// LoadKeySet reads a JSON Web Key Set, such as
+//
+//	{"keys": [{"kty": "oct", "kid": "shared", "k": "<base64url secret>"}, {"kty": "RSA", "kid": "idp-1", "n": "<base64url>", "e": "AQAB"}]}
+//
+// Keys of other types, or for other algorithms, are an error.
+func LoadKeySet(file string) (*KeySet, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("loading key set: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err = json.Unmarshal(b, &set)
+	if err != nil {
+		return nil, fmt.Errorf("loading key set: %w", err)
+	}
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("loading key set: no keys found in %s", file)
+	}
+
+	ks := &KeySet{}
+	for i, k := range set.Keys {
+		parsed, err := parseKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("loading key set: key %d: %w", i, err)
+		}
+		ks.keys = append(ks.keys, parsed)
+	}
+	return ks, nil
+}
+
+func parseKey(k jwk) (key, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "oct":
+		if k.Alg != "" && k.Alg != "HS256" {
+			return key{}, fmt.Errorf("unsupported algorithm %q for a symmetric key", k.Alg)
+		}
+		secret, err := decode(k.K)
+		if err != nil || len(secret) < minHMACKeyBytes {
+			return key{}, fmt.Errorf("k must be a base64url encoded secret of at least %d bytes", minHMACKeyBytes)
+		}
+		return key{id: k.Kid, alg: "HS256", secret: secret}, nil
+
+	case "RSA":
+		if k.Alg != "" && k.Alg != "RS256" {
+			return key{}, fmt.Errorf("unsupported algorithm %q for an RSA key", k.Alg)
+		}
+		n, err := decode(k.N)
+		if err != nil {
+			return key{}, errors.New("n is not base64url encoded")
+		}
+		e, err := decode(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return key{}, errors.New("e is not a base64url encoded exponent")
+		}
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if public.N.BitLen() < minRSAKeyBits {
+			return key{}, fmt.Errorf("RSA keys must have at least %d bits", minRSAKeyBits)
+		}
+		return key{id: k.Kid, alg: "RS256", public: public}, nil
+	}
+	return key{}, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// looksLikeJWT reports whether credential is shaped like a JWT rather than an API key: three base64url segments, the first a JSON object.
+func looksLikeJWT(credential string) bool {
+	header, _, ok := strings.Cut(credential, ".")
+	if !ok || strings.Count(credential, ".") != 2 {
+		return false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(header)
+	return err == nil && bytes.HasPrefix(bytes.TrimSpace(b), []byte("{"))
+}
+
+// Verify checks that token is signed by one of the keys, with the algorithm that key is for, and that it is valid at now.
+// The token must have an exp claim. Its claims are returned.
+func (ks *KeySet) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, invalid("malformed token header")
+	}
+	if header.Alg != "HS256" && header.Alg != "RS256" {
+		return nil, invalid(fmt.Sprintf("unsupported algorithm %q", header.Alg))
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid("malformed token signature")
+	}
+
+	//A key is only used for its own algorithm, so that an RSA public key can never be used as an HMAC secret.
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range ks.keys {
+		if k.alg != header.Alg || header.Kid != "" && k.id != header.Kid {
+			continue
+		}
+		if k.verify(signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, invalid("token signature does not match any key")
+	}
+
+	var claims Claims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil || claims == nil {
+		return nil, invalid("malformed token claims")
+	}
+
+	exp, ok, err := claims.time("exp")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, invalid("token has no expiry")
+	}
+	if !now.Before(exp.Add(clockSkew)) {
+		return nil, invalid("token has expired")
+	}
+	nbf, ok, err := claims.time("nbf")
+	if err != nil {
+		return nil, err
+	}
+	if ok && now.Add(clockSkew).Before(nbf) {
+		return nil, invalid("token is not valid yet")
+	}
+
+	return claims, nil
+}
+
+func (k key) verify(signed, sig []byte) bool {
+	if k.alg == "HS256" {
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig)
+	}
+	sum := sha256.Sum256(signed)
+	return rsa.VerifyPKCS1v15(k.public, crypto.SHA256, sum[:], sig) == nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(v)
+}
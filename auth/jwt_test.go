@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+	testNow    = time.Unix(1700000000, 0)
+)
+
+var testRSAKey = func() *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}()
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sign returns a JWT with header and claims, signed with HS256 using testSecret or RS256 using testRSAKey.
+func sign(t *testing.T, header, claims map[string]interface{}) string {
+	t.Helper()
+
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := b64(h) + "." + b64(c)
+
+	var sig []byte
+	switch header["alg"] {
+	case "HS256":
+		mac := hmac.New(sha256.New, testSecret)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case "RS256":
+		sum := sha256.Sum256([]byte(signed))
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + b64(sig)
+}
+
+func writeKeySet(t *testing.T, keys ...map[string]string) string {
+	t.Helper()
+
+	b, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	err := os.WriteFile(file, b, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func testKeySet(t *testing.T) *KeySet {
+	t.Helper()
+
+	ks, err := LoadKeySet(writeKeySet(t,
+		map[string]string{"kty": "oct", "kid": "shared", "k": b64(testSecret)},
+		map[string]string{"kty": "RSA", "kid": "idp", "n": b64(testRSAKey.N.Bytes()), "e": b64(big.NewInt(int64(testRSAKey.E)).Bytes())},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestLoadKeySet(t *testing.T) {
+	small, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	tt := []struct {
+		name string
+		keys []map[string]string
+		err  string
+	}{
+		{name: "symmetric and RSA keys should load", keys: []map[string]string{
+			{"kty": "oct", "k": b64(testSecret), "alg": "HS256"},
+			{"kty": "RSA", "n": b64(testRSAKey.N.Bytes()), "e": "AQAB", "alg": "RS256"},
+		}},
+		{name: "empty key set should be an error", err: "no keys found"},
+		{name: "short secret should be an error", keys: []map[string]string{{"kty": "oct", "k": b64([]byte("short"))}}, err: "at least 32 bytes"},
+		{name: "small RSA key should be an error", keys: []map[string]string{{"kty": "RSA", "n": b64(small.N.Bytes()), "e": "AQAB"}}, err: "at least 2048 bits"},
+		{name: "other algorithms should be an error", keys: []map[string]string{{"kty": "oct", "k": b64(testSecret), "alg": "HS512"}}, err: "unsupported algorithm"},
+		{name: "other key types should be an error", keys: []map[string]string{{"kty": "EC", "crv": "P-256"}}, err: "unsupported key type"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadKeySet(writeKeySet(t, tc.keys...))
+			if tc.err == "" && err != nil {
+				t.Errorf("LoadKeySet returned an error: %s", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("got error %v, expected one containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ks := testKeySet(t)
+	valid := map[string]interface{}{"sub": "alice", "exp": testNow.Add(time.Minute).Unix()}
+
+	tt := []struct {
+		name   string
+		token  string
+		reason string
+	}{
+		{name: "HS256 token should verify", token: sign(t, map[string]interface{}{"alg": "HS256", "kid": "shared"}, valid)},
+		{name: "RS256 token should verify", token: sign(t, map[string]interface{}{"alg": "RS256", "kid": "idp"}, valid)},
+		{name: "token without a kid should verify against every key for its algorithm", token: sign(t, map[string]interface{}{"alg": "RS256"}, valid)},
+		{
+			name:   "token with the kid of another key should be rejected",
+			token:  sign(t, map[string]interface{}{"alg": "HS256", "kid": "idp"}, valid),
+			reason: "does not match any key",
+		},
+		{
+			name:   "unsigned token should be rejected",
+			token:  b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{"sub":"alice","exp":9999999999}`)) + ".",
+			reason: "unsupported algorithm",
+		},
+		{
+			name:   "HS256 token signed with the RSA public key should be rejected",
+			token:  forgeWithPublicKey(t),
+			reason: "does not match any key",
+		},
+		{
+			name:   "tampered claims should be rejected",
+			token:  tamper(sign(t, map[string]interface{}{"alg": "HS256"}, valid)),
+			reason: "does not match any key",
+		},
+		{
+			name:   "expired token should be rejected",
+			token:  sign(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice", "exp": testNow.Add(-time.Minute).Unix()}),
+			reason: "expired",
+		},
+		{
+			name:  "token expired within the allowed clock skew should verify",
+			token: sign(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice", "exp": testNow.Add(-clockSkew / 2).Unix()}),
+		},
+		{
+			name:   "token without an expiry should be rejected",
+			token:  sign(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice"}),
+			reason: "no expiry",
+		},
+		{
+			name:   "token used before nbf should be rejected",
+			token:  sign(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice", "exp": testNow.Add(time.Hour).Unix(), "nbf": testNow.Add(time.Minute).Unix()}),
+			reason: "not valid yet",
+		},
+		{
+			name:   "token with an nbf too large to represent should be rejected",
+			token:  sign(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice", "exp": testNow.Add(time.Hour).Unix(), "nbf": 1e19}),
+			reason: "nbf is out of range",
+		},
+		{
+			name:   "token with an exp too large to represent should be rejected",
+			token:  sign(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice", "exp": 1e19}),
+			reason: "exp is out of range",
+		},
+		{name: "malformed token should be rejected", token: "a.b", reason: "malformed"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := ks.Verify(tc.token, testNow)
+			if tc.reason == "" {
+				if err != nil {
+					t.Fatalf("Verify returned an error: %s", err)
+				}
+				if claims.Subject() != "alice" {
+					t.Errorf("got subject %q", claims.Subject())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.reason) {
+				t.Errorf("got error %v, expected one containing %q", err, tc.reason)
+			}
+		})
+	}
+}
+
+// forgeWithPublicKey signs a token with HS256, using the RSA public key's modulus as the secret.
+func forgeWithPublicKey(t *testing.T) string {
+	h := b64([]byte(`{"alg":"HS256","kid":"idp"}`))
+	c := b64([]byte(`{"sub":"alice","exp":9999999999}`))
+	mac := hmac.New(sha256.New, testRSAKey.N.Bytes())
+	mac.Write([]byte(h + "." + c))
+	return h + "." + c + "." + b64(mac.Sum(nil))
+}
+
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	parts[1] = b64([]byte(`{"sub":"admin","exp":9999999999}`))
+	return strings.Join(parts, ".")
+}
+
+func TestClaimsAudience(t *testing.T) {
+	tt := []struct {
+		name     string
+		aud      interface{}
+		expected bool
+	}{
+		{name: "matching string should match", aud: "kvdb", expected: true},
+		{name: "list containing the audience should match", aud: []interface{}{"other", "kvdb"}, expected: true},
+		{name: "other string should not match", aud: "other"},
+		{name: "missing audience should not match"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := Claims{}
+			if tc.aud != nil {
+				c["aud"] = tc.aud
+			}
+			if got := c.hasAudience("kvdb"); got != tc.expected {
+				t.Errorf("got %v, expected %v", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config gives the PEM files that TLS is configured from.
+type Config struct {
+	//The certificate, with any intermediates, and private key to serve with. Also presented to other nodes that ask for a client certificate.
+	CertFile string
+	KeyFile  string
+
+	//CAs that clients must present a certificate signed by. Clients are not asked for a certificate if empty.
+	ClientCAFile string
+
+	//CAs that other nodes' certificates are verified against, when connecting to them and when raft peers connect. The system's roots are used if empty.
+	PeerCAFile string
+}
+
+// Reloader serves TLS with certificates that are reloaded when their files change.
+// Each handshake uses whatever was loaded last, so a reload never affects a connection that is already open.
+type Reloader struct {
+	cfg    Config
+	logger *slog.Logger
+
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+	peerCAs   *x509.CertPool
+
+	//Guards stamps, and serializes reloads.
+	lock sync.Mutex
+
+	//The files as they were when they were last loaded, to notice when they change.
+	stamps []stamp
+}
+
+type stamp struct {
+	modified time.Time
+	size     int64
+}
+
+// NewReloader loads the files in cfg, returning an error if any of them is missing or invalid.
+// The peer CAs are only read here; the certificate and client CAs are read again by Reload.
+func NewReloader(cfg Config, logger *slog.Logger) (*Reloader, error) {
+	r := &Reloader{cfg: cfg, logger: logger}
+
+	if cfg.PeerCAFile != "" {
+		pool, err := loadPool(cfg.PeerCAFile)
+		if err != nil {
+			return nil, err
+		}
+		r.peerCAs = pool
+	}
+
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and client CAs again. If any of them is invalid, such as while only some of them have been replaced,
+// what was loaded before is kept and the error is returned.
+func (r *Reloader) Reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	//Taken first, so that a file replaced while it is read is noticed next time.
+	r.stamps = r.stat()
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pool, err = loadPool(r.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.cert.Store(&cert)
+	r.clientCAs.Store(pool)
+	return nil
+}
+
+// Run checks the files every interval until ctx is done, reloading them when any has changed.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if !r.changed() {
+			continue
+		}
+
+		err := r.Reload()
+		if err != nil {
+			r.logger.Error("reloading TLS certificate, keeping the previous one", "err", err)
+			continue
+		}
+		r.logger.Info("reloaded TLS certificate", "cert", r.cfg.CertFile)
+	}
+}
+
+func (r *Reloader) changed() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	current := r.stat()
+	for i := range current {
+		if current[i] != r.stamps[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// stat returns a stamp for each file that is reloaded. A file that cannot be read has the zero stamp.
+func (r *Reloader) stat() []stamp {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile}
+	stamps := make([]stamp, len(files))
+	for i, f := range files {
+		if f == "" {
+			continue
+		}
+		//Stat follows symlinks, so a mounted secret whose link is swapped to new files is noticed too.
+		fi, err := os.Stat(f)
+		if err == nil {
+			stamps[i] = stamp{modified: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return stamps
+}
+
+// ServerConfig returns the TLS configuration to serve with. If client CAs are configured and verifyClients is true,
+// clients must present a certificate signed by one of them.
+func (r *Reloader) ServerConfig(verifyClients bool) *tls.Config {
+	c := r.serverConfig(false)
+	if verifyClients && r.cfg.ClientCAFile != "" {
+		//Built for each handshake, so that it uses the client CAs loaded last.
+		c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.serverConfig(true), nil
+		}
+	}
+	return c
+}
+
+func (r *Reloader) serverConfig(verifyClients bool) *tls.Config {
+	c := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.cert.Load(), nil
+		},
+	}
+	if verifyClients {
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		c.ClientCAs = r.clientCAs.Load()
+	}
+	return c
+}
+
+// PeerServerConfig returns the TLS configuration to serve other nodes with, such as raft peers:
+// they must present a certificate signed by one of the peer CAs, as this node's is.
+func (r *Reloader) PeerServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.cert.Load(), nil
+		},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  r.peerCAs,
+	}
+}
+
+// ClientConfig returns the TLS configuration to connect to other nodes with: their certificates are verified against the peer CAs,
+// and this node's own certificate is presented to those that ask for one.
+func (r *Reloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    r.peerCAs,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.cert.Load(), nil
+		},
+	}
+}
+
+// Transport returns a transport for requests to other nodes, which connects with ClientConfig.
+func (r *Reloader) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = r.ClientConfig()
+	return t
+}
+
+func loadPool(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("loading CAs: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, errors.New("loading CAs: no certificates found in " + file)
+	}
+	return pool, nil
+}
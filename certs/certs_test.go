@@ -0,0 +1,383 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.DiscardHandler)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T, name string) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate for localhost, usable by a server or a client, and its key.
+func (ca testCA) issue(t *testing.T, cn string) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"kvdb"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+}
+
+func (ca testCA) keyPair(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+
+	certPEM, keyPEM := ca.issue(t, cn)
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+func (ca testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func writeFile(t *testing.T, path string, b []byte) {
+	t.Helper()
+
+	//Renamed into place, as a certificate manager would, so that a reload never reads a half written file.
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, b, 0600)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeCert issues a certificate named cn and writes it and its key to cfg's files.
+func writeCert(t *testing.T, cfg Config, ca testCA, cn string) {
+	t.Helper()
+
+	certPEM, keyPEM := ca.issue(t, cn)
+	writeFile(t, cfg.CertFile, certPEM)
+	writeFile(t, cfg.KeyFile, keyPEM)
+}
+
+func testConfig(t *testing.T) Config {
+	dir := t.TempDir()
+	return Config{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "client-ca.crt"),
+	}
+}
+
+// serve serves h over TLS configured by tc, returning the server's address.
+func serve(t *testing.T, tc *tls.Config, h http.Handler) string {
+	t.Helper()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Rejected handshakes are expected, and not worth logging.
+	srv := &http.Server{Handler: h, ErrorLog: log.New(io.Discard, "", 0)}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return "https://" + l.Addr().String()
+}
+
+func client(roots *x509.CertPool, certs ...tls.Certificate) *http.Client {
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		},
+	}
+}
+
+// servedName returns the common name of the certificate c is served when it gets addr.
+func servedName(t *testing.T, c *http.Client, addr string) string {
+	t.Helper()
+
+	resp, err := c.Get(addr)
+	if err != nil {
+		t.Fatalf("GET returned an error: %s", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func TestNewReloader(t *testing.T) {
+	ca := newCA(t, "ca")
+
+	tt := []struct {
+		name  string
+		setup func(cfg *Config)
+		err   string
+	}{
+		{name: "valid files should be loaded", setup: func(cfg *Config) {}},
+		{name: "missing certificate should be an error", setup: func(cfg *Config) { cfg.CertFile += ".missing" }, err: "loading certificate"},
+		{name: "certificate and key that do not match should be an error", setup: func(cfg *Config) {
+			_, keyPEM := ca.issue(t, "other")
+			writeFile(t, cfg.KeyFile, keyPEM)
+		}, err: "loading certificate"},
+		{name: "client CA file without certificates should be an error", setup: func(cfg *Config) {
+			writeFile(t, cfg.ClientCAFile, []byte("not a certificate"))
+		}, err: "no certificates found"},
+		{name: "missing peer CA file should be an error", setup: func(cfg *Config) {
+			cfg.PeerCAFile = cfg.ClientCAFile + ".missing"
+		}, err: "loading CAs"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			writeCert(t, cfg, ca, "server")
+			writeFile(t, cfg.ClientCAFile, ca.pem)
+			tc.setup(&cfg)
+
+			_, err := NewReloader(cfg, testLogger)
+			if tc.err == "" && err != nil {
+				t.Errorf("NewReloader returned an error: %s", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("got error %v, expected one containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	ca := newCA(t, "ca")
+	cfg := testConfig(t)
+	cfg.ClientCAFile = ""
+	writeCert(t, cfg, ca, "first")
+
+	r, err := NewReloader(cfg, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serve(t, r.ServerConfig(true), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	open := client(ca.pool())
+	if got := servedName(t, open, addr); got != "first" {
+		t.Fatalf("served %q, expected first", got)
+	}
+
+	writeCert(t, cfg, ca, "second")
+	err = r.Reload()
+	if err != nil {
+		t.Fatalf("Reload returned an error: %s", err)
+	}
+
+	//The connection that was already open is kept, with the certificate it was opened with.
+	if got := servedName(t, open, addr); got != "first" {
+		t.Errorf("open connection: served %q, expected first", got)
+	}
+	if got := servedName(t, client(ca.pool()), addr); got != "second" {
+		t.Errorf("new connection: served %q, expected second", got)
+	}
+
+	//A key that does not match is not used, and the last good certificate is still served.
+	_, keyPEM := ca.issue(t, "third")
+	writeFile(t, cfg.KeyFile, keyPEM)
+	err = r.Reload()
+	if err == nil {
+		t.Error("Reload should have failed with a key that does not match the certificate")
+	}
+	if got := servedName(t, client(ca.pool()), addr); got != "second" {
+		t.Errorf("after a failed reload: served %q, expected second", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ca := newCA(t, "ca")
+	cfg := testConfig(t)
+	cfg.ClientCAFile = ""
+	writeCert(t, cfg, ca, "first")
+
+	r, err := NewReloader(cfg, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serve(t, r.ServerConfig(false), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, 10*time.Millisecond)
+
+	writeCert(t, cfg, ca, "second")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for servedName(t, client(ca.pool()), addr) != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("the changed certificate was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverCA := newCA(t, "server ca")
+	clientCA := newCA(t, "client ca")
+	otherCA := newCA(t, "other ca")
+
+	cfg := testConfig(t)
+	writeCert(t, cfg, serverCA, "server")
+	writeFile(t, cfg.ClientCAFile, clientCA.pem)
+
+	r, err := NewReloader(cfg, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Identify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := ClientIdentity(r.Context())
+		if !ok {
+			_, _ = io.WriteString(w, "anonymous")
+			return
+		}
+		_, _ = io.WriteString(w, id.String()+" "+id.Subject)
+	}))
+	verified := serve(t, r.ServerConfig(true), h)
+	unverified := serve(t, r.ServerConfig(false), h)
+
+	alice := clientCA.keyPair(t, "alice")
+	mallory := otherCA.keyPair(t, "mallory")
+
+	tt := []struct {
+		name     string
+		addr     string
+		certs    []tls.Certificate
+		expected string
+	}{
+		{name: "client certificate signed by the client CA should be identified", addr: verified, certs: []tls.Certificate{alice}, expected: "alice CN=alice,O=kvdb"},
+		{name: "client without a certificate should be rejected", addr: verified},
+		{name: "client certificate signed by another CA should be rejected", addr: verified, certs: []tls.Certificate{mallory}},
+		{name: "client should not be asked for a certificate unless clients are verified", addr: unverified, certs: []tls.Certificate{alice}, expected: "anonymous"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := client(serverCA.pool(), tc.certs...).Get(tc.addr)
+			if tc.expected == "" {
+				if err == nil {
+					_ = resp.Body.Close()
+					t.Error("the request should have been rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GET returned an error: %s", err)
+			}
+			defer resp.Body.Close()
+			b, _ := io.ReadAll(resp.Body)
+			if string(b) != tc.expected {
+				t.Errorf("got %q, expected %q", b, tc.expected)
+			}
+		})
+	}
+
+	//Replacing the client CA applies to new connections.
+	writeFile(t, cfg.ClientCAFile, otherCA.pem)
+	err = r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := client(serverCA.pool(), alice).Get(verified); err == nil {
+		_ = resp.Body.Close()
+		t.Error("a client certificate signed by the replaced CA should have been rejected")
+	}
+	resp, err := client(serverCA.pool(), mallory).Get(verified)
+	if err != nil {
+		t.Fatalf("a client certificate signed by the new CA was rejected: %s", err)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestTransport(t *testing.T) {
+	ca := newCA(t, "ca")
+	cfg := testConfig(t)
+	writeCert(t, cfg, ca, "node")
+	writeFile(t, cfg.ClientCAFile, ca.pem)
+	cfg.PeerCAFile = cfg.ClientCAFile
+
+	r, err := NewReloader(cfg, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serve(t, r.ServerConfig(true), Identify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := ClientIdentity(r.Context())
+		_, _ = io.WriteString(w, id.String())
+	})))
+
+	//Another node trusts the peer CA, and presents its own certificate when the server asks for one.
+	resp, err := (&http.Client{Transport: r.Transport()}).Get(addr)
+	if err != nil {
+		t.Fatalf("GET returned an error: %s", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if string(b) != "node" {
+		t.Errorf("server identified the node as %q", b)
+	}
+}
@@ -0,0 +1,76 @@
+package certs
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+)
+
+// Identity is who a client is, as given by the certificate it presented and that was verified against the client CAs.
+type Identity struct {
+	//The subject's common name.
+	CommonName string
+
+	//The whole subject, such as CN=alice,O=example.
+	Subject string
+
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+
+	Certificate *x509.Certificate
+}
+
+// String returns the common name, or the first subject alternative name if there is none.
+func (id Identity) String() string {
+	switch {
+	case id.CommonName != "":
+		return id.CommonName
+	case len(id.DNSNames) > 0:
+		return id.DNSNames[0]
+	case len(id.EmailAddresses) > 0:
+		return id.EmailAddresses[0]
+	case len(id.URIs) > 0:
+		return id.URIs[0]
+	}
+	return id.Subject
+}
+
+func newIdentity(cert *x509.Certificate) Identity {
+	id := Identity{
+		CommonName:     cert.Subject.CommonName,
+		Subject:        cert.Subject.String(),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           make([]string, len(cert.URIs)),
+		Certificate:    cert,
+	}
+	for i, u := range cert.URIs {
+		id.URIs[i] = u.String()
+	}
+	return id
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the client's identity.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// ClientIdentity returns the identity of the client a request came from, if it presented a verified certificate.
+func ClientIdentity(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// Identify puts the identity of a client that presented a verified certificate in the request context, where ClientIdentity finds it.
+// Requests over plain HTTP, or without a client certificate, are passed on unchanged.
+func Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			r = r.WithContext(WithIdentity(r.Context(), newIdentity(r.TLS.VerifiedChains[0][0])))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,72 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestIdentityString(t *testing.T) {
+	tt := []struct {
+		name     string
+		id       Identity
+		expected string
+	}{
+		{name: "common name should be preferred", id: Identity{CommonName: "alice", DNSNames: []string{"a.example"}}, expected: "alice"},
+		{name: "DNS name should be used without a common name", id: Identity{DNSNames: []string{"a.example"}, URIs: []string{"spiffe://x"}}, expected: "a.example"},
+		{name: "email address should be used without a DNS name", id: Identity{EmailAddresses: []string{"a@example.com"}}, expected: "a@example.com"},
+		{name: "URI should be used without a name or email address", id: Identity{URIs: []string{"spiffe://example/a"}}, expected: "spiffe://example/a"},
+		{name: "subject should be used as a last resort", id: Identity{Subject: "O=example"}, expected: "O=example"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.id.String(); got != tc.expected {
+				t.Errorf("got %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "alice", Organization: []string{"example"}},
+		URIs:    []*url.URL{{Scheme: "spiffe", Host: "example", Path: "/alice"}},
+	}
+
+	tt := []struct {
+		name  string
+		state *tls.ConnectionState
+		found bool
+	}{
+		{name: "plain HTTP request should have no identity"},
+		{name: "TLS request without a client certificate should have no identity", state: &tls.ConnectionState{}},
+		{name: "unverified client certificate should not be trusted", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}},
+		{name: "verified client certificate should be identified", state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, found: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var id Identity
+			var found bool
+			h := Identify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				id, found = ClientIdentity(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/key", nil)
+			r.TLS = tc.state
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if found != tc.found {
+				t.Fatalf("found identity %v, expected %v", found, tc.found)
+			}
+			if found && (id.CommonName != "alice" || id.Subject != "CN=alice,O=example" || len(id.URIs) != 1 || id.URIs[0] != "spiffe://example/alice" || id.Certificate != cert) {
+				t.Errorf("unexpected identity %+v", id)
+			}
+		})
+	}
+}
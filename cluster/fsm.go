@@ -0,0 +1,118 @@
+package cluster
+
+import (
+	"KeyValueDB/db"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// command is a write replicated through the raft log.
+// Every write is applied as a transaction, so the leader and its followers make exactly the same change at the same revision.
+type command struct {
+	Ops []commandOp `json:"ops"`
+}
+
+type commandOp struct {
+	Type db.TxnOpType `json:"type"`
+	Key  string       `json:"key"`
+	db.EncodedValue
+
+	//Absolute expiry as Unix nanoseconds, decided by the node that proposed the write so that every node expires the key at the same time.
+	ExpiresAt int64 `json:"exp,omitempty"`
+
+	IfVersion *uint64 `json:"ifVersion,omitempty"`
+}
+
+func newCommand(ops []db.TxnOp, now time.Time) command {
+	c := command{Ops: make([]commandOp, len(ops))}
+	for i, op := range ops {
+		c.Ops[i] = commandOp{
+			Type:         op.Type,
+			Key:          op.Key,
+			EncodedValue: db.EncodeValue(op.Value),
+			IfVersion:    op.IfVersion,
+		}
+
+		switch {
+		case op.TTL > 0:
+			c.Ops[i].ExpiresAt = now.Add(op.TTL).UnixNano()
+		case !op.ExpiresAt.IsZero():
+			c.Ops[i].ExpiresAt = op.ExpiresAt.UnixNano()
+		}
+	}
+	return c
+}
+
+func (c command) txnOps() []db.TxnOp {
+	ops := make([]db.TxnOp, len(c.Ops))
+	for i, op := range c.Ops {
+		ops[i] = db.TxnOp{
+			Type:      op.Type,
+			Key:       op.Key,
+			Value:     op.EncodedValue.Decode(),
+			IfVersion: op.IfVersion,
+		}
+
+		if op.ExpiresAt != 0 {
+			ops[i].ExpiresAt = time.Unix(0, op.ExpiresAt)
+		}
+	}
+	return ops
+}
+
+// applyResult is what applying a command returned, handed back to the node that proposed it.
+type applyResult struct {
+	results []db.TxnResult
+	err     error
+}
+
+// fsm applies committed commands to the local database.
+type fsm struct {
+	database *db.Database
+}
+
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	var c command
+	err := json.Unmarshal(l.Data, &c)
+	if err != nil {
+		return applyResult{err: fmt.Errorf("decoding command %d: %w", l.Index, err)}
+	}
+
+	results, err := f.database.Txn(c.txnOps())
+	return applyResult{results: results, err: err}
+}
+
+// Snapshot copies the database while no commands are being applied. Persisting the copy happens later, alongside new commands.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	var buf bytes.Buffer
+	_, err := f.database.DumpSnapshot(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return &fsmSnapshot{data: buf.Bytes()}, nil
+}
+
+func (f *fsm) Restore(snapshot io.ReadCloser) error {
+	defer snapshot.Close()
+	return f.database.LoadSnapshot(snapshot)
+}
+
+type fsmSnapshot struct {
+	data []byte
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	_, err := sink.Write(s.data)
+	if err != nil {
+		_ = sink.Cancel()
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
@@ -0,0 +1,125 @@
+package cluster
+
+import (
+	"KeyValueDB/db"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestCommandEncoding(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	version := uint64(7)
+
+	tt := []struct {
+		name     string
+		op       db.TxnOp
+		expected db.TxnOp
+	}{
+		{
+			name:     "blob should keep its bytes and type",
+			op:       db.TxnOp{Type: db.TxnSet, Key: "k", Value: db.Blob{ContentType: "image/png", Data: []byte{0xff, 0x00}}},
+			expected: db.TxnOp{Type: db.TxnSet, Key: "k", Value: db.Blob{ContentType: "image/png", Data: []byte{0xff, 0x00}}},
+		},
+		{
+			name:     "TTL should become an absolute expiry",
+			op:       db.TxnOp{Type: db.TxnSet, Key: "k", Value: "v", TTL: time.Minute},
+			expected: db.TxnOp{Type: db.TxnSet, Key: "k", Value: "v", ExpiresAt: now.Add(time.Minute)},
+		},
+		{
+			name:     "absolute expiry should be kept",
+			op:       db.TxnOp{Type: db.TxnSet, Key: "k", Value: "v", ExpiresAt: now.Add(time.Hour)},
+			expected: db.TxnOp{Type: db.TxnSet, Key: "k", Value: "v", ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name:     "precondition should be kept",
+			op:       db.TxnOp{Type: db.TxnDelete, Key: "k", IfVersion: &version},
+			expected: db.TxnOp{Type: db.TxnDelete, Key: "k", IfVersion: &version},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := json.Marshal(newCommand([]db.TxnOp{tc.op}, now))
+			if err != nil {
+				t.Fatalf("Marshal returned an error: %s", err)
+			}
+
+			var c command
+			err = json.Unmarshal(b, &c)
+			if err != nil {
+				t.Fatalf("Unmarshal returned an error: %s", err)
+			}
+
+			ops := c.txnOps()
+			if !reflect.DeepEqual(ops, []db.TxnOp{tc.expected}) {
+				t.Errorf("got %+v, want %+v", ops[0], tc.expected)
+			}
+		})
+	}
+}
+
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (s *bufferSink) ID() string    { return "test" }
+func (s *bufferSink) Cancel() error { return nil }
+func (s *bufferSink) Close() error  { return nil }
+
+func TestFSM(t *testing.T) {
+	src, _ := db.NewDatabase()
+	defer src.Close()
+	f := &fsm{database: src}
+
+	apply := func(index uint64, ops ...db.TxnOp) applyResult {
+		data, _ := json.Marshal(newCommand(ops, time.Now()))
+		return f.Apply(&raft.Log{Index: index, Type: raft.LogCommand, Data: data}).(applyResult)
+	}
+
+	res := apply(1, db.TxnOp{Type: db.TxnSet, Key: "key", Value: "value"})
+	if res.err != nil || len(res.results) != 1 || res.results[0].Version != 1 {
+		t.Errorf("applying a set returned %+v", res)
+	}
+
+	stale := uint64(0)
+	res = apply(2, db.TxnOp{Type: db.TxnSet, Key: "key", Value: "other", IfVersion: &stale})
+	if !errors.Is(res.err, db.ErrVersionMismatch) {
+		t.Errorf("applying a failed precondition returned %v, expected ErrVersionMismatch", res.err)
+	}
+
+	res = f.Apply(&raft.Log{Index: 3, Type: raft.LogCommand, Data: []byte("{")}).(applyResult)
+	if res.err == nil {
+		t.Error("applying a malformed command did not return an error")
+	}
+
+	snapshot, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot returned an error: %s", err)
+	}
+
+	var sink bufferSink
+	err = snapshot.Persist(&sink)
+	if err != nil {
+		t.Fatalf("Persist returned an error: %s", err)
+	}
+
+	dst, _ := db.NewDatabase()
+	defer dst.Close()
+
+	err = (&fsm{database: dst}).Restore(io.NopCloser(&sink))
+	if err != nil {
+		t.Fatalf("Restore returned an error: %s", err)
+	}
+
+	v, version, _ := dst.GetWithVersion("key")
+	if v != "value" || version != 1 {
+		t.Errorf("restored key is %v at version %d, expected value at version 1", v, version)
+	}
+}
@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"KeyValueDB/auth"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// forwardedHeader names the follower a request was forwarded from. A follower that takes the sender to be the leader answers 503 rather than
+// send the request straight back while leadership is changing; otherwise the request is forwarded on as usual, so a client sending it gains nothing.
+const forwardedHeader = "X-Forwarded-By-Node"
+
+// Handler serves requests that need the leader with h, which should be backed by the node, and forwards them to the leader from a follower.
+// A GET or HEAD may instead allow a stale read, with the X-Consistency: stale header or the consistency=stale query parameter,
+// in which case it is served on any node by stale, which should be backed by the local database.
+func (n *Node) Handler(h, stale http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allowsStale(r) {
+			stale.ServeHTTP(w, r)
+			return
+		}
+
+		if n.IsLeader() {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		n.forward(w, r)
+	})
+}
+
+func allowsStale(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return r.Header.Get("X-Consistency") == "stale" || r.URL.Query().Get("consistency") == "stale"
+}
+
+// forward proxies or redirects r to the leader. A client that the leader must authenticate by its certificate is always redirected.
+func (n *Node) forward(w http.ResponseWriter, r *http.Request) {
+	leader, ok := n.Leader()
+	if !ok || leader.HTTPAddr == "" || r.Header.Get(forwardedHeader) == leader.ID {
+		http.Error(w, "error - no leader", http.StatusServiceUnavailable)
+		return
+	}
+
+	target, err := url.Parse(leader.HTTPAddr)
+	if err != nil {
+		http.Error(w, "error - no leader", http.StatusServiceUnavailable)
+		n.logger.ErrorContext(r.Context(), "parsing leader address", "leader", leader.ID, "err", err)
+		return
+	}
+
+	if n.cfg.Redirect || !auth.Forwardable(r) {
+		u := *target
+		u.Path, u.RawPath, u.RawQuery = r.URL.Path, r.URL.RawPath, r.URL.RawQuery
+		http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set(forwardedHeader, n.cfg.ID)
+		},
+		Transport: n.cfg.Transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, "error - forwarding to leader", http.StatusBadGateway)
+			n.logger.ErrorContext(r.Context(), "forwarding to leader", "leader", leader.ID, "err", err)
+		},
+	}
+	proxy.ServeHTTP(w, r.WithContext(auth.Proxied(r.Context())))
+}
@@ -0,0 +1,173 @@
+package cluster
+
+import (
+	"KeyValueDB/auth"
+	"KeyValueDB/db"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func request(t *testing.T, client *http.Client, method, url, body string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("creating request: %s", err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %s", method, url, err)
+	}
+	defer res.Body.Close()
+
+	b, _ := io.ReadAll(res.Body)
+	return res, string(b)
+}
+
+func TestHandlerForwardsToLeader(t *testing.T) {
+	nodes := newTestCluster(t, 3, nil)
+	leader := waitForLeader(t, nodes)
+	follower := followers(nodes, leader)[0]
+	client := follower.server.Client()
+
+	res, _ := request(t, client, http.MethodPut, follower.server.URL+"/key", "value", map[string]string{"Content-Type": "text/plain"})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("PUT through a follower returned %d, expected 200", res.StatusCode)
+	}
+
+	//The write was acknowledged by the leader, so a linearizable read through any follower sees it straight away.
+	for _, tn := range followers(nodes, leader) {
+		res, body := request(t, client, http.MethodGet, tn.server.URL+"/key", "", nil)
+		if res.StatusCode != http.StatusOK || body != "value" {
+			t.Errorf("GET through %s returned %d %q, expected 200 value", tn.cfg.ID, res.StatusCode, body)
+		}
+	}
+
+	//A client sending the header itself is forwarded all the same.
+	res, _ = request(t, client, http.MethodPut, follower.server.URL+"/forged", "value", map[string]string{forwardedHeader: follower.cfg.ID})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("PUT with a forged %s returned %d, expected 200", forwardedHeader, res.StatusCode)
+	}
+
+	res, body := request(t, client, http.MethodPost, follower.server.URL+"/_txn", `{"ops":[{"op":"set","key":"txn","value":1}]}`, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("POST /_txn through a follower returned %d %q, expected 200", res.StatusCode, body)
+	}
+
+	res, _ = request(t, client, http.MethodDelete, follower.server.URL+"/key", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("DELETE through a follower returned %d, expected 200", res.StatusCode)
+	}
+
+	if v, _ := leader.database.Get("key"); v != nil {
+		t.Errorf("key is %v on the leader after DELETE, expected it to be absent", v)
+	}
+}
+
+func TestHandlerRedirectsToLeader(t *testing.T) {
+	nodes := newTestCluster(t, 3, func(c *Config) {
+		c.Redirect = true
+	})
+	leader := waitForLeader(t, nodes)
+	follower := followers(nodes, leader)[0]
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	res, _ := request(t, client, http.MethodPut, follower.server.URL+"/some%2Fkey?ttl=60", "value", nil)
+	if res.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("PUT to a follower returned %d, expected 307", res.StatusCode)
+	}
+
+	expected := leader.server.URL + "/some%2Fkey?ttl=60"
+	if loc := res.Header.Get("Location"); loc != expected {
+		t.Errorf("redirected to %q, expected %q", loc, expected)
+	}
+
+	//A 307 tells the client to repeat the PUT with its body.
+	res, _ = request(t, http.DefaultClient, http.MethodPut, follower.server.URL+"/key", "value", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("PUT following the redirect returned %d, expected 200", res.StatusCode)
+	}
+}
+
+func TestHandlerRedirectsCertificateClients(t *testing.T) {
+	nodes := newTestCluster(t, 3, nil)
+	leader := waitForLeader(t, nodes)
+	follower := followers(nodes, leader)[0]
+
+	//A follower proxying the write would send it over its own connection, with its own certificate, so the leader would
+	//authorize it as the follower rather than as the client.
+	unreachable := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request was served by the follower")
+	})
+	h := follower.node.Handler(unreachable, unreachable)
+
+	req := httptest.NewRequest(http.MethodPut, "/some%2Fkey?ttl=60", strings.NewReader("value"))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Name: "reader", Method: auth.MethodCertificate}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("PUT by a certificate client returned %d, expected 307", w.Code)
+	}
+	expected := leader.server.URL + "/some%2Fkey?ttl=60"
+	if loc := w.Header().Get("Location"); loc != expected {
+		t.Errorf("redirected to %q, expected %q", loc, expected)
+	}
+	if v, _ := leader.database.Get("some/key"); v != nil {
+		t.Errorf("key is %v on the leader, expected the write not to be forwarded", v)
+	}
+}
+
+func TestHandlerStaleReads(t *testing.T) {
+	nodes := newTestCluster(t, 3, nil)
+	leader := waitForLeader(t, nodes)
+	follower := followers(nodes, leader)[0]
+	client := follower.server.Client()
+
+	_ = leader.node.Set("key", db.Blob{ContentType: "text/plain", Data: []byte("value")})
+	eventually(t, "the follower to apply the write", func() bool {
+		v, _ := follower.database.Get("key")
+		return v != nil
+	})
+
+	//Without a quorum there is no leader, so only stale reads can be served.
+	for _, tn := range nodes {
+		if tn != follower {
+			tn.stop()
+		}
+	}
+	eventually(t, "the follower to lose the leader", func() bool {
+		_, ok := follower.node.Leader()
+		return !ok
+	})
+
+	res, _ := request(t, client, http.MethodGet, follower.server.URL+"/key", "", nil)
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("linearizable GET without a leader returned %d, expected 503", res.StatusCode)
+	}
+
+	res, body := request(t, client, http.MethodGet, follower.server.URL+"/key", "", map[string]string{"X-Consistency": "stale"})
+	if res.StatusCode != http.StatusOK || body != "value" {
+		t.Errorf("stale GET returned %d %q, expected 200 value", res.StatusCode, body)
+	}
+
+	res, body = request(t, client, http.MethodGet, follower.server.URL+"/key?consistency=stale", "", nil)
+	if res.StatusCode != http.StatusOK || body != "value" {
+		t.Errorf("stale GET by query returned %d %q, expected 200 value", res.StatusCode, body)
+	}
+
+	res, _ = request(t, client, http.MethodPut, follower.server.URL+"/key?consistency=stale", "other", nil)
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("PUT without a leader returned %d, expected 503", res.StatusCode)
+	}
+}
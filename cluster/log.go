@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// raftLogger passes what raft logs on to a slog logger. Raft logs through hclog, which writes each entry to it as a line of JSON.
+type raftLogger struct {
+	logger *slog.Logger
+}
+
+// newRaftLogger returns a logger for raft that logs its warnings and errors to logger.
+func newRaftLogger(logger *slog.Logger) hclog.Logger {
+	return hclog.New(&hclog.LoggerOptions{Name: "raft", Level: hclog.Warn, Output: raftLogger{logger: logger}, JSONFormat: true})
+}
+
+func (l raftLogger) Write(p []byte) (int, error) {
+	return l.LevelWrite(hclog.Info, p)
+}
+
+// LevelWrite logs an entry written by hclog at level.
+func (l raftLogger) LevelWrite(level hclog.Level, p []byte) (int, error) {
+	lvl := slog.LevelInfo
+	switch level {
+	case hclog.Trace, hclog.Debug:
+		lvl = slog.LevelDebug
+	case hclog.Warn:
+		lvl = slog.LevelWarn
+	case hclog.Error:
+		lvl = slog.LevelError
+	}
+
+	var entry map[string]interface{}
+	err := json.Unmarshal(p, &entry)
+	if err != nil {
+		l.logger.Log(context.Background(), lvl, string(bytes.TrimSpace(p)))
+		return len(p), nil
+	}
+
+	msg, _ := entry["@message"].(string)
+	args := []any{"module", entry["@module"]}
+	keys := make([]string, 0, len(entry))
+	for k := range entry {
+		if !strings.HasPrefix(k, "@") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, k, entry[k])
+	}
+	l.logger.Log(context.Background(), lvl, msg, args...)
+	return len(p), nil
+}
@@ -0,0 +1,57 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestRaftLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newRaftLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	tt := []struct {
+		name     string
+		log      func()
+		expected map[string]interface{}
+	}{
+		{
+			name:     "warning should be logged with its fields",
+			log:      func() { logger.Warn("failed to contact", "server-id", "n2", "error", errors.New("refused")) },
+			expected: map[string]interface{}{"level": "WARN", "msg": "failed to contact", "module": "raft", "server-id": "n2", "error": "refused"},
+		},
+		{
+			name:     "error of a named logger should be logged with its module",
+			log:      func() { logger.Named("net").Error("failed to accept connection") },
+			expected: map[string]interface{}{"level": "ERROR", "msg": "failed to accept connection", "module": "raft.net"},
+		},
+		{name: "info should not be logged", log: func() { logger.Info("entering follower state") }},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			tc.log()
+
+			if tc.expected == nil {
+				if buf.Len() != 0 {
+					t.Errorf("logged %s, expected nothing", buf.String())
+				}
+				return
+			}
+
+			var got map[string]interface{}
+			err := json.Unmarshal(buf.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("logged %q, which is not one JSON entry: %s", buf.String(), err)
+			}
+			for k, v := range tc.expected {
+				if got[k] != v {
+					t.Errorf("%s is %v, expected %v", k, got[k], v)
+				}
+			}
+		})
+	}
+}
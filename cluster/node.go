@@ -0,0 +1,568 @@
+package cluster
+
+import (
+	"KeyValueDB/db"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+)
+
+const (
+	defaultApplyTimeout = 5 * time.Second
+
+	//Snapshots kept in Config.Dir.
+	retainSnapshots = 2
+
+	//Connections kept open to each peer.
+	maxPool = 3
+
+	//Times Expire reads and rewrites a key that keeps changing in between before giving up.
+	expireAttempts = 5
+)
+
+var (
+	// ErrNotLeader is returned by writes and linearizable reads on a node that is not the leader.
+	ErrNotLeader = errors.New("not the raft leader")
+	// ErrInvalidPeer is returned, wrapped, by ParsePeers for a malformed peer.
+	ErrInvalidPeer = errors.New("invalid peer")
+)
+
+// Peer is a member of the cluster.
+type Peer struct {
+	ID string
+
+	//Where the peer listens for raft traffic.
+	RaftAddr string
+
+	//Base URL of the peer's HTTP API, where requests that need the leader are forwarded.
+	HTTPAddr string
+}
+
+// Config configures a Node.
+type Config struct {
+	ID string
+
+	//Address to listen on for raft traffic. Ignored if Listener is set.
+	RaftAddr string
+	Listener net.Listener
+
+	//Where the raft log and snapshots are kept. If empty they are only kept in memory.
+	Dir string
+
+	//Every member of the cluster, including this node. A node with no existing raft state forms a cluster from them;
+	//the same peers must be given to every member. With no peers the node forms a cluster of one.
+	Peers []Peer
+
+	//How long a write may wait to be committed. Defaults to 5 seconds.
+	ApplyTimeout time.Duration
+
+	//Redirect requests that need the leader with a 307 instead of proxying them.
+	Redirect bool
+
+	//Used to proxy requests to the leader. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	//If set, raft traffic is carried over TLS: ServerTLS accepts peers, and should require them to present a certificate,
+	//and ClientTLS connects to them. Both must be set together.
+	ServerTLS *tls.Config
+	ClientTLS *tls.Config
+
+	//Adjusts the raft configuration, for tests.
+	tune func(*raft.Config)
+}
+
+// ParsePeers parses a comma separated list of peers in the form id=raftaddr@httpaddr, such as n1=10.0.0.1:7000@http://10.0.0.1:8080.
+// An HTTP address without a scheme is taken to be http.
+func ParsePeers(s string) ([]Peer, error) {
+	peers := make([]Peer, 0)
+	if strings.TrimSpace(s) == "" {
+		return peers, nil
+	}
+
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		id, addrs, ok := strings.Cut(p, "=")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%w: %q has no id", ErrInvalidPeer, p)
+		}
+
+		raftAddr, httpAddr, ok := strings.Cut(addrs, "@")
+		if !ok || raftAddr == "" || httpAddr == "" {
+			return nil, fmt.Errorf("%w: %q must be id=raftaddr@httpaddr", ErrInvalidPeer, p)
+		}
+		if !strings.Contains(httpAddr, "://") {
+			httpAddr = "http://" + httpAddr
+		}
+
+		peers = append(peers, Peer{ID: id, RaftAddr: raftAddr, HTTPAddr: httpAddr})
+	}
+
+	return peers, nil
+}
+
+// Node is a member of a raft cluster replicating a database.
+// Writes are committed through the replicated log before they return, and are then applied to every member's database in the same order.
+// Node implements the same interfaces as db.Database, so the HTTP, Redis and gRPC APIs can be served from it unchanged.
+// Its reads are linearizable, and like its writes they fail with ErrNotLeader on a follower; read the database directly for stale reads.
+//
+// Expiry is decided by the node that proposes a write, but whether a key has expired when a conditional write is applied is judged by each node's own clock,
+// so members' clocks should be kept in sync.
+type Node struct {
+	cfg      Config
+	database *db.Database
+	logger   *slog.Logger
+
+	raft      *raft.Raft
+	transport *raft.NetworkTransport
+	snapshots raft.SnapshotStore
+	store     *raftboltdb.BoltStore
+
+	//Set once the node has applied every entry committed when it first found the leader.
+	caughtUp atomic.Bool
+
+	//The last term in which a barrier has committed an entry as leader, after which reads only need to confirm leadership.
+	readTerm atomic.Uint64
+}
+
+// NewNode joins database to the cluster described by cfg, replaying any raft state kept in cfg.Dir.
+// database must be empty and must not have a write-ahead log, since the raft log is what makes writes durable,
+// and it must not evict keys, since evictions would not be replicated. Errors forwarding requests to the leader are logged to logger.
+func NewNode(database *db.Database, cfg Config, logger *slog.Logger) (*Node, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("node id is required")
+	}
+	if (cfg.ServerTLS == nil) != (cfg.ClientTLS == nil) {
+		return nil, errors.New("raft TLS needs both a server and a client configuration")
+	}
+	if cfg.ApplyTimeout <= 0 {
+		cfg.ApplyTimeout = defaultApplyTimeout
+	}
+
+	rc := raft.DefaultConfig()
+	rc.LocalID = raft.ServerID(cfg.ID)
+	rc.Logger = newRaftLogger(logger)
+	if cfg.tune != nil {
+		cfg.tune(rc)
+	}
+
+	n := &Node{cfg: cfg, database: database, logger: logger}
+
+	var logs raft.LogStore
+	var stable raft.StableStore
+	if cfg.Dir == "" {
+		mem := raft.NewInmemStore()
+		logs, stable = mem, mem
+		n.snapshots = raft.NewInmemSnapshotStore()
+	} else {
+		err := os.MkdirAll(cfg.Dir, 0o755)
+		if err != nil {
+			return nil, err
+		}
+
+		n.store, err = raftboltdb.NewBoltStore(filepath.Join(cfg.Dir, "raft.db"))
+		if err != nil {
+			return nil, fmt.Errorf("opening raft log: %w", err)
+		}
+		logs, stable = n.store, n.store
+
+		n.snapshots, err = raft.NewFileSnapshotStoreWithLogger(cfg.Dir, retainSnapshots, rc.Logger)
+		if err != nil {
+			_ = n.store.Close()
+			return nil, fmt.Errorf("opening raft snapshots: %w", err)
+		}
+	}
+
+	l := cfg.Listener
+	if l == nil {
+		var err error
+		l, err = net.Listen("tcp", cfg.RaftAddr)
+		if err != nil {
+			n.closeStore()
+			return nil, err
+		}
+	}
+	if cfg.ServerTLS != nil {
+		l = tls.NewListener(l, cfg.ServerTLS)
+	}
+
+	advertise := l.Addr()
+	if self, ok := n.peer(cfg.ID); ok {
+		addr, err := net.ResolveTCPAddr("tcp", self.RaftAddr)
+		if err != nil {
+			_ = l.Close()
+			n.closeStore()
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPeer, err)
+		}
+		advertise = addr
+	}
+	n.transport = raft.NewNetworkTransportWithLogger(&streamLayer{Listener: l, advertise: advertise, tls: cfg.ClientTLS}, maxPool, 10*time.Second, rc.Logger)
+
+	existing, err := raft.HasExistingState(logs, stable, n.snapshots)
+	if err != nil {
+		_ = n.transport.Close()
+		n.closeStore()
+		return nil, err
+	}
+
+	n.raft, err = raft.NewRaft(rc, &fsm{database: database}, logs, stable, n.snapshots, n.transport)
+	if err != nil {
+		_ = n.transport.Close()
+		n.closeStore()
+		return nil, err
+	}
+
+	if !existing {
+		servers := make([]raft.Server, 0, len(cfg.Peers))
+		for _, p := range cfg.Peers {
+			servers = append(servers, raft.Server{ID: raft.ServerID(p.ID), Address: raft.ServerAddress(p.RaftAddr)})
+		}
+		if len(servers) == 0 {
+			servers = append(servers, raft.Server{ID: rc.LocalID, Address: n.transport.LocalAddr()})
+		}
+
+		err = n.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+		if err != nil && !errors.Is(err, raft.ErrCantBootstrap) {
+			_ = n.Close()
+			return nil, fmt.Errorf("bootstrapping cluster: %w", err)
+		}
+	}
+
+	return n, nil
+}
+
+// Close leaves the cluster and releases the raft log. It does not close the database.
+func (n *Node) Close() error {
+	err := n.raft.Shutdown().Error()
+
+	terr := n.transport.Close()
+	if err == nil {
+		err = terr
+	}
+
+	if n.store != nil {
+		serr := n.store.Close()
+		if err == nil {
+			err = serr
+		}
+	}
+
+	return err
+}
+
+func (n *Node) closeStore() {
+	if n.store != nil {
+		_ = n.store.Close()
+	}
+}
+
+// Ready reports why the node cannot serve requests yet, or nil if it can: it must be a member of the cluster,
+// know of a leader, and have caught up with the log, so that its stale reads are not far behind.
+// Once caught up, a node stays ready while there is a leader.
+func (n *Node) Ready() error {
+	if _, ok := n.Leader(); !ok {
+		return errors.New("no raft leader")
+	}
+
+	if !n.caughtUp.Load() {
+		f := n.raft.GetConfiguration()
+		if err := f.Error(); err != nil {
+			return err
+		}
+		member := false
+		for _, s := range f.Configuration().Servers {
+			member = member || s.ID == raft.ServerID(n.cfg.ID)
+		}
+		if !member {
+			return errors.New("not a member of the raft cluster")
+		}
+
+		applied, committed := n.raft.AppliedIndex(), n.raft.CommitIndex()
+		if applied < committed {
+			return fmt.Errorf("applying the raft log, %d of %d entries applied", applied, committed)
+		}
+		n.caughtUp.Store(true)
+	}
+
+	return nil
+}
+
+// ID is the node's id within the cluster.
+func (n *Node) ID() string {
+	return n.cfg.ID
+}
+
+// IsLeader reports whether the node currently believes it is the leader.
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// Leader returns the current leader, as far as this node knows, and whether there is one.
+func (n *Node) Leader() (Peer, bool) {
+	addr, id := n.raft.LeaderWithID()
+	if id == "" {
+		return Peer{}, false
+	}
+
+	if p, ok := n.peer(string(id)); ok {
+		return p, true
+	}
+	return Peer{ID: string(id), RaftAddr: string(addr)}, true
+}
+
+func (n *Node) peer(id string) (Peer, bool) {
+	for _, p := range n.cfg.Peers {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Peer{}, false
+}
+
+// propose commits a transaction through the raft log and returns what applying it returned.
+func (n *Node) propose(ops []db.TxnOp) ([]db.TxnResult, error) {
+	data, err := json.Marshal(newCommand(ops, time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("encoding command: %w", err)
+	}
+
+	f := n.raft.Apply(data, n.cfg.ApplyTimeout)
+	err = f.Error()
+	if err != nil {
+		return nil, raftError(err)
+	}
+
+	res := f.Response().(applyResult)
+	return res.results, res.err
+}
+
+// barrier waits until every write committed before it was called has been applied locally, confirming the node is still the leader,
+// so that a read which follows sees all of them. As in raft's ReadIndex, the leader only confirms with a quorum that it still leads, then
+// waits to have applied its commit index. The first read of each term waits for a barrier instead: until the leader has committed an entry
+// of its own term, its commit index may not yet cover the writes committed by the previous leader.
+func (n *Node) barrier() error {
+	term := n.raft.CurrentTerm()
+	if n.readTerm.Load() != term {
+		err := n.raft.Barrier(n.cfg.ApplyTimeout).Error()
+		if err != nil {
+			return raftError(err)
+		}
+		n.readTerm.Store(term)
+		return nil
+	}
+
+	index := n.raft.CommitIndex()
+	err := n.raft.VerifyLeader().Error()
+	if err != nil {
+		return raftError(err)
+	}
+	if n.raft.CurrentTerm() != term {
+		return ErrNotLeader
+	}
+
+	deadline := time.Now().Add(n.cfg.ApplyTimeout)
+	for n.raft.AppliedIndex() < index {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("raft: timed out applying index %d", index)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+func raftError(err error) error {
+	if errors.Is(err, raft.ErrNotLeader) {
+		return ErrNotLeader
+	}
+	return fmt.Errorf("raft: %w", err)
+}
+
+func (n *Node) GetAllKeys() ([]string, error) {
+	err := n.barrier()
+	if err != nil {
+		return nil, err
+	}
+	return n.database.GetAllKeys()
+}
+
+func (n *Node) Scan(opts db.ScanOptions) (db.ScanPage, error) {
+	err := n.barrier()
+	if err != nil {
+		return db.ScanPage{}, err
+	}
+	return n.database.Scan(opts)
+}
+
+func (n *Node) Get(key string) (interface{}, error) {
+	err := n.barrier()
+	if err != nil {
+		return nil, err
+	}
+	return n.database.Get(key)
+}
+
+func (n *Node) GetWithVersion(key string) (interface{}, uint64, error) {
+	err := n.barrier()
+	if err != nil {
+		return nil, 0, err
+	}
+	return n.database.GetWithVersion(key)
+}
+
+func (n *Node) Set(key string, value interface{}) error {
+	_, err := n.propose([]db.TxnOp{{Type: db.TxnSet, Key: key, Value: value}})
+	return err
+}
+
+func (n *Node) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return db.ErrInvalidTTL
+	}
+
+	_, err := n.propose([]db.TxnOp{{Type: db.TxnSet, Key: key, Value: value, TTL: ttl}})
+	return err
+}
+
+func (n *Node) Delete(key string) error {
+	_, err := n.propose([]db.TxnOp{{Type: db.TxnDelete, Key: key}})
+	return err
+}
+
+func (n *Node) CompareAndSet(key string, expected uint64, value interface{}, ttl time.Duration) (uint64, error) {
+	if ttl < 0 {
+		return 0, db.ErrInvalidTTL
+	}
+
+	results, err := n.propose([]db.TxnOp{{Type: db.TxnSet, Key: key, Value: value, TTL: ttl, IfVersion: &expected}})
+	if err != nil {
+		return 0, err
+	}
+	return results[0].Version, nil
+}
+
+func (n *Node) CompareAndDelete(key string, expected uint64) error {
+	_, err := n.propose([]db.TxnOp{{Type: db.TxnDelete, Key: key, IfVersion: &expected}})
+	return err
+}
+
+// Txn commits ops through the raft log. A transaction that only reads is not logged, and is linearizable like other reads.
+func (n *Node) Txn(ops []db.TxnOp) ([]db.TxnResult, error) {
+	err := db.ValidateTxn(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range ops {
+		if op.Type != db.TxnGet {
+			return n.propose(ops)
+		}
+	}
+
+	err = n.barrier()
+	if err != nil {
+		return nil, err
+	}
+	return n.database.Txn(ops)
+}
+
+// Expire reads the key's value and version, then writes the value back with the new ttl if the key is still at that version, retrying if it was changed in between.
+// It fails with db.ErrVersionMismatch if the key was changed every time.
+func (n *Node) Expire(key string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, db.ErrInvalidTTL
+	}
+
+	var err error
+	for range expireAttempts {
+		var value interface{}
+		var version uint64
+		value, version, err = n.GetWithVersion(key)
+		if err != nil {
+			return false, err
+		}
+		if version == 0 {
+			return false, nil
+		}
+
+		_, err = n.CompareAndSet(key, version, value, ttl)
+		if !errors.Is(err, db.ErrVersionMismatch) {
+			break
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (n *Node) TTL(key string) (time.Duration, bool, error) {
+	err := n.barrier()
+	if err != nil {
+		return 0, false, err
+	}
+	return n.database.TTL(key)
+}
+
+// Watch watches the local database, which changes as committed writes are applied to it.
+func (n *Node) Watch(opts db.WatchOptions) (*db.Watch, error) {
+	return n.database.Watch(opts)
+}
+
+// Stats describes the local database.
+func (n *Node) Stats() db.Stats {
+	return n.database.Stats()
+}
+
+// Snapshot takes a raft snapshot, after which the log entries it covers are discarded. The snapshot's sequence number is the raft index it covers.
+func (n *Node) Snapshot() (db.SnapshotInfo, error) {
+	start := time.Now()
+
+	err := n.raft.Snapshot().Error()
+	if err != nil && !errors.Is(err, raft.ErrNothingNewToSnapshot) {
+		return db.SnapshotInfo{}, raftError(err)
+	}
+
+	snapshots, err := n.snapshots.List()
+	if err != nil {
+		return db.SnapshotInfo{}, err
+	}
+	if len(snapshots) == 0 {
+		return db.SnapshotInfo{}, errors.New("no snapshot was taken")
+	}
+
+	return db.SnapshotInfo{
+		Seq:      snapshots[0].Index,
+		Keys:     int(n.database.Stats().Keys),
+		Bytes:    snapshots[0].Size,
+		Duration: time.Since(start),
+	}, nil
+}
+
+// streamLayer carries raft traffic over TCP, or TLS if tls is set, advertising the address peers know the node by rather than the one it listens on.
+type streamLayer struct {
+	net.Listener
+	advertise net.Addr
+	tls       *tls.Config
+}
+
+func (s *streamLayer) Dial(addr raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	if s.tls != nil {
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", string(addr), s.tls)
+	}
+	return net.DialTimeout("tcp", string(addr), timeout)
+}
+
+func (s *streamLayer) Addr() net.Addr {
+	return s.advertise
+}
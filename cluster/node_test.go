@@ -0,0 +1,473 @@
+package cluster
+
+import (
+	"KeyValueDB/db"
+	"KeyValueDB/handlers"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+type testNode struct {
+	node     *Node
+	database *db.Database
+	server   *httptest.Server
+	cfg      Config
+}
+
+// fastElections shortens raft's timeouts so tests elect and fail over quickly on loopback.
+func fastElections(c *raft.Config) {
+	c.HeartbeatTimeout = 200 * time.Millisecond
+	c.ElectionTimeout = 200 * time.Millisecond
+	c.LeaderLeaseTimeout = 100 * time.Millisecond
+	c.CommitTimeout = 5 * time.Millisecond
+}
+
+// newTestCluster starts size in-process nodes that talk raft and HTTP over loopback.
+func newTestCluster(t *testing.T, size int, configure func(*Config)) []*testNode {
+	t.Helper()
+
+	nodes := make([]*testNode, size)
+	peers := make([]Peer, size)
+	listeners := make([]net.Listener, size)
+	for i := range nodes {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listening for raft: %s", err)
+		}
+		listeners[i] = l
+
+		nodes[i] = &testNode{server: httptest.NewUnstartedServer(nil)}
+		peers[i] = Peer{
+			ID:       fmt.Sprintf("node%d", i+1),
+			RaftAddr: l.Addr().String(),
+			HTTPAddr: "http://" + nodes[i].server.Listener.Addr().String(),
+		}
+	}
+
+	for i, tn := range nodes {
+		tn.cfg = Config{ID: peers[i].ID, Listener: listeners[i], Peers: peers, tune: fastElections}
+		if configure != nil {
+			configure(&tn.cfg)
+		}
+		tn.start(t)
+	}
+
+	t.Cleanup(func() {
+		for _, tn := range nodes {
+			tn.stop()
+		}
+	})
+
+	return nodes
+}
+
+func (tn *testNode) start(t *testing.T) {
+	t.Helper()
+
+	database, err := db.NewDatabase()
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+
+	node, err := NewNode(database, tn.cfg, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("NewNode returned an error: %s", err)
+	}
+	tn.node, tn.database = node, database
+
+	mux := http.NewServeMux()
+	mux.Handle("/", node.Handler(handlers.IndexHandler(node, slog.New(slog.DiscardHandler)), handlers.IndexHandler(database, slog.New(slog.DiscardHandler))))
+	mux.Handle("/_txn", node.Handler(handlers.TxnHandler(node, slog.New(slog.DiscardHandler)), handlers.TxnHandler(database, slog.New(slog.DiscardHandler))))
+	tn.server.Config.Handler = mux
+	if tn.server.URL == "" {
+		tn.server.Start()
+	}
+}
+
+func (tn *testNode) stop() {
+	if tn.node == nil {
+		return
+	}
+	_ = tn.node.Close()
+	_ = tn.database.Close()
+	tn.node = nil
+}
+
+// waitForLeader waits until exactly one of the running nodes is leader and every running node knows it.
+func waitForLeader(t *testing.T, nodes []*testNode) *testNode {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var leader *testNode
+		leaders, known := 0, 0
+		running := 0
+		for _, tn := range nodes {
+			if tn.node == nil {
+				continue
+			}
+			running++
+			if tn.node.IsLeader() {
+				leader = tn
+				leaders++
+			}
+			if _, ok := tn.node.Leader(); ok {
+				known++
+			}
+		}
+
+		if leaders == 1 && known == running {
+			return leader
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatal("no leader was elected")
+	return nil
+}
+
+func followers(nodes []*testNode, leader *testNode) []*testNode {
+	out := make([]*testNode, 0, len(nodes))
+	for _, tn := range nodes {
+		if tn != leader && tn.node != nil {
+			out = append(out, tn)
+		}
+	}
+	return out
+}
+
+// eventually retries check until it passes or a few seconds have gone by.
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClusterReplicatesWrites(t *testing.T) {
+	nodes := newTestCluster(t, 3, nil)
+	leader := waitForLeader(t, nodes)
+
+	blob := db.Blob{ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}}
+	_ = leader.node.Set("plain", "value")
+	_ = leader.node.Set("blob", blob)
+	_ = leader.node.SetWithTTL("ttl", "value", time.Hour)
+	_ = leader.node.Set("deleted", "value")
+	_ = leader.node.Delete("deleted")
+
+	_, err := leader.node.Txn([]db.TxnOp{
+		{Type: db.TxnSet, Key: "txn1", Value: "a"},
+		{Type: db.TxnSet, Key: "txn2", Value: "b"},
+	})
+	if err != nil {
+		t.Fatalf("Txn returned an error: %s", err)
+	}
+
+	_, version, _ := leader.node.GetWithVersion("txn1")
+
+	for _, tn := range nodes {
+		eventually(t, tn.cfg.ID+" to apply every write", func() bool {
+			_, v, _ := tn.database.GetWithVersion("txn2")
+			return v == version
+		})
+
+		if v, _ := tn.database.Get("plain"); v != "value" {
+			t.Errorf("%s: plain is %v, expected value", tn.cfg.ID, v)
+		}
+		if v, _ := tn.database.Get("blob"); !reflect.DeepEqual(v, blob) {
+			t.Errorf("%s: blob is %v, expected %v", tn.cfg.ID, v, blob)
+		}
+		if v, _ := tn.database.Get("deleted"); v != nil {
+			t.Errorf("%s: deleted is %v, expected it to be absent", tn.cfg.ID, v)
+		}
+		if ttl, ok, _ := tn.database.TTL("ttl"); !ok || ttl <= 0 || ttl > time.Hour {
+			t.Errorf("%s: ttl has TTL %s, expected up to an hour", tn.cfg.ID, ttl)
+		}
+
+		//Every node applies the same writes in the same order, so versions agree everywhere.
+		for _, key := range []string{"plain", "blob", "ttl", "txn1"} {
+			_, want, _ := leader.database.GetWithVersion(key)
+			if _, got, _ := tn.database.GetWithVersion(key); got != want {
+				t.Errorf("%s: %s is at version %d, leader has %d", tn.cfg.ID, key, got, want)
+			}
+		}
+	}
+}
+
+func TestClusterFollowersRejectDirectWrites(t *testing.T) {
+	nodes := newTestCluster(t, 3, nil)
+	leader := waitForLeader(t, nodes)
+	follower := followers(nodes, leader)[0]
+
+	err := follower.node.Set("key", "value")
+	if !errors.Is(err, ErrNotLeader) {
+		t.Errorf("Set on a follower returned %v, expected ErrNotLeader", err)
+	}
+
+	_, err = follower.node.Get("key")
+	if !errors.Is(err, ErrNotLeader) {
+		t.Errorf("Get on a follower returned %v, expected ErrNotLeader", err)
+	}
+}
+
+func TestClusterConditionalWrites(t *testing.T) {
+	nodes := newTestCluster(t, 3, nil)
+	leader := waitForLeader(t, nodes)
+
+	version, err := leader.node.CompareAndSet("key", 0, "first", 0)
+	if err != nil {
+		t.Fatalf("CompareAndSet returned an error: %s", err)
+	}
+
+	_, err = leader.node.CompareAndSet("key", 0, "second", 0)
+	if !errors.Is(err, db.ErrVersionMismatch) {
+		t.Errorf("CompareAndSet on an existing key returned %v, expected ErrVersionMismatch", err)
+	}
+
+	ok, err := leader.node.Expire("key", time.Minute)
+	if err != nil || !ok {
+		t.Errorf("Expire returned %t, %v", ok, err)
+	}
+
+	err = leader.node.CompareAndDelete("key", version)
+	if !errors.Is(err, db.ErrVersionMismatch) {
+		t.Errorf("CompareAndDelete at the version before Expire returned %v, expected ErrVersionMismatch", err)
+	}
+
+	v, _ := leader.node.Get("key")
+	ttl, _, _ := leader.node.TTL("key")
+	if v != "first" || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("key is %v with TTL %s, expected first with up to a minute", v, ttl)
+	}
+}
+
+func TestClusterFailover(t *testing.T) {
+	nodes := newTestCluster(t, 3, nil)
+	leader := waitForLeader(t, nodes)
+
+	err := leader.node.Set("before", "value")
+	if err != nil {
+		t.Fatalf("Set returned an error: %s", err)
+	}
+
+	leader.stop()
+	next := waitForLeader(t, nodes)
+	if next == leader {
+		t.Fatal("stopped node is still leader")
+	}
+
+	err = next.node.Set("after", "value")
+	if err != nil {
+		t.Fatalf("Set on the new leader returned an error: %s", err)
+	}
+
+	for _, tn := range followers(nodes, nil) {
+		eventually(t, tn.cfg.ID+" to apply the write after failover", func() bool {
+			v, _ := tn.database.Get("after")
+			return v == "value"
+		})
+
+		if v, _ := tn.database.Get("before"); v != "value" {
+			t.Errorf("%s lost the write from before failover", tn.cfg.ID)
+		}
+	}
+}
+
+func TestClusterOverTLS(t *testing.T) {
+	serverTLS, clientTLS := newTestTLS(t)
+	nodes := newTestCluster(t, 3, func(c *Config) {
+		c.ServerTLS, c.ClientTLS = serverTLS, clientTLS
+	})
+	leader := waitForLeader(t, nodes)
+
+	err := leader.node.Set("key", "value")
+	if err != nil {
+		t.Fatalf("Set returned an error: %s", err)
+	}
+	for _, tn := range nodes {
+		eventually(t, tn.cfg.ID+" to apply the write", func() bool {
+			v, _ := tn.database.Get("key")
+			return v == "value"
+		})
+	}
+
+	//A peer without a certificate is turned away.
+	conn, err := tls.Dial("tcp", leader.cfg.Peers[0].RaftAddr, &tls.Config{RootCAs: clientTLS.RootCAs})
+	if err == nil {
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		_ = conn.Close()
+	}
+	if err == nil {
+		t.Error("raft accepted a connection without a client certificate")
+	}
+}
+
+// newTestTLS returns configurations for raft over mutual TLS on loopback, with a certificate issued by a throwaway CA.
+func newTestTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool},
+		&tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool}
+}
+
+func TestNodeRestart(t *testing.T) {
+	dir := t.TempDir()
+	nodes := newTestCluster(t, 1, func(c *Config) {
+		c.Dir = dir
+	})
+	tn := waitForLeader(t, nodes)
+
+	_ = tn.node.Set("snapshotted", "value")
+	_, err := tn.node.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot returned an error: %s", err)
+	}
+	_ = tn.node.Set("logged", "value")
+	_, version, _ := tn.node.GetWithVersion("logged")
+
+	tn.stop()
+
+	l, err := net.Listen("tcp", tn.cfg.Peers[0].RaftAddr)
+	if err != nil {
+		t.Fatalf("listening for raft again: %s", err)
+	}
+	tn.cfg.Listener = l
+	tn.start(t)
+	waitForLeader(t, nodes)
+
+	for _, key := range []string{"snapshotted", "logged"} {
+		if v, _ := tn.node.Get(key); v != "value" {
+			t.Errorf("%s is %v after restart, expected value", key, v)
+		}
+	}
+
+	if _, v, _ := tn.node.GetWithVersion("logged"); v != version {
+		t.Errorf("logged is at version %d after restart, expected %d", v, version)
+	}
+}
+
+func TestNodeReady(t *testing.T) {
+	nodes := newTestCluster(t, 3, nil)
+	waitForLeader(t, nodes)
+
+	for _, tn := range nodes {
+		eventually(t, tn.cfg.ID+" to be ready", func() bool { return tn.node.Ready() == nil })
+	}
+
+	//Without a quorum no leader can be elected, so the last node standing stops being ready.
+	leader := waitForLeader(t, nodes)
+	last := followers(nodes, leader)[0]
+	for _, tn := range nodes {
+		if tn != last {
+			tn.stop()
+		}
+	}
+	eventually(t, "the last node to stop being ready", func() bool { return last.node.Ready() != nil })
+}
+
+func TestParsePeers(t *testing.T) {
+	tt := []struct {
+		name     string
+		peers    string
+		expected []Peer
+		err      bool
+	}{
+		{name: "empty should give no peers", peers: "", expected: []Peer{}},
+		{
+			name:  "peers should be split on commas",
+			peers: "n1=10.0.0.1:7000@http://10.0.0.1:8080, n2=10.0.0.2:7000@https://10.0.0.2:8443",
+			expected: []Peer{
+				{ID: "n1", RaftAddr: "10.0.0.1:7000", HTTPAddr: "http://10.0.0.1:8080"},
+				{ID: "n2", RaftAddr: "10.0.0.2:7000", HTTPAddr: "https://10.0.0.2:8443"},
+			},
+		},
+		{
+			name:     "HTTP address without a scheme should default to http",
+			peers:    "n1=10.0.0.1:7000@10.0.0.1:8080",
+			expected: []Peer{{ID: "n1", RaftAddr: "10.0.0.1:7000", HTTPAddr: "http://10.0.0.1:8080"}},
+		},
+		{name: "missing id should be rejected", peers: "=10.0.0.1:7000@10.0.0.1:8080", err: true},
+		{name: "missing HTTP address should be rejected", peers: "n1=10.0.0.1:7000", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			peers, err := ParsePeers(tc.peers)
+			if tc.err {
+				if !errors.Is(err, ErrInvalidPeer) {
+					t.Errorf("ParsePeers returned %v, expected ErrInvalidPeer", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParsePeers returned an error: %s", err)
+			}
+			if !reflect.DeepEqual(peers, tc.expected) {
+				t.Errorf("got %+v, want %+v", peers, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,482 @@
+package config
+
+import (
+	"KeyValueDB/auth"
+	"KeyValueDB/certs"
+	"KeyValueDB/cluster"
+	"KeyValueDB/db"
+	"KeyValueDB/logging"
+	"KeyValueDB/ratelimit"
+	"KeyValueDB/sharding"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything the server can be configured with. The zero value is not valid; start from Default.
+type Config struct {
+	HTTP        HTTP        `yaml:"http"`
+	TLS         TLS         `yaml:"tls"`
+	Auth        Auth        `yaml:"auth"`
+	GRPC        GRPC        `yaml:"grpc"`
+	RESP        RESP        `yaml:"resp"`
+	Storage     Storage     `yaml:"storage"`
+	Limits      Limits      `yaml:"limits"`
+	RateLimit   RateLimit   `yaml:"rateLimit"`
+	Raft        Raft        `yaml:"raft"`
+	Replication Replication `yaml:"replication"`
+	Sharding    Sharding    `yaml:"sharding"`
+	Features    Features    `yaml:"features"`
+	Log         Log         `yaml:"log"`
+	Metrics     Metrics     `yaml:"metrics"`
+}
+
+type HTTP struct {
+	Addr string `yaml:"addr"`
+
+	//How long a client may take to send request headers. 0 means no limit.
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+
+	//How long shutdown waits for open requests, and the other APIs, to finish.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+
+	//How long the server keeps serving once shutdown begins, reporting that it is not ready, so that load balancers can stop sending it traffic first.
+	DrainDelay time.Duration `yaml:"drainDelay"`
+}
+
+// TLS serves the HTTP API, and the metrics, over HTTPS.
+type TLS struct {
+	//PEM certificate and private key files. HTTPS is disabled if empty.
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+
+	//PEM file of the CAs that clients must present a certificate signed by. Client certificates are not asked for if empty.
+	ClientCA string `yaml:"clientCA"`
+
+	//PEM file of the CAs that other nodes' certificates are verified against: the primary, the raft leader and other shards,
+	//and in a raft cluster, the peers connecting to this node.
+	//The system's roots are used if empty.
+	PeerCA string `yaml:"peerCA"`
+
+	//How often the certificate, key and client CAs are checked for changes, and reloaded. 0 disables reloading.
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+}
+
+// Auth requires requests to the HTTP API to authenticate with an API key or a JWT, or with a client certificate if tls.clientCA is set.
+type Auth struct {
+	//File of API keys, each on its own line as a name and the hex SHA-256 of the key.
+	APIKeys string `yaml:"apiKeys"`
+
+	//JSON Web Key Set file of the HS256 secrets and RS256 public keys that JWTs may be signed with.
+	JWKS string `yaml:"jwks"`
+
+	//If set, a JWT must have been issued by Issuer, for Audience.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+
+	//API key sent with this node's own requests to other nodes, such as a replica's to its primary.
+	PeerKey string `yaml:"peerKey"`
+
+	//YAML file of the roles that callers hold, granting permissions on keys. Every authenticated caller may do anything if empty.
+	Policy string `yaml:"policy"`
+}
+
+type GRPC struct {
+	//Disabled if empty.
+	Addr string `yaml:"addr"`
+}
+
+type RESP struct {
+	//Disabled if empty.
+	Addr string `yaml:"addr"`
+}
+
+type Storage struct {
+	//Whether writes are recorded in a write-ahead log in Dir, and replayed on startup.
+	//Ignored in a raft cluster and on a replica, which keep their data elsewhere.
+	WAL bool   `yaml:"wal"`
+	Dir string `yaml:"dir"`
+
+	//always, interval or never.
+	Sync             string        `yaml:"sync"`
+	SyncInterval     time.Duration `yaml:"syncInterval"`
+	SnapshotInterval time.Duration `yaml:"snapshotInterval"`
+
+	Shards         int           `yaml:"shards"`
+	ExpiryInterval time.Duration `yaml:"expiryInterval"`
+	WatchHistory   int           `yaml:"watchHistory"`
+}
+
+type Limits struct {
+	//0 means unlimited.
+	MaxBytes int64 `yaml:"maxBytes"`
+	MaxKeys  int64 `yaml:"maxKeys"`
+
+	EvictionPolicy string `yaml:"evictionPolicy"`
+
+	//Limits on the keys under a prefix, such as a tenant's, each as prefix=maxKeys:maxBytes.
+	Quotas List `yaml:"quotas"`
+}
+
+// RateLimit keeps each client of the HTTP API's keys to a budget of requests, told apart by their principal or else their address.
+type RateLimit struct {
+	//Requests per second, on average, that a client may make that read and that write. 0 means unlimited.
+	ReadRate  int `yaml:"readRate"`
+	WriteRate int `yaml:"writeRate"`
+
+	//Requests a client may make at once after being idle. 0 means the rate.
+	ReadBurst  int `yaml:"readBurst"`
+	WriteBurst int `yaml:"writeBurst"`
+
+	//Addresses or CIDRs of the proxies whose X-Forwarded-For names the client, such as load balancers and the other nodes.
+	TrustedProxies List `yaml:"trustedProxies"`
+}
+
+type Raft struct {
+	//Clustering is disabled if empty.
+	ID       string `yaml:"id"`
+	Addr     string `yaml:"addr"`
+	Dir      string `yaml:"dir"`
+	Peers    List   `yaml:"peers"`
+	Redirect bool   `yaml:"redirect"`
+
+	//How long a write may wait to be committed.
+	ApplyTimeout time.Duration `yaml:"applyTimeout"`
+}
+
+type Replication struct {
+	//Base URL of the primary to serve a read-only replica of. Disabled if empty.
+	ReplicaOf string `yaml:"replicaOf"`
+}
+
+type Sharding struct {
+	//Sharding is disabled if empty.
+	ID           string `yaml:"id"`
+	Peers        List   `yaml:"peers"`
+	VirtualNodes int    `yaml:"virtualNodes"`
+}
+
+// Features turns optional HTTP endpoints on and off.
+type Features struct {
+	Watch     bool `yaml:"watch"`
+	WebSocket bool `yaml:"websocket"`
+	Snapshot  bool `yaml:"snapshot"`
+
+	//Serve /_replication on a standalone server, so that replicas can follow it.
+	Replication bool `yaml:"replication"`
+
+	//Serve namespaces on /ns/{name}/ and administer them on /_namespaces, on a standalone server.
+	//Off by default, as keys starting with "ns/" in the default keyspace can no longer be reached over HTTP.
+	Namespaces bool `yaml:"namespaces"`
+}
+
+type Log struct {
+	//debug, info, warn or error.
+	Level string `yaml:"level"`
+
+	//text or json.
+	Format string `yaml:"format"`
+
+	//Whether every HTTP request is logged at info.
+	Access bool `yaml:"access"`
+}
+
+type Metrics struct {
+	//Address to serve Prometheus metrics on, at /metrics. Disabled if empty.
+	Addr string `yaml:"addr"`
+}
+
+// List is a list of strings, written in YAML as a sequence or as a comma separated string, and in flags and environment variables as a comma separated string.
+type List []string
+
+func (l *List) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = splitList(node.Value)
+		return nil
+	}
+
+	var items []string
+	err := node.Decode(&items)
+	if err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+func (l List) String() string {
+	return strings.Join(l, ",")
+}
+
+func splitList(s string) List {
+	l := make(List, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			l = append(l, item)
+		}
+	}
+	return l
+}
+
+// Default returns the configuration used for anything that is not set.
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   5 * time.Second,
+		},
+		TLS: TLS{
+			ReloadInterval: 10 * time.Second,
+		},
+		Storage: Storage{
+			WAL:              true,
+			Dir:              "data",
+			Sync:             "interval",
+			SyncInterval:     100 * time.Millisecond,
+			SnapshotInterval: 10 * time.Minute,
+			Shards:           32,
+			ExpiryInterval:   time.Second,
+			WatchHistory:     10000,
+		},
+		Limits: Limits{
+			EvictionPolicy: string(db.EvictNone),
+			Quotas:         List{},
+		},
+		Raft: Raft{
+			Addr:         ":7000",
+			Dir:          "data/raft",
+			Peers:        List{},
+			ApplyTimeout: 5 * time.Second,
+		},
+		RateLimit: RateLimit{
+			TrustedProxies: List{},
+		},
+		Sharding: Sharding{
+			Peers:        List{},
+			VirtualNodes: sharding.DefaultVirtualNodes,
+		},
+		Features: Features{
+			Watch:       true,
+			WebSocket:   true,
+			Snapshot:    true,
+			Replication: true,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: string(logging.FormatText),
+			Access: true,
+		},
+	}
+}
+
+// TLSEnabled reports whether the HTTP API is served over HTTPS.
+func (c Config) TLSEnabled() bool {
+	return c.TLS.Cert != ""
+}
+
+// AuthEnabled reports whether requests to the HTTP API must be authenticated.
+func (c Config) AuthEnabled() bool {
+	return c.Auth.APIKeys != "" || c.Auth.JWKS != "" || c.Auth.Policy != ""
+}
+
+// RateLimited reports whether clients of the HTTP API are kept to a budget of requests.
+func (c Config) RateLimited() bool {
+	return c.RateLimit.ReadRate > 0 || c.RateLimit.WriteRate > 0
+}
+
+// Clustered reports whether the server is a member of a raft cluster.
+func (c Config) Clustered() bool {
+	return c.Raft.ID != ""
+}
+
+// Replica reports whether the server is a read-only replica of another.
+func (c Config) Replica() bool {
+	return c.Replication.ReplicaOf != ""
+}
+
+// Sharded reports whether the server holds a share of keys partitioned across several servers.
+func (c Config) Sharded() bool {
+	return c.Sharding.ID != ""
+}
+
+// Validate checks every setting, returning all of the problems found.
+func (c Config) Validate() error {
+	errs := make([]error, 0)
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.HTTP.Addr != "", "http.addr is required")
+	check(c.HTTP.ReadHeaderTimeout >= 0, "http.readHeaderTimeout must not be negative")
+	check(c.HTTP.ShutdownTimeout > 0, "http.shutdownTimeout must be positive")
+	check(c.HTTP.DrainDelay >= 0, "http.drainDelay must not be negative")
+
+	check(c.TLS.Cert != "" && c.TLS.Key != "" || c.TLS.Cert == "" && c.TLS.Key == "", "tls.cert and tls.key must be given together")
+	check(c.TLS.ClientCA == "" || c.TLSEnabled(), "tls.clientCA requires tls.cert")
+	check(c.TLS.PeerCA == "" || c.TLSEnabled(), "tls.peerCA requires tls.cert")
+	check(c.TLS.ReloadInterval >= 0, "tls.reloadInterval must not be negative")
+
+	check(c.Auth.Issuer == "" && c.Auth.Audience == "" || c.Auth.JWKS != "", "auth.issuer and auth.audience require auth.jwks")
+	check(c.Auth.Policy == "" || c.Auth.APIKeys != "" || c.Auth.JWKS != "" || c.TLS.ClientCA != "", "auth.policy requires auth.apiKeys, auth.jwks or tls.clientCA to authenticate callers with")
+
+	sync, err := db.ParseSyncMode(c.Storage.Sync)
+	check(err == nil, "storage.sync: %v", err)
+	check(!c.Storage.WAL || c.Storage.Dir != "", "storage.dir is required with the write-ahead log")
+	check(sync != db.SyncInterval || c.Storage.SyncInterval > 0, "storage.syncInterval must be positive")
+	check(c.Storage.SnapshotInterval >= 0, "storage.snapshotInterval must not be negative")
+	check(c.Storage.Shards > 0, "storage.shards must be positive")
+	check(c.Storage.ExpiryInterval > 0, "storage.expiryInterval must be positive")
+	check(c.Storage.WatchHistory > 0, "storage.watchHistory must be positive")
+
+	policy, err := db.ParseEvictionPolicy(c.Limits.EvictionPolicy)
+	check(err == nil, "limits.evictionPolicy: %v", err)
+	check(c.Limits.MaxBytes >= 0, "limits.maxBytes must not be negative")
+	check(c.Limits.MaxKeys >= 0, "limits.maxKeys must not be negative")
+	for _, q := range c.Limits.Quotas {
+		_, err = db.ParseQuota(q)
+		check(err == nil, "limits.quotas: %v", err)
+	}
+
+	check(c.RateLimit.ReadRate >= 0 && c.RateLimit.WriteRate >= 0, "rateLimit.readRate and rateLimit.writeRate must not be negative")
+	check(c.RateLimit.ReadBurst >= 0 && c.RateLimit.WriteBurst >= 0, "rateLimit.readBurst and rateLimit.writeBurst must not be negative")
+	_, err = ratelimit.ParseCIDRs(c.RateLimit.TrustedProxies)
+	check(err == nil, "rateLimit.trustedProxies: %v", err)
+
+	_, err = cluster.ParsePeers(c.Raft.Peers.String())
+	check(err == nil, "raft.peers: %v", err)
+	check(c.Raft.ApplyTimeout > 0, "raft.applyTimeout must be positive")
+	check(!c.Clustered() || c.Raft.Addr != "", "raft.addr is required in a raft cluster")
+	check(!c.Clustered() || policy == db.EvictNone, "eviction is not supported in a raft cluster")
+	//Members reap expired keys at different times, so could disagree on whether a write is over a limit or quota,
+	//and a member that refused an entry the others applied would diverge from them.
+	check(!c.Clustered() || c.Limits.MaxKeys == 0 && c.Limits.MaxBytes == 0, "limits.maxKeys and limits.maxBytes are not supported in a raft cluster")
+	check(!c.Clustered() || len(c.Limits.Quotas) == 0, "quotas are not supported in a raft cluster")
+
+	check(!c.Replica() || !c.Clustered(), "a replica cannot be a member of a raft cluster")
+	check(!c.Replica() || policy == db.EvictNone, "eviction is not supported on a replica")
+
+	_, err = sharding.ParseMembers(c.Sharding.Peers.String())
+	check(err == nil, "sharding.peers: %v", err)
+	check(c.Sharding.VirtualNodes > 0, "sharding.virtualNodes must be positive")
+	check(!c.Sharded() || !c.Clustered() && !c.Replica(), "sharding cannot be combined with a raft cluster or a replica")
+	check(!c.Sharded() || c.RESP.Addr == "" && c.GRPC.Addr == "", "the Redis and gRPC APIs are not supported with sharding")
+
+	//Neither is authenticated, so either would let any caller around auth.
+	authenticated := c.AuthEnabled() || c.TLS.ClientCA != ""
+	check(!authenticated || c.RESP.Addr == "" && c.GRPC.Addr == "", "the Redis and gRPC APIs are not authenticated, so they cannot be combined with auth or tls.clientCA")
+	//Raft traffic is only authenticated over TLS, where peers must present a certificate signed by tls.peerCA.
+	check(!c.AuthEnabled() || !c.Clustered() || c.TLSEnabled(), "auth in a raft cluster requires tls.cert, so that raft traffic is authenticated")
+
+	check(!c.Features.Namespaces || !c.Clustered() && !c.Replica() && !c.Sharded(), "namespaces are not supported in a raft cluster, on a replica or with sharding")
+
+	_, err = logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level: %v", err)
+	_, err = logging.ParseFormat(c.Log.Format)
+	check(err == nil, "log.format: %v", err)
+
+	return errors.Join(errs...)
+}
+
+// Logger returns the logger to write the server's logs to w with. c must be valid.
+func (c Config) Logger(w io.Writer) *slog.Logger {
+	level, _ := logging.ParseLevel(c.Log.Level)
+	format, _ := logging.ParseFormat(c.Log.Format)
+	return logging.New(w, format, level)
+}
+
+// Certs returns the files to serve TLS with. HTTPS is only enabled if TLSEnabled.
+func (c Config) Certs() certs.Config {
+	return certs.Config{
+		CertFile:     c.TLS.Cert,
+		KeyFile:      c.TLS.Key,
+		ClientCAFile: c.TLS.ClientCA,
+		PeerCAFile:   c.TLS.PeerCA,
+	}
+}
+
+// Authentication loads the API keys and JWT keys that requests are authenticated with. It is only needed if AuthEnabled.
+func (c Config) Authentication() (auth.Config, error) {
+	cfg := auth.Config{
+		Issuer:       c.Auth.Issuer,
+		Audience:     c.Auth.Audience,
+		Certificates: c.TLS.ClientCA != "",
+	}
+
+	var err error
+	if c.Auth.APIKeys != "" {
+		cfg.APIKeys, err = auth.LoadAPIKeys(c.Auth.APIKeys)
+		if err != nil {
+			return auth.Config{}, err
+		}
+	}
+	if c.Auth.JWKS != "" {
+		cfg.KeySet, err = auth.LoadKeySet(c.Auth.JWKS)
+		if err != nil {
+			return auth.Config{}, err
+		}
+	}
+	return cfg, nil
+}
+
+// RateLimiter returns the budget of each client. It is only needed if RateLimited.
+func (c Config) RateLimiter() ratelimit.Config {
+	//Already validated.
+	proxies, _ := ratelimit.ParseCIDRs(c.RateLimit.TrustedProxies)
+	return ratelimit.Config{
+		ReadRate:       c.RateLimit.ReadRate,
+		WriteRate:      c.RateLimit.WriteRate,
+		ReadBurst:      c.RateLimit.ReadBurst,
+		WriteBurst:     c.RateLimit.WriteBurst,
+		TrustedProxies: proxies,
+	}
+}
+
+// DBOptions returns the options to open the database with. c must be valid.
+func (c Config) DBOptions() []db.Option {
+	policy, _ := db.ParseEvictionPolicy(c.Limits.EvictionPolicy)
+	opts := []db.Option{
+		db.WithMaxBytes(c.Limits.MaxBytes),
+		db.WithMaxKeys(c.Limits.MaxKeys),
+		db.WithEvictionPolicy(policy),
+		db.WithShards(c.Storage.Shards),
+		db.WithExpiryInterval(c.Storage.ExpiryInterval),
+		db.WithWatchHistory(c.Storage.WatchHistory),
+	}
+
+	if len(c.Limits.Quotas) > 0 {
+		quotas := make([]db.Quota, len(c.Limits.Quotas))
+		for i, q := range c.Limits.Quotas {
+			quotas[i], _ = db.ParseQuota(q)
+		}
+		opts = append(opts, db.WithQuotas(quotas...))
+	}
+
+	//Revisions on a raft member follow the log, and on a replica the primary's, so expired keys must be removed without a revision of their own.
+	if c.Clustered() || c.Replica() {
+		opts = append(opts, db.WithLocalExpiry())
+	}
+
+	//In a cluster the raft log makes writes durable instead, and a replica is rebuilt from its primary.
+	if c.Storage.WAL && !c.Clustered() && !c.Replica() {
+		sync, _ := db.ParseSyncMode(c.Storage.Sync)
+		opts = append(opts, db.WithWAL(db.WALConfig{
+			Dir:          c.Storage.Dir,
+			Sync:         sync,
+			SyncInterval: c.Storage.SyncInterval,
+		}))
+		if c.Storage.SnapshotInterval > 0 {
+			opts = append(opts, db.WithSnapshotInterval(c.Storage.SnapshotInterval))
+		}
+	}
+
+	return opts
+}
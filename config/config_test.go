@@ -0,0 +1,205 @@
+package config
+
+import (
+	"KeyValueDB/auth"
+	"KeyValueDB/db"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tt := []struct {
+		name     string
+		change   func(c *Config)
+		expected string
+	}{
+		{name: "defaults should be valid", change: func(c *Config) {}},
+		{name: "http address should be required", change: func(c *Config) { c.HTTP.Addr = "" }, expected: "http.addr is required"},
+		{name: "shutdown timeout should be positive", change: func(c *Config) { c.HTTP.ShutdownTimeout = 0 }, expected: "http.shutdownTimeout"},
+		{name: "drain delay should not be negative", change: func(c *Config) { c.HTTP.DrainDelay = -time.Second }, expected: "http.drainDelay"},
+		{name: "tls should be allowed with a certificate and key", change: func(c *Config) { c.TLS.Cert, c.TLS.Key, c.TLS.ClientCA = "tls.crt", "tls.key", "ca.crt" }},
+		{name: "tls certificate should need a key", change: func(c *Config) { c.TLS.Cert = "tls.crt" }, expected: "tls.cert and tls.key"},
+		{name: "client CA should need a certificate", change: func(c *Config) { c.TLS.ClientCA = "ca.crt" }, expected: "tls.clientCA requires tls.cert"},
+		{name: "jwt audience should need a key set", change: func(c *Config) { c.Auth.Audience = "kvdb" }, expected: "auth.audience require auth.jwks"},
+		{name: "policy should need a way to authenticate", change: func(c *Config) { c.Auth.Policy = "policy.yaml" }, expected: "auth.policy requires"},
+		{name: "policy should be allowed with client certificates", change: func(c *Config) {
+			c.Auth.Policy, c.TLS.Cert, c.TLS.Key, c.TLS.ClientCA = "policy.yaml", "tls.crt", "tls.key", "ca.crt"
+		}},
+		{name: "tls reload interval should not be negative", change: func(c *Config) { c.TLS.ReloadInterval = -time.Second }, expected: "tls.reloadInterval"},
+		{name: "sync mode should be known", change: func(c *Config) { c.Storage.Sync = "sometimes" }, expected: "storage.sync"},
+		{name: "interval sync should have an interval", change: func(c *Config) { c.Storage.SyncInterval = 0 }, expected: "storage.syncInterval"},
+		{name: "interval should not be needed without interval sync", change: func(c *Config) { c.Storage.Sync, c.Storage.SyncInterval = "always", 0 }},
+		{name: "eviction policy should be known", change: func(c *Config) { c.Limits.EvictionPolicy = "most-recent" }, expected: "limits.evictionPolicy"},
+		{name: "limits should not be negative", change: func(c *Config) { c.Limits.MaxKeys = -1 }, expected: "limits.maxKeys"},
+		{name: "quotas should parse", change: func(c *Config) { c.Limits.Quotas = List{"team-a/"} }, expected: "limits.quotas"},
+		{name: "quotas should not be allowed in a cluster", change: func(c *Config) { c.Raft.ID, c.Limits.Quotas = "n1", List{"team-a/=1:0"} }, expected: "quotas are not supported"},
+		{name: "rates should not be negative", change: func(c *Config) { c.RateLimit.WriteRate = -1 }, expected: "rateLimit.writeRate"},
+		{name: "trusted proxies should parse", change: func(c *Config) { c.RateLimit.TrustedProxies = List{"proxy"} }, expected: "rateLimit.trustedProxies"},
+		{name: "raft peers should parse", change: func(c *Config) { c.Raft.Peers = List{"n1"} }, expected: "raft.peers"},
+		{name: "eviction should not be allowed in a cluster", change: func(c *Config) { c.Raft.ID, c.Limits.EvictionPolicy = "n1", "allkeys-lru" }, expected: "raft cluster"},
+		{name: "limits should not be allowed in a cluster", change: func(c *Config) { c.Raft.ID, c.Limits.MaxBytes = "n1", 1<<20 }, expected: "limits.maxKeys and limits.maxBytes are not supported"},
+		{name: "replica should not be clustered", change: func(c *Config) { c.Raft.ID, c.Replication.ReplicaOf = "n1", "http://primary" }, expected: "replica cannot"},
+		{name: "sharding should not serve redis", change: func(c *Config) { c.Sharding.ID, c.RESP.Addr = "n1", ":6379" }, expected: "not supported with sharding"},
+		{name: "auth should not be combined with redis", change: func(c *Config) { c.Auth.APIKeys, c.RESP.Addr = "keys.txt", ":6379" }, expected: "not authenticated"},
+		{name: "client certificates should not be combined with grpc", change: func(c *Config) {
+			c.TLS.Cert, c.TLS.Key, c.TLS.ClientCA, c.GRPC.Addr = "tls.crt", "tls.key", "ca.crt", ":9090"
+		}, expected: "not authenticated"},
+		{name: "policy should not be combined with grpc", change: func(c *Config) {
+			c.Auth.Policy, c.Auth.APIKeys, c.GRPC.Addr = "policy.yaml", "keys.txt", ":9090"
+		}, expected: "not authenticated"},
+		{name: "auth in a cluster should need tls", change: func(c *Config) { c.Raft.ID, c.Raft.Addr, c.Auth.APIKeys = "n1", ":7000", "keys.txt" }, expected: "raft traffic is authenticated"},
+		{name: "auth in a cluster should be allowed with tls", change: func(c *Config) {
+			c.Raft.ID, c.Raft.Addr, c.Auth.APIKeys, c.TLS.Cert, c.TLS.Key = "n1", ":7000", "keys.txt", "tls.crt", "tls.key"
+		}},
+		{name: "namespaces should be allowed standalone", change: func(c *Config) { c.Features.Namespaces = true }},
+		{name: "namespaces should not be sharded", change: func(c *Config) { c.Sharding.ID, c.Features.Namespaces = "n1", true }, expected: "namespaces are not supported"},
+		{name: "log level should be known", change: func(c *Config) { c.Log.Level = "loud" }, expected: "log.level"},
+		{name: "log format should be known", change: func(c *Config) { c.Log.Format = "xml" }, expected: "log.format"},
+		{name: "sharding peers should parse", change: func(c *Config) { c.Sharding.Peers = List{"n1"} }, expected: "sharding.peers"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := Default()
+			tc.change(&c)
+
+			err := c.Validate()
+			if tc.expected == "" && err != nil {
+				t.Errorf("Validate returned %s", err)
+			}
+			if tc.expected != "" && (err == nil || !strings.Contains(err.Error(), tc.expected)) {
+				t.Errorf("Validate returned %v, expected an error about %s", err, tc.expected)
+			}
+		})
+	}
+
+	t.Run("every problem should be reported", func(t *testing.T) {
+		c := Default()
+		c.HTTP.Addr, c.Storage.Shards = "", 0
+
+		err := c.Validate()
+		if err == nil || !strings.Contains(err.Error(), "http.addr") || !strings.Contains(err.Error(), "storage.shards") {
+			t.Errorf("Validate returned %v, expected both problems", err)
+		}
+	})
+}
+
+func TestDBOptions(t *testing.T) {
+	t.Run("write-ahead log should be kept in the storage directory", func(t *testing.T) {
+		c := Default()
+		c.Storage.Dir = filepath.Join(t.TempDir(), "data")
+		c.Storage.Sync = "always"
+
+		database, err := db.NewDatabase(c.DBOptions()...)
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		_ = database.Set("key", "value")
+		database.Close()
+
+		entries, _ := os.ReadDir(c.Storage.Dir)
+		if len(entries) == 0 {
+			t.Error("nothing was written to the storage directory")
+		}
+	})
+
+	t.Run("replica should not have a write-ahead log", func(t *testing.T) {
+		c := Default()
+		c.Storage.Dir = filepath.Join(t.TempDir(), "data")
+		c.Replication.ReplicaOf = "http://primary:8080"
+
+		database, err := db.NewDatabase(c.DBOptions()...)
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		defer database.Close()
+
+		if _, err := os.Stat(c.Storage.Dir); !os.IsNotExist(err) {
+			t.Errorf("storage directory was created for a replica: %v", err)
+		}
+	})
+
+	t.Run("limits should be applied", func(t *testing.T) {
+		c := Default()
+		c.Storage.WAL = false
+		c.Limits.MaxKeys = 1
+		c.Storage.ExpiryInterval = time.Minute
+
+		database, err := db.NewDatabase(c.DBOptions()...)
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		defer database.Close()
+
+		_ = database.Set("a", "1")
+		if err := database.Set("b", "1"); err == nil {
+			t.Error("second key was accepted with a limit of one key")
+		}
+	})
+
+	t.Run("quotas should be applied", func(t *testing.T) {
+		c := Default()
+		c.Storage.WAL = false
+		c.Limits.Quotas = List{"team-a/=1:0"}
+
+		database, err := db.NewDatabase(c.DBOptions()...)
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		defer database.Close()
+
+		_ = database.Set("team-a/1", "1")
+		if err := database.Set("team-a/2", "1"); !errors.Is(err, db.ErrQuotaExceeded) {
+			t.Errorf("second key under the quota returned %v, expected ErrQuotaExceeded", err)
+		}
+		if err := database.Set("team-b/1", "1"); err != nil {
+			t.Errorf("key outside the quota returned %v", err)
+		}
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	c := Default()
+	c.RateLimit.ReadRate, c.RateLimit.WriteRate, c.RateLimit.WriteBurst = 100, 10, 50
+	c.RateLimit.TrustedProxies = List{"10.0.0.0/8", "192.168.1.1"}
+
+	if !c.RateLimited() || Default().RateLimited() {
+		t.Error("only a configured rate should limit clients")
+	}
+
+	got := c.RateLimiter()
+	if got.ReadRate != 100 || got.WriteRate != 10 || got.WriteBurst != 50 || len(got.TrustedProxies) != 2 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "api-keys")
+	_ = os.WriteFile(keys, []byte("deploy-bot "+auth.HashAPIKey("secret")+"\n"), 0600)
+
+	c := Default()
+	c.Auth.APIKeys = keys
+	c.TLS.Cert, c.TLS.Key, c.TLS.ClientCA = "tls.crt", "tls.key", "ca.crt"
+
+	cfg, err := c.Authentication()
+	if err != nil {
+		t.Fatalf("Authentication returned an error: %s", err)
+	}
+	if name, _ := cfg.APIKeys.Lookup("secret"); name != "deploy-bot" {
+		t.Errorf("API keys were not loaded: %v", cfg.APIKeys)
+	}
+	if !cfg.Certificates || cfg.KeySet != nil {
+		t.Errorf("got %+v", cfg)
+	}
+
+	c.Auth.JWKS = filepath.Join(dir, "missing.json")
+	_, err = c.Authentication()
+	if err == nil {
+		t.Error("a missing key set should be an error")
+	}
+}
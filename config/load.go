@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the name of every environment variable read by Load, such as KVDB_HTTP_ADDR for http.addr.
+const EnvPrefix = "KVDB_"
+
+// setting is one configurable value, with the flag that sets it. Its environment variable is derived from its key.
+type setting struct {
+	key   string
+	flag  string
+	usage string
+	field func(c *Config) interface{}
+}
+
+var settings = []setting{
+	{"http.addr", "http-addr", "address to serve HTTP on", func(c *Config) interface{} { return &c.HTTP.Addr }},
+	{"http.readHeaderTimeout", "read-header-timeout", "how long a client may take to send request headers, 0 for no limit", func(c *Config) interface{} { return &c.HTTP.ReadHeaderTimeout }},
+	{"http.shutdownTimeout", "shutdown-timeout", "how long shutdown waits for open requests to finish", func(c *Config) interface{} { return &c.HTTP.ShutdownTimeout }},
+	{"http.drainDelay", "drain-delay", "how long to keep serving once shutdown begins, reporting not ready, before closing connections", func(c *Config) interface{} { return &c.HTTP.DrainDelay }},
+
+	{"tls.cert", "tls-cert", "PEM certificate file to serve HTTPS with; HTTPS is disabled if empty", func(c *Config) interface{} { return &c.TLS.Cert }},
+	{"tls.key", "tls-key", "PEM private key file for -tls-cert", func(c *Config) interface{} { return &c.TLS.Key }},
+	{"tls.clientCA", "tls-client-ca", "PEM file of the CAs that clients must present a certificate signed by; client certificates are not required if empty", func(c *Config) interface{} { return &c.TLS.ClientCA }},
+	{"tls.peerCA", "tls-peer-ca", "PEM file of the CAs that other nodes' certificates are verified against; the system's roots if empty", func(c *Config) interface{} { return &c.TLS.PeerCA }},
+	{"tls.reloadInterval", "tls-reload-interval", "how often the certificate, key and client CAs are reloaded if they have changed, 0 to disable", func(c *Config) interface{} { return &c.TLS.ReloadInterval }},
+
+	{"auth.apiKeys", "auth-api-keys", "file of API keys, one per line as a name and the key's hex SHA-256; requests must authenticate if set", func(c *Config) interface{} { return &c.Auth.APIKeys }},
+	{"auth.jwks", "auth-jwks", "JSON Web Key Set file of the keys JWTs may be signed with; requests must authenticate if set", func(c *Config) interface{} { return &c.Auth.JWKS }},
+	{"auth.issuer", "auth-issuer", "iss claim that JWTs must have, if set", func(c *Config) interface{} { return &c.Auth.Issuer }},
+	{"auth.audience", "auth-audience", "audience that JWTs must be for, if set", func(c *Config) interface{} { return &c.Auth.Audience }},
+	{"auth.peerKey", "auth-peer-key", "API key this node sends to other nodes that require authentication", func(c *Config) interface{} { return &c.Auth.PeerKey }},
+	{"auth.policy", "auth-policy", "YAML file of roles granting permissions on key prefixes and patterns, and the callers holding them", func(c *Config) interface{} { return &c.Auth.Policy }},
+
+	{"grpc.addr", "grpc-addr", "address to serve gRPC on, such as :9090; disabled if empty", func(c *Config) interface{} { return &c.GRPC.Addr }},
+	{"resp.addr", "resp-addr", "address to serve the Redis protocol on, such as :6379; disabled if empty", func(c *Config) interface{} { return &c.RESP.Addr }},
+
+	{"storage.wal", "wal", "record writes in a write-ahead log and replay it on startup", func(c *Config) interface{} { return &c.Storage.WAL }},
+	{"storage.dir", "data-dir", "directory for the write-ahead log, snapshots and the shard topology", func(c *Config) interface{} { return &c.Storage.Dir }},
+	{"storage.sync", "wal-sync", "when the write-ahead log is fsynced: always, interval or never", func(c *Config) interface{} { return &c.Storage.Sync }},
+	{"storage.syncInterval", "wal-sync-interval", "how often the write-ahead log is fsynced with -wal-sync interval", func(c *Config) interface{} { return &c.Storage.SyncInterval }},
+	{"storage.snapshotInterval", "snapshot-interval", "how often a snapshot is taken in the background, 0 to disable", func(c *Config) interface{} { return &c.Storage.SnapshotInterval }},
+	{"storage.shards", "shards", "number of independently locked partitions of the keyspace", func(c *Config) interface{} { return &c.Storage.Shards }},
+	{"storage.expiryInterval", "expiry-interval", "how often expired keys are looked for in the background", func(c *Config) interface{} { return &c.Storage.ExpiryInterval }},
+	{"storage.watchHistory", "watch-history", "recent changes kept for watchers and replicas to resume from", func(c *Config) interface{} { return &c.Storage.WatchHistory }},
+
+	{"limits.maxBytes", "max-bytes", "approximate memory limit for keys and values, 0 for unlimited", func(c *Config) interface{} { return &c.Limits.MaxBytes }},
+	{"limits.maxKeys", "max-keys", "maximum number of keys, 0 for unlimited", func(c *Config) interface{} { return &c.Limits.MaxKeys }},
+	{"limits.evictionPolicy", "eviction-policy", "noeviction, allkeys-lru, allkeys-lfu, allkeys-random or volatile-ttl", func(c *Config) interface{} { return &c.Limits.EvictionPolicy }},
+	{"limits.quotas", "quotas", "limits on the keys under prefixes, as prefix=maxKeys:maxBytes separated by commas, 0 for unlimited", func(c *Config) interface{} { return &c.Limits.Quotas }},
+
+	{"rateLimit.readRate", "rate-limit-reads", "reads per second each client may make, 0 for unlimited", func(c *Config) interface{} { return &c.RateLimit.ReadRate }},
+	{"rateLimit.writeRate", "rate-limit-writes", "writes per second each client may make, 0 for unlimited", func(c *Config) interface{} { return &c.RateLimit.WriteRate }},
+	{"rateLimit.readBurst", "rate-limit-read-burst", "reads a client may make at once after being idle, 0 for the rate", func(c *Config) interface{} { return &c.RateLimit.ReadBurst }},
+	{"rateLimit.writeBurst", "rate-limit-write-burst", "writes a client may make at once after being idle, 0 for the rate", func(c *Config) interface{} { return &c.RateLimit.WriteBurst }},
+	{"rateLimit.trustedProxies", "rate-limit-trusted-proxies", "addresses or CIDRs of proxies whose X-Forwarded-For names the client, separated by commas", func(c *Config) interface{} { return &c.RateLimit.TrustedProxies }},
+
+	{"raft.id", "raft-id", "id of this node within a raft cluster; clustering is disabled if empty", func(c *Config) interface{} { return &c.Raft.ID }},
+	{"raft.addr", "raft-addr", "address to listen on for raft traffic", func(c *Config) interface{} { return &c.Raft.Addr }},
+	{"raft.dir", "raft-dir", "directory for the raft log and snapshots", func(c *Config) interface{} { return &c.Raft.Dir }},
+	{"raft.peers", "raft-peers", "every member of the raft cluster, as id=raftaddr@httpaddr separated by commas", func(c *Config) interface{} { return &c.Raft.Peers }},
+	{"raft.redirect", "raft-redirect", "redirect requests that need the raft leader instead of proxying them", func(c *Config) interface{} { return &c.Raft.Redirect }},
+	{"raft.applyTimeout", "raft-apply-timeout", "how long a write may wait to be committed", func(c *Config) interface{} { return &c.Raft.ApplyTimeout }},
+
+	{"replication.replicaOf", "replica-of", "base URL of a primary to serve a read-only replica of, such as http://primary:8080", func(c *Config) interface{} { return &c.Replication.ReplicaOf }},
+
+	{"sharding.id", "shard-id", "id of this node among nodes that partition the keys; sharding is disabled if empty", func(c *Config) interface{} { return &c.Sharding.ID }},
+	{"sharding.peers", "shard-peers", "every node the keys are partitioned across, as id=httpaddr separated by commas", func(c *Config) interface{} { return &c.Sharding.Peers }},
+	{"sharding.virtualNodes", "shard-vnodes", "points each node has on the hash ring; must be the same on every node", func(c *Config) interface{} { return &c.Sharding.VirtualNodes }},
+
+	{"features.watch", "enable-watch", "serve /_watch", func(c *Config) interface{} { return &c.Features.Watch }},
+	{"features.websocket", "enable-websocket", "serve /_ws", func(c *Config) interface{} { return &c.Features.WebSocket }},
+	{"features.snapshot", "enable-snapshot", "serve /_snapshot", func(c *Config) interface{} { return &c.Features.Snapshot }},
+	{"features.replication", "enable-replication", "serve /_replication for replicas to follow, unless clustered, sharded or a replica", func(c *Config) interface{} { return &c.Features.Replication }},
+	{"features.namespaces", "enable-namespaces", "serve namespaces on /ns/{name}/ and /_namespaces, unless clustered, sharded or a replica", func(c *Config) interface{} { return &c.Features.Namespaces }},
+
+	{"log.level", "log-level", "least severe level logged: debug, info, warn or error", func(c *Config) interface{} { return &c.Log.Level }},
+	{"log.format", "log-format", "how logs are written: text or json", func(c *Config) interface{} { return &c.Log.Format }},
+	{"log.access", "access-log", "log every HTTP request", func(c *Config) interface{} { return &c.Log.Access }},
+
+	{"metrics.addr", "metrics-addr", "address to serve Prometheus metrics on at /metrics, such as :9100; disabled if empty", func(c *Config) interface{} { return &c.Metrics.Addr }},
+}
+
+// env returns the environment variable for the setting, such as KVDB_HTTP_READ_HEADER_TIMEOUT for http.readHeaderTimeout.
+// An initialism is kept as one word, such as KVDB_TLS_CLIENT_CA for tls.clientCA.
+func (s setting) env() string {
+	var b strings.Builder
+	b.WriteString(EnvPrefix)
+	for i, r := range s.key {
+		switch {
+		case r == '.':
+			b.WriteByte('_')
+		case r >= 'A' && r <= 'Z':
+			if i > 0 && s.key[i-1] != '.' && !(s.key[i-1] >= 'A' && s.key[i-1] <= 'Z') {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteString(strings.ToUpper(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// Load builds the configuration from, in increasing order of precedence: the defaults, a YAML file, environment variables and command line flags.
+// The file is given by the -config flag or the KVDB_CONFIG environment variable. Unknown settings in the file are an error.
+// Returns flag.ErrHelp if -help was given. The returned configuration has been validated.
+func Load(name string, args []string, lookupEnv func(string) (string, bool), output io.Writer) (Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	defaults := Default()
+	path := fs.String("config", "", "YAML file to read settings from; may also be given by "+EnvPrefix+"CONFIG")
+	flags := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		field := s.field(&defaults)
+		_, isBool := field.(*bool)
+		fs.Var(&recorded{def: format(field), isBool: isBool}, s.flag, fmt.Sprintf("%s (%s, %s)", s.usage, s.key, s.env()))
+		flags[s.flag] = s
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	c := Default()
+
+	file := *path
+	if file == "" {
+		file, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if file != "" {
+		err = c.loadFile(file)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings {
+		v, ok := lookupEnv(s.env())
+		if !ok {
+			continue
+		}
+		err = parse(s.field(&c), v)
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %w", s.env(), err)
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		s, ok := flags[f.Name]
+		if ok && err == nil {
+			err = parse(s.field(&c), f.Value.(*recorded).value)
+			if err != nil {
+				err = fmt.Errorf("-%s: %w", f.Name, err)
+			}
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	return c, c.Validate()
+}
+
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	err = dec.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// recorded is a flag's value as given on the command line. It is parsed into the configuration once the file and environment have been applied.
+type recorded struct {
+	def    string
+	value  string
+	isBool bool
+}
+
+func (r *recorded) String() string {
+	if r == nil {
+		return ""
+	}
+	return r.def
+}
+
+func (r *recorded) Set(v string) error {
+	r.value = v
+	return nil
+}
+
+func (r *recorded) IsBoolFlag() bool {
+	return r.isBool
+}
+
+// parse sets the field that p points to from its text form.
+func parse(p interface{}, v string) error {
+	var err error
+	switch p := p.(type) {
+	case *string:
+		*p = v
+	case *bool:
+		*p, err = strconv.ParseBool(v)
+	case *int:
+		*p, err = strconv.Atoi(v)
+	case *int64:
+		*p, err = strconv.ParseInt(v, 10, 64)
+	case *time.Duration:
+		*p, err = time.ParseDuration(v)
+	case *List:
+		*p = splitList(v)
+	default:
+		err = fmt.Errorf("unsupported setting type %T", p)
+	}
+	return err
+}
+
+// format returns the text form of the field that p points to.
+func format(p interface{}) string {
+	switch p := p.(type) {
+	case *string:
+		return *p
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *int:
+		return strconv.Itoa(*p)
+	case *int64:
+		return strconv.FormatInt(*p, 10)
+	case *time.Duration:
+		return p.String()
+	case *List:
+		return p.String()
+	}
+	return ""
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := vars[k]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(contents), 0o600)
+	if err != nil {
+		t.Fatalf("writing config file: %s", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	file := writeFile(t, `
+http:
+  addr: ":9000"
+  shutdownTimeout: 30s
+limits:
+  maxKeys: 100
+  evictionPolicy: allkeys-lru
+sharding:
+  peers:
+    - n1=10.0.0.1:8080
+    - n2=10.0.0.2:8080
+features:
+  websocket: false
+`)
+
+	t.Run("defaults should be used with nothing set", func(t *testing.T) {
+		c, err := Load("kvdb", nil, env(nil), io.Discard)
+		if err != nil || !reflect.DeepEqual(c, Default()) {
+			t.Errorf("Load returned %+v, %v, expected the defaults", c, err)
+		}
+	})
+
+	t.Run("file should override the defaults", func(t *testing.T) {
+		c, err := Load("kvdb", []string{"-config", file}, env(nil), io.Discard)
+		if err != nil {
+			t.Fatalf("Load returned an error: %s", err)
+		}
+
+		if c.HTTP.Addr != ":9000" || c.HTTP.ShutdownTimeout != 30*time.Second || c.Limits.MaxKeys != 100 || c.Features.WebSocket {
+			t.Errorf("Load returned %+v", c)
+		}
+		if !reflect.DeepEqual(c.Sharding.Peers, List{"n1=10.0.0.1:8080", "n2=10.0.0.2:8080"}) {
+			t.Errorf("sharding.peers is %v", c.Sharding.Peers)
+		}
+		//Settings not in the file keep their defaults.
+		if c.Storage.Dir != "data" || !c.Features.Watch {
+			t.Errorf("Load returned %+v, expected defaults for settings not in the file", c)
+		}
+	})
+
+	t.Run("environment should override the file, and flags the environment", func(t *testing.T) {
+		vars := map[string]string{
+			"KVDB_CONFIG":                 file,
+			"KVDB_HTTP_ADDR":              ":9001",
+			"KVDB_HTTP_SHUTDOWN_TIMEOUT":  "1m",
+			"KVDB_LIMITS_EVICTION_POLICY": "allkeys-lfu",
+			"KVDB_FEATURES_WEBSOCKET":     "true",
+			"KVDB_RAFT_PEERS":             "n1=a:7000@a:8080, n2=b:7000@b:8080",
+		}
+		c, err := Load("kvdb", []string{"-http-addr", ":9002", "-enable-websocket=false", "-max-keys", "5"}, env(vars), io.Discard)
+		if err != nil {
+			t.Fatalf("Load returned an error: %s", err)
+		}
+
+		if c.HTTP.Addr != ":9002" || c.HTTP.ShutdownTimeout != time.Minute || c.Limits.EvictionPolicy != "allkeys-lfu" || c.Limits.MaxKeys != 5 || c.Features.WebSocket {
+			t.Errorf("Load returned %+v", c)
+		}
+		if !reflect.DeepEqual(c.Raft.Peers, List{"n1=a:7000@a:8080", "n2=b:7000@b:8080"}) {
+			t.Errorf("raft.peers is %v", c.Raft.Peers)
+		}
+	})
+
+	t.Run("bool flags should not need a value", func(t *testing.T) {
+		c, err := Load("kvdb", []string{"-raft-redirect"}, env(nil), io.Discard)
+		if err != nil || !c.Raft.Redirect {
+			t.Errorf("Load returned %+v, %v, expected raft.redirect", c.Raft, err)
+		}
+	})
+
+	errorCases := []struct {
+		name     string
+		args     []string
+		vars     map[string]string
+		expected string
+	}{
+		{name: "unknown setting in the file should be rejected", args: []string{"-config", writeFile(t, "http:\n  adr: :9000\n")}, expected: "field adr not found"},
+		{name: "missing file should be rejected", args: []string{"-config", "/does/not/exist.yaml"}, expected: "reading config file"},
+		{name: "malformed environment variable should be rejected", vars: map[string]string{"KVDB_LIMITS_MAX_KEYS": "many"}, expected: "KVDB_LIMITS_MAX_KEYS"},
+		{name: "malformed flag should be rejected", args: []string{"-shutdown-timeout", "soon"}, expected: "-shutdown-timeout"},
+		{name: "invalid result should be rejected", args: []string{"-eviction-policy", "most-recent"}, expected: "limits.evictionPolicy"},
+		{name: "unexpected arguments should be rejected", args: []string{"serve"}, expected: "unexpected argument"},
+	}
+
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load("kvdb", tc.args, env(tc.vars), io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Load returned %v, expected an error containing %q", err, tc.expected)
+			}
+		})
+	}
+
+	t.Run("help should return ErrHelp", func(t *testing.T) {
+		_, err := Load("kvdb", []string{"-help"}, env(nil), io.Discard)
+		if !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("Load returned %v, expected flag.ErrHelp", err)
+		}
+	})
+}
+
+func TestSettingEnv(t *testing.T) {
+	tt := []struct {
+		key      string
+		expected string
+	}{
+		{key: "http.addr", expected: "KVDB_HTTP_ADDR"},
+		{key: "http.readHeaderTimeout", expected: "KVDB_HTTP_READ_HEADER_TIMEOUT"},
+		{key: "replication.replicaOf", expected: "KVDB_REPLICATION_REPLICA_OF"},
+		{key: "tls.clientCA", expected: "KVDB_TLS_CLIENT_CA"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.key, func(t *testing.T) {
+			if got := (setting{key: tc.key}).env(); got != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+
+	t.Run("every setting should have a unique flag and environment variable", func(t *testing.T) {
+		flags := make(map[string]bool)
+		vars := make(map[string]bool)
+		for _, s := range settings {
+			if flags[s.flag] || vars[s.env()] {
+				t.Errorf("%s reuses a flag or environment variable", s.key)
+			}
+			flags[s.flag], vars[s.env()] = true, true
+		}
+	})
+}
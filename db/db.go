@@ -2,84 +2,386 @@ package db
 
 import (
 	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Database is an in-memory key-value store, partitioned into hash shards that each have their own lock
+// so that writes to one shard do not stall readers of another.
 type Database struct {
-	Data map[string]interface{}
-	lock sync.RWMutex
+	shards []*shard
+	mask   uint32
+
+	//Guards revision and the write-ahead log, so that revisions are handed out in the order records are logged.
+	seqLock  sync.Mutex
+	revision uint64
+	wal      *wal
+
+	clock func() time.Time
+
+	//Given to keys set without a TTL. 0 means they do not expire.
+	defaultTTL time.Duration
+
+	//Whether the reaper removes expired keys without committing the removals.
+	localExpiry bool
+
+	maxBytes  int64
+	maxKeys   int64
+	policy    EvictionPolicy
+	quotas    []*quota
+	evictions atomic.Uint64
+	expired   atomic.Uint64
+
+	//Room taken by writes that are under way, so that concurrent writers cannot each take the same room.
+	reserveLock sync.Mutex
+	reserved    usage
+
+	metrics Metrics
+	logger  *slog.Logger
+
+	watches *watchHub
+
+	snapshotLock sync.Mutex
+
+	done chan struct{}
+	wg   sync.WaitGroup
 }
 
 type IDatabase interface {
 	GetAllKeys() ([]string, error)
+	Scan(opts ScanOptions) (ScanPage, error)
 	Get(key string) (interface{}, error)
 	Set(key string, value interface{}) error
+	SetWithTTL(key string, value interface{}, ttl time.Duration) error
 	Delete(key string) error
+
+	GetWithVersion(key string) (interface{}, uint64, error)
+	CompareAndSet(key string, expected uint64, value interface{}, ttl time.Duration) (uint64, error)
+	CompareAndDelete(key string, expected uint64) error
 }
 
-func NewDatabase() *Database {
-	return &Database{
-		Data: make(map[string]interface{}),
+// Option configures optional behaviour of a Database.
+type Option func(*options)
+
+type options struct {
+	wal              *WALConfig
+	snapshotInterval time.Duration
+	expiryInterval   time.Duration
+	defaultTTL       time.Duration
+	localExpiry      bool
+	shards           int
+	maxBytes         int64
+	maxKeys          int64
+	policy           EvictionPolicy
+	quotas           []Quota
+	watchHistory     int
+	metrics          Metrics
+	logger           *slog.Logger
+}
+
+// WithWAL makes every Set and Delete durable by recording it in a write-ahead log before it is applied.
+// The latest snapshot and the log in cfg.Dir are replayed when the database is created.
+func WithWAL(cfg WALConfig) Option {
+	return func(o *options) {
+		o.wal = &cfg
+	}
+}
+
+// WithLogger logs errors in background work, such as evicting keys or syncing the write-ahead log, to logger instead of slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
 	}
 }
 
+func NewDatabase(opts ...Option) (*Database, error) {
+	o := options{
+		expiryInterval: defaultExpiryInterval,
+		shards:         defaultShards,
+		policy:         EvictNone,
+		watchHistory:   defaultWatchHistory,
+		logger:         slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	_, err := ParseEvictionPolicy(string(o.policy))
+	if err != nil {
+		return nil, err
+	}
+
+	n := shardCount(o.shards)
+	d := &Database{
+		shards:      make([]*shard, n),
+		mask:        uint32(n - 1),
+		clock:       time.Now,
+		defaultTTL:  o.defaultTTL,
+		localExpiry: o.localExpiry,
+		maxBytes:    o.maxBytes,
+		maxKeys:     o.maxKeys,
+		policy:      o.policy,
+		metrics:     o.metrics,
+		logger:      o.logger,
+		done:        make(chan struct{}),
+	}
+	for _, q := range o.quotas {
+		d.quotas = append(d.quotas, &quota{Quota: q})
+	}
+	for i := range d.shards {
+		d.shards[i] = newShard(i)
+		d.shards[i].quotas = d.quotas
+	}
+
+	if o.wal != nil {
+		w, err := openWAL(*o.wal, o.logger)
+		if err != nil {
+			return nil, err
+		}
+
+		seq, err := loadLatestSnapshot(o.wal.Dir, d.restore)
+		if err != nil {
+			return nil, fmt.Errorf("loading snapshot: %w", err)
+		}
+
+		err = w.replay(seq, d.restore)
+		if err != nil {
+			if w.file != nil {
+				_ = w.file.Close()
+			}
+			return nil, fmt.Errorf("replaying wal: %w", err)
+		}
+		d.wal = w
+
+		if o.snapshotInterval > 0 {
+			d.wg.Add(1)
+			go d.snapshotLoop(o.snapshotInterval)
+		}
+	}
+
+	d.watches = newWatchHub(max(o.watchHistory, 0), d.revision)
+
+	d.wg.Add(1)
+	go d.reapLoop(o.expiryInterval)
+
+	return d, nil
+}
+
+// Close stops background work, then flushes and releases any persistence resources held by the database.
+func (d *Database) Close() error {
+	if d.done != nil {
+		select {
+		case <-d.done:
+		default:
+			close(d.done)
+		}
+	}
+	d.wg.Wait()
+
+	if d.watches != nil {
+		d.watches.close()
+	}
+
+	d.seqLock.Lock()
+	defer d.seqLock.Unlock()
+
+	if d.wal == nil {
+		return nil
+	}
+
+	err := d.wal.close()
+	d.wal = nil
+	return err
+}
+
 func initCheck(d *Database) error {
-	if d.Data == nil {
+	if d.shards == nil {
 		return errors.New("database is not initialized")
 	}
 	return nil
 }
 
-func (d *Database) GetAllKeys() ([]string, error) {
-	d.lock.RLock()
-	defer d.lock.RUnlock()
+// Ready reports why the database cannot serve requests, or nil if it can: it must have been created by NewDatabase, which replays any
+// persisted state before returning, and not yet be closed.
+func (d *Database) Ready() error {
+	if err := initCheck(d); err != nil {
+		return err
+	}
 
+	select {
+	case <-d.done:
+		return errors.New("database is closed")
+	default:
+		return nil
+	}
+}
+
+// GetAllKeys returns every live key, in no particular order.
+// Shards are read one at a time, so the result is not a point-in-time snapshot of the whole database:
+// a key that exists for the entire call is always included, but one set or deleted concurrently may or may not be.
+// Use Txn where several keys must be read consistently.
+func (d *Database) GetAllKeys() (_ []string, err error) {
+	defer d.observe(OpList, &err)
 	out := make([]string, 0)
 
 	if err := initCheck(d); err != nil {
 		return nil, err
 	}
 
-	for k, _ := range d.Data {
-		out = append(out, k)
+	now := d.now()
+	for _, s := range d.shards {
+		d.rlock(s, OpList)
+		for k, e := range s.entries {
+			if e.expired(now) {
+				continue
+			}
+			out = append(out, k)
+		}
+		s.lock.RUnlock()
 	}
 
 	return out, nil
 }
 
-func (d *Database) Get(key string) (interface{}, error) {
-	d.lock.RLock()
-	defer d.lock.RUnlock()
+func (d *Database) Get(key string) (_ interface{}, err error) {
+	defer d.observe(OpGet, &err)
 
 	if err := initCheck(d); err != nil {
 		return nil, err
 	}
 
-	return d.Data[key], nil
+	s := d.shardFor(key)
+	d.rlock(s, OpGet)
+	defer s.lock.RUnlock()
+
+	now := d.now()
+	e := s.get(key, now)
+	if e == nil {
+		return nil, nil
+	}
+	d.touch(e, now)
+
+	return e.value, nil
 }
 
+// Set stores value under key with no expiry, clearing any TTL the key previously had.
+// If the database has a default TTL, the key expires after it instead.
 func (d *Database) Set(key string, value interface{}) error {
-	d.lock.Lock()
-	defer d.lock.Unlock()
+	return d.set(key, value, d.expiry(d.now(), 0))
+}
+
+func (d *Database) set(key string, value interface{}, expiresAt time.Time) (err error) {
+	defer d.observe(OpSet, &err)
 
 	if err := initCheck(d); err != nil {
 		return err
 	}
 
-	d.Data[key] = value
+	s := d.shardFor(key)
+	d.lock(s, OpSet)
+	defer s.lock.Unlock()
 
-	return nil
+	rec := setRecord(key, value, expiresAt)
+	release, err := d.admit([]walRecord{rec}, []string{key})
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = d.commit(rec)
+	return err
 }
 
-func (d *Database) Delete(key string) error {
-	d.lock.Lock()
-	defer d.lock.Unlock()
+func setRecord(key string, value interface{}, expiresAt time.Time) walRecord {
+	rec := walRecord{Op: walOpSet, Key: key, Value: value}
+	if !expiresAt.IsZero() {
+		rec.ExpiresAt = expiresAt.UnixNano()
+	}
+	return rec
+}
+
+func (d *Database) Delete(key string) (err error) {
+	defer d.observe(OpDelete, &err)
 
 	if err := initCheck(d); err != nil {
 		return err
 	}
 
-	delete(d.Data, key)
+	s := d.shardFor(key)
+	d.lock(s, OpDelete)
+	defer s.lock.Unlock()
+
+	_, err = d.commit(walRecord{Op: walOpDelete, Key: key})
+	return err
+}
+
+// commit assigns rec the next revision, records it in the write-ahead log if one is configured, publishes it to watchers, then applies it.
+// Must be called with the write lock held on every shard rec touches.
+func (d *Database) commit(rec walRecord) (uint64, error) {
+	d.seqLock.Lock()
+	rec.Rev = d.revision + 1
+
+	err := d.log(rec)
+	d.seqLock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	d.apply(rec)
+
+	return rec.Rev, nil
+}
+
+// log records rec in the write-ahead log if one is configured, advances the revision to rec's, and publishes it to watchers.
+// Must be called with the sequence lock held, and the write lock held on every shard rec touches.
+func (d *Database) log(rec walRecord) error {
+	if d.wal != nil {
+		err := d.wal.append(rec)
+		if err != nil {
+			return err
+		}
+	}
+
+	d.revision = rec.Rev
+
+	//Publishing under the sequence lock keeps events in revision order.
+	if d.watches != nil {
+		d.watches.publish(rec.Rev, d.events(rec, d.now()))
+	}
 
 	return nil
 }
+
+// Revision returns the revision of the last write.
+func (d *Database) Revision() uint64 {
+	d.seqLock.Lock()
+	defer d.seqLock.Unlock()
+
+	return d.revision
+}
+
+// apply applies a logged mutation to the shards it touches. Must be called with their write locks held, or before the database is shared.
+func (d *Database) apply(rec walRecord) {
+	switch rec.Op {
+	case walOpSet:
+		d.shardFor(rec.Key).set(rec, d.now())
+	case walOpDelete, walOpExpire:
+		d.shardFor(rec.Key).remove(rec.Key)
+	case walOpTxn:
+		for _, op := range rec.Ops {
+			op.Rev = rec.Rev
+			d.apply(op)
+		}
+	}
+}
+
+// restore applies a record read back from a snapshot or the log while the database is being opened.
+func (d *Database) restore(rec walRecord) {
+	if rec.Rev > d.revision {
+		d.revision = rec.Rev
+	}
+	d.apply(rec)
+}
@@ -1,9 +1,58 @@
 package db
 
-import "testing"
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestDatabase returns a database holding data, or an uninitialized one if data is nil.
+func newTestDatabase(t testing.TB, data map[string]interface{}) *Database {
+	if data == nil {
+		return &Database{}
+	}
+
+	db, _ := NewDatabase()
+	t.Cleanup(func() { _ = db.Close() })
+	for k, v := range data {
+		_ = db.Set(k, v)
+	}
+	return db
+}
+
+// contents returns every entry held by db's shards, including expired ones that have not been reaped.
+func contents(db *Database) map[string]interface{} {
+	out := make(map[string]interface{})
+	for _, s := range db.shards {
+		s.lock.RLock()
+		for k, e := range s.entries {
+			out[k] = e.value
+		}
+		s.lock.RUnlock()
+	}
+	return out
+}
+
+// expiriesOf returns the expiry time of every key with a TTL.
+func expiriesOf(db *Database) map[string]time.Time {
+	out := make(map[string]time.Time)
+	for _, s := range db.shards {
+		s.lock.RLock()
+		for k := range s.volatile {
+			out[k] = time.Unix(0, s.entries[k].expiresAt)
+		}
+		s.lock.RUnlock()
+	}
+	return out
+}
 
 func TestNewDatabase(t *testing.T) {
-	db := NewDatabase()
+	db, err := NewDatabase()
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
 
 	t.Run("NewDatabase should return a non-nil database", func(t *testing.T) {
 		if db == nil {
@@ -12,22 +61,36 @@ func TestNewDatabase(t *testing.T) {
 		return
 	})
 
-	t.Run("NewDatabase should return a database with an empty non-nil Data map", func(t *testing.T) {
-		if db.Data == nil {
-			t.Error("NewDatabase returned a database with a nil Data map")
+	t.Run("NewDatabase should return a database with empty non-nil shards", func(t *testing.T) {
+		if len(db.shards) != defaultShards {
+			t.Errorf("NewDatabase returned a database with %d shards, expected %d", len(db.shards), defaultShards)
+		}
+
+		for _, s := range db.shards {
+			if s == nil || s.entries == nil {
+				t.Fatal("NewDatabase returned a database with an uninitialized shard")
+			}
 		}
 
-		if len(db.Data) != 0 {
-			t.Error("NewDatabase returned a database with a non-empty Data map")
+		if len(contents(db)) != 0 {
+			t.Error("NewDatabase returned a non-empty database")
 		}
 		return
 	})
+
+	t.Run("WithShards should round up to a power of two", func(t *testing.T) {
+		db, _ := NewDatabase(WithShards(5))
+		t.Cleanup(func() { _ = db.Close() })
+		if len(db.shards) != 8 {
+			t.Errorf("NewDatabase returned a database with %d shards, expected 8", len(db.shards))
+		}
+	})
 }
 
 func TestInitCheck(t *testing.T) {
-	db := NewDatabase()
-	db.Data = make(map[string]interface{})
-	t.Run("initCheck should return nil if Data is not nil", func(t *testing.T) {
+	db, _ := NewDatabase()
+	t.Cleanup(func() { _ = db.Close() })
+	t.Run("initCheck should return nil if shards are not nil", func(t *testing.T) {
 		err := initCheck(db)
 		if err != nil {
 			t.Errorf("initCheck returned an error: %s", err)
@@ -35,8 +98,8 @@ func TestInitCheck(t *testing.T) {
 		return
 	})
 
-	t.Run("initCheck should return an error if Data is nil", func(t *testing.T) {
-		db.Data = nil
+	t.Run("initCheck should return an error if shards are nil", func(t *testing.T) {
+		db.shards = nil
 		err := initCheck(db)
 		if err == nil {
 			t.Error("initCheck did not return an error")
@@ -45,6 +108,30 @@ func TestInitCheck(t *testing.T) {
 	})
 }
 
+func TestReady(t *testing.T) {
+	tt := []struct {
+		name     string
+		database func() *Database
+		ready    bool
+	}{
+		{name: "open database should be ready", database: func() *Database { d, _ := NewDatabase(); return d }, ready: true},
+		{name: "uninitialised database should not be ready", database: func() *Database { return &Database{} }},
+		{name: "closed database should not be ready", database: func() *Database { d, _ := NewDatabase(); _ = d.Close(); return d }},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			d := tc.database()
+			defer d.Close()
+
+			err := d.Ready()
+			if (err == nil) != tc.ready {
+				t.Errorf("Ready returned %v", err)
+			}
+		})
+	}
+}
+
 func TestGetAllKeys(t *testing.T) {
 	tt := []struct {
 		name      string
@@ -86,8 +173,7 @@ func TestGetAllKeys(t *testing.T) {
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			db := NewDatabase()
-			db.Data = tc.data
+			db := newTestDatabase(t, tc.data)
 
 			keys, err := db.GetAllKeys()
 			if err != nil {
@@ -119,12 +205,11 @@ func TestGetAllKeys(t *testing.T) {
 
 func BenchmarkDatabase_GetAllKeys(b *testing.B) {
 
-	db := NewDatabase()
-	db.Data = map[string]interface{}{
+	db := newTestDatabase(b, map[string]interface{}{
 		"key1": "value1",
 		"key2": "value2",
 		"key3": "value3",
-	}
+	})
 
 	// run the Fib function b.N times
 	for n := 0; n < b.N; n++ {
@@ -198,8 +283,7 @@ func TestGet(t *testing.T) {
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			db := NewDatabase()
-			db.Data = tc.data
+			db := newTestDatabase(t, tc.data)
 
 			value, err := db.Get(tc.key)
 			if err != nil {
@@ -218,12 +302,11 @@ func TestGet(t *testing.T) {
 
 func BenchmarkDatabase_Get(b *testing.B) {
 
-	db := NewDatabase()
-	db.Data = map[string]interface{}{
+	db := newTestDatabase(b, map[string]interface{}{
 		"key1": "value1",
 		"key2": "value2",
 		"key3": "value3",
-	}
+	})
 
 	// run the Fib function b.N times
 	for n := 0; n < b.N; n++ {
@@ -305,8 +388,7 @@ func TestSet(t *testing.T) {
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			db := NewDatabase()
-			db.Data = tc.data
+			db := newTestDatabase(t, tc.data)
 
 			err := db.Set(tc.key, tc.value)
 			if err != nil {
@@ -316,8 +398,9 @@ func TestSet(t *testing.T) {
 				return
 			}
 
+			data := contents(db)
 			for k, v := range tc.expected {
-				if db.Data[k] != v {
+				if data[k] != v {
 					t.Errorf("Set did not set key correctly: %s", k)
 				}
 			}
@@ -327,12 +410,11 @@ func TestSet(t *testing.T) {
 
 func BenchmarkDatabase_Set(b *testing.B) {
 
-	db := NewDatabase()
-	db.Data = map[string]interface{}{
+	db := newTestDatabase(b, map[string]interface{}{
 		"key1": "value1",
 		"key2": "value2",
 		"key3": "value3",
-	}
+	})
 
 	// run the Fib function b.N times
 	for n := 0; n < b.N; n++ {
@@ -393,8 +475,7 @@ func TestDelete(t *testing.T) {
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			db := NewDatabase()
-			db.Data = tc.data
+			db := newTestDatabase(t, tc.data)
 
 			err := db.Delete(tc.key)
 			if err != nil {
@@ -404,8 +485,9 @@ func TestDelete(t *testing.T) {
 				return
 			}
 
+			data := contents(db)
 			for k, v := range tc.expected {
-				if db.Data[k] != v {
+				if data[k] != v {
 					t.Errorf("Delete did not delete key correctly: %s", k)
 				}
 			}
@@ -415,15 +497,64 @@ func TestDelete(t *testing.T) {
 }
 
 func BenchmarkDatabase_Delete(b *testing.B) {
-	db := NewDatabase()
-	db.Data = map[string]interface{}{
+	db := newTestDatabase(b, map[string]interface{}{
 		"key1": "value1",
 		"key2": "value2",
 		"key3": "value3",
-	}
+	})
 
 	// run the Fib function b.N times
 	for n := 0; n < b.N; n++ {
 		_ = db.Delete("key2")
 	}
 }
+
+// benchmarkParallel runs op from GOMAXPROCS goroutines against a single shard and against the default shard count,
+// showing how much of the contention the shards remove.
+func benchmarkParallel(b *testing.B, op func(db *Database, key string, i int)) {
+	for _, shards := range []int{1, defaultShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			db, _ := NewDatabase(WithShards(shards))
+			defer db.Close()
+
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key%d", i)
+				_ = db.Set(keys[i], "value")
+			}
+
+			var offset int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(atomic.AddInt64(&offset, 97))
+				for pb.Next() {
+					op(db, keys[i%len(keys)], i)
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkDatabase_GetParallel(b *testing.B) {
+	benchmarkParallel(b, func(db *Database, key string, i int) {
+		_, _ = db.Get(key)
+	})
+}
+
+func BenchmarkDatabase_SetParallel(b *testing.B) {
+	benchmarkParallel(b, func(db *Database, key string, i int) {
+		_ = db.Set(key, "value")
+	})
+}
+
+func BenchmarkDatabase_MixedParallel(b *testing.B) {
+	//One write for every nine reads.
+	benchmarkParallel(b, func(db *Database, key string, i int) {
+		if i%10 == 0 {
+			_ = db.Set(key, "value")
+			return
+		}
+		_, _ = db.Get(key)
+	})
+}
@@ -0,0 +1,414 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// EvictionPolicy decides which keys are removed when the database reaches its memory or key limit.
+type EvictionPolicy string
+
+const (
+	// EvictNone rejects writes with ErrOutOfMemory once the limit is reached.
+	EvictNone EvictionPolicy = "noeviction"
+	// EvictLRU removes the least recently used key.
+	EvictLRU EvictionPolicy = "allkeys-lru"
+	// EvictLFU removes the least frequently used key.
+	EvictLFU EvictionPolicy = "allkeys-lfu"
+	// EvictRandom removes a random key.
+	EvictRandom EvictionPolicy = "allkeys-random"
+	// EvictVolatileTTL removes the key with a TTL that is closest to expiring, and rejects writes if no key has a TTL.
+	EvictVolatileTTL EvictionPolicy = "volatile-ttl"
+)
+
+const (
+	//Candidates compared per eviction, as with Redis' approximated LRU.
+	evictionSamples = 16
+
+	//Per shard, so that candidates come from more than one shard.
+	evictionSamplesPerShard = 5
+
+	maxEvictionAttempts = 64
+
+	//Rough per-key overhead of the map slot, entry and index node.
+	entryOverhead = 96
+)
+
+// ErrOutOfMemory is returned by writes that would take the database over its limits when nothing can be evicted.
+var ErrOutOfMemory = errors.New("database is at its memory limit")
+
+// ParseEvictionPolicy returns the policy with the given name.
+func ParseEvictionPolicy(s string) (EvictionPolicy, error) {
+	switch p := EvictionPolicy(s); p {
+	case EvictNone, EvictLRU, EvictLFU, EvictRandom, EvictVolatileTTL:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown eviction policy %q", s)
+}
+
+// WithMaxBytes limits the approximate memory used by keys and values. 0 means unlimited.
+func WithMaxBytes(n int64) Option {
+	return func(o *options) {
+		o.maxBytes = n
+	}
+}
+
+// WithMaxKeys limits the number of keys. 0 means unlimited.
+func WithMaxKeys(n int64) Option {
+	return func(o *options) {
+		o.maxKeys = n
+	}
+}
+
+// WithEvictionPolicy sets how room is made once a limit is reached. Defaults to EvictNone.
+func WithEvictionPolicy(p EvictionPolicy) Option {
+	return func(o *options) {
+		o.policy = p
+	}
+}
+
+// Stats reports the size of the database against its limits.
+type Stats struct {
+	Keys      int64          `json:"keys"`
+	Bytes     int64          `json:"bytes"`
+	MaxKeys   int64          `json:"maxKeys"`
+	MaxBytes  int64          `json:"maxBytes"`
+	Policy    EvictionPolicy `json:"policy"`
+	Evictions uint64         `json:"evictions"`
+
+	//Keys removed by the background reaper once their TTL had passed.
+	Expired uint64 `json:"expired"`
+
+	Quotas []QuotaUsage `json:"quotas,omitempty"`
+}
+
+// IStats is implemented by databases that report their size and eviction counts.
+type IStats interface {
+	Stats() Stats
+}
+
+// Stats returns the current key count, approximate memory use, and eviction and expiry counts. Keys that have expired but not yet been reaped are included.
+func (d *Database) Stats() Stats {
+	st := Stats{
+		MaxKeys:   d.maxKeys,
+		MaxBytes:  d.maxBytes,
+		Policy:    d.policy,
+		Evictions: d.evictions.Load(),
+		Expired:   d.expired.Load(),
+	}
+
+	for _, s := range d.shards {
+		st.Keys += s.keys.Load()
+		st.Bytes += s.bytes.Load()
+	}
+	if len(d.quotas) > 0 {
+		st.Quotas = d.Quotas()
+	}
+
+	return st
+}
+
+// trackAccess reports whether reads need to record recency and frequency for the eviction policy.
+func (d *Database) trackAccess() bool {
+	return d.policy == EvictLRU || d.policy == EvictLFU
+}
+
+// touch records a read of e for LRU and LFU eviction. Safe under a read lock.
+func (d *Database) touch(e *entry, now time.Time) {
+	if !d.trackAccess() {
+		return
+	}
+
+	e.lastAccess.Store(now.UnixNano())
+	if hits := e.hits.Load(); hits < ^uint32(0) {
+		e.hits.CompareAndSwap(hits, hits+1)
+	}
+}
+
+// usage is an amount of keys and memory.
+type usage struct {
+	keys  int64
+	bytes int64
+}
+
+// growth is how much a write adds to the keys and memory used, which may be negative: in all, and under each of the database's quotas.
+type growth struct {
+	usage
+	quotas []usage
+
+	//The first key the write adds to under each quota, for a QuotaError.
+	quotaKeys []string
+}
+
+// admit makes room for writes, a write's sets and deletes in order, evicting other keys according to the policy, and reserves it until the
+// returned function is called once the write has been applied or abandoned. Writes that would exceed a quota are rejected without evicting.
+// Must be called with the write lock held on the shard of every key in locked, the keys the write reads or writes. Reserving room under
+// the locks, where the keys' sizes cannot change, keeps the limits hard: concurrent writers can never take the same room.
+func (d *Database) admit(writes []walRecord, locked []string) (func(), error) {
+	if d.maxBytes == 0 && d.maxKeys == 0 && len(d.quotas) == 0 {
+		return func() {}, nil
+	}
+
+	grow, err := d.growth(writes)
+	if err != nil {
+		return nil, err
+	}
+
+	//Keys the write reads are kept too, so that what it read is still there when it commits.
+	keep := make(map[string]bool, len(locked))
+	held := make(map[*shard]bool, len(locked))
+	for _, k := range locked {
+		keep[k] = true
+		held[d.shardFor(k)] = true
+	}
+
+	d.reserveLock.Lock()
+	defer d.reserveLock.Unlock()
+
+	err = d.checkQuotas(grow)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; d.overLimit(grow.usage); attempt++ {
+		if d.policy == EvictNone || attempt == maxEvictionAttempts {
+			return nil, ErrOutOfMemory
+		}
+
+		if !d.evictOne(keep, held) {
+			return nil, ErrOutOfMemory
+		}
+	}
+
+	d.reserve(grow, 1)
+	return func() {
+		d.reserveLock.Lock()
+		defer d.reserveLock.Unlock()
+
+		d.reserve(grow, -1)
+	}, nil
+}
+
+// growth works out how much applying writes would add. Must be called with the write lock held on the shard of every key written.
+func (d *Database) growth(writes []walRecord) (growth, error) {
+	g := growth{quotas: make([]usage, len(d.quotas)), quotaKeys: make([]string, len(d.quotas))}
+
+	//The size of each key written so far, or -1 once it is absent, including keys that have expired but not been reaped.
+	sizes := make(map[string]int64, len(writes))
+	for _, w := range writes {
+		before, ok := sizes[w.Key]
+		if !ok {
+			before = -1
+			if e, ok := d.shardFor(w.Key).entries[w.Key]; ok {
+				before = e.size
+			}
+		}
+
+		after := int64(-1)
+		if w.Op == walOpSet {
+			after = entrySize(w.Key, w.Value)
+			if d.maxBytes > 0 && after > d.maxBytes {
+				return growth{}, ErrOutOfMemory
+			}
+		}
+		sizes[w.Key] = after
+
+		g.add(d.quotas, w.Key, usage{keys: present(after) - present(before), bytes: max(after, 0) - max(before, 0)})
+	}
+
+	return g, nil
+}
+
+// add adds grow, the growth of key, to the total and to every quota covering it.
+func (g *growth) add(quotas []*quota, key string, grow usage) {
+	g.keys += grow.keys
+	g.bytes += grow.bytes
+
+	for i, q := range quotas {
+		if !strings.HasPrefix(key, q.Prefix) {
+			continue
+		}
+		g.quotas[i].keys += grow.keys
+		g.quotas[i].bytes += grow.bytes
+		if g.quotaKeys[i] == "" && (grow.keys > 0 || grow.bytes > 0) {
+			g.quotaKeys[i] = key
+		}
+	}
+}
+
+func present(size int64) int64 {
+	if size < 0 {
+		return 0
+	}
+	return 1
+}
+
+// reserve adds the room grow takes, in every limit it adds to, to the room reserved, or with a sign of -1 gives it back.
+// Must be called with the reservation lock held.
+func (d *Database) reserve(grow growth, sign int64) {
+	d.reserved.keys += sign * max(grow.keys, 0)
+	d.reserved.bytes += sign * max(grow.bytes, 0)
+
+	for i, q := range d.quotas {
+		q.reserved.keys += sign * max(grow.quotas[i].keys, 0)
+		q.reserved.bytes += sign * max(grow.quotas[i].bytes, 0)
+	}
+}
+
+// overLimit reports whether growing by grow would take the database over a limit that it adds to, counting the room reserved by other writes.
+// Must be called with the reservation lock held.
+func (d *Database) overLimit(grow usage) bool {
+	var used usage
+	for _, s := range d.shards {
+		used.keys += s.keys.Load()
+		used.bytes += s.bytes.Load()
+	}
+
+	return exceeds(used, d.reserved, grow, d.maxKeys, d.maxBytes)
+}
+
+// exceeds reports whether growing used and reserved usage by grow would go over either limit, where grow adds to it. A limit of 0 is unlimited.
+func exceeds(used usage, reserved usage, grow usage, maxKeys int64, maxBytes int64) bool {
+	if maxKeys > 0 && grow.keys > 0 && used.keys+reserved.keys+grow.keys > maxKeys {
+		return true
+	}
+	return maxBytes > 0 && grow.bytes > 0 && used.bytes+reserved.bytes+grow.bytes > maxBytes
+}
+
+type evictionCandidate struct {
+	shard   *shard
+	key     string
+	version uint64
+	score   int64
+}
+
+// evictOne samples keys from a few shards and removes the best candidate not in keep under the policy, logging the removal like a delete.
+// It returns false if there was nothing that could be evicted.
+// The shards in held are already write-locked by the caller. Other shards are only locked if they are free, since the caller waiting for
+// them while holding its own could deadlock with another writer; one that is busy is skipped.
+func (d *Database) evictOne(keep map[string]bool, held map[*shard]bool) bool {
+	var best *evictionCandidate
+
+	start := rand.Intn(len(d.shards))
+	sampled := 0
+	for i := 0; i < len(d.shards) && sampled < evictionSamples; i++ {
+		s := d.shards[(start+i)%len(d.shards)]
+
+		if !held[s] && !s.lock.TryRLock() {
+			continue
+		}
+		var keys []string
+		if d.policy == EvictVolatileTTL {
+			keys = sampleKeys(s.volatile, evictionSamplesPerShard)
+		} else {
+			keys = sampleKeys(s.entries, evictionSamplesPerShard)
+		}
+
+		for _, k := range keys {
+			if keep[k] {
+				continue
+			}
+
+			e := s.entries[k]
+			c := evictionCandidate{shard: s, key: k, version: e.version, score: d.evictionScore(e)}
+			if best == nil || c.score < best.score {
+				best = &c
+			}
+		}
+		if !held[s] {
+			s.lock.RUnlock()
+		}
+
+		sampled += len(keys)
+	}
+
+	if best == nil {
+		return false
+	}
+
+	if !held[best.shard] {
+		//Locked by another writer since it was sampled, so leave it for the next attempt.
+		if !best.shard.lock.TryLock() {
+			return true
+		}
+		defer best.shard.lock.Unlock()
+	}
+
+	//Rewritten since it was sampled, so leave it for the next attempt.
+	if e, ok := best.shard.entries[best.key]; !ok || e.version != best.version {
+		return true
+	}
+
+	_, err := d.commit(walRecord{Op: walOpDelete, Key: best.key})
+	if err != nil {
+		d.logger.Error("evicting key", "key", best.key, "err", err)
+		return false
+	}
+	d.evictions.Add(1)
+
+	return true
+}
+
+// sampleKeys returns up to n keys of m, relying on Go's randomised map iteration order.
+func sampleKeys[V any](m map[string]V, n int) []string {
+	out := make([]string, 0, n)
+	for k := range m {
+		if len(out) == n {
+			break
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+// evictionScore ranks e for eviction under the policy; the lowest score is evicted first.
+func (d *Database) evictionScore(e *entry) int64 {
+	switch d.policy {
+	case EvictLRU:
+		return e.lastAccess.Load()
+	case EvictLFU:
+		return int64(e.hits.Load())
+	case EvictVolatileTTL:
+		return e.expiresAt
+	default:
+		return rand.Int63()
+	}
+}
+
+// entrySize approximates the memory held by a key and its value.
+func entrySize(key string, value interface{}) int64 {
+	return entryOverhead + int64(len(key)) + valueSize(value)
+}
+
+func valueSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case Blob:
+		return int64(len(v.ContentType) + len(v.Data))
+	case bool:
+		return 1
+	case map[string]interface{}:
+		size := int64(48)
+		for k, item := range v {
+			size += 16 + int64(len(k)) + valueSize(item)
+		}
+		return size
+	case []interface{}:
+		size := int64(24)
+		for _, item := range v {
+			size += 16 + valueSize(item)
+		}
+		return size
+	}
+
+	return int64(reflect.TypeOf(v).Size())
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newEvictionTestDatabase(t *testing.T, opts ...Option) (*Database, *fakeClock) {
+	//A single shard lets every sample see every key, so the tests are deterministic.
+	db, err := NewDatabase(append([]Option{WithShards(1), WithExpiryInterval(time.Hour)}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	c := &fakeClock{now: time.Unix(1000, 0)}
+	db.clock = c.Now
+	return db, c
+}
+
+func TestEviction(t *testing.T) {
+	tt := []struct {
+		name    string
+		policy  EvictionPolicy
+		prepare func(db *Database, c *fakeClock)
+		evicted string
+	}{
+		{
+			name:   "allkeys-lru should evict the least recently used key",
+			policy: EvictLRU,
+			prepare: func(db *Database, c *fakeClock) {
+				for _, k := range []string{"a", "b", "c"} {
+					_ = db.Set(k, "value")
+					c.now = c.now.Add(time.Second)
+				}
+				_, _ = db.Get("a")
+			},
+			evicted: "b",
+		},
+		{
+			name:   "allkeys-lfu should evict the least frequently used key",
+			policy: EvictLFU,
+			prepare: func(db *Database, c *fakeClock) {
+				for _, k := range []string{"a", "b", "c"} {
+					_ = db.Set(k, "value")
+				}
+				_, _ = db.Get("a")
+				_, _ = db.Get("a")
+				_, _, _ = db.GetWithVersion("c")
+			},
+			evicted: "b",
+		},
+		{
+			name:   "volatile-ttl should evict the key closest to expiring",
+			policy: EvictVolatileTTL,
+			prepare: func(db *Database, c *fakeClock) {
+				_ = db.Set("a", "value")
+				_ = db.SetWithTTL("b", "value", 2*time.Minute)
+				_ = db.SetWithTTL("c", "value", time.Minute)
+			},
+			evicted: "c",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, c := newEvictionTestDatabase(t, WithMaxKeys(3), WithEvictionPolicy(tc.policy))
+			tc.prepare(db, c)
+
+			err := db.Set("d", "value")
+			if err != nil {
+				t.Fatalf("Set returned an error: %s", err)
+			}
+
+			if _, ok := contents(db)[tc.evicted]; ok {
+				t.Errorf("%s should have been evicted, have %v", tc.evicted, contents(db))
+			}
+
+			if len(contents(db)) != 3 {
+				t.Errorf("database has %d keys, expected 3", len(contents(db)))
+			}
+
+			if db.Stats().Evictions != 1 {
+				t.Errorf("Stats reported %d evictions, expected 1", db.Stats().Evictions)
+			}
+		})
+	}
+}
+
+func TestEvictionRandom(t *testing.T) {
+	db, _ := newEvictionTestDatabase(t, WithShards(4), WithMaxKeys(5), WithEvictionPolicy(EvictRandom))
+
+	for i := 0; i < 20; i++ {
+		err := db.Set("key"+strconv.Itoa(i), "value")
+		if err != nil {
+			t.Fatalf("Set returned an error: %s", err)
+		}
+	}
+
+	st := db.Stats()
+	if st.Keys != 5 || len(contents(db)) != 5 {
+		t.Errorf("database has %d keys, expected 5", st.Keys)
+	}
+
+	if st.Evictions != 15 {
+		t.Errorf("Stats reported %d evictions, expected 15", st.Evictions)
+	}
+
+	if contents(db)["key19"] != "value" {
+		t.Error("the key just written should not have been evicted")
+	}
+}
+
+func TestEvictionRejectsWrites(t *testing.T) {
+	t.Run("noeviction should reject new keys but allow overwrites", func(t *testing.T) {
+		db, _ := newEvictionTestDatabase(t, WithMaxKeys(2))
+
+		_ = db.Set("a", "value")
+		_ = db.Set("b", "value")
+
+		err := db.Set("c", "value")
+		if !errors.Is(err, ErrOutOfMemory) {
+			t.Errorf("Set returned %v, expected ErrOutOfMemory", err)
+		}
+
+		err = db.Set("a", "other")
+		if err != nil {
+			t.Errorf("overwriting a key returned an error: %s", err)
+		}
+
+		_, err = db.CompareAndSet("c", 0, "value", 0)
+		if !errors.Is(err, ErrOutOfMemory) {
+			t.Errorf("CompareAndSet returned %v, expected ErrOutOfMemory", err)
+		}
+
+		_, err = db.Txn([]TxnOp{{Type: TxnSet, Key: "c", Value: "value"}})
+		if !errors.Is(err, ErrOutOfMemory) {
+			t.Errorf("Txn returned %v, expected ErrOutOfMemory", err)
+		}
+
+		if db.Stats().Evictions != 0 {
+			t.Errorf("Stats reported %d evictions, expected 0", db.Stats().Evictions)
+		}
+	})
+
+	t.Run("transaction should be rejected if all of its sets together exceed the limit", func(t *testing.T) {
+		db, _ := newEvictionTestDatabase(t, WithMaxKeys(2))
+
+		ops := make([]TxnOp, 10)
+		for i := range ops {
+			ops[i] = TxnOp{Type: TxnSet, Key: "key" + strconv.Itoa(i), Value: "value"}
+		}
+
+		_, err := db.Txn(ops)
+		if !errors.Is(err, ErrOutOfMemory) {
+			t.Errorf("Txn returned %v, expected ErrOutOfMemory", err)
+		}
+		if st := db.Stats(); st.Keys != 0 {
+			t.Errorf("database has %d keys, expected 0", st.Keys)
+		}
+	})
+
+	t.Run("volatile-ttl should reject writes when no key has a ttl", func(t *testing.T) {
+		db, _ := newEvictionTestDatabase(t, WithMaxKeys(1), WithEvictionPolicy(EvictVolatileTTL))
+
+		_ = db.Set("a", "value")
+
+		err := db.Set("b", "value")
+		if !errors.Is(err, ErrOutOfMemory) {
+			t.Errorf("Set returned %v, expected ErrOutOfMemory", err)
+		}
+	})
+
+	t.Run("max bytes should reject a value that is too large", func(t *testing.T) {
+		db, _ := newEvictionTestDatabase(t, WithMaxBytes(entrySize("a", "value")), WithEvictionPolicy(EvictLRU))
+
+		err := db.Set("a", "value")
+		if err != nil {
+			t.Fatalf("Set returned an error: %s", err)
+		}
+
+		err = db.Set("a", "a longer value")
+		if !errors.Is(err, ErrOutOfMemory) {
+			t.Errorf("Set returned %v, expected ErrOutOfMemory", err)
+		}
+	})
+}
+
+func TestEvictionLimitsAreHard(t *testing.T) {
+	t.Run("concurrent writers should never exceed the limit", func(t *testing.T) {
+		db, _ := newEvictionTestDatabase(t, WithShards(8), WithMaxKeys(10))
+
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					_ = db.Set(strconv.Itoa(w)+"/"+strconv.Itoa(i), "value")
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		if st := db.Stats(); st.Keys != 10 {
+			t.Errorf("database has %d keys, expected 10", st.Keys)
+		}
+	})
+
+	t.Run("transaction should evict enough keys for all of its sets", func(t *testing.T) {
+		db, _ := newEvictionTestDatabase(t, WithMaxKeys(3), WithEvictionPolicy(EvictLRU))
+		for _, k := range []string{"a", "b", "c"} {
+			_ = db.Set(k, "value")
+		}
+
+		_, err := db.Txn([]TxnOp{{Type: TxnGet, Key: "a"}, {Type: TxnSet, Key: "d", Value: "value"}, {Type: TxnSet, Key: "e", Value: "value"}})
+		if err != nil {
+			t.Fatalf("Txn returned an error: %s", err)
+		}
+
+		got := contents(db)
+		if len(got) != 3 || got["a"] != "value" || got["d"] != "value" || got["e"] != "value" {
+			t.Errorf("database has %v, expected a, d and e", got)
+		}
+	})
+
+	t.Run("aborted transaction should not evict", func(t *testing.T) {
+		db, _ := newEvictionTestDatabase(t, WithMaxKeys(1), WithEvictionPolicy(EvictLRU))
+		_ = db.Set("a", "value")
+
+		stale := uint64(1000)
+		_, err := db.Txn([]TxnOp{{Type: TxnSet, Key: "b", Value: "value", IfVersion: &stale}})
+		if !errors.Is(err, ErrVersionMismatch) {
+			t.Fatalf("Txn returned %v, expected ErrVersionMismatch", err)
+		}
+
+		if _, ok := contents(db)["a"]; !ok || db.Stats().Evictions != 0 {
+			t.Errorf("a was evicted for an aborted transaction")
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	db, _ := newEvictionTestDatabase(t, WithMaxBytes(1<<20), WithEvictionPolicy(EvictLFU))
+
+	_ = db.Set("a", "value")
+	_ = db.Set("b", map[string]interface{}{"nested": "value"})
+	_ = db.Set("a", "a longer value")
+
+	st := db.Stats()
+	expectedBytes := entrySize("a", "a longer value") + entrySize("b", map[string]interface{}{"nested": "value"})
+	if st.Keys != 2 || st.Bytes != expectedBytes {
+		t.Errorf("Stats reported %d keys and %d bytes, expected 2 and %d", st.Keys, st.Bytes, expectedBytes)
+	}
+
+	if st.MaxBytes != 1<<20 || st.Policy != EvictLFU {
+		t.Errorf("Stats reported limits %d and %s", st.MaxBytes, st.Policy)
+	}
+
+	_ = db.Delete("a")
+	_ = db.Delete("b")
+
+	st = db.Stats()
+	if st.Keys != 0 || st.Bytes != 0 {
+		t.Errorf("Stats reported %d keys and %d bytes after deleting everything, expected 0", st.Keys, st.Bytes)
+	}
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	p, err := ParseEvictionPolicy("allkeys-lru")
+	if err != nil || p != EvictLRU {
+		t.Errorf("ParseEvictionPolicy returned %s, %v", p, err)
+	}
+
+	_, err = ParseEvictionPolicy("most-recent")
+	if err == nil {
+		t.Error("ParseEvictionPolicy did not return an error for an unknown policy")
+	}
+
+	_, err = NewDatabase(WithEvictionPolicy("most-recent"))
+	if err == nil {
+		t.Error("NewDatabase did not return an error for an unknown policy")
+	}
+}
@@ -0,0 +1,214 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultExpiryInterval = time.Second
+
+	//Keys checked per reaper pass, mirroring Redis' active expiry cycle.
+	reapSampleSize = 20
+)
+
+// ErrInvalidTTL is returned by SetWithTTL when the TTL is not positive.
+var ErrInvalidTTL = errors.New("ttl must be positive")
+
+// IExpirer is implemented by databases that can change and report the remaining lifetime of an existing key.
+type IExpirer interface {
+	Expire(key string, ttl time.Duration) (bool, error)
+	TTL(key string) (time.Duration, bool, error)
+}
+
+// WithExpiryInterval sets how often the background reaper looks for expired keys. Defaults to one second.
+func WithExpiryInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.expiryInterval = interval
+	}
+}
+
+// WithLocalExpiry removes keys whose TTL has passed without logging the removals or publishing them to watchers, so without using a revision.
+// It is for databases whose revisions must follow another's, as on a raft member or a replica, which remove expired keys at their own pace.
+func WithLocalExpiry() Option {
+	return func(o *options) {
+		o.localExpiry = true
+	}
+}
+
+// WithDefaultTTL gives keys that are set without a TTL this lifetime instead of none. 0, the default, means they do not expire.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.defaultTTL = ttl
+	}
+}
+
+// expiry returns when a key written at now expires: after ttl if it is positive, otherwise after the default TTL if there is one.
+// The zero time means never.
+func (d *Database) expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = d.defaultTTL
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// SetWithTTL stores value under key and expires it once ttl has elapsed.
+// Expired keys are treated as absent immediately and removed from memory by the background reaper.
+func (d *Database) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return d.set(key, value, d.now().Add(ttl))
+}
+
+// Expire sets the lifetime of an existing key to ttl without changing its value, reporting whether the key existed.
+// Like any write it gives the key a new version.
+func (d *Database) Expire(key string, ttl time.Duration) (_ bool, err error) {
+	defer d.observe(OpExpire, &err)
+
+	if ttl <= 0 {
+		return false, ErrInvalidTTL
+	}
+
+	if err := initCheck(d); err != nil {
+		return false, err
+	}
+
+	s := d.shardFor(key)
+	d.lock(s, OpExpire)
+	defer s.lock.Unlock()
+
+	now := d.now()
+	e := s.get(key, now)
+	if e == nil {
+		return false, nil
+	}
+
+	_, err = d.commit(setRecord(key, e.value, now.Add(ttl)))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// TTL returns how long key has left to live and whether it exists. A key without a TTL has a remaining lifetime of 0.
+func (d *Database) TTL(key string) (_ time.Duration, _ bool, err error) {
+	defer d.observe(OpTTL, &err)
+
+	if err := initCheck(d); err != nil {
+		return 0, false, err
+	}
+
+	s := d.shardFor(key)
+	d.rlock(s, OpTTL)
+	defer s.lock.RUnlock()
+
+	now := d.now()
+	e := s.get(key, now)
+	if e == nil {
+		return 0, false, nil
+	}
+	if e.expiresAt == 0 {
+		return 0, true, nil
+	}
+
+	return time.Duration(e.expiresAt - now.UnixNano()), true, nil
+}
+
+func (d *Database) now() time.Time {
+	if d.clock == nil {
+		return time.Now()
+	}
+	return d.clock()
+}
+
+func (d *Database) reapLoop(interval time.Duration) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.reapExpired()
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// reapExpired removes expired keys from every shard and returns how many it removed.
+// A failure to commit the removals is logged and ends the pass; the keys are left for a later one, and read as absent meanwhile.
+func (d *Database) reapExpired() int {
+	total := 0
+	for _, s := range d.shards {
+		removed, err := d.reapShard(s)
+		total += removed
+		if err != nil {
+			d.logger.Error("removing expired keys", "err", err)
+			break
+		}
+	}
+	d.expired.Add(uint64(total))
+	return total
+}
+
+// reapShard removes expired keys from s and returns how many it removed.
+// Rather than scanning every key under the write lock it checks small samples of keys with a TTL,
+// repeating while more than a quarter of a sample turns out to be expired.
+func (d *Database) reapShard(s *shard) (int, error) {
+	total := 0
+	for {
+		checked, removed, err := d.reapSample(s, d.now())
+		total += removed
+		if err != nil {
+			return total, err
+		}
+		if checked < reapSampleSize || removed*4 <= checked {
+			return total, nil
+		}
+	}
+}
+
+// reapSample removes the expired keys among a sample of s's keys with a TTL, returning how many it checked and removed.
+// The keys removed are committed together at a new revision, so that watchers and replicas see them deleted,
+// unless expiry is local, when they are removed without a trace.
+func (d *Database) reapSample(s *shard, now time.Time) (int, int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	checked := 0
+	ops := make([]walRecord, 0)
+	for k := range s.volatile {
+		if checked == reapSampleSize {
+			break
+		}
+		checked++
+
+		if s.entries[k].expired(now) {
+			ops = append(ops, walRecord{Op: walOpExpire, Key: k})
+		}
+	}
+
+	if len(ops) == 0 {
+		return checked, 0, nil
+	}
+
+	if d.localExpiry {
+		for _, op := range ops {
+			s.remove(op.Key)
+		}
+		return checked, len(ops), nil
+	}
+
+	_, err := d.commit(walRecord{Op: walOpTxn, Ops: ops})
+	if err != nil {
+		return checked, 0, fmt.Errorf("committing expired keys: %w", err)
+	}
+	return checked, len(ops), nil
+}
@@ -0,0 +1,342 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newExpiryTestDatabase(t *testing.T) (*Database, *fakeClock) {
+	db, err := NewDatabase(WithExpiryInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	c := &fakeClock{now: time.Unix(1000, 0)}
+	db.clock = c.Now
+	return db, c
+}
+
+func TestSetWithTTL(t *testing.T) {
+	t.Run("SetWithTTL should reject a non-positive ttl", func(t *testing.T) {
+		db, _ := newExpiryTestDatabase(t)
+
+		err := db.SetWithTTL("key", "value", 0)
+		if !errors.Is(err, ErrInvalidTTL) {
+			t.Errorf("SetWithTTL returned %v, expected ErrInvalidTTL", err)
+		}
+	})
+
+	t.Run("key should be visible until it expires", func(t *testing.T) {
+		db, c := newExpiryTestDatabase(t)
+
+		_ = db.SetWithTTL("key", "value", time.Minute)
+		_ = db.Set("other", "value")
+
+		c.now = c.now.Add(59 * time.Second)
+		v, _ := db.Get("key")
+		if v != "value" {
+			t.Errorf("Get before expiry returned %v, expected value", v)
+		}
+
+		c.now = c.now.Add(time.Second)
+		v, _ = db.Get("key")
+		if v != nil {
+			t.Errorf("Get after expiry returned %v, expected nil", v)
+		}
+
+		keys, _ := db.GetAllKeys()
+		if len(keys) != 1 || keys[0] != "other" {
+			t.Errorf("GetAllKeys after expiry returned %v, expected [other]", keys)
+		}
+	})
+
+	t.Run("Set should clear an existing ttl", func(t *testing.T) {
+		db, c := newExpiryTestDatabase(t)
+
+		_ = db.SetWithTTL("key", "value", time.Minute)
+		_ = db.Set("key", "value2")
+
+		c.now = c.now.Add(time.Hour)
+		v, _ := db.Get("key")
+		if v != "value2" {
+			t.Errorf("Get returned %v, expected value2", v)
+		}
+	})
+
+	t.Run("Delete should clear an existing ttl", func(t *testing.T) {
+		db, _ := newExpiryTestDatabase(t)
+
+		_ = db.SetWithTTL("key", "value", time.Minute)
+		_ = db.Delete("key")
+
+		if len(expiriesOf(db)) != 0 {
+			t.Errorf("expires has %d entries after delete, expected 0", len(expiriesOf(db)))
+		}
+	})
+}
+
+func TestReapExpired(t *testing.T) {
+	db, c := newExpiryTestDatabase(t)
+
+	for i := 0; i < 100; i++ {
+		_ = db.SetWithTTL("short"+strconv.Itoa(i), "value", time.Second)
+	}
+	for i := 0; i < 5; i++ {
+		_ = db.SetWithTTL("long"+strconv.Itoa(i), "value", time.Hour)
+	}
+	_ = db.Set("forever", "value")
+
+	c.now = c.now.Add(time.Minute)
+
+	removed := db.reapExpired()
+	if removed == 0 {
+		t.Fatal("reapExpired removed nothing")
+	}
+
+	//The reaper stops once a sample is mostly live, so keep going until it has caught up.
+	for db.reapExpired() > 0 {
+	}
+
+	if len(contents(db)) != 6 {
+		t.Errorf("database has %d keys after reaping, expected 6", len(contents(db)))
+	}
+
+	if len(expiriesOf(db)) != 5 {
+		t.Errorf("expires has %d entries after reaping, expected 5", len(expiriesOf(db)))
+	}
+
+	if db.Stats().Expired != 100 {
+		t.Errorf("Stats reported %d expired keys, expected 100", db.Stats().Expired)
+	}
+}
+
+func TestReapFailedCommit(t *testing.T) {
+	var logs bytes.Buffer
+	db, err := NewDatabase(
+		WithExpiryInterval(time.Hour),
+		WithWAL(WALConfig{Dir: t.TempDir(), Sync: SyncAlways}),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	c := &fakeClock{now: time.Unix(1000, 0)}
+	db.clock = c.Now
+
+	//Spread across the shards, so that a pass that carried on would fail again on each.
+	for i := 0; i < 100; i++ {
+		_ = db.SetWithTTL("key"+strconv.Itoa(i), "value", time.Second)
+	}
+	c.now = c.now.Add(time.Second)
+
+	db.wal.lock.Lock()
+	db.wal.fail(errors.New("disk full"))
+	db.wal.lock.Unlock()
+
+	if removed := db.reapExpired(); removed != 0 {
+		t.Errorf("reapExpired removed %d keys, expected none without a log to commit them to", removed)
+	}
+	if len(expiriesOf(db)) != 100 {
+		t.Errorf("expires has %d entries, expected the keys to be left for a later pass", len(expiriesOf(db)))
+	}
+	if n := strings.Count(logs.String(), "removing expired keys"); n != 1 {
+		t.Errorf("logged the failure %d times, expected once:\n%s", n, logs.String())
+	}
+}
+
+func TestReapedKeysAreWatched(t *testing.T) {
+	t.Run("removal should be published as a delete at a new revision", func(t *testing.T) {
+		db, c := newExpiryTestDatabase(t)
+		_ = db.SetWithTTL("key", "value", time.Second)
+		_ = db.Set("other", "value")
+
+		w, err := db.Watch(WatchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		c.now = c.now.Add(time.Second)
+		if db.reapExpired() != 1 {
+			t.Fatal("reapExpired did not remove the key")
+		}
+
+		events, err := w.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := Event{Revision: 3, Type: EventDelete, Key: "key", Time: c.now, OldVersion: 1}
+		if len(events) != 1 || events[0] != expected {
+			t.Errorf("got events %+v, expected %+v", events, expected)
+		}
+		if db.Revision() != 3 {
+			t.Errorf("revision is %d, expected 3", db.Revision())
+		}
+	})
+
+	t.Run("local expiry should remove keys without a revision", func(t *testing.T) {
+		db, err := NewDatabase(WithExpiryInterval(time.Hour), WithLocalExpiry())
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+		c := &fakeClock{now: time.Unix(1000, 0)}
+		db.clock = c.Now
+
+		_ = db.SetWithTTL("key", "value", time.Second)
+		c.now = c.now.Add(time.Second)
+
+		if db.reapExpired() != 1 || len(expiriesOf(db)) != 0 {
+			t.Fatal("reapExpired did not remove the key")
+		}
+		if db.Revision() != 1 {
+			t.Errorf("revision is %d, expected 1", db.Revision())
+		}
+	})
+}
+
+func TestReaperRunsInBackground(t *testing.T) {
+	db, err := NewDatabase(WithExpiryInterval(5 * time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	defer db.Close()
+
+	_ = db.SetWithTTL("key", "value", time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		n := len(contents(db))
+		if n == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("expired key was not reaped in the background")
+}
+
+func TestTTLSurvivesRestart(t *testing.T) {
+	cfg := WALConfig{Dir: t.TempDir(), Sync: SyncNever}
+
+	db, err := NewDatabase(WithWAL(cfg))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	_ = db.SetWithTTL("snapshotted", "value", time.Hour)
+	_, _ = db.Snapshot()
+	_ = db.SetWithTTL("logged", "value", time.Hour)
+	_ = db.Close()
+
+	db, err = NewDatabase(WithWAL(cfg))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error on reopen: %s", err)
+	}
+	defer db.Close()
+
+	for _, k := range []string{"snapshotted", "logged"} {
+		at, ok := expiriesOf(db)[k]
+		if !ok {
+			t.Errorf("%s lost its ttl across restart", k)
+			continue
+		}
+		if time.Until(at) < 59*time.Minute {
+			t.Errorf("%s has expiry %s, expected about an hour from now", k, at)
+		}
+	}
+}
+
+func TestExpireAndTTL(t *testing.T) {
+	db, c := newExpiryTestDatabase(t)
+
+	_ = db.Set("key", "value")
+
+	ttl, ok, _ := db.TTL("key")
+	if !ok || ttl != 0 {
+		t.Errorf("TTL of a key without expiry returned %s, %t, expected 0, true", ttl, ok)
+	}
+
+	_, before, _ := db.GetWithVersion("key")
+
+	ok, err := db.Expire("key", time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("Expire returned %t, %v", ok, err)
+	}
+
+	v, after, _ := db.GetWithVersion("key")
+	if v != "value" || after <= before {
+		t.Errorf("Expire left value %v at version %d, expected value at a version above %d", v, after, before)
+	}
+
+	c.now = c.now.Add(20 * time.Second)
+	ttl, ok, _ = db.TTL("key")
+	if !ok || ttl != 40*time.Second {
+		t.Errorf("TTL returned %s, %t, expected 40s, true", ttl, ok)
+	}
+
+	c.now = c.now.Add(40 * time.Second)
+	_, ok, _ = db.TTL("key")
+	if ok {
+		t.Error("TTL reported an expired key as existing")
+	}
+
+	ok, _ = db.Expire("key", time.Minute)
+	if ok {
+		t.Error("Expire reported an expired key as existing")
+	}
+
+	_, err = db.Expire("key", 0)
+	if !errors.Is(err, ErrInvalidTTL) {
+		t.Errorf("Expire returned %v, expected ErrInvalidTTL", err)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	db, c := newExpiryTestDatabase(t)
+	db.defaultTTL = time.Minute
+
+	_ = db.Set("set", "value")
+	_, _ = db.CompareAndSet("cas", 0, "value", 0)
+	_, _ = db.Txn([]TxnOp{{Type: TxnSet, Key: "txn", Value: "value"}})
+	_ = db.SetWithTTL("explicit", "value", time.Hour)
+
+	tt := []struct {
+		key      string
+		expected time.Duration
+	}{
+		{key: "set", expected: time.Minute},
+		{key: "cas", expected: time.Minute},
+		{key: "txn", expected: time.Minute},
+		{key: "explicit", expected: time.Hour},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.key, func(t *testing.T) {
+			ttl, ok, _ := db.TTL(tc.key)
+			if !ok || ttl != tc.expected {
+				t.Errorf("TTL returned %s, %t, expected %s, true", ttl, ok, tc.expected)
+			}
+		})
+	}
+
+	c.now = c.now.Add(time.Minute)
+	keys, _ := db.GetAllKeys()
+	if len(keys) != 1 || keys[0] != "explicit" {
+		t.Errorf("GetAllKeys after the default TTL returned %v, expected [explicit]", keys)
+	}
+}
@@ -0,0 +1,142 @@
+package db
+
+import "strings"
+
+const (
+	skipListMaxLevel = 32
+
+	//Each level holds roughly a quarter of the nodes of the level below.
+	skipListBranching = 4
+)
+
+// skipList is an ordered set of keys with O(log n) insert, remove and seek, used to serve range scans without sorting the whole map.
+// It is not safe for concurrent use; the database guards it with its own lock.
+type skipList struct {
+	head   *skipNode
+	level  int
+	length int
+	seed   uint64
+}
+
+type skipNode struct {
+	key  string
+	next []*skipNode
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		head:  &skipNode{next: make([]*skipNode, skipListMaxLevel)},
+		level: 1,
+		seed:  0x9e3779b97f4a7c15,
+	}
+}
+
+func (s *skipList) randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel {
+		//xorshift64, so inserts do not contend on a shared random source.
+		s.seed ^= s.seed << 13
+		s.seed ^= s.seed >> 7
+		s.seed ^= s.seed << 17
+		if s.seed%skipListBranching != 0 {
+			break
+		}
+		level++
+	}
+	return level
+}
+
+// findPredecessors fills update with the last node before key on every level.
+func (s *skipList) findPredecessors(key string, update []*skipNode) *skipNode {
+	n := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].key < key {
+			n = n.next[i]
+		}
+		if update != nil {
+			update[i] = n
+		}
+	}
+	return n.next[0]
+}
+
+// insert adds key, returning false if it was already present.
+func (s *skipList) insert(key string) bool {
+	update := make([]*skipNode, skipListMaxLevel)
+	n := s.findPredecessors(key, update)
+	if n != nil && n.key == key {
+		return false
+	}
+
+	level := s.randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = s.head
+		}
+		s.level = level
+	}
+
+	node := &skipNode{key: key, next: make([]*skipNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	s.length++
+
+	return true
+}
+
+// remove deletes key, returning false if it was not present.
+func (s *skipList) remove(key string) bool {
+	update := make([]*skipNode, skipListMaxLevel)
+	n := s.findPredecessors(key, update)
+	if n == nil || n.key != key {
+		return false
+	}
+
+	for i := 0; i < len(n.next); i++ {
+		update[i].next[i] = n.next[i]
+	}
+
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.length--
+
+	return true
+}
+
+// seek returns the first node with a key at or after key, or nil.
+func (s *skipList) seek(key string) *skipNode {
+	return s.findPredecessors(key, nil)
+}
+
+// keyRange bounds a scan. Start is inclusive and End exclusive; an empty End means unbounded.
+type keyRange struct {
+	Prefix string
+	Start  string
+	End    string
+	After  string
+}
+
+// lowerBound returns the smallest key the range can contain.
+func (r keyRange) lowerBound() string {
+	lb := r.Start
+	if r.Prefix > lb {
+		lb = r.Prefix
+	}
+
+	//The smallest string strictly greater than After.
+	if r.After != "" && r.After >= lb {
+		lb = r.After + "\x00"
+	}
+	return lb
+}
+
+// beyond reports whether key, and so every key after it, is past the end of the range.
+func (r keyRange) beyond(key string) bool {
+	if r.End != "" && key >= r.End {
+		return true
+	}
+	return !strings.HasPrefix(key, r.Prefix)
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func skipListKeys(s *skipList) []string {
+	out := make([]string, 0)
+	for n := s.head.next[0]; n != nil; n = n.next[0] {
+		out = append(out, n.key)
+	}
+	return out
+}
+
+func TestSkipList(t *testing.T) {
+	t.Run("insert should keep keys ordered and unique", func(t *testing.T) {
+		s := newSkipList()
+		expected := make(map[string]bool)
+
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 2000; i++ {
+			k := strconv.Itoa(r.Intn(1000))
+			inserted := s.insert(k)
+			if inserted == expected[k] {
+				t.Fatalf("insert(%s) returned %v with key already present = %v", k, inserted, expected[k])
+			}
+			expected[k] = true
+		}
+
+		keys := skipListKeys(s)
+		if !sort.StringsAreSorted(keys) {
+			t.Error("skip list keys are not sorted")
+		}
+
+		if len(keys) != len(expected) || s.length != len(expected) {
+			t.Errorf("skip list has %d keys (length %d), expected %d", len(keys), s.length, len(expected))
+		}
+	})
+
+	t.Run("remove should only remove present keys", func(t *testing.T) {
+		s := newSkipList()
+		for _, k := range []string{"b", "a", "d", "c"} {
+			s.insert(k)
+		}
+
+		if !s.remove("c") {
+			t.Error("remove(c) returned false")
+		}
+
+		if s.remove("c") || s.remove("z") {
+			t.Error("remove of a missing key returned true")
+		}
+
+		keys := skipListKeys(s)
+		if len(keys) != 3 || keys[0] != "a" || keys[1] != "b" || keys[2] != "d" {
+			t.Errorf("unexpected keys after remove: %v", keys)
+		}
+	})
+
+	t.Run("seek should find the first key at or after its argument", func(t *testing.T) {
+		s := newSkipList()
+		for _, k := range []string{"apple", "banana", "cherry"} {
+			s.insert(k)
+		}
+
+		tt := map[string]string{"": "apple", "apple": "apple", "b": "banana", "banana\x00": "cherry"}
+		for seek, want := range tt {
+			n := s.seek(seek)
+			if n == nil || n.key != want {
+				t.Errorf("seek(%q) returned %v, want %s", seek, n, want)
+			}
+		}
+
+		if s.seek("d") != nil {
+			t.Error("seek past the last key should return nil")
+		}
+	})
+}
+
+func BenchmarkSkipList_Insert(b *testing.B) {
+	s := newSkipList()
+	for n := 0; n < b.N; n++ {
+		s.insert(strconv.Itoa(n))
+	}
+}
@@ -0,0 +1,67 @@
+package db
+
+import "time"
+
+// Op names a database operation in metrics.
+type Op string
+
+const (
+	OpGet              Op = "get"
+	OpSet              Op = "set"
+	OpDelete           Op = "delete"
+	OpList             Op = "list"
+	OpScan             Op = "scan"
+	OpCompareAndSet    Op = "compare_and_set"
+	OpCompareAndDelete Op = "compare_and_delete"
+	OpExpire           Op = "expire"
+	OpTTL              Op = "ttl"
+	OpTxn              Op = "txn"
+	OpReplicate        Op = "replicate"
+)
+
+// Metrics is told about every operation the database performs. It is called on the hot path, so its methods must be cheap and safe for concurrent use.
+type Metrics interface {
+	//Operation is called once op has finished, with the error it returned, if any.
+	Operation(op Op, err error)
+
+	//LockWait is called with how long op waited for a shard lock, once for each shard it locks.
+	LockWait(op Op, wait time.Duration)
+}
+
+// WithMetrics reports every operation to m. Without it, lock waits are not timed.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// observe reports op and the error it finished with. Deferred with a pointer to the operation's named error result.
+func (d *Database) observe(op Op, err *error) {
+	if d.metrics != nil {
+		d.metrics.Operation(op, *err)
+	}
+}
+
+// lock write-locks s for op, timing the wait if metrics are enabled.
+func (d *Database) lock(s *shard, op Op) {
+	if d.metrics == nil {
+		s.lock.Lock()
+		return
+	}
+
+	start := time.Now()
+	s.lock.Lock()
+	d.metrics.LockWait(op, time.Since(start))
+}
+
+// rlock read-locks s for op, timing the wait if metrics are enabled.
+func (d *Database) rlock(s *shard, op Op) {
+	if d.metrics == nil {
+		s.lock.RLock()
+		return
+	}
+
+	start := time.Now()
+	s.lock.RLock()
+	d.metrics.LockWait(op, time.Since(start))
+}
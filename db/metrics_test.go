@@ -0,0 +1,104 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	lock       sync.Mutex
+	operations map[Op]int
+	errors     map[Op]int
+	lockWaits  map[Op]int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		operations: make(map[Op]int),
+		errors:     make(map[Op]int),
+		lockWaits:  make(map[Op]int),
+	}
+}
+
+func (m *recordingMetrics) Operation(op Op, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.operations[op]++
+	if err != nil {
+		m.errors[op]++
+	}
+}
+
+func (m *recordingMetrics) LockWait(op Op, wait time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.lockWaits[op]++
+}
+
+func TestMetrics(t *testing.T) {
+	tt := []struct {
+		name      string
+		run       func(d *Database)
+		op        Op
+		errors    int
+		lockWaits int
+	}{
+		{name: "get should be counted", run: func(d *Database) { _, _ = d.Get("a") }, op: OpGet, lockWaits: 1},
+		{name: "get with version should count as a get", run: func(d *Database) { _, _, _ = d.GetWithVersion("a") }, op: OpGet, lockWaits: 1},
+		{name: "set should be counted", run: func(d *Database) { _ = d.Set("a", "1") }, op: OpSet, lockWaits: 1},
+		{name: "set with ttl should count as a set", run: func(d *Database) { _ = d.SetWithTTL("a", "1", time.Minute) }, op: OpSet, lockWaits: 1},
+		{name: "delete should be counted", run: func(d *Database) { _ = d.Delete("a") }, op: OpDelete, lockWaits: 1},
+		{name: "listing should wait on every shard", run: func(d *Database) { _, _ = d.GetAllKeys() }, op: OpList, lockWaits: 4},
+		{name: "scan should wait on every shard", run: func(d *Database) { _, _ = d.Scan(ScanOptions{Limit: 10}) }, op: OpScan, lockWaits: 4},
+		{name: "failed compare and set should be counted as an error", run: func(d *Database) { _, _ = d.CompareAndSet("a", 5, "1", 0) }, op: OpCompareAndSet, errors: 1, lockWaits: 1},
+		{name: "compare and delete should be counted", run: func(d *Database) { _ = d.CompareAndDelete("a", 0) }, op: OpCompareAndDelete, lockWaits: 1},
+		{name: "expire should be counted", run: func(d *Database) { _, _ = d.Expire("a", time.Minute) }, op: OpExpire, lockWaits: 1},
+		{name: "ttl should be counted", run: func(d *Database) { _, _, _ = d.TTL("a") }, op: OpTTL, lockWaits: 1},
+		{name: "invalid scan should be counted as an error", run: func(d *Database) { _, _ = d.Scan(ScanOptions{}) }, op: OpScan, errors: 1},
+		{
+			name: "transaction should wait once for each shard it locks",
+			run: func(d *Database) {
+				_, _ = d.Txn([]TxnOp{{Type: TxnSet, Key: "a", Value: "1"}, {Type: TxnSet, Key: "a", Value: "2"}})
+			},
+			op:        OpTxn,
+			lockWaits: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newRecordingMetrics()
+			d, err := NewDatabase(WithShards(4), WithMetrics(m))
+			if err != nil {
+				t.Fatalf("NewDatabase returned an error: %s", err)
+			}
+			defer d.Close()
+
+			tc.run(d)
+
+			if m.operations[tc.op] != 1 || m.errors[tc.op] != tc.errors || m.lockWaits[tc.op] != tc.lockWaits {
+				t.Errorf("got %d operations, %d errors and %d lock waits, expected 1, %d and %d",
+					m.operations[tc.op], m.errors[tc.op], m.lockWaits[tc.op], tc.errors, tc.lockWaits)
+			}
+		})
+	}
+
+	t.Run("rejected write should be counted as an error", func(t *testing.T) {
+		m := newRecordingMetrics()
+		d, _ := NewDatabase(WithMaxKeys(1), WithMetrics(m))
+		defer d.Close()
+
+		_ = d.Set("a", "1")
+		err := d.Set("b", "1")
+		if !errors.Is(err, ErrOutOfMemory) {
+			t.Fatalf("Set returned %v, expected ErrOutOfMemory", err)
+		}
+		if m.operations[OpSet] != 2 || m.errors[OpSet] != 1 {
+			t.Errorf("got %d sets and %d errors, expected 2 and 1", m.operations[OpSet], m.errors[OpSet])
+		}
+	})
+}
@@ -0,0 +1,355 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	//Subdirectory of the write-ahead log's directory that namespaces keep their own logs in, one directory each.
+	namespacesDir = "namespaces"
+
+	//Lists the namespaces and their settings. Namespace names cannot contain a dot, so it never clashes with a namespace's directory.
+	namespacesManifest = "namespaces.json"
+)
+
+var namespaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+var (
+	// ErrNamespaceExists is returned by Create when a namespace of that name already exists.
+	ErrNamespaceExists = errors.New("namespace already exists")
+	// ErrNamespaceNotFound is returned when there is no namespace of the given name.
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	// ErrInvalidNamespace is returned by Create when the name or settings of a namespace are not valid.
+	ErrInvalidNamespace = errors.New("invalid namespace")
+)
+
+// NamespaceConfig is the quota and settings of a namespace, which apply to its keys alone.
+type NamespaceConfig struct {
+	//0 means unlimited.
+	MaxKeys  int64 `json:"maxKeys"`
+	MaxBytes int64 `json:"maxBytes"`
+
+	//Defaults to EvictNone.
+	EvictionPolicy EvictionPolicy `json:"evictionPolicy"`
+
+	//Given to keys set without a TTL. 0 means they do not expire.
+	DefaultTTL time.Duration `json:"defaultTTL"`
+}
+
+// NamespaceInfo describes a namespace.
+type NamespaceInfo struct {
+	Name   string          `json:"name"`
+	Config NamespaceConfig `json:"config"`
+	Stats  Stats           `json:"stats"`
+}
+
+// Namespaces holds logically separate keyspaces, each a Database of its own with its own keys, limits, eviction policy and default TTL.
+// Creating and dropping a namespace is atomic: it is either listed with all of its keys, or not at all.
+type Namespaces struct {
+	opts []Option
+
+	//Where the manifest and each namespace's write-ahead log are kept. Namespaces are only kept in memory if empty.
+	dir string
+	wal WALConfig
+
+	lock   sync.RWMutex
+	spaces map[string]*namespace
+}
+
+type namespace struct {
+	cfg NamespaceConfig
+	db  *Database
+}
+
+// OpenNamespaces opens the namespaces persisted by an earlier run, if any. Every namespace is opened with opts, which may be the same as the
+// default database's, overridden by the namespace's own settings.
+// If opts include a write-ahead log, namespaces are persisted in its directory, each with its own log in a subdirectory.
+func OpenNamespaces(opts ...Option) (*Namespaces, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	n := &Namespaces{
+		opts:   opts,
+		spaces: make(map[string]*namespace),
+	}
+	if o.wal == nil {
+		return n, nil
+	}
+	n.wal = *o.wal
+	n.dir = filepath.Join(o.wal.Dir, namespacesDir)
+
+	manifest, err := n.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range sortedNames(manifest) {
+		d, err := n.open(name, manifest[name])
+		if err != nil {
+			_ = n.Close()
+			return nil, fmt.Errorf("opening namespace %s: %w", name, err)
+		}
+		n.spaces[name] = &namespace{cfg: manifest[name], db: d}
+	}
+
+	//Left behind by a drop that was interrupted after the manifest was written.
+	entries, _ := os.ReadDir(n.dir)
+	for _, e := range entries {
+		if _, ok := manifest[e.Name()]; e.IsDir() && !ok {
+			_ = os.RemoveAll(filepath.Join(n.dir, e.Name()))
+		}
+	}
+
+	return n, nil
+}
+
+// Create adds an empty namespace called name. Names are 1 to 63 lowercase letters, digits, dashes and underscores, starting with a letter or digit.
+func (n *Namespaces) Create(name string, cfg NamespaceConfig) error {
+	if !namespaceName.MatchString(name) {
+		return fmt.Errorf("%w: name %q must be 1 to 63 lowercase letters, digits, dashes and underscores", ErrInvalidNamespace, name)
+	}
+
+	cfg, err := cfg.validate()
+	if err != nil {
+		return err
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if _, ok := n.spaces[name]; ok {
+		return ErrNamespaceExists
+	}
+
+	//Left behind by an earlier namespace of the same name if it was not dropped cleanly; a new namespace starts empty.
+	if n.dir != "" {
+		err = os.RemoveAll(filepath.Join(n.dir, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	d, err := n.open(name, cfg)
+	if err != nil {
+		return err
+	}
+
+	n.spaces[name] = &namespace{cfg: cfg, db: d}
+	err = n.save()
+	if err != nil {
+		delete(n.spaces, name)
+		_ = d.Close()
+		n.remove(name)
+		return err
+	}
+
+	return nil
+}
+
+// Drop removes the namespace called name and all of its keys.
+// Requests that looked the namespace up before it was dropped may still complete, but nothing they write is kept.
+func (n *Namespaces) Drop(name string) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	ns, ok := n.spaces[name]
+	if !ok {
+		return ErrNamespaceNotFound
+	}
+
+	delete(n.spaces, name)
+	err := n.save()
+	if err != nil {
+		n.spaces[name] = ns
+		return err
+	}
+
+	err = ns.db.Close()
+	n.remove(name)
+	return err
+}
+
+// Get returns the database holding the keys of the namespace called name.
+func (n *Namespaces) Get(name string) (*Database, bool) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	ns, ok := n.spaces[name]
+	if !ok {
+		return nil, false
+	}
+	return ns.db, true
+}
+
+// Info describes the namespace called name.
+func (n *Namespaces) Info(name string) (NamespaceInfo, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	ns, ok := n.spaces[name]
+	if !ok {
+		return NamespaceInfo{}, ErrNamespaceNotFound
+	}
+	return NamespaceInfo{Name: name, Config: ns.cfg, Stats: ns.db.Stats()}, nil
+}
+
+// List describes every namespace, ordered by name.
+func (n *Namespaces) List() []NamespaceInfo {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	out := make([]NamespaceInfo, 0, len(n.spaces))
+	for _, name := range sortedNames(n.spaces) {
+		ns := n.spaces[name]
+		out = append(out, NamespaceInfo{Name: name, Config: ns.cfg, Stats: ns.db.Stats()})
+	}
+	return out
+}
+
+// Close closes the database of every namespace.
+func (n *Namespaces) Close() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	errs := make([]error, 0)
+	for name, ns := range n.spaces {
+		err := ns.db.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("closing namespace %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (cfg NamespaceConfig) validate() (NamespaceConfig, error) {
+	if cfg.EvictionPolicy == "" {
+		cfg.EvictionPolicy = EvictNone
+	}
+
+	errs := make([]error, 0)
+	if _, err := ParseEvictionPolicy(string(cfg.EvictionPolicy)); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.MaxKeys < 0 {
+		errs = append(errs, errors.New("maxKeys must not be negative"))
+	}
+	if cfg.MaxBytes < 0 {
+		errs = append(errs, errors.New("maxBytes must not be negative"))
+	}
+	if cfg.DefaultTTL < 0 {
+		errs = append(errs, errors.New("defaultTTL must not be negative"))
+	}
+
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("%w: %w", ErrInvalidNamespace, errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+func (n *Namespaces) open(name string, cfg NamespaceConfig) (*Database, error) {
+	opts := append([]Option{}, n.opts...)
+	opts = append(opts,
+		WithMaxKeys(cfg.MaxKeys),
+		WithMaxBytes(cfg.MaxBytes),
+		WithEvictionPolicy(cfg.EvictionPolicy),
+		WithDefaultTTL(cfg.DefaultTTL),
+		//A namespace's own limits are its quota.
+		WithQuotas(),
+	)
+	if n.dir != "" {
+		wal := n.wal
+		wal.Dir = filepath.Join(n.dir, name)
+		opts = append(opts, WithWAL(wal))
+	}
+	return NewDatabase(opts...)
+}
+
+func (n *Namespaces) remove(name string) {
+	if n.dir != "" {
+		_ = os.RemoveAll(filepath.Join(n.dir, name))
+	}
+}
+
+// load reads the manifest, which is empty if namespaces have never been created.
+func (n *Namespaces) load() (map[string]NamespaceConfig, error) {
+	manifest := make(map[string]NamespaceConfig)
+
+	b, err := os.ReadFile(filepath.Join(n.dir, namespacesManifest))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading namespaces: %w", err)
+	}
+
+	err = json.Unmarshal(b, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("reading namespaces: %w", err)
+	}
+	return manifest, nil
+}
+
+// save atomically replaces the manifest with the current namespaces. Must be called with the lock held.
+func (n *Namespaces) save() error {
+	if n.dir == "" {
+		return nil
+	}
+
+	manifest := make(map[string]NamespaceConfig, len(n.spaces))
+	for name, ns := range n.spaces {
+		manifest[name] = ns.cfg
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(n.dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(n.dir, namespacesManifest)
+	tmp := path + ".tmp"
+	defer os.Remove(tmp)
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("writing namespaces: %w", err)
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("writing namespaces: %w", err)
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return fmt.Errorf("writing namespaces: %w", err)
+	}
+	return syncDir(n.dir)
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestNamespaces(t *testing.T, opts ...Option) *Namespaces {
+	t.Helper()
+
+	n, err := OpenNamespaces(opts...)
+	if err != nil {
+		t.Fatalf("OpenNamespaces returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = n.Close() })
+	return n
+}
+
+func TestCreateNamespace(t *testing.T) {
+	tt := []struct {
+		name      string
+		namespace string
+		cfg       NamespaceConfig
+		err       error
+	}{
+		{name: "valid namespace should be created", namespace: "team-a", cfg: NamespaceConfig{MaxKeys: 10, EvictionPolicy: EvictLRU}},
+		{name: "existing namespace should be an error", namespace: "existing", err: ErrNamespaceExists},
+		{name: "empty name should be invalid", namespace: "", err: ErrInvalidNamespace},
+		{name: "name with a slash should be invalid", namespace: "team/a", err: ErrInvalidNamespace},
+		{name: "uppercase name should be invalid", namespace: "TeamA", err: ErrInvalidNamespace},
+		{name: "unknown eviction policy should be invalid", namespace: "team-a", cfg: NamespaceConfig{EvictionPolicy: "fifo"}, err: ErrInvalidNamespace},
+		{name: "negative quota should be invalid", namespace: "team-a", cfg: NamespaceConfig{MaxBytes: -1}, err: ErrInvalidNamespace},
+		{name: "negative default TTL should be invalid", namespace: "team-a", cfg: NamespaceConfig{DefaultTTL: -time.Second}, err: ErrInvalidNamespace},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			n := openTestNamespaces(t)
+			_ = n.Create("existing", NamespaceConfig{})
+
+			err := n.Create(tc.namespace, tc.cfg)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Create returned %v, expected %v", err, tc.err)
+			}
+
+			_, ok := n.Get(tc.namespace)
+			if ok != (tc.err == nil || tc.err == ErrNamespaceExists) {
+				t.Errorf("Get found the namespace: %t", ok)
+			}
+		})
+	}
+}
+
+func TestNamespacesAreIndependent(t *testing.T) {
+	n := openTestNamespaces(t)
+	_ = n.Create("a", NamespaceConfig{MaxKeys: 1})
+	_ = n.Create("b", NamespaceConfig{MaxKeys: 1, EvictionPolicy: EvictLRU})
+
+	a, _ := n.Get("a")
+	b, _ := n.Get("b")
+
+	_ = a.Set("key", "in a")
+	_ = b.Set("key", "in b")
+
+	if v, _ := a.Get("key"); v != "in a" {
+		t.Errorf("Get in a returned %v", v)
+	}
+	if v, _ := b.Get("key"); v != "in b" {
+		t.Errorf("Get in b returned %v", v)
+	}
+
+	err := a.Set("other", "value")
+	if !errors.Is(err, ErrOutOfMemory) {
+		t.Errorf("Set over a's quota returned %v, expected ErrOutOfMemory", err)
+	}
+	err = b.Set("other", "value")
+	if err != nil {
+		t.Errorf("Set over b's quota returned %v, expected an eviction", err)
+	}
+
+	list := n.List()
+	if len(list) != 2 || list[0].Name != "a" || list[1].Name != "b" {
+		t.Fatalf("List returned %+v", list)
+	}
+	if list[0].Stats.Keys != 1 || list[0].Config.EvictionPolicy != EvictNone || list[1].Stats.Evictions != 1 {
+		t.Errorf("List returned %+v", list)
+	}
+}
+
+func TestDropNamespace(t *testing.T) {
+	n := openTestNamespaces(t)
+	_ = n.Create("a", NamespaceConfig{})
+	a, _ := n.Get("a")
+	_ = a.Set("key", "value")
+
+	err := n.Drop("a")
+	if err != nil {
+		t.Fatalf("Drop returned an error: %s", err)
+	}
+	if _, ok := n.Get("a"); ok {
+		t.Error("Get found a dropped namespace")
+	}
+	if _, err := n.Info("a"); !errors.Is(err, ErrNamespaceNotFound) {
+		t.Errorf("Info returned %v, expected ErrNamespaceNotFound", err)
+	}
+
+	err = n.Drop("a")
+	if !errors.Is(err, ErrNamespaceNotFound) {
+		t.Errorf("Drop returned %v, expected ErrNamespaceNotFound", err)
+	}
+
+	_ = n.Create("a", NamespaceConfig{})
+	a, _ = n.Get("a")
+	if v, _ := a.Get("key"); v != nil {
+		t.Errorf("recreated namespace has %v, expected no keys", v)
+	}
+}
+
+func TestNamespacesSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	wal := WithWAL(WALConfig{Dir: dir, Sync: SyncAlways})
+
+	n, err := OpenNamespaces(wal)
+	if err != nil {
+		t.Fatalf("OpenNamespaces returned an error: %s", err)
+	}
+	_ = n.Create("kept", NamespaceConfig{MaxKeys: 5, DefaultTTL: time.Hour})
+	_ = n.Create("dropped", NamespaceConfig{})
+	kept, _ := n.Get("kept")
+	_ = kept.Set("key", "value")
+	dropped, _ := n.Get("dropped")
+	_ = dropped.Set("key", "value")
+	_ = n.Drop("dropped")
+	_ = n.Close()
+
+	//As if a drop was interrupted after the manifest was written.
+	err = os.MkdirAll(filepath.Join(dir, namespacesDir, "orphan"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n = openTestNamespaces(t, wal)
+
+	list := n.List()
+	if len(list) != 1 || list[0].Name != "kept" || list[0].Config.MaxKeys != 5 || list[0].Config.DefaultTTL != time.Hour {
+		t.Fatalf("List after restart returned %+v", list)
+	}
+
+	kept, _ = n.Get("kept")
+	if v, _ := kept.Get("key"); v != "value" {
+		t.Errorf("Get after restart returned %v", v)
+	}
+	if ttl, _, _ := kept.TTL("key"); ttl <= 0 {
+		t.Errorf("key lost its default TTL: %s", ttl)
+	}
+
+	for _, name := range []string{"dropped", "orphan"} {
+		if _, err := os.Stat(filepath.Join(dir, namespacesDir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("directory of %s was not removed: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrQuotaExceeded is returned by writes that would take the keys under a quota's prefix over its limits.
+// Such errors are also ErrOutOfMemory, but nothing is evicted to make room.
+var ErrQuotaExceeded = fmt.Errorf("%w: quota exceeded", ErrOutOfMemory)
+
+// Quota limits the keys starting with Prefix, such as one tenant's, on top of the database's own limits. 0 means unlimited.
+type Quota struct {
+	Prefix   string `json:"prefix"`
+	MaxKeys  int64  `json:"maxKeys"`
+	MaxBytes int64  `json:"maxBytes"`
+}
+
+// QuotaUsage reports how much of a quota is used.
+type QuotaUsage struct {
+	Quota
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// QuotaError is returned when a write to Key would exceed the quota on Prefix.
+type QuotaError struct {
+	Prefix string
+	Key    string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded for prefix %q by key %q", e.Prefix, e.Key)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+type quota struct {
+	Quota
+
+	//Totals for the keys under the prefix, across every shard.
+	keys  atomic.Int64
+	bytes atomic.Int64
+
+	//Room taken by writes that are under way. Guarded by the database's reservation lock.
+	reserved usage
+}
+
+// WithQuotas limits the keys and memory used by the keys under each quota's prefix. A key counts towards every quota whose prefix it has.
+// Writes over a quota are rejected, whatever the eviction policy, and expired keys count until they are reaped.
+// A transaction is checked against each quota with all of its writes together.
+func WithQuotas(quotas ...Quota) Option {
+	return func(o *options) {
+		o.quotas = quotas
+	}
+}
+
+// ParseQuota reads a quota written as prefix=maxKeys:maxBytes, such as "team-a/=10000:67108864". Either limit may be 0 for unlimited.
+func ParseQuota(s string) (Quota, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return Quota{}, fmt.Errorf("quota %q is not prefix=maxKeys:maxBytes", s)
+	}
+
+	keys, bytes, ok := strings.Cut(s[i+1:], ":")
+	if !ok {
+		return Quota{}, fmt.Errorf("quota %q is not prefix=maxKeys:maxBytes", s)
+	}
+
+	q := Quota{Prefix: s[:i]}
+	var err error
+	q.MaxKeys, err = strconv.ParseInt(keys, 10, 64)
+	if err != nil || q.MaxKeys < 0 {
+		return Quota{}, fmt.Errorf("quota %q: maxKeys must be a number that is not negative", s)
+	}
+	q.MaxBytes, err = strconv.ParseInt(bytes, 10, 64)
+	if err != nil || q.MaxBytes < 0 {
+		return Quota{}, fmt.Errorf("quota %q: maxBytes must be a number that is not negative", s)
+	}
+	if q.Prefix == "" {
+		return Quota{}, fmt.Errorf("quota %q: prefix is required", s)
+	}
+	return q, nil
+}
+
+// Quotas reports the usage of every quota, in the order they were given.
+func (d *Database) Quotas() []QuotaUsage {
+	out := make([]QuotaUsage, len(d.quotas))
+	for i, q := range d.quotas {
+		out[i] = QuotaUsage{Quota: q.Quota, Keys: q.keys.Load(), Bytes: q.bytes.Load()}
+	}
+	return out
+}
+
+// checkQuotas returns a QuotaError if growing by grow would take any quota over a limit that it adds to, counting the room reserved by other writes.
+// Must be called with the reservation lock held.
+func (d *Database) checkQuotas(grow growth) error {
+	for i, q := range d.quotas {
+		used := usage{keys: q.keys.Load(), bytes: q.bytes.Load()}
+		if exceeds(used, q.reserved, grow.quotas[i], q.MaxKeys, q.MaxBytes) {
+			return &QuotaError{Prefix: q.Prefix, Key: grow.quotaKeys[i]}
+		}
+	}
+	return nil
+}
+
+// account adds to the usage of every quota covering key. Safe under the write lock of key's shard.
+func (s *shard) account(key string, keys int64, bytes int64) {
+	for _, q := range s.quotas {
+		if strings.HasPrefix(key, q.Prefix) {
+			q.keys.Add(keys)
+			q.bytes.Add(bytes)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseQuota(t *testing.T) {
+	tt := []struct {
+		name     string
+		in       string
+		expected Quota
+		err      bool
+	}{
+		{name: "quota should parse", in: "team-a/=100:4096", expected: Quota{Prefix: "team-a/", MaxKeys: 100, MaxBytes: 4096}},
+		{name: "prefix may contain = and :", in: "a=b:=0:10", expected: Quota{Prefix: "a=b:", MaxBytes: 10}},
+		{name: "missing limits should be an error", in: "team-a/", err: true},
+		{name: "missing byte limit should be an error", in: "team-a/=100", err: true},
+		{name: "negative limit should be an error", in: "team-a/=-1:0", err: true},
+		{name: "empty prefix should be an error", in: "=1:1", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := ParseQuota(tc.in)
+			if (err != nil) != tc.err {
+				t.Fatalf("ParseQuota returned %v", err)
+			}
+			if q != tc.expected {
+				t.Errorf("got %+v, expected %+v", q, tc.expected)
+			}
+		})
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	d, err := NewDatabase(WithQuotas(Quota{Prefix: "a/", MaxKeys: 2}, Quota{Prefix: "b/", MaxBytes: 200}), WithEvictionPolicy(EvictLRU), WithMaxKeys(100))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+
+	_ = d.Set("a/1", "value")
+	_ = d.Set("a/2", "value")
+
+	err = d.Set("a/3", "value")
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Prefix != "a/" || !errors.Is(err, ErrQuotaExceeded) || !errors.Is(err, ErrOutOfMemory) {
+		t.Errorf("Set over the key quota returned %v, expected a QuotaError", err)
+	}
+	if err := d.Set("a/1", "new value"); err != nil {
+		t.Errorf("overwriting a key under a full quota returned %v", err)
+	}
+	if err := d.Set("c/1", "value"); err != nil {
+		t.Errorf("Set outside any quota returned %v", err)
+	}
+	if st := d.Stats(); st.Evictions != 0 {
+		t.Errorf("%d keys were evicted for a quota", st.Evictions)
+	}
+
+	_, err = d.Txn([]TxnOp{{Type: TxnSet, Key: "b/1", Value: string(bytes.Repeat([]byte("x"), 200))}})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Txn over the byte quota returned %v, expected ErrQuotaExceeded", err)
+	}
+
+	_ = d.Delete("a/2")
+	if err := d.Set("a/3", "value"); err != nil {
+		t.Errorf("Set after a delete returned %v", err)
+	}
+
+	usage := d.Stats().Quotas
+	if len(usage) != 2 || usage[0].Keys != 2 || usage[0].Bytes == 0 || usage[1].Keys != 0 || usage[1].Bytes != 0 {
+		t.Errorf("Stats returned quotas %+v", usage)
+	}
+}
+
+func TestQuotasAreHard(t *testing.T) {
+	t.Run("transaction should be checked with all of its sets together", func(t *testing.T) {
+		d, err := NewDatabase(WithQuotas(Quota{Prefix: "t/", MaxKeys: 2}))
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		t.Cleanup(func() { _ = d.Close() })
+
+		ops := make([]TxnOp, 10)
+		for i := range ops {
+			ops[i] = TxnOp{Type: TxnSet, Key: "t/" + strconv.Itoa(i), Value: "value"}
+		}
+
+		_, err = d.Txn(ops)
+		var quotaErr *QuotaError
+		if !errors.As(err, &quotaErr) || quotaErr.Prefix != "t/" || quotaErr.Key != "t/0" {
+			t.Errorf("Txn returned %v, expected a QuotaError", err)
+		}
+		if usage := d.Quotas(); usage[0].Keys != 0 {
+			t.Errorf("quota usage is %d keys, expected 0", usage[0].Keys)
+		}
+
+		_, err = d.Txn([]TxnOp{{Type: TxnSet, Key: "t/a", Value: "value"}, {Type: TxnDelete, Key: "t/a"}, {Type: TxnSet, Key: "t/b", Value: "value"}})
+		if err != nil {
+			t.Errorf("Txn within the quota returned %v", err)
+		}
+	})
+
+	t.Run("concurrent writers should never exceed a quota", func(t *testing.T) {
+		d, err := NewDatabase(WithShards(8), WithQuotas(Quota{Prefix: "t/", MaxKeys: 10}))
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		t.Cleanup(func() { _ = d.Close() })
+
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					_ = d.Set("t/"+strconv.Itoa(w)+"/"+strconv.Itoa(i), "value")
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		if usage := d.Quotas(); usage[0].Keys != 10 {
+			t.Errorf("quota usage is %d keys, expected 10", usage[0].Keys)
+		}
+	})
+}
+
+func TestQuotaUsageFollowsExpiryAndSnapshots(t *testing.T) {
+	d, c := newExpiryTestDatabase(t)
+	d.quotas = []*quota{{Quota: Quota{Prefix: "a/", MaxKeys: 1}}}
+	for _, s := range d.shards {
+		s.quotas = d.quotas
+	}
+
+	_ = d.SetWithTTL("a/1", "value", time.Second)
+	c.now = c.now.Add(time.Second)
+	d.reapExpired()
+
+	if err := d.Set("a/2", "value"); err != nil {
+		t.Fatalf("Set after the only key expired returned %v", err)
+	}
+
+	var buf bytes.Buffer
+	_, err := d.DumpSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.LoadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usage := d.Quotas(); usage[0].Keys != 1 {
+		t.Errorf("usage after loading a snapshot is %d keys, expected 1", usage[0].Keys)
+	}
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrStaleRevision is returned by Replicate for changes at or below the database's revision, which it already has.
+	ErrStaleRevision = errors.New("revision already applied")
+	// ErrInvalidReplication is returned, wrapped, by Replicate for changes that cannot have come from a single revision.
+	ErrInvalidReplication = errors.New("invalid replicated changes")
+)
+
+// Replicate applies the changes another database made at one revision, as its watchers received them, so that this database becomes a copy of it.
+// Keys get the versions and expiry they have on the other database and the revision moves up to theirs, skipping any revisions at which nothing changed.
+// Replicated changes are not subject to this database's limits. It is for read-only replicas: writing to a replica directly would make it diverge.
+func (d *Database) Replicate(events []Event) (err error) {
+	if len(events) == 0 {
+		return nil
+	}
+	defer d.observe(OpReplicate, &err)
+
+	if err := initCheck(d); err != nil {
+		return err
+	}
+
+	rev := events[0].Revision
+	keys := make([]string, len(events))
+	ops := make([]walRecord, 0, len(events))
+	for i, e := range events {
+		if e.Revision != rev {
+			return fmt.Errorf("%w: revisions %d and %d", ErrInvalidReplication, rev, e.Revision)
+		}
+		keys[i] = e.Key
+
+		switch e.Type {
+		case EventSet:
+			ops = append(ops, setRecord(e.Key, e.Value, e.ExpiresAt))
+		case EventDelete:
+			ops = append(ops, walRecord{Op: walOpDelete, Key: e.Key})
+		default:
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidReplication, e.Type)
+		}
+	}
+
+	unlock := d.lockShards(OpReplicate, keys)
+	defer unlock()
+
+	rec := walRecord{Op: walOpTxn, Rev: rev, Ops: ops}
+
+	d.seqLock.Lock()
+	if rev <= d.revision {
+		d.seqLock.Unlock()
+		return fmt.Errorf("%w: %d", ErrStaleRevision, rev)
+	}
+
+	err = d.log(rec)
+	d.seqLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	d.apply(rec)
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// byRevision splits events into the changes of each revision.
+func byRevision(events []Event) [][]Event {
+	out := make([][]Event, 0)
+	for i, e := range events {
+		if i == 0 || e.Revision != events[i-1].Revision {
+			out = append(out, []Event{})
+		}
+		out[len(out)-1] = append(out[len(out)-1], e)
+	}
+	return out
+}
+
+func TestReplicate(t *testing.T) {
+	t.Run("Replicate should copy changes with their versions and expiry", func(t *testing.T) {
+		primary, _ := NewDatabase()
+		defer primary.Close()
+
+		w, _ := primary.Watch(WatchOptions{})
+		defer w.Close()
+
+		_ = primary.Set("a", "1")
+		_ = primary.SetWithTTL("b", Blob{ContentType: "image/png", Data: []byte{0xff}}, time.Hour)
+		_ = primary.Delete("missing")
+		_ = primary.Delete("a")
+		_, _ = primary.Txn([]TxnOp{
+			{Type: TxnSet, Key: "c", Value: "1"},
+			{Type: TxnSet, Key: "d", Value: map[string]interface{}{"x": 1.0}},
+		})
+
+		replica, _ := NewDatabase()
+		defer replica.Close()
+
+		rw, _ := replica.Watch(WatchOptions{})
+		defer rw.Close()
+
+		events := next(t, w)
+		for _, changes := range byRevision(events) {
+			err := replica.Replicate(changes)
+			if err != nil {
+				t.Fatalf("Replicate returned an error: %s", err)
+			}
+		}
+
+		if replica.Revision() != primary.Revision() {
+			t.Errorf("replica is at revision %d, primary at %d", replica.Revision(), primary.Revision())
+		}
+
+		for _, key := range []string{"a", "b", "c", "d"} {
+			pv, pver, _ := primary.GetWithVersion(key)
+			rv, rver, _ := replica.GetWithVersion(key)
+			if !reflect.DeepEqual(pv, rv) || pver != rver {
+				t.Errorf("%s: replica has %v at version %d, primary %v at version %d", key, rv, rver, pv, pver)
+			}
+		}
+
+		pttl, _, _ := primary.TTL("b")
+		rttl, _, _ := replica.TTL("b")
+		if rttl <= 0 || pttl-rttl > time.Second {
+			t.Errorf("b has TTL %s on the replica, %s on the primary", rttl, pttl)
+		}
+
+		//The replica's own watchers see the same changes.
+		if got := summarize(next(t, rw)); !reflect.DeepEqual(got, summarize(events)) {
+			t.Errorf("replica watch got %v, want %v", got, summarize(events))
+		}
+	})
+
+	t.Run("Replicate should reject revisions it already has", func(t *testing.T) {
+		replica, _ := NewDatabase()
+		defer replica.Close()
+
+		_ = replica.Replicate([]Event{{Revision: 5, Type: EventSet, Key: "a", Value: "1"}})
+
+		err := replica.Replicate([]Event{{Revision: 5, Type: EventSet, Key: "a", Value: "2"}})
+		if !errors.Is(err, ErrStaleRevision) {
+			t.Errorf("Replicate returned %v, expected ErrStaleRevision", err)
+		}
+
+		if v, _ := replica.Get("a"); v != "1" {
+			t.Errorf("a is %v, expected 1", v)
+		}
+	})
+
+	t.Run("Replicate should reject changes from several revisions", func(t *testing.T) {
+		replica, _ := NewDatabase()
+		defer replica.Close()
+
+		err := replica.Replicate([]Event{
+			{Revision: 1, Type: EventSet, Key: "a", Value: "1"},
+			{Revision: 2, Type: EventSet, Key: "b", Value: "1"},
+		})
+		if !errors.Is(err, ErrInvalidReplication) {
+			t.Errorf("Replicate returned %v, expected ErrInvalidReplication", err)
+		}
+	})
+}
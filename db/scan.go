@@ -0,0 +1,68 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrInvalidScan is returned, wrapped, when scan options are malformed.
+var ErrInvalidScan = errors.New("invalid scan")
+
+// ScanOptions selects a page of keys in lexicographic order.
+// Keys must have Prefix, be at or after Start and before End (when set), and come strictly after After, which is how a page is continued.
+type ScanOptions struct {
+	Prefix string
+	Start  string
+	End    string
+	After  string
+	Limit  int
+}
+
+// ScanPage is one page of a scan. Next is the key to pass as ScanOptions.After to fetch the following page, or empty if this is the last page.
+type ScanPage struct {
+	Keys []string
+	Next string
+}
+
+// Scan returns keys in order from the shards' ordered indexes, walking only the requested range rather than sorting every key.
+// Each shard contributes at most Limit+1 keys, which are merged into the page.
+// Like GetAllKeys, shards are read one at a time, so a page is not a point-in-time snapshot across shards.
+func (d *Database) Scan(opts ScanOptions) (_ ScanPage, err error) {
+	defer d.observe(OpScan, &err)
+
+	if opts.Limit <= 0 {
+		return ScanPage{}, fmt.Errorf("%w: limit must be positive", ErrInvalidScan)
+	}
+
+	if err := initCheck(d); err != nil {
+		return ScanPage{}, err
+	}
+
+	r := keyRange{Prefix: opts.Prefix, Start: opts.Start, End: opts.End, After: opts.After}
+	now := d.now()
+	candidates := make([]string, 0)
+
+	for _, s := range d.shards {
+		d.rlock(s, OpScan)
+		found := 0
+		for n := s.index.seek(r.lowerBound()); n != nil && !r.beyond(n.key) && found <= opts.Limit; n = n.next[0] {
+			if s.entries[n.key].expired(now) {
+				continue
+			}
+			candidates = append(candidates, n.key)
+			found++
+		}
+		s.lock.RUnlock()
+	}
+
+	sort.Strings(candidates)
+
+	page := ScanPage{Keys: candidates}
+	if len(candidates) > opts.Limit {
+		page.Keys = candidates[:opts.Limit]
+		page.Next = page.Keys[opts.Limit-1]
+	}
+
+	return page, nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	db, c := newExpiryTestDatabase(t)
+	for _, k := range []string{"user:3", "user:1", "order:1", "user:2", "user:10", "zebra", "apple"} {
+		_ = db.Set(k, "value")
+	}
+	_ = db.SetWithTTL("user:15", "value", time.Second)
+	c.now = c.now.Add(time.Minute)
+
+	tt := []struct {
+		name     string
+		opts     ScanOptions
+		expected []string
+		next     string
+	}{
+		{
+			name:     "all keys in order",
+			opts:     ScanOptions{Limit: 100},
+			expected: []string{"apple", "order:1", "user:1", "user:10", "user:2", "user:3", "zebra"},
+		},
+		{
+			name:     "prefix",
+			opts:     ScanOptions{Prefix: "user:", Limit: 100},
+			expected: []string{"user:1", "user:10", "user:2", "user:3"},
+		},
+		{
+			name:     "start inclusive and end exclusive",
+			opts:     ScanOptions{Start: "order:1", End: "user:2", Limit: 100},
+			expected: []string{"order:1", "user:1", "user:10"},
+		},
+		{
+			name:     "prefix within range",
+			opts:     ScanOptions{Prefix: "user:", Start: "user:2", Limit: 100},
+			expected: []string{"user:2", "user:3"},
+		},
+		{
+			name:     "limit returns a continuation",
+			opts:     ScanOptions{Prefix: "user:", Limit: 2},
+			expected: []string{"user:1", "user:10"},
+			next:     "user:10",
+		},
+		{
+			name:     "continuation resumes after the cursor",
+			opts:     ScanOptions{Prefix: "user:", After: "user:10", Limit: 2},
+			expected: []string{"user:2", "user:3"},
+		},
+		{
+			name:     "no matches",
+			opts:     ScanOptions{Prefix: "missing", Limit: 10},
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := db.Scan(tc.opts)
+			if err != nil {
+				t.Fatalf("Scan returned an error: %s", err)
+			}
+
+			if !reflect.DeepEqual(page.Keys, tc.expected) {
+				t.Errorf("Scan returned %v, expected %v", page.Keys, tc.expected)
+			}
+
+			if page.Next != tc.next {
+				t.Errorf("Scan returned next %q, expected %q", page.Next, tc.next)
+			}
+		})
+	}
+
+	t.Run("deleted keys should leave the index", func(t *testing.T) {
+		_ = db.Delete("apple")
+
+		page, _ := db.Scan(ScanOptions{End: "b", Limit: 10})
+		if len(page.Keys) != 0 {
+			t.Errorf("Scan returned %v after delete", page.Keys)
+		}
+	})
+
+	t.Run("non-positive limit should error", func(t *testing.T) {
+		_, err := db.Scan(ScanOptions{})
+		if !errors.Is(err, ErrInvalidScan) {
+			t.Errorf("Scan returned %v, expected ErrInvalidScan", err)
+		}
+	})
+}
+
+func TestScanPaginatesEverything(t *testing.T) {
+	db, _ := NewDatabase()
+	for i := 0; i < 250; i++ {
+		_ = db.Set(fmt.Sprintf("key%04d", i), i)
+	}
+
+	var all []string
+	opts := ScanOptions{Limit: 40}
+	for {
+		page, err := db.Scan(opts)
+		if err != nil {
+			t.Fatalf("Scan returned an error: %s", err)
+		}
+		all = append(all, page.Keys...)
+		if page.Next == "" {
+			break
+		}
+		opts.After = page.Next
+	}
+
+	if len(all) != 250 {
+		t.Fatalf("pagination returned %d keys, expected 250", len(all))
+	}
+
+	for i, k := range all {
+		if k != fmt.Sprintf("key%04d", i) {
+			t.Fatalf("key %d is %s", i, k)
+		}
+	}
+}
+
+func BenchmarkDatabase_Scan(b *testing.B) {
+	db, _ := NewDatabase()
+	for i := 0; i < 100000; i++ {
+		_ = db.Set(fmt.Sprintf("key%06d", i), i)
+	}
+
+	for n := 0; n < b.N; n++ {
+		_, _ = db.Scan(ScanOptions{Prefix: "key05", Limit: 100})
+	}
+}
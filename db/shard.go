@@ -0,0 +1,222 @@
+package db
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultShards = 32
+
+// WithShards sets how many independently locked partitions the keyspace is split into, rounded up to a power of two. Defaults to 32.
+func WithShards(n int) Option {
+	return func(o *options) {
+		o.shards = n
+	}
+}
+
+// shard owns every key that hashes to it, along with the index and expiry bookkeeping for those keys.
+// All fields are guarded by lock.
+type shard struct {
+	id   int
+	lock sync.RWMutex
+
+	entries map[string]*entry
+
+	//Every key in entries, in order, for range scans.
+	index *skipList
+
+	//Keys set with a TTL, sampled by the reaper.
+	volatile map[string]struct{}
+
+	//Totals for the shard, readable without the lock.
+	keys  atomic.Int64
+	bytes atomic.Int64
+
+	//The database's quotas, which every shard adds its keys to.
+	quotas []*quota
+}
+
+type entry struct {
+	value interface{}
+
+	//The revision of the mutation that last wrote the key.
+	version uint64
+
+	//Unix nanoseconds, or 0 if the key does not expire.
+	expiresAt int64
+
+	//Approximate memory held by the key and value.
+	size int64
+
+	//Read and written under a read lock, for LRU and LFU eviction.
+	lastAccess atomic.Int64
+	hits       atomic.Uint32
+}
+
+func newShard(id int) *shard {
+	return &shard{
+		id:       id,
+		entries:  make(map[string]*entry),
+		index:    newSkipList(),
+		volatile: make(map[string]struct{}),
+	}
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return e.expiresAt != 0 && now.UnixNano() >= e.expiresAt
+}
+
+// get returns the live entry for key, or nil if it is absent or expired. Must be called with the lock held.
+func (s *shard) get(key string, now time.Time) *entry {
+	e, ok := s.entries[key]
+	if !ok || e.expired(now) {
+		return nil
+	}
+	return e
+}
+
+// version returns the current version of key, or 0 if it is absent or expired. Must be called with the lock held.
+func (s *shard) version(key string, now time.Time) uint64 {
+	e := s.get(key, now)
+	if e == nil {
+		return 0
+	}
+	return e.version
+}
+
+// set stores a logged set, counting it as an access at now. Must be called with the write lock held.
+func (s *shard) set(rec walRecord, now time.Time) {
+	var newKeys int64
+	e, ok := s.entries[rec.Key]
+	if !ok {
+		e = &entry{}
+		s.entries[rec.Key] = e
+		s.index.insert(rec.Key)
+		s.keys.Add(1)
+		newKeys = 1
+	}
+
+	size := entrySize(rec.Key, rec.Value)
+	s.bytes.Add(size - e.size)
+	s.account(rec.Key, newKeys, size-e.size)
+
+	e.value = rec.Value
+	e.version = rec.Rev
+	e.expiresAt = rec.ExpiresAt
+	e.size = size
+	e.lastAccess.Store(now.UnixNano())
+	e.hits.Add(1)
+
+	if rec.ExpiresAt != 0 {
+		s.volatile[rec.Key] = struct{}{}
+	} else {
+		delete(s.volatile, rec.Key)
+	}
+}
+
+// clear drops every key. Must be called with the write lock held.
+func (s *shard) clear() {
+	if len(s.quotas) > 0 {
+		for k, e := range s.entries {
+			s.account(k, -1, -e.size)
+		}
+	}
+
+	s.entries = make(map[string]*entry)
+	s.index = newSkipList()
+	s.volatile = make(map[string]struct{})
+	s.keys.Store(0)
+	s.bytes.Store(0)
+}
+
+// remove drops key and everything tracked about it. Must be called with the write lock held.
+func (s *shard) remove(key string) {
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+
+	s.keys.Add(-1)
+	s.bytes.Add(-e.size)
+	s.account(key, -1, -e.size)
+
+	delete(s.entries, key)
+	delete(s.volatile, key)
+	s.index.remove(key)
+}
+
+// shardFor hashes key with FNV-1a to pick its shard.
+func (d *Database) shardFor(key string) *shard {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return d.shards[h&d.mask]
+}
+
+// lockShards write-locks the shards owning keys for op, in a fixed order so that concurrent multi-shard operations cannot deadlock.
+// It returns the function that unlocks them.
+func (d *Database) lockShards(op Op, keys []string) func() {
+	seen := make(map[*shard]bool, len(keys))
+	locked := make([]*shard, 0, len(keys))
+	for _, k := range keys {
+		s := d.shardFor(k)
+		if !seen[s] {
+			seen[s] = true
+			locked = append(locked, s)
+		}
+	}
+
+	sort.Slice(locked, func(i, j int) bool { return locked[i].id < locked[j].id })
+
+	for _, s := range locked {
+		d.lock(s, op)
+	}
+
+	return func() {
+		for _, s := range locked {
+			s.lock.Unlock()
+		}
+	}
+}
+
+// lockAll write-locks every shard, in order, and returns the function that unlocks them.
+func (d *Database) lockAll() func() {
+	for _, s := range d.shards {
+		s.lock.Lock()
+	}
+
+	return func() {
+		for _, s := range d.shards {
+			s.lock.Unlock()
+		}
+	}
+}
+
+// rlockAll read-locks every shard, stopping all writes, and returns the function that unlocks them.
+func (d *Database) rlockAll() func() {
+	for _, s := range d.shards {
+		s.lock.RLock()
+	}
+
+	return func() {
+		for _, s := range d.shards {
+			s.lock.RUnlock()
+		}
+	}
+}
+
+func shardCount(n int) int {
+	if n <= 0 {
+		n = defaultShards
+	}
+
+	count := 1
+	for count < n {
+		count <<= 1
+	}
+	return count
+}
@@ -0,0 +1,318 @@
+package db
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotExt = ".snap"
+
+var (
+	// ErrPersistenceDisabled is returned by persistence operations on a database created without WithWAL.
+	ErrPersistenceDisabled = errors.New("persistence is not enabled")
+	// ErrPersistenceEnabled is returned by LoadSnapshot on a database created with WithWAL.
+	ErrPersistenceEnabled = errors.New("persistence is enabled")
+)
+
+// SnapshotInfo describes a snapshot that has been written to disk.
+type SnapshotInfo struct {
+	Seq      uint64        `json:"seq"`
+	Keys     int           `json:"keys"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ISnapshotter is implemented by databases that can write a point-in-time snapshot on demand.
+type ISnapshotter interface {
+	Snapshot() (SnapshotInfo, error)
+}
+
+// WithSnapshotInterval takes a snapshot every interval in the background.
+// It has no effect unless WithWAL is also given.
+func WithSnapshotInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.snapshotInterval = interval
+	}
+}
+
+// Snapshot writes the full contents of the database to a compressed snapshot file and removes the log segments and snapshots it supersedes.
+// Writers are only blocked while the log is rotated and the shards are copied; encoding and syncing the file happen outside the locks.
+func (d *Database) Snapshot() (SnapshotInfo, error) {
+	d.snapshotLock.Lock()
+	defer d.snapshotLock.Unlock()
+
+	start := time.Now()
+
+	//Holding every shard's read lock stops all writes, so rotating the log now means the copy reflects exactly the records in segments below seq.
+	unlock := d.rlockAll()
+
+	d.seqLock.Lock()
+	if d.wal == nil {
+		d.seqLock.Unlock()
+		unlock()
+		return SnapshotInfo{}, ErrPersistenceDisabled
+	}
+
+	seq, err := d.wal.rotate()
+	revision := d.revision
+	dir := d.wal.cfg.Dir
+	d.seqLock.Unlock()
+
+	if err != nil {
+		unlock()
+		return SnapshotInfo{}, err
+	}
+
+	records := d.snapshotRecords(revision)
+	unlock()
+
+	size, err := writeSnapshot(dir, seq, records)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	err = removeSeqsBefore(dir, snapshotExt, seq)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("removing old snapshots: %w", err)
+	}
+
+	err = removeSeqsBefore(dir, segmentExt, seq)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("truncating wal: %w", err)
+	}
+
+	return SnapshotInfo{
+		Seq:      seq,
+		Keys:     len(records) - 1,
+		Bytes:    size,
+		Duration: time.Since(start),
+	}, nil
+}
+
+// DumpSnapshot writes the full contents of the database to w in the snapshot format, returning the revision it reflects.
+// Like Snapshot, writers are only blocked while the shards are copied.
+func (d *Database) DumpSnapshot(w io.Writer) (uint64, error) {
+	if err := initCheck(d); err != nil {
+		return 0, err
+	}
+
+	unlock := d.rlockAll()
+	d.seqLock.Lock()
+	revision := d.revision
+	d.seqLock.Unlock()
+	records := d.snapshotRecords(revision)
+	unlock()
+
+	return revision, encodeSnapshot(w, records)
+}
+
+// LoadSnapshot replaces the entire contents of the database, including its revision, with a snapshot written by DumpSnapshot.
+// The changes between the old and new contents are not known, so open watches end with ErrCompacted.
+// It is for databases whose state is kept elsewhere, such as in a replicated log, and fails if the database has its own write-ahead log.
+func (d *Database) LoadSnapshot(r io.Reader) error {
+	if err := initCheck(d); err != nil {
+		return err
+	}
+
+	d.seqLock.Lock()
+	persistent := d.wal != nil
+	d.seqLock.Unlock()
+	if persistent {
+		return ErrPersistenceEnabled
+	}
+
+	records := make([]walRecord, 0)
+	err := decodeSnapshot(r, func(rec walRecord) {
+		records = append(records, rec)
+	})
+	if err != nil {
+		return err
+	}
+
+	unlock := d.lockAll()
+	defer unlock()
+
+	d.seqLock.Lock()
+	defer d.seqLock.Unlock()
+
+	for _, s := range d.shards {
+		s.clear()
+	}
+	d.revision = 0
+	for _, rec := range records {
+		d.restore(rec)
+	}
+	d.watches.reset(d.revision)
+
+	return nil
+}
+
+// snapshotRecords copies every live key. Must be called with every shard locked and no writes after revision.
+func (d *Database) snapshotRecords(revision uint64) []walRecord {
+	now := d.now()
+	records := []walRecord{{Op: walOpRevision, Rev: revision}}
+	for _, s := range d.shards {
+		for k, e := range s.entries {
+			if e.expired(now) {
+				continue
+			}
+			records = append(records, walRecord{Op: walOpSet, Key: k, Value: e.value, ExpiresAt: e.expiresAt, Rev: e.version})
+		}
+	}
+	return records
+}
+
+func (d *Database) snapshotLoop(interval time.Duration) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := d.Snapshot()
+			if err != nil {
+				d.logger.Error("taking background snapshot", "err", err)
+			}
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// writeSnapshot atomically writes records as snapshot seq in dir, returning the size of the file.
+func writeSnapshot(dir string, seq uint64, records []walRecord) (int64, error) {
+	path := seqPath(dir, seq, snapshotExt)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("creating snapshot: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	err = encodeSnapshot(f, records)
+	if err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		_ = f.Close()
+		return 0, fmt.Errorf("syncing snapshot: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return 0, fmt.Errorf("renaming snapshot: %w", err)
+	}
+
+	return info.Size(), syncDir(dir)
+}
+
+func encodeSnapshot(w io.Writer, records []walRecord) error {
+	bw := bufio.NewWriter(w)
+	zw := gzip.NewWriter(bw)
+
+	var buf []byte
+	var err error
+	for _, rec := range records {
+		buf, err = appendRecord(buf[:0], rec)
+		if err != nil {
+			return err
+		}
+
+		_, err = zw.Write(buf)
+		if err != nil {
+			return fmt.Errorf("writing snapshot: %w", err)
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+
+	return bw.Flush()
+}
+
+// loadLatestSnapshot applies the newest snapshot in dir and returns its sequence number, or 0 if there is none.
+func loadLatestSnapshot(dir string, apply func(walRecord)) (uint64, error) {
+	//Leftovers from a snapshot that was interrupted before its rename.
+	tmps, _ := filepath.Glob(filepath.Join(dir, "*"+snapshotExt+".tmp"))
+	for _, tmp := range tmps {
+		_ = os.Remove(tmp)
+	}
+
+	seqs, err := listSeqs(dir, snapshotExt)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(seqs) == 0 {
+		return 0, nil
+	}
+	seq := seqs[len(seqs)-1]
+
+	f, err := os.Open(seqPath(dir, seq, snapshotExt))
+	if err != nil {
+		return 0, fmt.Errorf("opening snapshot: %w", err)
+	}
+	defer f.Close()
+
+	err = decodeSnapshot(bufio.NewReader(f), apply)
+	if err != nil {
+		return 0, fmt.Errorf("snapshot %d: %w", seq, err)
+	}
+
+	return seq, nil
+}
+
+// decodeSnapshot applies each record of a snapshot written by encodeSnapshot.
+func decodeSnapshot(r io.Reader, apply func(walRecord)) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(zr)
+	for {
+		rec, _, err := readRecord(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		apply(rec)
+	}
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
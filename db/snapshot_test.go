@@ -0,0 +1,204 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Run("Snapshot should error when persistence is disabled", func(t *testing.T) {
+		db, _ := NewDatabase()
+
+		_, err := db.Snapshot()
+		if !errors.Is(err, ErrPersistenceDisabled) {
+			t.Errorf("Snapshot returned %v, expected ErrPersistenceDisabled", err)
+		}
+	})
+
+	t.Run("Snapshot should truncate old segments and restore on reopen", func(t *testing.T) {
+		cfg := WALConfig{Dir: t.TempDir(), Sync: SyncAlways}
+
+		db, err := NewDatabase(WithWAL(cfg))
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+
+		_ = db.Set("key1", "value1")
+		_ = db.Set("key2", map[string]interface{}{"nested": "value"})
+		_ = db.Set("key3", "value3")
+
+		info, err := db.Snapshot()
+		if err != nil {
+			t.Fatalf("Snapshot returned an error: %s", err)
+		}
+
+		if info.Keys != 3 {
+			t.Errorf("Snapshot reported %d keys, expected 3", info.Keys)
+		}
+
+		//Writes after the snapshot must come back from the log.
+		_ = db.Delete("key3")
+		_ = db.Set("key4", "value4")
+
+		_, err = db.Snapshot()
+		if err != nil {
+			t.Fatalf("second Snapshot returned an error: %s", err)
+		}
+		_ = db.Set("key5", "value5")
+		_ = db.Close()
+
+		segments, _ := listSeqs(cfg.Dir, segmentExt)
+		if len(segments) != 1 {
+			t.Errorf("expected 1 wal segment after snapshot, found %d", len(segments))
+		}
+
+		snapshots, _ := listSeqs(cfg.Dir, snapshotExt)
+		if len(snapshots) != 1 {
+			t.Errorf("expected 1 snapshot file, found %d", len(snapshots))
+		}
+
+		db, err = NewDatabase(WithWAL(cfg))
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error on reopen: %s", err)
+		}
+		defer db.Close()
+
+		expected := map[string]interface{}{
+			"key1": "value1",
+			"key4": "value4",
+			"key5": "value5",
+		}
+
+		if len(contents(db)) != 4 {
+			t.Errorf("restored database has %d keys, expected 4", len(contents(db)))
+		}
+
+		for k, v := range expected {
+			if contents(db)[k] != v {
+				t.Errorf("%s: got %v, want %v", k, contents(db)[k], v)
+			}
+		}
+
+		nested, ok := contents(db)["key2"].(map[string]interface{})
+		if !ok || nested["nested"] != "value" {
+			t.Errorf("key2: got %v, want map with nested value", contents(db)["key2"])
+		}
+	})
+
+	t.Run("Snapshot interval should snapshot in the background", func(t *testing.T) {
+		cfg := WALConfig{Dir: t.TempDir(), Sync: SyncNever}
+
+		db, err := NewDatabase(WithWAL(cfg), WithSnapshotInterval(10*time.Millisecond))
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		defer db.Close()
+
+		_ = db.Set("key", "value")
+
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			snapshots, _ := listSeqs(cfg.Dir, snapshotExt)
+			if len(snapshots) > 0 {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Error("no snapshot was written in the background")
+	})
+}
+
+func TestSnapshotConcurrentWrites(t *testing.T) {
+	db, err := NewDatabase(WithWAL(WALConfig{Dir: t.TempDir(), Sync: SyncNever}))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 1000; i++ {
+		_ = db.Set(string(rune('a'+i%26))+time.Duration(i).String(), "value")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = db.Snapshot()
+	}()
+
+	for i := 0; i < 100; i++ {
+		_, _ = db.Get("a0s")
+		_ = db.Set("concurrent", i)
+	}
+	<-done
+}
+
+func TestDumpAndLoadSnapshot(t *testing.T) {
+	src, _ := NewDatabase()
+	defer src.Close()
+
+	_ = src.Set("key1", "value1")
+	_ = src.Set("key2", Blob{ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}})
+	_ = src.SetWithTTL("key3", "value3", time.Hour)
+	_ = src.Delete("key1")
+
+	var buf bytes.Buffer
+	rev, err := src.DumpSnapshot(&buf)
+	dump := buf.Bytes()
+	if err != nil {
+		t.Fatalf("DumpSnapshot returned an error: %s", err)
+	}
+	if rev != 4 {
+		t.Errorf("DumpSnapshot returned revision %d, expected 4", rev)
+	}
+
+	dst, _ := NewDatabase()
+	defer dst.Close()
+	_ = dst.Set("stale", "gone after load")
+
+	w, _ := dst.Watch(WatchOptions{})
+	defer w.Close()
+
+	err = dst.LoadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("LoadSnapshot returned an error: %s", err)
+	}
+
+	keys, _ := dst.GetAllKeys()
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"key2", "key3"}) {
+		t.Errorf("LoadSnapshot left keys %v, expected [key2 key3]", keys)
+	}
+
+	value, version, _ := dst.GetWithVersion("key2")
+	if !reflect.DeepEqual(value, Blob{ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}}) || version != 2 {
+		t.Errorf("key2 loaded as %v at version %d, expected the blob at version 2", value, version)
+	}
+
+	ttl, _, _ := dst.TTL("key3")
+	if ttl <= 0 || ttl > time.Hour {
+		t.Errorf("key3 loaded with TTL %s, expected up to an hour", ttl)
+	}
+
+	results, _ := dst.Txn([]TxnOp{{Type: TxnSet, Key: "key4", Value: "value4"}})
+	if results[0].Version != 5 {
+		t.Errorf("first write after LoadSnapshot got version %d, expected 5", results[0].Version)
+	}
+
+	_, err = w.Next(context.Background())
+	if !errors.Is(err, ErrCompacted) {
+		t.Errorf("open watch ended with %v, expected ErrCompacted", err)
+	}
+
+	persistent, _ := NewDatabase(WithWAL(WALConfig{Dir: t.TempDir()}))
+	defer persistent.Close()
+
+	err = persistent.LoadSnapshot(bytes.NewReader(dump))
+	if !errors.Is(err, ErrPersistenceEnabled) {
+		t.Errorf("LoadSnapshot into a database with a wal returned %v, expected ErrPersistenceEnabled", err)
+	}
+}
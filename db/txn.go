@@ -0,0 +1,192 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxTxnOps is the most operations a single transaction may contain.
+const MaxTxnOps = 1000
+
+// ErrInvalidTxn is returned, wrapped, when a transaction is malformed. Nothing is applied.
+var ErrInvalidTxn = errors.New("invalid transaction")
+
+type TxnOpType string
+
+const (
+	TxnGet    TxnOpType = "get"
+	TxnSet    TxnOpType = "set"
+	TxnDelete TxnOpType = "delete"
+)
+
+// TxnOp is a single operation within a transaction.
+// If IfVersion is set, the key must be at exactly that version (0 meaning absent) when the operation runs, or the whole transaction is aborted.
+// The version a transaction writes is only known once it commits, so a precondition on a key set earlier in the same transaction always fails.
+// A set expires after TTL, or at ExpiresAt if that is given instead, as when the expiry was decided on another node.
+// A set with neither gets the database's default TTL, if it has one.
+type TxnOp struct {
+	Type      TxnOpType
+	Key       string
+	Value     interface{}
+	TTL       time.Duration
+	ExpiresAt time.Time
+	IfVersion *uint64
+}
+
+// TxnResult is the outcome of one operation. For gets and deletes, Found reports whether the key existed;
+// Value and Version are what a get read, or the version a set wrote.
+type TxnResult struct {
+	Key     string      `json:"key"`
+	Value   interface{} `json:"value,omitempty"`
+	Version uint64      `json:"version"`
+	Found   bool        `json:"found"`
+}
+
+// TxnConflictError is returned when an operation's version precondition fails. It matches ErrVersionMismatch.
+type TxnConflictError struct {
+	Index    int
+	Key      string
+	Expected uint64
+	Actual   uint64
+}
+
+func (e *TxnConflictError) Error() string {
+	return fmt.Sprintf("operation %d on %q: expected version %d, found %d", e.Index, e.Key, e.Expected, e.Actual)
+}
+
+func (e *TxnConflictError) Unwrap() error {
+	return ErrVersionMismatch
+}
+
+// ITransactor is implemented by databases that can apply several operations atomically.
+type ITransactor interface {
+	Txn(ops []TxnOp) ([]TxnResult, error)
+}
+
+type stagedKey struct {
+	value   interface{}
+	version uint64
+	exists  bool
+
+	//Written earlier in the transaction, so its version is the one the transaction will commit at.
+	pending bool
+}
+
+// Txn applies ops in order, all or nothing, holding the write locks of every shard the transaction touches.
+// Each operation sees the effects of the ones before it. Every write in the transaction gets the same new version,
+// and the writes are logged as one record so a crash can never leave half a transaction applied.
+func (d *Database) Txn(ops []TxnOp) (_ []TxnResult, err error) {
+	defer d.observe(OpTxn, &err)
+
+	err = ValidateTxn(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := initCheck(d); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(ops))
+	for i, op := range ops {
+		keys[i] = op.Key
+	}
+	unlock := d.lockShards(OpTxn, keys)
+	defer unlock()
+
+	now := d.now()
+	staged := make(map[string]*stagedKey)
+	results := make([]TxnResult, len(ops))
+	pending := make([]int, 0)
+	writes := make([]walRecord, 0, len(ops))
+
+	for i, op := range ops {
+		s, ok := staged[op.Key]
+		if !ok {
+			s = &stagedKey{}
+			if e := d.shardFor(op.Key).get(op.Key, now); e != nil {
+				s.value, s.version, s.exists = e.value, e.version, true
+				d.touch(e, now)
+			}
+			staged[op.Key] = s
+		}
+
+		if op.IfVersion != nil && (s.pending || *op.IfVersion != s.version) {
+			return nil, &TxnConflictError{Index: i, Key: op.Key, Expected: *op.IfVersion, Actual: s.version}
+		}
+
+		results[i] = TxnResult{Key: op.Key, Found: s.exists}
+
+		switch op.Type {
+		case TxnGet:
+			results[i].Value = s.value
+			results[i].Version = s.version
+			if s.pending {
+				pending = append(pending, i)
+			}
+		case TxnSet:
+			expiresAt := op.ExpiresAt
+			if op.TTL > 0 || expiresAt.IsZero() {
+				expiresAt = d.expiry(now, op.TTL)
+			}
+			writes = append(writes, setRecord(op.Key, op.Value, expiresAt))
+
+			s.value, s.version, s.exists, s.pending = op.Value, 0, true, true
+			pending = append(pending, i)
+		case TxnDelete:
+			writes = append(writes, walRecord{Op: walOpDelete, Key: op.Key})
+
+			s.value, s.version, s.exists, s.pending = nil, 0, false, false
+		}
+	}
+
+	if len(writes) == 0 {
+		return results, nil
+	}
+
+	//Only once every precondition has held, so that nothing is evicted for a transaction that is then aborted.
+	release, err := d.admit(writes, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rev, err := d.commit(walRecord{Op: walOpTxn, Ops: writes})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range pending {
+		results[i].Version = rev
+	}
+
+	return results, nil
+}
+
+// ValidateTxn checks ops the way Txn does before applying anything, so a malformed transaction can be rejected before it is sent elsewhere.
+func ValidateTxn(ops []TxnOp) error {
+	if len(ops) == 0 {
+		return fmt.Errorf("%w: no operations", ErrInvalidTxn)
+	}
+	if len(ops) > MaxTxnOps {
+		return fmt.Errorf("%w: more than %d operations", ErrInvalidTxn, MaxTxnOps)
+	}
+
+	for i, op := range ops {
+		if op.Key == "" {
+			return fmt.Errorf("%w: operation %d has no key", ErrInvalidTxn, i)
+		}
+		if op.TTL < 0 {
+			return fmt.Errorf("%w: operation %d: %s", ErrInvalidTxn, i, ErrInvalidTTL)
+		}
+
+		switch op.Type {
+		case TxnGet, TxnSet, TxnDelete:
+		default:
+			return fmt.Errorf("%w: operation %d has unknown type %q", ErrInvalidTxn, i, op.Type)
+		}
+	}
+
+	return nil
+}
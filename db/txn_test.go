@@ -0,0 +1,184 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func uintPtr(v uint64) *uint64 {
+	return &v
+}
+
+func TestTxn(t *testing.T) {
+	t.Run("Txn should move a value between keys atomically", func(t *testing.T) {
+		db, _ := NewDatabase()
+		_ = db.Set("from", "value")
+		_, from, _ := db.GetWithVersion("from")
+
+		results, err := db.Txn([]TxnOp{
+			{Type: TxnGet, Key: "from", IfVersion: uintPtr(from)},
+			{Type: TxnSet, Key: "to", Value: "value", IfVersion: uintPtr(0)},
+			{Type: TxnDelete, Key: "from"},
+		})
+		if err != nil {
+			t.Fatalf("Txn returned an error: %s", err)
+		}
+
+		if len(results) != 3 {
+			t.Fatalf("Txn returned %d results, expected 3", len(results))
+		}
+
+		if results[0].Value != "value" || results[0].Version != from || !results[0].Found {
+			t.Errorf("get result: %+v", results[0])
+		}
+
+		if results[1].Version <= from || results[1].Found {
+			t.Errorf("set result: %+v", results[1])
+		}
+
+		if !results[2].Found {
+			t.Errorf("delete result: %+v", results[2])
+		}
+
+		if v, _ := db.Get("from"); v != nil {
+			t.Errorf("from still present: %v", v)
+		}
+
+		if v, ver, _ := db.GetWithVersion("to"); v != "value" || ver != results[1].Version {
+			t.Errorf("to: got %v at version %d", v, ver)
+		}
+	})
+
+	t.Run("Txn should apply nothing if a precondition fails", func(t *testing.T) {
+		db, _ := NewDatabase()
+		_ = db.Set("a", "a1")
+		_ = db.Set("b", "b1")
+		_, a, _ := db.GetWithVersion("a")
+		_, b, _ := db.GetWithVersion("b")
+
+		_, err := db.Txn([]TxnOp{
+			{Type: TxnSet, Key: "a", Value: "a2", IfVersion: uintPtr(a)},
+			{Type: TxnSet, Key: "b", Value: "b2", IfVersion: uintPtr(b - 1)},
+		})
+
+		var conflict *TxnConflictError
+		if !errors.As(err, &conflict) || !errors.Is(err, ErrVersionMismatch) {
+			t.Fatalf("Txn returned %v, expected a TxnConflictError", err)
+		}
+
+		if conflict.Index != 1 || conflict.Key != "b" || conflict.Actual != b {
+			t.Errorf("unexpected conflict: %+v", conflict)
+		}
+
+		if v, _ := db.Get("a"); v != "a1" {
+			t.Errorf("a was changed by an aborted transaction: %v", v)
+		}
+	})
+
+	t.Run("later operations should see earlier ones", func(t *testing.T) {
+		db, _ := NewDatabase()
+
+		results, err := db.Txn([]TxnOp{
+			{Type: TxnSet, Key: "key", Value: "value"},
+			{Type: TxnGet, Key: "key"},
+			{Type: TxnDelete, Key: "key"},
+			{Type: TxnGet, Key: "key", IfVersion: uintPtr(0)},
+		})
+		if err != nil {
+			t.Fatalf("Txn returned an error: %s", err)
+		}
+
+		if results[1].Value != "value" || !results[1].Found {
+			t.Errorf("get after set: %+v", results[1])
+		}
+
+		if results[3].Found {
+			t.Errorf("get after delete: %+v", results[3])
+		}
+	})
+
+	t.Run("read only transaction should not change the revision", func(t *testing.T) {
+		db, _ := NewDatabase()
+		_ = db.Set("key", "value")
+		before := db.revision
+
+		_, err := db.Txn([]TxnOp{{Type: TxnGet, Key: "key"}})
+		if err != nil {
+			t.Fatalf("Txn returned an error: %s", err)
+		}
+
+		if db.revision != before {
+			t.Errorf("revision changed from %d to %d", before, db.revision)
+		}
+	})
+
+	t.Run("set should expire at an absolute ExpiresAt", func(t *testing.T) {
+		db, _ := NewDatabase()
+		expiresAt := time.Now().Add(time.Hour)
+
+		_, err := db.Txn([]TxnOp{{Type: TxnSet, Key: "key", Value: "value", ExpiresAt: expiresAt}})
+		if err != nil {
+			t.Fatalf("Txn returned an error: %s", err)
+		}
+
+		s := db.shardFor("key")
+		if got := s.entries["key"].expiresAt; got != expiresAt.UnixNano() {
+			t.Errorf("key expires at %d, expected %d", got, expiresAt.UnixNano())
+		}
+	})
+}
+
+func TestTxnValidation(t *testing.T) {
+	tt := []struct {
+		name string
+		ops  []TxnOp
+	}{
+		{name: "no operations", ops: nil},
+		{name: "missing key", ops: []TxnOp{{Type: TxnGet}}},
+		{name: "unknown type", ops: []TxnOp{{Type: "incr", Key: "key"}}},
+		{name: "negative ttl", ops: []TxnOp{{Type: TxnSet, Key: "key", TTL: -1}}},
+		{name: "too many operations", ops: make([]TxnOp, MaxTxnOps+1)},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := NewDatabase()
+
+			_, err := db.Txn(tc.ops)
+			if !errors.Is(err, ErrInvalidTxn) {
+				t.Errorf("Txn returned %v, expected ErrInvalidTxn", err)
+			}
+		})
+	}
+}
+
+func TestTxnSurvivesRestart(t *testing.T) {
+	cfg := WALConfig{Dir: t.TempDir(), Sync: SyncAlways}
+
+	db, _ := NewDatabase(WithWAL(cfg))
+	_ = db.Set("from", "value")
+	_, err := db.Txn([]TxnOp{
+		{Type: TxnSet, Key: "to", Value: "value"},
+		{Type: TxnDelete, Key: "from"},
+	})
+	if err != nil {
+		t.Fatalf("Txn returned an error: %s", err)
+	}
+	_, want, _ := db.GetWithVersion("to")
+	_ = db.Close()
+
+	db, err = NewDatabase(WithWAL(cfg))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error on reopen: %s", err)
+	}
+	defer db.Close()
+
+	if v, ver, _ := db.GetWithVersion("to"); v != "value" || ver != want {
+		t.Errorf("to: got %v at version %d, want value at %d", v, ver, want)
+	}
+
+	if v, _ := db.Get("from"); v != nil {
+		t.Errorf("from still present after replay: %v", v)
+	}
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"encoding/json"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// Blob is a value stored exactly as it was received, along with the media type it was sent with.
+type Blob struct {
+	ContentType string
+	Data        []byte
+}
+
+// IsJSON reports whether the blob was sent as JSON and holds valid JSON.
+func (b Blob) IsJSON() bool {
+	mt, _, err := mime.ParseMediaType(b.ContentType)
+	if err != nil {
+		return false
+	}
+	if mt != "application/json" && !strings.HasSuffix(mt, "+json") {
+		return false
+	}
+	return json.Valid(b.Data)
+}
+
+// MarshalJSON embeds the blob where a JSON value is needed, such as a transaction result: JSON is embedded as is, text as a string and anything else as a base64 string.
+func (b Blob) MarshalJSON() ([]byte, error) {
+	if b.IsJSON() {
+		return b.Data, nil
+	}
+	if utf8.Valid(b.Data) {
+		return json.Marshal(string(b.Data))
+	}
+	return json.Marshal(b.Data)
+}
+
+// AsBlob returns any stored value as bytes and a media type. Values written as JSON through a transaction are returned as JSON.
+func AsBlob(v interface{}) (Blob, error) {
+	switch v := v.(type) {
+	case Blob:
+		return v, nil
+	case string:
+		return Blob{ContentType: "text/plain; charset=utf-8", Data: []byte(v)}, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Blob{}, err
+	}
+	return Blob{ContentType: "application/json", Data: b}, nil
+}
+
+// EncodedValue is a value in a form that survives a JSON round trip, for logging it or sending it to another node.
+// A Blob keeps its exact bytes and media type rather than its MarshalJSON form.
+type EncodedValue struct {
+	Value       interface{} `json:"value,omitempty"`
+	Blob        []byte      `json:"blob,omitempty"`
+	ContentType string      `json:"ct,omitempty"`
+	IsBlob      bool        `json:"isBlob,omitempty"`
+}
+
+// EncodeValue wraps v for encoding.
+func EncodeValue(v interface{}) EncodedValue {
+	if b, ok := v.(Blob); ok {
+		return EncodedValue{Blob: b.Data, ContentType: b.ContentType, IsBlob: true}
+	}
+	return EncodedValue{Value: v}
+}
+
+// Decode returns the value that was encoded.
+func (e EncodedValue) Decode() interface{} {
+	if e.IsBlob {
+		return Blob{ContentType: e.ContentType, Data: e.Blob}
+	}
+	return e.Value
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestBlobMarshalJSON(t *testing.T) {
+	tt := []struct {
+		name     string
+		blob     Blob
+		expected string
+	}{
+		{
+			name:     "JSON should be embedded as is",
+			blob:     Blob{ContentType: "application/json; charset=utf-8", Data: []byte(`[1,true,"x"]`)},
+			expected: `[1,true,"x"]`,
+		},
+		{
+			name:     "JSON suffix types should be embedded as is",
+			blob:     Blob{ContentType: "application/merge-patch+json", Data: []byte(`{"a":1}`)},
+			expected: `{"a":1}`,
+		},
+		{
+			name:     "invalid JSON should be embedded as a string",
+			blob:     Blob{ContentType: "application/json", Data: []byte(`{"a":`)},
+			expected: `"{\"a\":"`,
+		},
+		{
+			name:     "text should be embedded as a string",
+			blob:     Blob{ContentType: "text/plain", Data: []byte("hello")},
+			expected: `"hello"`,
+		},
+		{
+			name:     "binary should be embedded as base64",
+			blob:     Blob{ContentType: "image/png", Data: []byte{0xff, 0x00}},
+			expected: `"/wA="`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := json.Marshal(tc.blob)
+			if err != nil {
+				t.Fatalf("Marshal returned an error: %s", err)
+			}
+
+			if string(b) != tc.expected {
+				t.Errorf("got %s, want %s", b, tc.expected)
+			}
+		})
+	}
+}
+
+func TestAsBlob(t *testing.T) {
+	tt := []struct {
+		name     string
+		value    interface{}
+		expected Blob
+	}{
+		{
+			name:     "blobs should be returned as is",
+			value:    Blob{ContentType: "image/png", Data: []byte{0x89}},
+			expected: Blob{ContentType: "image/png", Data: []byte{0x89}},
+		},
+		{
+			name:     "strings should be returned as text",
+			value:    "hello",
+			expected: Blob{ContentType: "text/plain; charset=utf-8", Data: []byte("hello")},
+		},
+		{
+			name:     "other values should be returned as JSON",
+			value:    map[string]interface{}{"a": []interface{}{1.5, true}},
+			expected: Blob{ContentType: "application/json", Data: []byte(`{"a":[1.5,true]}`)},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := AsBlob(tc.value)
+			if err != nil {
+				t.Fatalf("AsBlob returned an error: %s", err)
+			}
+
+			if b.ContentType != tc.expected.ContentType || string(b.Data) != string(tc.expected.Data) {
+				t.Errorf("got %#v, want %#v", b, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEncodedValue(t *testing.T) {
+	tt := []struct {
+		name  string
+		value interface{}
+	}{
+		{name: "blob should keep its bytes and type", value: Blob{ContentType: "image/png", Data: []byte{0xff, 0x00}}},
+		{name: "JSON blob should not be embedded", value: Blob{ContentType: "application/json", Data: []byte(`{"a":1}`)}},
+		{name: "string should stay a string", value: "hello"},
+		{name: "decoded JSON should stay decoded", value: map[string]interface{}{"a": 1.0}},
+		{name: "nil should stay nil", value: nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := json.Marshal(EncodeValue(tc.value))
+			if err != nil {
+				t.Fatalf("Marshal returned an error: %s", err)
+			}
+
+			var e EncodedValue
+			err = json.Unmarshal(b, &e)
+			if err != nil {
+				t.Fatalf("Unmarshal returned an error: %s", err)
+			}
+
+			if got := e.Decode(); !reflect.DeepEqual(got, tc.value) {
+				t.Errorf("got %#v, want %#v", got, tc.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrVersionMismatch is returned by the compare-and-swap methods when the key's current version is not the expected one.
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// GetWithVersion returns the value stored under key along with its version.
+// Versions are database revisions, so they only ever increase and are never reused, even across a delete and re-create.
+// An absent key has version 0.
+func (d *Database) GetWithVersion(key string) (_ interface{}, _ uint64, err error) {
+	defer d.observe(OpGet, &err)
+
+	if err := initCheck(d); err != nil {
+		return nil, 0, err
+	}
+
+	s := d.shardFor(key)
+	d.rlock(s, OpGet)
+	defer s.lock.RUnlock()
+
+	now := d.now()
+	e := s.get(key, now)
+	if e == nil {
+		return nil, 0, nil
+	}
+	d.touch(e, now)
+
+	return e.value, e.version, nil
+}
+
+// CompareAndSet stores value under key only if the key's current version is expected, returning the new version.
+// An expected version of 0 requires that the key does not exist. A ttl of 0 means the key does not expire, or expires after the default TTL if the database has one.
+func (d *Database) CompareAndSet(key string, expected uint64, value interface{}, ttl time.Duration) (_ uint64, err error) {
+	defer d.observe(OpCompareAndSet, &err)
+
+	if ttl < 0 {
+		return 0, ErrInvalidTTL
+	}
+
+	if err := initCheck(d); err != nil {
+		return 0, err
+	}
+
+	s := d.shardFor(key)
+	d.lock(s, OpCompareAndSet)
+	defer s.lock.Unlock()
+
+	now := d.now()
+	if s.version(key, now) != expected {
+		return 0, ErrVersionMismatch
+	}
+
+	rec := setRecord(key, value, d.expiry(now, ttl))
+	release, err := d.admit([]walRecord{rec}, []string{key})
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	return d.commit(rec)
+}
+
+// CompareAndDelete deletes key only if its current version is expected.
+func (d *Database) CompareAndDelete(key string, expected uint64) (err error) {
+	defer d.observe(OpCompareAndDelete, &err)
+
+	if err := initCheck(d); err != nil {
+		return err
+	}
+
+	s := d.shardFor(key)
+	d.lock(s, OpCompareAndDelete)
+	defer s.lock.Unlock()
+
+	if s.version(key, d.now()) != expected {
+		return ErrVersionMismatch
+	}
+
+	_, err = d.commit(walRecord{Op: walOpDelete, Key: key})
+	return err
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVersions(t *testing.T) {
+	t.Run("versions should increase on every write and never be reused", func(t *testing.T) {
+		db, _ := NewDatabase()
+
+		_, v0, _ := db.GetWithVersion("key")
+		if v0 != 0 {
+			t.Errorf("absent key has version %d, expected 0", v0)
+		}
+
+		_ = db.Set("key", "value")
+		_, v1, _ := db.GetWithVersion("key")
+
+		_ = db.Set("other", "value")
+		_ = db.Set("key", "value2")
+		_, v2, _ := db.GetWithVersion("key")
+
+		_ = db.Delete("key")
+		_ = db.Set("key", "value3")
+		_, v3, _ := db.GetWithVersion("key")
+
+		if !(v1 > 0 && v2 > v1 && v3 > v2) {
+			t.Errorf("versions did not increase: %d, %d, %d", v1, v2, v3)
+		}
+	})
+
+	t.Run("versions should survive a restart", func(t *testing.T) {
+		cfg := WALConfig{Dir: t.TempDir(), Sync: SyncNever}
+
+		db, _ := NewDatabase(WithWAL(cfg))
+		_ = db.Set("snapshotted", "value")
+		_ = db.Set("deleted", "value")
+		_ = db.Delete("deleted")
+		_, _ = db.Snapshot()
+		_ = db.Set("logged", "value")
+
+		_, snapshotted, _ := db.GetWithVersion("snapshotted")
+		_, logged, _ := db.GetWithVersion("logged")
+		_ = db.Close()
+
+		db, err := NewDatabase(WithWAL(cfg))
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error on reopen: %s", err)
+		}
+		defer db.Close()
+
+		if _, v, _ := db.GetWithVersion("snapshotted"); v != snapshotted {
+			t.Errorf("snapshotted: got version %d, want %d", v, snapshotted)
+		}
+
+		if _, v, _ := db.GetWithVersion("logged"); v != logged {
+			t.Errorf("logged: got version %d, want %d", v, logged)
+		}
+
+		_ = db.Set("new", "value")
+		if _, v, _ := db.GetWithVersion("new"); v <= logged {
+			t.Errorf("new write got version %d, expected above %d", v, logged)
+		}
+	})
+}
+
+func TestCompareAndSet(t *testing.T) {
+	tt := []struct {
+		name      string
+		existing  bool
+		expected  func(current uint64) uint64
+		shouldErr error
+	}{
+		{
+			name:     "matching version should set",
+			existing: true,
+			expected: func(current uint64) uint64 { return current },
+		},
+		{
+			name:      "stale version should not set",
+			existing:  true,
+			expected:  func(current uint64) uint64 { return current - 1 },
+			shouldErr: ErrVersionMismatch,
+		},
+		{
+			name:     "zero version should create a missing key",
+			existing: false,
+			expected: func(current uint64) uint64 { return 0 },
+		},
+		{
+			name:      "zero version should not overwrite an existing key",
+			existing:  true,
+			expected:  func(current uint64) uint64 { return 0 },
+			shouldErr: ErrVersionMismatch,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := NewDatabase()
+			_ = db.Set("unrelated", "value")
+			if tc.existing {
+				_ = db.Set("key", "old")
+			}
+			_, current, _ := db.GetWithVersion("key")
+
+			version, err := db.CompareAndSet("key", tc.expected(current), "new", 0)
+			if !errors.Is(err, tc.shouldErr) {
+				t.Fatalf("CompareAndSet returned %v, expected %v", err, tc.shouldErr)
+			}
+
+			v, after, _ := db.GetWithVersion("key")
+			if tc.shouldErr != nil {
+				if after != current {
+					t.Errorf("version changed after failed CompareAndSet: %d -> %d", current, after)
+				}
+				return
+			}
+
+			if v != "new" || after != version || version <= current {
+				t.Errorf("CompareAndSet stored %v at version %d, returned %d", v, after, version)
+			}
+		})
+	}
+
+	t.Run("expired key should count as missing", func(t *testing.T) {
+		db, c := newExpiryTestDatabase(t)
+		_ = db.SetWithTTL("key", "old", time.Second)
+		c.now = c.now.Add(time.Minute)
+
+		_, err := db.CompareAndSet("key", 0, "new", time.Minute)
+		if err != nil {
+			t.Errorf("CompareAndSet returned an error: %s", err)
+		}
+
+		if _, ok := expiriesOf(db)["key"]; !ok {
+			t.Error("CompareAndSet did not set the ttl")
+		}
+	})
+}
+
+func TestCompareAndSetConcurrent(t *testing.T) {
+	db, _ := NewDatabase()
+	_ = db.Set("counter", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for {
+					v, version, _ := db.GetWithVersion("counter")
+					_, err := db.CompareAndSet("counter", version, v.(int)+1, 0)
+					if err == nil {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, _ := db.Get("counter")
+	if v != 800 {
+		t.Errorf("counter is %v after concurrent increments, expected 800", v)
+	}
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	db, _ := NewDatabase()
+	_ = db.Set("key", "value")
+	_, current, _ := db.GetWithVersion("key")
+
+	err := db.CompareAndDelete("key", current+1)
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("CompareAndDelete with stale version returned %v, expected ErrVersionMismatch", err)
+	}
+
+	err = db.CompareAndDelete("key", current)
+	if err != nil {
+		t.Errorf("CompareAndDelete returned an error: %s", err)
+	}
+
+	if v, _ := db.Get("key"); v != nil {
+		t.Errorf("key still present after CompareAndDelete: %v", v)
+	}
+}
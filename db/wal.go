@@ -0,0 +1,508 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncMode controls when the write-ahead log is flushed to stable storage.
+type SyncMode int
+
+const (
+	// SyncAlways fsyncs the log after every record, before the write is applied.
+	SyncAlways SyncMode = iota
+	// SyncInterval fsyncs the log in the background every WALConfig.SyncInterval.
+	SyncInterval
+	// SyncNever leaves flushing entirely to the operating system.
+	SyncNever
+)
+
+// ParseSyncMode returns the sync mode with the given name: always, interval or never.
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch s {
+	case "always":
+		return SyncAlways, nil
+	case "interval":
+		return SyncInterval, nil
+	case "never":
+		return SyncNever, nil
+	}
+	return 0, fmt.Errorf("unknown sync mode %q", s)
+}
+
+const (
+	segmentExt = ".wal"
+
+	//Length + checksum, both uint32.
+	recordHeaderSize = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errWALFailed is returned, wrapped with the cause, by every write once the log could not be written to or synced and could not be put right.
+var errWALFailed = errors.New("write-ahead log has failed")
+
+// WALConfig configures the write-ahead log.
+type WALConfig struct {
+	Dir          string
+	Sync         SyncMode
+	SyncInterval time.Duration
+}
+
+type walOp string
+
+const (
+	walOpSet    walOp = "set"
+	walOpDelete walOp = "del"
+
+	//Removes a key whose TTL has passed, which watchers see as a delete even though the key already reads as absent.
+	walOpExpire walOp = "exp"
+
+	//Carries only a revision, so a snapshot remembers revisions used by keys that no longer exist.
+	walOpRevision walOp = "rev"
+
+	//Groups the sets and deletes of one transaction, which all share its revision.
+	walOpTxn walOp = "txn"
+)
+
+type walRecord struct {
+	Op    walOp       `json:"op"`
+	Key   string      `json:"key"`
+	Value interface{} `json:"-"`
+
+	//Absolute expiry as Unix nanoseconds, or 0 if the key does not expire.
+	ExpiresAt int64 `json:"exp,omitempty"`
+
+	//The database revision this mutation created, which becomes the key's version.
+	Rev uint64 `json:"rev,omitempty"`
+
+	Ops []walRecord `json:"ops,omitempty"`
+}
+
+// MarshalJSON logs the record's value as an EncodedValue, so a Blob keeps its exact bytes and type.
+func (r walRecord) MarshalJSON() ([]byte, error) {
+	type plain walRecord
+	out := struct {
+		plain
+		EncodedValue
+	}{plain: plain(r), EncodedValue: EncodeValue(r.Value)}
+	out.plain.Value = nil
+
+	return json.Marshal(out)
+}
+
+func (r *walRecord) UnmarshalJSON(data []byte) error {
+	type plain walRecord
+	var in struct {
+		plain
+		EncodedValue
+	}
+
+	err := json.Unmarshal(data, &in)
+	if err != nil {
+		return err
+	}
+
+	*r = walRecord(in.plain)
+	r.Value = in.EncodedValue.Decode()
+	return nil
+}
+
+// wal is an append-only log split into numbered segment files.
+// Only the highest numbered segment is ever written to; older segments are removed once a snapshot covers them.
+type wal struct {
+	cfg    WALConfig
+	logger *slog.Logger
+	lock   sync.Mutex
+	file   *os.File
+	seq    uint64
+	buf    []byte
+
+	//The length of the current segment up to the end of its last whole record.
+	size int64
+
+	//Set once the log has failed, after which it refuses every write.
+	err error
+
+	dirty bool
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func openWAL(cfg WALConfig, logger *slog.Logger) (*wal, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("wal directory is not set")
+	}
+	if cfg.Sync == SyncInterval && cfg.SyncInterval <= 0 {
+		return nil, errors.New("wal sync interval must be positive")
+	}
+
+	err := os.MkdirAll(cfg.Dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating wal directory: %w", err)
+	}
+
+	return &wal{
+		cfg:    cfg,
+		logger: logger,
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// replay calls apply for every intact record in segments numbered fromSeq or above, in order, and leaves the last segment open for appending.
+// A torn or corrupt tail on the last segment (e.g. from a crash mid-write) is truncated away; corruption in any earlier segment is an error.
+func (w *wal) replay(fromSeq uint64, apply func(walRecord)) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	seqs, err := listSeqs(w.cfg.Dir, segmentExt)
+	if err != nil {
+		return err
+	}
+
+	live := seqs[:0]
+	for _, seq := range seqs {
+		if seq >= fromSeq {
+			live = append(live, seq)
+		}
+	}
+
+	if len(live) == 0 {
+		if fromSeq == 0 {
+			fromSeq = 1
+		}
+		err = w.openSegment(fromSeq)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, seq := range live {
+		last := i == len(live)-1
+
+		f, err := os.OpenFile(seqPath(w.cfg.Dir, seq, segmentExt), os.O_RDWR, 0o644)
+		if err != nil {
+			return fmt.Errorf("opening wal segment: %w", err)
+		}
+
+		offset, err := replaySegment(f, apply)
+		if err != nil && !last {
+			_ = f.Close()
+			return fmt.Errorf("wal segment %d: %w", seq, err)
+		}
+		if err != nil {
+			w.logger.Warn("truncating corrupt tail of wal segment", "segment", seq, "offset", offset, "err", err)
+		}
+
+		if !last {
+			_ = f.Close()
+			continue
+		}
+
+		err = f.Truncate(offset)
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("truncating wal: %w", err)
+		}
+
+		_, err = f.Seek(offset, io.SeekStart)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+
+		w.file = f
+		w.seq = seq
+		w.size = offset
+	}
+
+	if w.cfg.Sync == SyncInterval {
+		w.wg.Add(1)
+		go w.syncLoop()
+	}
+
+	return nil
+}
+
+// replaySegment applies every intact record in f and returns the offset just past the last one.
+func replaySegment(f *os.File, apply func(walRecord)) (int64, error) {
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		rec, n, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		apply(rec)
+		offset += n
+	}
+}
+
+func (w *wal) openSegment(seq uint64) error {
+	f, err := os.OpenFile(seqPath(w.cfg.Dir, seq, segmentExt), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening wal segment: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("opening wal segment: %w", err)
+	}
+
+	w.file = f
+	w.seq = seq
+	w.size = info.Size()
+
+	return nil
+}
+
+func readRecord(r io.Reader) (walRecord, int64, error) {
+	var rec walRecord
+
+	header := make([]byte, recordHeaderSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return rec, 0, errors.New("short record header")
+		}
+		return rec, 0, err
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	sum := binary.LittleEndian.Uint32(header[4:8])
+
+	payload := make([]byte, size)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return rec, 0, errors.New("short record payload")
+	}
+
+	if crc32.Checksum(payload, crcTable) != sum {
+		return rec, 0, errors.New("checksum mismatch")
+	}
+
+	err = json.Unmarshal(payload, &rec)
+	if err != nil {
+		return rec, 0, fmt.Errorf("decoding record: %w", err)
+	}
+
+	return rec, int64(recordHeaderSize + size), nil
+}
+
+// appendRecord frames rec with its length and checksum and appends it to buf.
+func appendRecord(buf []byte, rec walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return buf, fmt.Errorf("encoding record: %w", err)
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(payload, crcTable))
+	return append(buf, payload...), nil
+}
+
+// append writes rec to the log, syncing it first if the policy is SyncAlways.
+// If rec cannot be written, whatever part of it was is truncated away, since replay stops at a torn record and would drop every record
+// appended after it. If that fails too, or the log cannot be synced, the log fails and refuses every later write.
+func (w *wal) append(rec walRecord) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	var err error
+	w.buf, err = appendRecord(w.buf[:0], rec)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.file.Write(w.buf)
+	if err != nil {
+		w.discardTail()
+		return fmt.Errorf("writing wal record: %w", err)
+	}
+
+	if w.cfg.Sync == SyncAlways {
+		err = w.file.Sync()
+		if err != nil {
+			//The write is refused, so it must not be replayed; and once a sync has failed, what is on disk cannot be relied on.
+			w.discardTail()
+			w.fail(fmt.Errorf("syncing wal: %w", err))
+			return w.err
+		}
+	} else {
+		w.dirty = true
+	}
+
+	w.size += int64(len(w.buf))
+	return nil
+}
+
+// discardTail truncates the current segment back to the end of its last whole record, failing the log if it cannot. Must be called with the lock held.
+func (w *wal) discardTail() {
+	err := w.file.Truncate(w.size)
+	if err == nil {
+		_, err = w.file.Seek(w.size, io.SeekStart)
+	}
+	if err != nil {
+		w.fail(fmt.Errorf("truncating wal after a failed write: %w", err))
+	}
+}
+
+// fail makes the log refuse every later write with err. Must be called with the lock held.
+func (w *wal) fail(err error) {
+	if w.err == nil {
+		w.err = fmt.Errorf("%w: %w", errWALFailed, err)
+	}
+}
+
+// rotate seals the current segment and starts a new one, returning the new segment's number.
+// Every record appended before rotate returns lives in a segment below that number.
+func (w *wal) rotate() (uint64, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	err := w.file.Sync()
+	if err != nil {
+		return 0, fmt.Errorf("syncing wal: %w", err)
+	}
+	w.dirty = false
+
+	err = w.file.Close()
+	if err != nil {
+		return 0, fmt.Errorf("closing wal segment: %w", err)
+	}
+
+	err = w.openSegment(w.seq + 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return w.seq, nil
+}
+
+// removeBefore deletes every segment numbered below seq.
+func (w *wal) removeBefore(seq uint64) error {
+	return removeSeqsBefore(w.cfg.Dir, segmentExt, seq)
+}
+
+func (w *wal) syncLoop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := w.sync()
+			if err != nil {
+				w.logger.Error("syncing wal", "err", err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *wal) sync() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.dirty {
+		return nil
+	}
+
+	err := w.file.Sync()
+	if err != nil {
+		//Once a sync has failed, what is on disk cannot be relied on, so later writes are refused as they are with SyncAlways.
+		w.fail(fmt.Errorf("syncing wal: %w", err))
+		return err
+	}
+	w.dirty = false
+
+	return nil
+}
+
+func (w *wal) close() error {
+	close(w.done)
+	w.wg.Wait()
+
+	err := w.sync()
+	if err != nil {
+		return err
+	}
+
+	return w.file.Close()
+}
+
+func seqPath(dir string, seq uint64, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("%016d%s", seq, ext))
+}
+
+// listSeqs returns the sequence numbers of every file in dir with the given extension, ascending.
+func listSeqs(dir string, ext string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]uint64, 0)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ext) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		out = append(out, seq)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+func removeSeqsBefore(dir string, ext string, seq uint64) error {
+	seqs, err := listSeqs(dir, ext)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range seqs {
+		if s >= seq {
+			break
+		}
+		err = os.Remove(seqPath(dir, s, ext))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
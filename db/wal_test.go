@@ -0,0 +1,299 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWALReplay(t *testing.T) {
+	tt := []struct {
+		name     string
+		sync     SyncMode
+		interval time.Duration
+	}{
+		{name: "sync always", sync: SyncAlways},
+		{name: "sync interval", sync: SyncInterval, interval: 10 * time.Millisecond},
+		{name: "sync never", sync: SyncNever},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := WALConfig{Dir: t.TempDir(), Sync: tc.sync, SyncInterval: tc.interval}
+
+			db, err := NewDatabase(WithWAL(cfg))
+			if err != nil {
+				t.Fatalf("NewDatabase returned an error: %s", err)
+			}
+
+			_ = db.Set("key1", "value1")
+			_ = db.Set("key2", map[string]interface{}{"nested": "value"})
+			_ = db.Set("key3", "value3")
+			_ = db.Set("key1", "value4")
+			_ = db.Delete("key3")
+
+			err = db.Close()
+			if err != nil {
+				t.Fatalf("Close returned an error: %s", err)
+			}
+
+			db, err = NewDatabase(WithWAL(cfg))
+			if err != nil {
+				t.Fatalf("NewDatabase returned an error on reopen: %s", err)
+			}
+			defer db.Close()
+
+			if len(contents(db)) != 2 {
+				t.Errorf("replayed database has %d keys, expected 2", len(contents(db)))
+			}
+
+			if contents(db)["key1"] != "value4" {
+				t.Errorf("key1: got %v, want value4", contents(db)["key1"])
+			}
+
+			nested, ok := contents(db)["key2"].(map[string]interface{})
+			if !ok || nested["nested"] != "value" {
+				t.Errorf("key2: got %v, want map with nested value", contents(db)["key2"])
+			}
+
+			if _, ok := contents(db)["key3"]; ok {
+				t.Error("key3 should have been deleted on replay")
+			}
+		})
+	}
+}
+
+func TestWALPreservesBlobs(t *testing.T) {
+	cfg := WALConfig{Dir: t.TempDir(), Sync: SyncAlways}
+
+	blobs := map[string]Blob{
+		"image": {ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}},
+		"json":  {ContentType: "application/json", Data: []byte(`[1, 2.50, true]`)},
+		"empty": {ContentType: "text/plain"},
+	}
+
+	db, err := NewDatabase(WithWAL(cfg))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	_ = db.Set("image", blobs["image"])
+	_ = db.Set("json", blobs["json"])
+	_, _ = db.Snapshot()
+	_, _ = db.Txn([]TxnOp{{Type: TxnSet, Key: "empty", Value: blobs["empty"]}})
+	_ = db.Close()
+
+	db, err = NewDatabase(WithWAL(cfg))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error on reopen: %s", err)
+	}
+	defer db.Close()
+
+	for k, want := range blobs {
+		got, ok := contents(db)[k].(Blob)
+		if !ok || got.ContentType != want.ContentType || string(got.Data) != string(want.Data) {
+			t.Errorf("%s: got %#v, want %#v", k, contents(db)[k], want)
+		}
+	}
+}
+
+func TestWALTruncatesTornTail(t *testing.T) {
+	cfg := WALConfig{Dir: t.TempDir(), Sync: SyncAlways}
+
+	db, err := NewDatabase(WithWAL(cfg))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	_ = db.Set("key1", "value1")
+	_ = db.Set("key2", "value2")
+	_ = db.Close()
+
+	//Simulate a crash halfway through writing the last record.
+	path := seqPath(cfg.Dir, 1, segmentExt)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Truncate(path, info.Size()-3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDatabase(WithWAL(cfg))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error on reopen: %s", err)
+	}
+
+	if contents(db)["key1"] != "value1" {
+		t.Errorf("key1: got %v, want value1", contents(db)["key1"])
+	}
+
+	if _, ok := contents(db)["key2"]; ok {
+		t.Error("torn record for key2 should not have been replayed")
+	}
+
+	//New records must land after the last intact one and survive another restart.
+	_ = db.Set("key3", "value3")
+	_ = db.Close()
+
+	db, err = NewDatabase(WithWAL(cfg))
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error on second reopen: %s", err)
+	}
+	defer db.Close()
+
+	if contents(db)["key1"] != "value1" || contents(db)["key3"] != "value3" {
+		t.Errorf("unexpected data after second reopen: %v", contents(db))
+	}
+}
+
+func TestWALFailedWrites(t *testing.T) {
+	t.Run("partly written record should be truncated away", func(t *testing.T) {
+		cfg := WALConfig{Dir: t.TempDir(), Sync: SyncAlways}
+
+		db, err := NewDatabase(WithWAL(cfg))
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		_ = db.Set("key1", "value1")
+
+		//Simulate a write that failed after writing part of its record.
+		frame, _ := appendRecord(nil, setRecord("lost", "value", time.Time{}))
+		_, _ = db.wal.file.Write(frame[:len(frame)/2])
+		db.wal.discardTail()
+
+		err = db.Set("key2", "value2")
+		if err != nil {
+			t.Fatalf("Set after a failed write returned an error: %s", err)
+		}
+		_ = db.Close()
+
+		db, err = NewDatabase(WithWAL(cfg))
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error on reopen: %s", err)
+		}
+		defer db.Close()
+
+		if contents(db)["key1"] != "value1" || contents(db)["key2"] != "value2" {
+			t.Errorf("unexpected data after reopen: %v", contents(db))
+		}
+	})
+
+	t.Run("log that cannot be truncated should refuse later writes", func(t *testing.T) {
+		cfg := WALConfig{Dir: t.TempDir(), Sync: SyncAlways}
+
+		db, err := NewDatabase(WithWAL(cfg))
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		defer db.Close()
+
+		//Neither writable nor truncatable.
+		good := db.wal.file
+		readOnly, err := os.Open(good.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer readOnly.Close()
+		db.wal.file = readOnly
+
+		err = db.Set("key1", "value1")
+		if err == nil {
+			t.Fatal("Set returned no error for a failed write")
+		}
+
+		db.wal.file = good
+		err = db.Set("key2", "value2")
+		if !errors.Is(err, errWALFailed) {
+			t.Errorf("Set after the log failed returned %v, expected errWALFailed", err)
+		}
+		if len(contents(db)) != 0 {
+			t.Errorf("database has %v, expected nothing", contents(db))
+		}
+	})
+
+	t.Run("failed interval sync should refuse later writes", func(t *testing.T) {
+		cfg := WALConfig{Dir: t.TempDir(), Sync: SyncInterval, SyncInterval: time.Hour}
+
+		db, err := NewDatabase(WithWAL(cfg))
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		defer db.Close()
+
+		_ = db.Set("key1", "value1")
+
+		//A closed file cannot be synced.
+		good := db.wal.file
+		closed, err := os.Open(good.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = closed.Close()
+		db.wal.file = closed
+
+		err = db.wal.sync()
+		db.wal.file = good
+		if err == nil {
+			t.Fatal("sync returned no error for a closed file")
+		}
+
+		err = db.Set("key2", "value2")
+		if !errors.Is(err, errWALFailed) {
+			t.Errorf("Set after a failed sync returned %v, expected errWALFailed", err)
+		}
+	})
+}
+
+func TestWALConfigValidation(t *testing.T) {
+	t.Run("missing directory should error", func(t *testing.T) {
+		_, err := NewDatabase(WithWAL(WALConfig{}))
+		if err == nil {
+			t.Error("NewDatabase did not return an error")
+		}
+	})
+
+	t.Run("interval sync without interval should error", func(t *testing.T) {
+		_, err := NewDatabase(WithWAL(WALConfig{Dir: t.TempDir(), Sync: SyncInterval}))
+		if err == nil {
+			t.Error("NewDatabase did not return an error")
+		}
+	})
+}
+
+func TestParseSyncMode(t *testing.T) {
+	tt := []struct {
+		name     string
+		expected SyncMode
+	}{
+		{name: "always", expected: SyncAlways},
+		{name: "interval", expected: SyncInterval},
+		{name: "never", expected: SyncNever},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := ParseSyncMode(tc.name)
+			if err != nil || m != tc.expected {
+				t.Errorf("ParseSyncMode returned %d, %v", m, err)
+			}
+		})
+	}
+
+	_, err := ParseSyncMode("sometimes")
+	if err == nil {
+		t.Error("ParseSyncMode did not return an error for an unknown mode")
+	}
+}
+
+func BenchmarkDatabase_SetWAL(b *testing.B) {
+	db, err := NewDatabase(WithWAL(WALConfig{Dir: b.TempDir(), Sync: SyncNever}))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	for n := 0; n < b.N; n++ {
+		_ = db.Set("key2", "value4")
+	}
+}
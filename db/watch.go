@@ -0,0 +1,365 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWatchHistory = 10000
+
+	//Events a watcher may fall behind by before it is dropped, so a slow consumer cannot hold memory indefinitely.
+	maxWatchBacklog = 10000
+)
+
+var (
+	// ErrCompacted is returned by Watch when events after the requested revision are no longer retained.
+	ErrCompacted = errors.New("revision has been compacted")
+	// ErrWatchLagged ends a watch whose consumer fell too far behind. It can be resumed from the last revision it received.
+	ErrWatchLagged = errors.New("watcher fell too far behind")
+	// ErrWatchClosed ends a watch that was closed, or whose database was closed.
+	ErrWatchClosed = errors.New("watch closed")
+)
+
+// EventType is the kind of change an Event describes.
+type EventType string
+
+const (
+	EventSet    EventType = "set"
+	EventDelete EventType = "delete"
+)
+
+// Event describes one change to a key. Every key changed by a transaction has an event with the transaction's revision.
+type Event struct {
+	Revision uint64    `json:"revision"`
+	Type     EventType `json:"type"`
+	Key      string    `json:"key"`
+	Time     time.Time `json:"time"`
+
+	//0 if the key did not exist before a set.
+	OldVersion uint64 `json:"oldVersion"`
+
+	//0 after a delete.
+	NewVersion uint64 `json:"newVersion"`
+
+	//Only set on sets.
+	Value interface{} `json:"value,omitempty"`
+
+	//Only set on sets of a key with a TTL.
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+// WatchOptions selects the events a watch receives.
+type WatchOptions struct {
+	Prefix string
+
+	//Deliver retained events with a revision after Since before live ones.
+	Since uint64
+
+	//Whether Since is set. Without it only changes made after Watch returns are delivered.
+	Resume bool
+}
+
+// IWatcher is implemented by databases that publish their changes.
+type IWatcher interface {
+	Watch(opts WatchOptions) (*Watch, error)
+}
+
+// WithWatchHistory sets how many recent events are retained for watchers resuming from an earlier revision. Defaults to 10000.
+func WithWatchHistory(n int) Option {
+	return func(o *options) {
+		o.watchHistory = n
+	}
+}
+
+// Watch is a subscription to changes. Events are queued as they are committed and collected with Next.
+type Watch struct {
+	hub    *watchHub
+	prefix string
+	start  uint64
+
+	lock   sync.Mutex
+	queue  []Event
+	err    error
+	notify chan struct{}
+}
+
+// Revision is the revision the watch started after. Resuming from it misses nothing.
+func (w *Watch) Revision() uint64 {
+	return w.start
+}
+
+// Next waits for events and returns every one queued so far, in revision order.
+// It returns an error once the watch has ended, or if ctx is done first.
+func (w *Watch) Next(ctx context.Context) ([]Event, error) {
+	for {
+		w.lock.Lock()
+		if len(w.queue) > 0 {
+			events := w.queue
+			w.queue = nil
+			w.lock.Unlock()
+			return events, nil
+		}
+		if w.err != nil {
+			err := w.err
+			w.lock.Unlock()
+			return nil, err
+		}
+		w.lock.Unlock()
+
+		select {
+		case <-w.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close ends the watch, releasing its queue.
+func (w *Watch) Close() {
+	w.hub.remove(w)
+	w.end(ErrWatchClosed)
+}
+
+// push queues the events of one revision that match the watch, all at once so that Next never returns part of a transaction.
+// Must be called with the hub's lock held.
+func (w *Watch) push(events []Event) {
+	w.lock.Lock()
+	if w.err != nil {
+		w.lock.Unlock()
+		return
+	}
+
+	n := len(w.queue)
+	for _, e := range events {
+		if strings.HasPrefix(e.Key, w.prefix) {
+			w.queue = append(w.queue, e)
+		}
+	}
+	if len(w.queue) == n {
+		w.lock.Unlock()
+		return
+	}
+
+	if len(w.queue) > maxWatchBacklog {
+		w.queue = w.queue[:n]
+		w.lock.Unlock()
+		w.hub.removeLocked(w)
+		w.end(ErrWatchLagged)
+		return
+	}
+	w.lock.Unlock()
+
+	w.wake()
+}
+
+// end stops the watch with err. Events already queued are still returned by Next.
+func (w *Watch) end(err error) {
+	w.lock.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.lock.Unlock()
+
+	w.wake()
+}
+
+func (w *Watch) wake() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// watchHub fans committed events out to watches and retains the most recent ones for resuming.
+type watchHub struct {
+	lock    sync.Mutex
+	watches map[*Watch]struct{}
+	closed  bool
+
+	//A ring of the most recent events, oldest first from head.
+	history []Event
+	head    int
+	size    int
+
+	//Events with this revision or lower are no longer all retained.
+	floor uint64
+
+	//The revision of the last committed mutation.
+	last uint64
+}
+
+func newWatchHub(capacity int, revision uint64) *watchHub {
+	return &watchHub{
+		watches: make(map[*Watch]struct{}),
+		history: make([]Event, capacity),
+		floor:   revision,
+		last:    revision,
+	}
+}
+
+// publish records the events of a committed revision. It is called in revision order, under the database's sequence lock.
+func (h *watchHub) publish(revision uint64, events []Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.last = revision
+
+	for _, e := range events {
+		if len(h.history) == 0 {
+			h.floor = revision
+			break
+		}
+
+		if h.size == len(h.history) {
+			h.floor = h.history[h.head].Revision
+			h.head = (h.head + 1) % len(h.history)
+			h.size--
+		}
+		h.history[(h.head+h.size)%len(h.history)] = e
+		h.size++
+	}
+
+	for w := range h.watches {
+		w.push(events)
+	}
+}
+
+func (h *watchHub) watch(opts WatchOptions) (*Watch, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		return nil, ErrWatchClosed
+	}
+
+	w := &Watch{hub: h, prefix: opts.Prefix, start: h.last, notify: make(chan struct{}, 1)}
+
+	if opts.Resume && opts.Since < h.last {
+		if opts.Since < h.floor {
+			return nil, ErrCompacted
+		}
+
+		w.start = opts.Since
+
+		backlog := make([]Event, 0, h.size)
+		for i := 0; i < h.size; i++ {
+			e := h.history[(h.head+i)%len(h.history)]
+			if e.Revision > opts.Since {
+				backlog = append(backlog, e)
+			}
+		}
+		w.push(backlog)
+
+		if w.err != nil {
+			return nil, w.err
+		}
+	}
+
+	h.watches[w] = struct{}{}
+	return w, nil
+}
+
+func (h *watchHub) remove(w *Watch) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.removeLocked(w)
+}
+
+func (h *watchHub) removeLocked(w *Watch) {
+	delete(h.watches, w)
+}
+
+// reset discards the retained events and ends every watch with ErrCompacted, after the database's contents were replaced wholesale at revision.
+func (h *watchHub) reset(revision uint64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for w := range h.watches {
+		w.end(ErrCompacted)
+	}
+	h.watches = make(map[*Watch]struct{})
+
+	h.head, h.size = 0, 0
+	h.floor, h.last = revision, revision
+}
+
+// close ends every watch and refuses new ones.
+func (h *watchHub) close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.closed = true
+	for w := range h.watches {
+		w.end(ErrWatchClosed)
+	}
+	h.watches = make(map[*Watch]struct{})
+}
+
+// Watch subscribes to changes to keys with opts.Prefix.
+// With opts.Resume, retained events after opts.Since are delivered first, or ErrCompacted is returned if some of them have been discarded.
+// A watch must be closed once it is no longer needed.
+func (d *Database) Watch(opts WatchOptions) (*Watch, error) {
+	if err := initCheck(d); err != nil {
+		return nil, err
+	}
+	return d.watches.watch(opts)
+}
+
+// events describes the changes rec is about to make. Must be called with the write lock held on every shard rec touches, before it is applied.
+func (d *Database) events(rec walRecord, now time.Time) []Event {
+	events := make([]Event, 0, 1+len(rec.Ops))
+
+	//Versions written earlier in the same transaction.
+	var staged map[string]uint64
+
+	var add func(op walRecord)
+	add = func(op walRecord) {
+		if op.Op == walOpTxn {
+			staged = make(map[string]uint64, len(op.Ops))
+			for _, o := range op.Ops {
+				add(o)
+			}
+			return
+		}
+
+		old, ok := staged[op.Key]
+		if !ok {
+			old = d.shardFor(op.Key).version(op.Key, now)
+			if e, ok := d.shardFor(op.Key).entries[op.Key]; ok && op.Op == walOpExpire {
+				old = e.version
+			}
+		}
+
+		e := Event{Revision: rec.Rev, Key: op.Key, Time: now, OldVersion: old}
+		switch op.Op {
+		case walOpSet:
+			e.Type = EventSet
+			e.NewVersion = rec.Rev
+			e.Value = op.Value
+			if op.ExpiresAt != 0 {
+				e.ExpiresAt = time.Unix(0, op.ExpiresAt)
+			}
+		case walOpDelete, walOpExpire:
+			//Deleting a key that does not exist changes nothing.
+			if old == 0 {
+				return
+			}
+			e.Type = EventDelete
+		default:
+			return
+		}
+
+		if staged != nil {
+			staged[op.Key] = e.NewVersion
+		}
+		events = append(events, e)
+	}
+	add(rec)
+
+	return events
+}
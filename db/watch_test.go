@@ -0,0 +1,217 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// next collects the events queued on w, failing if none arrive.
+func next(t *testing.T, w *Watch) []Event {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	events, err := w.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next returned an error: %s", err)
+	}
+	return events
+}
+
+// summarize reduces events to type, key, old and new version for comparison.
+func summarize(events []Event) []string {
+	out := make([]string, len(events))
+	for i, e := range events {
+		out[i] = string(e.Type) + " " + e.Key + " " + strconv.FormatUint(e.OldVersion, 10) + "->" + strconv.FormatUint(e.NewVersion, 10)
+	}
+	return out
+}
+
+func TestWatch(t *testing.T) {
+	t.Run("Watch should publish sets, deletes and transactions in order", func(t *testing.T) {
+		db, _ := NewDatabase()
+		defer db.Close()
+
+		w, err := db.Watch(WatchOptions{})
+		if err != nil {
+			t.Fatalf("Watch returned an error: %s", err)
+		}
+		defer w.Close()
+
+		_ = db.Set("a", "1")
+		_ = db.Set("a", "2")
+		_ = db.Delete("a")
+		_ = db.Delete("missing")
+		_, _ = db.Txn([]TxnOp{
+			{Type: TxnSet, Key: "b", Value: "1"},
+			{Type: TxnDelete, Key: "b"},
+			{Type: TxnSet, Key: "b", Value: "2"},
+		})
+
+		expected := []string{
+			"set a 0->1",
+			"set a 1->2",
+			"delete a 2->0",
+			"set b 0->5",
+			"delete b 5->0",
+			"set b 0->5",
+		}
+
+		events := next(t, w)
+		if !reflect.DeepEqual(summarize(events), expected) {
+			t.Errorf("got %v, want %v", summarize(events), expected)
+		}
+
+		if events[1].Value != "2" || events[1].Revision != 2 || events[5].Revision != 5 {
+			t.Errorf("unexpected event details: %+v", events)
+		}
+	})
+
+	t.Run("Watch should only deliver keys with the prefix", func(t *testing.T) {
+		db, _ := NewDatabase()
+		defer db.Close()
+
+		w, _ := db.Watch(WatchOptions{Prefix: "user:"})
+		defer w.Close()
+
+		_ = db.Set("order:1", "value")
+		_ = db.Set("user:1", "value")
+
+		events := next(t, w)
+		if len(events) != 1 || events[0].Key != "user:1" {
+			t.Errorf("got %v, want only user:1", summarize(events))
+		}
+	})
+
+	t.Run("Watch should resume from a revision", func(t *testing.T) {
+		db, _ := NewDatabase()
+		defer db.Close()
+
+		_ = db.Set("a", "1")
+		_ = db.Set("b", "1")
+		_ = db.Set("c", "1")
+
+		w, err := db.Watch(WatchOptions{Since: 1, Resume: true})
+		if err != nil {
+			t.Fatalf("Watch returned an error: %s", err)
+		}
+		defer w.Close()
+
+		if w.Revision() != 1 {
+			t.Errorf("Revision returned %d, expected 1", w.Revision())
+		}
+
+		_ = db.Set("d", "1")
+
+		expected := []string{"set b 0->2", "set c 0->3", "set d 0->4"}
+		if got := summarize(next(t, w)); !reflect.DeepEqual(got, expected) {
+			t.Errorf("got %v, want %v", got, expected)
+		}
+	})
+
+	t.Run("Watch should report compacted revisions", func(t *testing.T) {
+		db, _ := NewDatabase(WithWatchHistory(2))
+		defer db.Close()
+
+		for i := 0; i < 5; i++ {
+			_ = db.Set("key", strconv.Itoa(i))
+		}
+
+		_, err := db.Watch(WatchOptions{Since: 2, Resume: true})
+		if !errors.Is(err, ErrCompacted) {
+			t.Errorf("Watch returned %v, expected ErrCompacted", err)
+		}
+
+		w, err := db.Watch(WatchOptions{Since: 3, Resume: true})
+		if err != nil {
+			t.Fatalf("Watch returned an error: %s", err)
+		}
+		defer w.Close()
+
+		if got := summarize(next(t, w)); !reflect.DeepEqual(got, []string{"set key 3->4", "set key 4->5"}) {
+			t.Errorf("got %v", got)
+		}
+	})
+
+	t.Run("Watch should report revisions from before a restart as compacted", func(t *testing.T) {
+		cfg := WALConfig{Dir: t.TempDir(), Sync: SyncNever}
+
+		db, _ := NewDatabase(WithWAL(cfg))
+		_ = db.Set("key", "value")
+		_ = db.Close()
+
+		db, _ = NewDatabase(WithWAL(cfg))
+		defer db.Close()
+
+		_, err := db.Watch(WatchOptions{Since: 0, Resume: true})
+		if !errors.Is(err, ErrCompacted) {
+			t.Errorf("Watch returned %v, expected ErrCompacted", err)
+		}
+
+		w, err := db.Watch(WatchOptions{Since: 1, Resume: true})
+		if err != nil {
+			t.Fatalf("Watch from the current revision returned an error: %s", err)
+		}
+		w.Close()
+	})
+
+	t.Run("Watch should drop a watcher that falls behind", func(t *testing.T) {
+		db, _ := NewDatabase()
+		defer db.Close()
+
+		w, _ := db.Watch(WatchOptions{})
+		defer w.Close()
+
+		for i := 0; i <= maxWatchBacklog; i++ {
+			_ = db.Set("key", "value")
+		}
+
+		events := next(t, w)
+		if len(events) != maxWatchBacklog {
+			t.Errorf("got %d queued events, expected %d", len(events), maxWatchBacklog)
+		}
+
+		_, err := w.Next(context.Background())
+		if !errors.Is(err, ErrWatchLagged) {
+			t.Errorf("Next returned %v, expected ErrWatchLagged", err)
+		}
+	})
+
+	t.Run("Closing the database should end watches", func(t *testing.T) {
+		db, _ := NewDatabase()
+		w, _ := db.Watch(WatchOptions{})
+
+		_ = db.Close()
+
+		_, err := w.Next(context.Background())
+		if !errors.Is(err, ErrWatchClosed) {
+			t.Errorf("Next returned %v, expected ErrWatchClosed", err)
+		}
+
+		_, err = db.Watch(WatchOptions{})
+		if !errors.Is(err, ErrWatchClosed) {
+			t.Errorf("Watch returned %v, expected ErrWatchClosed", err)
+		}
+	})
+
+	t.Run("Next should return when the context is done", func(t *testing.T) {
+		db, _ := NewDatabase()
+		defer db.Close()
+
+		w, _ := db.Watch(WatchOptions{})
+		defer w.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := w.Next(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Next returned %v, expected DeadlineExceeded", err)
+		}
+	})
+}
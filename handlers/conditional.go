@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func etag(version uint64) string {
+	return "\"" + strconv.FormatUint(version, 10) + "\""
+}
+
+func hasPreconditions(r *http.Request) bool {
+	return r.Header.Get("If-Match") != "" || r.Header.Get("If-None-Match") != ""
+}
+
+// preconditionsMet evaluates If-Match and If-None-Match against the key's current version, where 0 means the key does not exist.
+func preconditionsMet(r *http.Request, current uint64) bool {
+	if v := r.Header.Get("If-Match"); v != "" {
+		if current == 0 || !etagListMatches(v, current) {
+			return false
+		}
+	}
+
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		if current != 0 && etagListMatches(v, current) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// etagListMatches reports whether a comma separated list of entity tags (or "*") matches version.
+// Weak tags are compared by their value, since versions are the only validator.
+func etagListMatches(list string, version uint64) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+
+		tag = strings.TrimPrefix(tag, "W/")
+		if tag == etag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalSet checks the request's preconditions and writes value with a single CompareAndSet, so a concurrent write in between causes a mismatch rather than being overwritten.
+// It returns the version written.
+func conditionalSet(d db.IDatabase, r *http.Request, key string, value interface{}, ttl time.Duration) (uint64, error) {
+	_, current, err := d.GetWithVersion(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if !preconditionsMet(r, current) {
+		return 0, db.ErrVersionMismatch
+	}
+
+	return d.CompareAndSet(key, current, value, ttl)
+}
+
+// versionedSet writes value whatever the key's version, returning the version written. It uses CompareAndSet, since Set does not say
+// which version it wrote; a concurrent write in between means another writer went first, so it tries again against the version that left.
+func versionedSet(d db.IDatabase, key string, value interface{}, ttl time.Duration) (uint64, error) {
+	for {
+		_, current, err := d.GetWithVersion(key)
+		if err != nil {
+			return 0, err
+		}
+
+		version, err := d.CompareAndSet(key, current, value, ttl)
+		if !errors.Is(err, db.ErrVersionMismatch) {
+			return version, err
+		}
+	}
+}
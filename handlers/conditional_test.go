@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	tt := []struct {
+		name                 string
+		method               string
+		path                 string
+		headers              map[string]string
+		version              uint64
+		casConflict          bool
+		expectedCASCount     int
+		expectedCASExpected  uint64
+		expectedCADCount     int
+		expectedSetCount     int
+		expectedDeleteCount  int
+		expectedResponseCode int
+		expectedETag         string
+	}{
+		{
+			name:                 "GET Should Return ETag",
+			method:               http.MethodGet,
+			path:                 "/test",
+			version:              7,
+			expectedResponseCode: http.StatusOK,
+			expectedETag:         "\"7\"",
+		},
+		{
+			name:                 "GET Should Return 304 if If-None-Match Matches",
+			method:               http.MethodGet,
+			path:                 "/test",
+			headers:              map[string]string{"If-None-Match": "\"7\""},
+			version:              7,
+			expectedResponseCode: http.StatusNotModified,
+			expectedETag:         "\"7\"",
+		},
+		{
+			name:                 "PUT Should Compare And Set if If-Match Matches",
+			method:               http.MethodPut,
+			path:                 "/test",
+			headers:              map[string]string{"If-Match": "\"6\", \"7\""},
+			version:              7,
+			expectedCASCount:     1,
+			expectedCASExpected:  7,
+			expectedSetCount:     1,
+			expectedResponseCode: http.StatusOK,
+			expectedETag:         "\"8\"",
+		},
+		{
+			name:                 "PUT Should Return 412 if If-Match Does Not Match",
+			method:               http.MethodPut,
+			path:                 "/test",
+			headers:              map[string]string{"If-Match": "\"6\""},
+			version:              7,
+			expectedResponseCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:                 "PUT Should Return 412 if If-Match Given for Missing Key",
+			method:               http.MethodPut,
+			path:                 "/not-found",
+			headers:              map[string]string{"If-Match": "*"},
+			expectedResponseCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:                 "PUT Should Create if If-None-Match Star and Key Missing",
+			method:               http.MethodPut,
+			path:                 "/not-found",
+			headers:              map[string]string{"If-None-Match": "*"},
+			expectedCASCount:     1,
+			expectedCASExpected:  0,
+			expectedSetCount:     1,
+			expectedResponseCode: http.StatusOK,
+			expectedETag:         "\"1\"",
+		},
+		{
+			name:                 "PUT Should Return 412 if If-None-Match Star and Key Exists",
+			method:               http.MethodPut,
+			path:                 "/test",
+			headers:              map[string]string{"If-None-Match": "*"},
+			version:              7,
+			expectedResponseCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:                 "PUT Should Return 412 if Key Changes Before Compare And Set",
+			method:               http.MethodPut,
+			path:                 "/test",
+			headers:              map[string]string{"If-Match": "\"7\""},
+			version:              7,
+			casConflict:          true,
+			expectedCASCount:     1,
+			expectedCASExpected:  7,
+			expectedResponseCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:                 "DELETE Should Compare And Delete if If-Match Matches",
+			method:               http.MethodDelete,
+			path:                 "/test",
+			headers:              map[string]string{"If-Match": "W/\"7\""},
+			version:              7,
+			expectedCADCount:     1,
+			expectedDeleteCount:  1,
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "DELETE Should Return 412 if If-Match Does Not Match",
+			method:               http.MethodDelete,
+			path:                 "/test",
+			headers:              map[string]string{"If-Match": "\"6\""},
+			version:              7,
+			expectedResponseCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:                 "DELETE Should Return 412 if If-Match Given for Missing Key",
+			method:               http.MethodDelete,
+			path:                 "/not-found",
+			headers:              map[string]string{"If-Match": "*"},
+			expectedResponseCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:                 "DELETE Should Return 404 if Only If-None-Match Given for Missing Key",
+			method:               http.MethodDelete,
+			path:                 "/not-found",
+			headers:              map[string]string{"If-None-Match": "*"},
+			expectedResponseCode: http.StatusNotFound,
+		},
+		{
+			name:                 "DELETE Should Return 412 if Key Changes Before Compare And Delete",
+			method:               http.MethodDelete,
+			path:                 "/test",
+			headers:              map[string]string{"If-Match": "\"7\""},
+			version:              7,
+			casConflict:          true,
+			expectedCADCount:     1,
+			expectedResponseCode: http.StatusPreconditionFailed,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &mockDatabase{version: tc.version, casConflict: tc.casConflict}
+			r := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString("hello"))
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			IndexHandler(d, testLogger)(w, r)
+
+			if d.casCalledCount != tc.expectedCASCount {
+				t.Errorf("CompareAndSet called count: got %d, want %d", d.casCalledCount, tc.expectedCASCount)
+			}
+
+			if d.casExpected != tc.expectedCASExpected {
+				t.Errorf("CompareAndSet called with wrong version: got %d, want %d", d.casExpected, tc.expectedCASExpected)
+			}
+
+			if d.cadCalledCount != tc.expectedCADCount {
+				t.Errorf("CompareAndDelete called count: got %d, want %d", d.cadCalledCount, tc.expectedCADCount)
+			}
+
+			if d.setCalledCount != tc.expectedSetCount {
+				t.Errorf("Set called count: got %d, want %d", d.setCalledCount, tc.expectedSetCount)
+			}
+
+			if d.deleteCalledCount != tc.expectedDeleteCount {
+				t.Errorf("Delete called count: got %d, want %d", d.deleteCalledCount, tc.expectedDeleteCount)
+			}
+
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+
+			if got := w.Header().Get("ETag"); got != tc.expectedETag {
+				t.Errorf("ETag: got %s, want %s", got, tc.expectedETag)
+			}
+		})
+	}
+}
@@ -2,41 +2,76 @@ package handlers
 
 import (
 	"KeyValueDB/db"
+	"KeyValueDB/rbac"
 	"KeyValueDB/util"
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func IndexHandler(d db.IDatabase) http.HandlerFunc {
+// inlineTypes are the content types a stored value is served with for a browser to display. Any other type, such as HTML or SVG,
+// could run script on this origin, so it is served as an attachment to be downloaded instead.
+var inlineTypes = map[string]bool{
+	"text/plain":               true,
+	"text/csv":                 true,
+	"application/json":         true,
+	"application/octet-stream": true,
+	"application/pdf":          true,
+	"image/png":                true,
+	"image/jpeg":               true,
+	"image/gif":                true,
+	"image/webp":               true,
+	"audio/mpeg":               true,
+	"video/mp4":                true,
+}
+
+// TTLHeader sets a lifetime on a PUT, either as a Go duration ("90s", "1h") or a whole number of seconds.
+// The "ttl" query parameter may be used instead.
+const TTLHeader = "X-TTL"
+
+// IndexHandler serves GET, PUT and DELETE on keys, and listing and scanning keys on GET /. Errors are logged to logger.
+// If access control is enabled, each request needs the caller to have permission on its key, and listings only include the keys the caller may list.
+func IndexHandler(d db.IDatabase, logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			getHandler(d, w, r)
+			getHandler(d, logger, w, r)
 		case http.MethodPut:
-			putHandler(d, w, r)
+			putHandler(d, logger, w, r)
 		case http.MethodDelete:
-			deleteHandler(d, w, r)
+			deleteHandler(d, logger, w, r)
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	}
 }
 
-func getHandler(d db.IDatabase, w http.ResponseWriter, r *http.Request) {
+func getHandler(d db.IDatabase, logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" && isScan(r) {
+		scanHandler(d, logger, w, r)
+		return
+	}
+
 	if r.URL.Path == "/" {
 		v, err := d.GetAllKeys()
 		if err != nil {
 			http.Error(w, "error - getting all keys", http.StatusInternalServerError)
-			fmt.Println("error - getting all keys: ", err)
+			logger.ErrorContext(r.Context(), "getting all keys", "err", err)
 			return
 		}
+		if a, ok := rbac.AccessFrom(r.Context()); ok {
+			v = a.Filter(rbac.List, v)
+		}
 
 		err = json.NewEncoder(w).Encode(v)
 		if err != nil {
 			http.Error(w, "error - encoding response", http.StatusInternalServerError)
-			fmt.Println("error - encoding response: ", err)
+			logger.ErrorContext(r.Context(), "encoding response", "err", err)
 			return
 		}
 		return
@@ -44,10 +79,15 @@ func getHandler(d db.IDatabase, w http.ResponseWriter, r *http.Request) {
 
 	key := r.URL.Path[1:]
 
-	v, err := d.Get(key)
+	if !rbac.Allowed(r, rbac.Read, key) {
+		http.Error(w, "error - forbidden", http.StatusForbidden)
+		return
+	}
+
+	v, version, err := d.GetWithVersion(key)
 	if err != nil {
 		http.Error(w, "error - getting key", http.StatusInternalServerError)
-		fmt.Printf("error - getting key %s: %s\n", key, err)
+		logger.ErrorContext(r.Context(), "getting key", "key", key, "err", err)
 		return
 	}
 
@@ -56,15 +96,51 @@ func getHandler(d db.IDatabase, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(v)
+	w.Header().Set("ETag", etag(version))
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeValue(logger, w, r, v)
+}
+
+// writeValue writes a blob back exactly as it was stored. Values written as JSON through a transaction are encoded as JSON.
+// Browsers are told not to sniff the type, and blobs of a type they could run script from are served as attachments.
+func writeValue(logger *slog.Logger, w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if b, ok := v.(db.Blob); ok {
+		//Sniffed here, as net/http would if it were left unset, so that a sniffed type is held to the allowlist too.
+		contentType := b.ContentType
+		if contentType == "" {
+			contentType = http.DetectContentType(b.Data)
+		}
+		w.Header().Set("Content-Type", contentType)
+
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || !inlineTypes[mediaType] {
+			w.Header().Set("Content-Disposition", "attachment")
+		}
+
+		_, err = w.Write(b.Data)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "writing response", "err", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
 	if err != nil {
 		http.Error(w, "error - encoding response", http.StatusInternalServerError)
-		fmt.Println("error - encoding response: ", err)
+		logger.ErrorContext(r.Context(), "encoding response", "err", err)
 		return
 	}
 }
 
-func putHandler(d db.IDatabase, w http.ResponseWriter, r *http.Request) {
+func putHandler(d db.IDatabase, logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
 	key := r.URL.Path[1:]
 
 	if len(key) == 0 {
@@ -72,39 +148,99 @@ func putHandler(d db.IDatabase, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b, err := util.StreamToByte(r.Body)
-
-	//Encase not valid JSON, stream to []byte instead of decoder to preserve original stream.
-	reader := bytes.NewReader(b)
+	if !rbac.Allowed(r, rbac.Write, key) {
+		http.Error(w, "error - forbidden", http.StatusForbidden)
+		return
+	}
 
-	data := make(map[string]interface{})
-	err = json.NewDecoder(reader).Decode(&data)
+	ttl, err := requestTTL(r)
 	if err != nil {
-		err = d.Set(key, string(b))
-		if err != nil {
-			http.Error(w, "error - putting kv pair", http.StatusInternalServerError)
-			//This would all be logged away with splunk or similar, not logging directly to console.
-			fmt.Printf("error - putting kvpair %s: %s\n", key, err)
-			return
+		http.Error(w, "error - invalid ttl", http.StatusBadRequest)
+		return
+	}
+
+	set := func(key string, value interface{}) (uint64, error) {
+		return versionedSet(d, key, value, ttl)
+	}
+	if hasPreconditions(r) {
+		set = func(key string, value interface{}) (uint64, error) {
+			return conditionalSet(d, r, key, value, ttl)
 		}
+	}
+
+	b, err := util.StreamToByte(r.Body)
+	if err != nil {
+		http.Error(w, "error - reading request body", http.StatusBadRequest)
 		return
 	}
 
-	err = d.Set(key, data)
+	//Stored verbatim so that any content type round-trips exactly.
+	version, err := set(key, db.Blob{ContentType: r.Header.Get("Content-Type"), Data: b})
+	if errors.Is(err, db.ErrVersionMismatch) {
+		http.Error(w, "error - precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, db.ErrQuotaExceeded) {
+		http.Error(w, "error - quota exceeded", http.StatusInsufficientStorage)
+		return
+	}
+	if errors.Is(err, db.ErrOutOfMemory) {
+		http.Error(w, "error - database is full", http.StatusInsufficientStorage)
+		return
+	}
 	if err != nil {
-		http.Error(w, "error - putting json kv pair", http.StatusInternalServerError)
-		fmt.Printf("error - putting json kvpair %s: %s\n", key, err)
+		http.Error(w, "error - putting kv pair", http.StatusInternalServerError)
+		logger.ErrorContext(r.Context(), "putting kv pair", "key", key, "err", err)
 		return
 	}
+
+	w.Header().Set("ETag", etag(version))
+}
+
+// requestTTL reads the TTL from the X-TTL header or ttl query parameter. A zero duration means no TTL was given.
+func requestTTL(r *http.Request) (time.Duration, error) {
+	v := r.Header.Get(TTLHeader)
+	if v == "" {
+		v = r.URL.Query().Get("ttl")
+	}
+	if v == "" {
+		return 0, nil
+	}
+
+	return parseTTL(v)
+}
+
+// parseTTL accepts a Go duration ("90s", "1h") or a whole number of seconds.
+func parseTTL(v string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(v)
+	if err != nil {
+		secs, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		ttl = time.Duration(secs) * time.Second
+	}
+
+	if ttl <= 0 {
+		return 0, fmt.Errorf("ttl must be positive, got %s", v)
+	}
+
+	return ttl, nil
 }
 
-func deleteHandler(d db.IDatabase, w http.ResponseWriter, r *http.Request) {
+func deleteHandler(d db.IDatabase, logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
 	key := r.URL.Path[1:]
 
 	if len(key) == 0 {
 		http.Error(w, "error - no key provided", http.StatusBadRequest)
 		return
 	}
+
+	//Checked first, so that a caller without permission cannot tell whether the key exists.
+	if !rbac.Allowed(r, rbac.Delete, key) {
+		http.Error(w, "error - forbidden", http.StatusForbidden)
+		return
+	}
 	/*
 			The following code that checking the existence of the key purely for a 404, is not necessary.
 		    The data is to be discarded anyway, and so we don't need to see if it exists. Just delete it.
@@ -112,22 +248,40 @@ func deleteHandler(d db.IDatabase, w http.ResponseWriter, r *http.Request) {
 
 		    I am including it here, as the spec specifically requires it.
 	*/
-	v, err := d.Get(key)
+	v, version, err := d.GetWithVersion(key)
 	if err != nil {
 		http.Error(w, "error - getting key", http.StatusInternalServerError)
-		fmt.Printf("error - getting key %s: %s\n", key, err)
+		logger.ErrorContext(r.Context(), "getting key", "key", key, "err", err)
 		return
 	}
 
 	if v == nil {
+		//If-Match fails on a key that does not exist, before there is anything to be missing.
+		if hasPreconditions(r) && !preconditionsMet(r, 0) {
+			http.Error(w, "error - precondition failed", http.StatusPreconditionFailed)
+			return
+		}
 		w.WriteHeader(404)
 		return
 	}
 
-	err = d.Delete(key)
+	if hasPreconditions(r) {
+		if !preconditionsMet(r, version) {
+			http.Error(w, "error - precondition failed", http.StatusPreconditionFailed)
+			return
+		}
+
+		err = d.CompareAndDelete(key, version)
+		if errors.Is(err, db.ErrVersionMismatch) {
+			http.Error(w, "error - precondition failed", http.StatusPreconditionFailed)
+			return
+		}
+	} else {
+		err = d.Delete(key)
+	}
 	if err != nil {
 		http.Error(w, "error - deleting key", http.StatusInternalServerError)
-		fmt.Printf("error - deleting key %s: %s\n", key, err)
+		logger.ErrorContext(r.Context(), "deleting key", "key", key, "err", err)
 		return
 	}
 }
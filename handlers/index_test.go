@@ -1,31 +1,51 @@
 package handlers
 
 import (
+	"KeyValueDB/auth"
+	"KeyValueDB/db"
+	"KeyValueDB/rbac"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
 	"testing"
+	"time"
 )
 
 type mockDatabase struct {
 	//counts
 	getCalledCount        int
 	getAllKeysCalledCount int
+	scanCalledCount       int
 	setCalledCount        int
+	setWithTTLCalledCount int
 	deleteCalledCount     int
+	casCalledCount        int
+	cadCalledCount        int
 
 	//arguments
 	getKeyArg    string
 	setKeyArg    string
 	setValueArg  interface{}
+	setTTLArg    time.Duration
 	deleteKeyArg string
+	scanOptsArg  db.ScanOptions
+	casExpected  uint64
+	cadExpected  uint64
 
 	//options
 	isEmpty           bool
 	shouldError       bool
 	getShouldError    bool
 	deleteShouldError bool
+	setErr            error
+
+	//version of every existing key, and whether a compare-and-swap should lose a race
+	version     uint64
+	casConflict bool
 }
 
 func (m *mockDatabase) Get(key string) (interface{}, error) {
@@ -41,9 +61,56 @@ func (m *mockDatabase) Get(key string) (interface{}, error) {
 		return nil, nil
 	}
 
+	if key == "image" {
+		return db.Blob{ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G', 0x00}}, nil
+	}
+
+	if key == "page" {
+		return db.Blob{ContentType: "text/html; charset=utf-8", Data: []byte("<script>alert(1)</script>")}, nil
+	}
+
+	if key == "untyped" {
+		return db.Blob{Data: []byte("<html><script>alert(1)</script></html>")}, nil
+	}
+
 	return "hello", nil
 }
 
+func (m *mockDatabase) GetWithVersion(key string) (interface{}, uint64, error) {
+	v, err := m.Get(key)
+	if v == nil || err != nil {
+		return v, 0, err
+	}
+	return v, m.version, nil
+}
+
+func (m *mockDatabase) CompareAndSet(key string, expected uint64, value interface{}, ttl time.Duration) (uint64, error) {
+	m.casCalledCount++
+	m.casExpected = expected
+	m.setTTLArg = ttl
+
+	if m.casConflict {
+		return 0, db.ErrVersionMismatch
+	}
+
+	err := m.Set(key, value)
+	if err != nil {
+		return 0, err
+	}
+	return expected + 1, nil
+}
+
+func (m *mockDatabase) CompareAndDelete(key string, expected uint64) error {
+	m.cadCalledCount++
+	m.cadExpected = expected
+
+	if m.casConflict {
+		return db.ErrVersionMismatch
+	}
+
+	return m.Delete(key)
+}
+
 func (m *mockDatabase) GetAllKeys() ([]string, error) {
 	m.getAllKeysCalledCount++
 
@@ -59,6 +126,21 @@ func (m *mockDatabase) GetAllKeys() ([]string, error) {
 	return []string{"hello", "world"}, nil
 }
 
+func (m *mockDatabase) Scan(opts db.ScanOptions) (db.ScanPage, error) {
+	m.scanCalledCount++
+	m.scanOptsArg = opts
+
+	if m.shouldError {
+		return db.ScanPage{}, errors.New("error")
+	}
+
+	if m.isEmpty {
+		return db.ScanPage{Keys: []string{}}, nil
+	}
+
+	return db.ScanPage{Keys: []string{"hello", "world"}, Next: "world"}, nil
+}
+
 func (m *mockDatabase) Set(key string, value interface{}) error {
 	m.setCalledCount++
 	m.setKeyArg = key
@@ -68,7 +150,13 @@ func (m *mockDatabase) Set(key string, value interface{}) error {
 		return errors.New("error")
 	}
 
-	return nil
+	return m.setErr
+}
+
+func (m *mockDatabase) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	m.setWithTTLCalledCount++
+	m.setTTLArg = ttl
+	return m.Set(key, value)
 }
 
 func (m *mockDatabase) Delete(key string) error {
@@ -85,7 +173,7 @@ func (m *mockDatabase) Delete(key string) error {
 func TestIndexHandler(t *testing.T) {
 	t.Run("IndexHandler should return a function", func(t *testing.T) {
 		d := &mockDatabase{}
-		h := IndexHandler(d)
+		h := IndexHandler(d, testLogger)
 		if h == nil {
 			t.Error("IndexHandler returned nil")
 		}
@@ -101,6 +189,8 @@ func TestGetHandler(t *testing.T) {
 		expectedGetAllKeysCount int
 		expectedResponseCode    int
 		expectedResponseBody    string
+		expectedContentType     string
+		expectedDisposition     string
 		isDbEmpty               bool
 		shouldError             bool
 	}{
@@ -112,8 +202,41 @@ func TestGetHandler(t *testing.T) {
 			expectedGetAllKeysCount: 0,
 			expectedResponseCode:    http.StatusOK,
 			expectedResponseBody:    "\"hello\"\n",
+			expectedContentType:     "application/json",
 			isDbEmpty:               false,
 		},
+		{
+			name:                    "Should Return Blob Verbatim with Its Content Type",
+			request:                 httptest.NewRequest(http.MethodGet, "/image", nil),
+			expectedArgument:        "image",
+			expectedGetCalledCount:  1,
+			expectedGetAllKeysCount: 0,
+			expectedResponseCode:    http.StatusOK,
+			expectedResponseBody:    "\x89PNG\x00",
+			expectedContentType:     "image/png",
+		},
+		{
+			name:                    "Should Serve Blob That Could Run Script as an Attachment",
+			request:                 httptest.NewRequest(http.MethodGet, "/page", nil),
+			expectedArgument:        "page",
+			expectedGetCalledCount:  1,
+			expectedGetAllKeysCount: 0,
+			expectedResponseCode:    http.StatusOK,
+			expectedResponseBody:    "<script>alert(1)</script>",
+			expectedContentType:     "text/html; charset=utf-8",
+			expectedDisposition:     "attachment",
+		},
+		{
+			name:                    "Should Serve Blob Sniffed as HTML as an Attachment",
+			request:                 httptest.NewRequest(http.MethodGet, "/untyped", nil),
+			expectedArgument:        "untyped",
+			expectedGetCalledCount:  1,
+			expectedGetAllKeysCount: 0,
+			expectedResponseCode:    http.StatusOK,
+			expectedResponseBody:    "<html><script>alert(1)</script></html>",
+			expectedContentType:     "text/html; charset=utf-8",
+			expectedDisposition:     "attachment",
+		},
 		{
 			name:                    "Should Return 404 if Key Not Found",
 			request:                 httptest.NewRequest(http.MethodGet, "/not-found", nil),
@@ -169,7 +292,7 @@ func TestGetHandler(t *testing.T) {
 			d.isEmpty = tc.isDbEmpty
 			d.shouldError = tc.shouldError
 			w := httptest.NewRecorder()
-			getHandler(d, w, tc.request)
+			getHandler(d, testLogger, w, tc.request)
 
 			if d.getCalledCount != tc.expectedGetCalledCount {
 				t.Errorf("Get called count: got %d, want %d", d.getCalledCount, tc.expectedGetCalledCount)
@@ -190,6 +313,18 @@ func TestGetHandler(t *testing.T) {
 			if w.Body.String() != tc.expectedResponseBody {
 				t.Errorf("Response body: got %s, want %s", w.Body.String(), tc.expectedResponseBody)
 			}
+
+			if tc.expectedContentType != "" && w.Header().Get("Content-Type") != tc.expectedContentType {
+				t.Errorf("Content-Type: got %s, want %s", w.Header().Get("Content-Type"), tc.expectedContentType)
+			}
+
+			if w.Header().Get("Content-Disposition") != tc.expectedDisposition {
+				t.Errorf("Content-Disposition: got %q, want %q", w.Header().Get("Content-Disposition"), tc.expectedDisposition)
+			}
+
+			if tc.expectedResponseCode == http.StatusOK && tc.expectedContentType != "" && w.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Error("X-Content-Type-Options should be nosniff")
+			}
 		})
 	}
 }
@@ -200,20 +335,23 @@ func TestPutHandler(t *testing.T) {
 		request                *http.Request
 		expectedSetCalledCount int
 		expectedSetKey         string
-		expectedSetValue       interface{}
+		expectedSetValue       db.Blob
+		expectedSetTTL         time.Duration
 		expectedResponseCode   int
 		expectedResponseBody   string
+		expectedETag           string
 		noKeySet               bool
-		shouldError            bool
+		setErr                 error
 	}{
 		{
 			name:                   "Should Call Set with Correct Key and Value",
 			request:                httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString("hello")),
 			expectedSetCalledCount: 1,
 			expectedSetKey:         "test",
-			expectedSetValue:       "hello",
+			expectedSetValue:       db.Blob{Data: []byte("hello")},
 			expectedResponseCode:   http.StatusOK,
 			expectedResponseBody:   "",
+			expectedETag:           "\"1\"",
 		},
 		{
 			name:                 "Should Return 400 if No Key Provided",
@@ -227,29 +365,107 @@ func TestPutHandler(t *testing.T) {
 			request:                httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString("hello")),
 			expectedSetCalledCount: 1,
 			expectedSetKey:         "test",
-			expectedSetValue:       "hello",
+			expectedSetValue:       db.Blob{Data: []byte("hello")},
 			expectedResponseCode:   http.StatusInternalServerError,
 			expectedResponseBody:   "error - putting kv pair\n",
-			shouldError:            true,
+			setErr:                 errors.New("error"),
 		},
 		{
 			name:                   "Should Return 500 if Database Returns Error JSON Value",
 			request:                httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString("{\"key\": \"value\"}")),
 			expectedSetCalledCount: 1,
 			expectedSetKey:         "test",
-			expectedSetValue:       map[string]interface{}{"key": "value"},
+			expectedSetValue:       db.Blob{Data: []byte("{\"key\": \"value\"}")},
 			expectedResponseCode:   http.StatusInternalServerError,
-			expectedResponseBody:   "error - putting json kv pair\n",
-			shouldError:            true,
+			expectedResponseBody:   "error - putting kv pair\n",
+			setErr:                 errors.New("error"),
+		},
+		{
+			name: "Should Store Body and Content-Type Verbatim",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString("[1, true, \"x\"]"))
+				r.Header.Set("Content-Type", "application/json")
+				return r
+			}(),
+			expectedSetCalledCount: 1,
+			expectedSetKey:         "test",
+			expectedSetValue:       db.Blob{ContentType: "application/json", Data: []byte("[1, true, \"x\"]")},
+			expectedResponseCode:   http.StatusOK,
+			expectedResponseBody:   "",
+			expectedETag:           "\"1\"",
+		},
+		{
+			name:                   "Should Return 507 if Database Is Full",
+			request:                httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString("hello")),
+			expectedSetCalledCount: 1,
+			expectedSetKey:         "test",
+			expectedSetValue:       db.Blob{Data: []byte("hello")},
+			expectedResponseCode:   http.StatusInsufficientStorage,
+			expectedResponseBody:   "error - database is full\n",
+			setErr:                 db.ErrOutOfMemory,
+		},
+		{
+			name:                   "Should Return 507 if a Quota Is Exceeded",
+			request:                httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString("hello")),
+			expectedSetCalledCount: 1,
+			expectedSetKey:         "test",
+			expectedSetValue:       db.Blob{Data: []byte("hello")},
+			expectedResponseCode:   http.StatusInsufficientStorage,
+			expectedResponseBody:   "error - quota exceeded\n",
+			setErr:                 &db.QuotaError{Prefix: "te", Key: "test"},
+		},
+		{
+			name: "Should Set TTL from Header",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString("hello"))
+				r.Header.Set(TTLHeader, "90s")
+				return r
+			}(),
+			expectedSetCalledCount: 1,
+			expectedSetKey:         "test",
+			expectedSetValue:       db.Blob{Data: []byte("hello")},
+			expectedSetTTL:         90 * time.Second,
+			expectedResponseCode:   http.StatusOK,
+			expectedResponseBody:   "",
+			expectedETag:           "\"1\"",
+		},
+		{
+			name:                   "Should Set TTL in Seconds from Query Parameter",
+			request:                httptest.NewRequest(http.MethodPut, "/test?ttl=30", bytes.NewBufferString("{\"key\": \"value\"}")),
+			expectedSetCalledCount: 1,
+			expectedSetKey:         "test",
+			expectedSetValue:       db.Blob{Data: []byte("{\"key\": \"value\"}")},
+			expectedSetTTL:         30 * time.Second,
+			expectedResponseCode:   http.StatusOK,
+			expectedResponseBody:   "",
+			expectedETag:           "\"1\"",
+		},
+		{
+			name:                 "Should Return 400 if TTL Invalid",
+			request:              httptest.NewRequest(http.MethodPut, "/test?ttl=soon", bytes.NewBufferString("hello")),
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid ttl\n",
+			noKeySet:             true,
+		},
+		{
+			name:                 "Should Return 400 if TTL Not Positive",
+			request:              httptest.NewRequest(http.MethodPut, "/test?ttl=-5s", bytes.NewBufferString("hello")),
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid ttl\n",
+			noKeySet:             true,
 		},
 	}
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
 			d := &mockDatabase{}
-			d.shouldError = tc.shouldError
+			d.setErr = tc.setErr
 			w := httptest.NewRecorder()
-			putHandler(d, w, tc.request)
+			putHandler(d, testLogger, w, tc.request)
+
+			if w.Header().Get("ETag") != tc.expectedETag {
+				t.Errorf("ETag: got %s, want %s", w.Header().Get("ETag"), tc.expectedETag)
+			}
 
 			if d.setCalledCount != tc.expectedSetCalledCount {
 				t.Errorf("Set called count: got %d, want %d", d.setCalledCount, tc.expectedSetCalledCount)
@@ -271,17 +487,12 @@ func TestPutHandler(t *testing.T) {
 				t.Errorf("Set called with wrong key: got %s, want %s", d.setKeyArg, tc.expectedSetKey)
 			}
 
-			switch tc.expectedSetValue.(type) {
-			case string:
-				if d.setValueArg.(string) != tc.expectedSetValue {
-					t.Errorf("Set called with wrong value: got %s, want %s", d.setValueArg, tc.expectedSetValue)
-				}
-			case map[string]interface{}:
-				for k, v := range d.setValueArg.(map[string]interface{}) {
-					if tc.expectedSetValue.(map[string]interface{})[k] != v {
-						t.Errorf("Set called with wrong value: got %v, want %v", d.setValueArg, tc.expectedSetValue)
-					}
-				}
+			if d.setTTLArg != tc.expectedSetTTL {
+				t.Errorf("Set called with wrong ttl: got %s, want %s", d.setTTLArg, tc.expectedSetTTL)
+			}
+
+			if !reflect.DeepEqual(d.setValueArg, tc.expectedSetValue) {
+				t.Errorf("Set called with wrong value: got %v, want %v", d.setValueArg, tc.expectedSetValue)
 			}
 		})
 	}
@@ -348,7 +559,7 @@ func TestDeleteHandler(t *testing.T) {
 			d.deleteShouldError = tc.dbDeleteShouldFail
 			d.getShouldError = tc.dbGetShouldFail
 			w := httptest.NewRecorder()
-			deleteHandler(d, w, tc.request)
+			deleteHandler(d, testLogger, w, tc.request)
 
 			if d.deleteCalledCount != tc.expectedDeleteCalledCount {
 				t.Errorf("Delete called count: got %d, want %d", d.deleteCalledCount, tc.expectedDeleteCalledCount)
@@ -372,3 +583,74 @@ func TestDeleteHandler(t *testing.T) {
 		})
 	}
 }
+
+// withAccess returns r as sent by a caller allowed to do anything with team-a/ keys, and to read and list shared: keys.
+func withAccess(r *http.Request) *http.Request {
+	policy := &rbac.Policy{
+		Roles: map[string]rbac.Role{
+			"team-a": {Grants: []rbac.Grant{
+				{Prefix: "team-a/", Permissions: []rbac.Permission{rbac.Read, rbac.Write, rbac.Delete, rbac.List}},
+				{Pattern: "shared:*", Permissions: []rbac.Permission{rbac.Read, rbac.List}},
+			}},
+		},
+		Bindings: map[string][]string{"api-key:alice": {"team-a"}},
+	}
+	return r.WithContext(rbac.WithAccess(r.Context(), policy.Access(auth.Principal{Name: "alice", Method: auth.MethodAPIKey})))
+}
+
+func TestIndexHandlerAccessControl(t *testing.T) {
+	tt := []struct {
+		name                 string
+		method               string
+		target               string
+		expectedResponseCode int
+		expectedResponseBody string
+	}{
+		{name: "Should Get Permitted Key", method: http.MethodGet, target: "/team-a/1", expectedResponseCode: http.StatusOK, expectedResponseBody: "a"},
+		{name: "Should Forbid Get of Other Key", method: http.MethodGet, target: "/team-b/1", expectedResponseCode: http.StatusForbidden, expectedResponseBody: "error - forbidden\n"},
+		{name: "Should Forbid Get of Missing Key Rather than 404", method: http.MethodGet, target: "/team-b/missing", expectedResponseCode: http.StatusForbidden, expectedResponseBody: "error - forbidden\n"},
+		{name: "Should Put Permitted Key", method: http.MethodPut, target: "/team-a/2", expectedResponseCode: http.StatusOK},
+		{name: "Should Forbid Put Without Write Permission", method: http.MethodPut, target: "/shared:1", expectedResponseCode: http.StatusForbidden, expectedResponseBody: "error - forbidden\n"},
+		{name: "Should Forbid Delete of Other Key", method: http.MethodDelete, target: "/team-b/1", expectedResponseCode: http.StatusForbidden, expectedResponseBody: "error - forbidden\n"},
+		{name: "Should Return 404 on Delete of Missing Permitted Key", method: http.MethodDelete, target: "/team-a/missing", expectedResponseCode: http.StatusNotFound},
+		{name: "Should List Only Permitted Keys", method: http.MethodGet, target: "/", expectedResponseCode: http.StatusOK, expectedResponseBody: "[\"shared:1\",\"team-a/1\"]\n"},
+		{name: "Should Scan Only Permitted Keys", method: http.MethodGet, target: "/?prefix=team", expectedResponseCode: http.StatusOK, expectedResponseBody: "{\"keys\":[\"team-a/1\"]}\n"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			d, _ := db.NewDatabase()
+			defer d.Close()
+			for _, k := range []string{"team-a/1", "team-b/1", "shared:1"} {
+				_ = d.Set(k, db.Blob{Data: []byte("a")})
+			}
+
+			w := httptest.NewRecorder()
+			r := withAccess(httptest.NewRequest(tc.method, tc.target, bytes.NewBufferString("b")))
+			IndexHandler(d, testLogger)(w, r)
+
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+			body := w.Body.String()
+			if tc.target == "/" {
+				//Listed in no particular order.
+				var keys []string
+				_ = json.Unmarshal(w.Body.Bytes(), &keys)
+				sort.Strings(keys)
+				b, _ := json.Marshal(keys)
+				body = string(b) + "\n"
+			}
+			if body != tc.expectedResponseBody {
+				t.Errorf("Response body: got %q, want %q", body, tc.expectedResponseBody)
+			}
+
+			if v, _ := d.Get("team-b/1"); v == nil {
+				t.Error("a key the caller may not delete was deleted")
+			}
+			if v, _ := d.Get("shared:1"); v.(db.Blob).Data[0] != 'a' {
+				t.Error("a key the caller may not write was written")
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"KeyValueDB/certs"
+	"KeyValueDB/logging"
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader carries a request's ID. A client or proxy may set it, otherwise one is generated; either way it is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds a client supplied request ID, which is written to every log record of the request.
+const maxRequestIDLength = 128
+
+// RequestID gives each request an ID, which is put in the request context for logging and echoed in the response.
+// The ID is also set on the request itself, so it is passed on when the request is proxied to another node.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog logs every request once it has been served, with its method, key, status, size and latency, and the client's identity if it presented a certificate.
+// Requests to the API's own endpoints, such as /_stats, are logged with their path instead of a key.
+func AccessLog(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+		}
+		if key := requestKey(r); key != "" {
+			attrs = append(attrs, slog.String("key", key))
+		} else {
+			attrs = append(attrs, slog.String("path", r.URL.Path))
+		}
+		attrs = append(attrs,
+			slog.Int("status", sw.code()),
+			slog.Int64("bytes", sw.written),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		)
+		if id, ok := certs.ClientIdentity(r.Context()); ok {
+			attrs = append(attrs, slog.String("client", id.String()))
+		}
+		logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+	})
+}
+
+// requestKey returns the key a request to the index is for, or "" for a listing or another endpoint.
+func requestKey(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/_") {
+		return ""
+	}
+	return strings.TrimPrefix(r.URL.Path, "/")
+}
+
+// statusWriter records the status and size of a response. Streaming and upgrading to a WebSocket still work through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	//The connection now belongs to the handler, typically as a WebSocket.
+	w.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// code returns the status sent, which is 200 if the handler wrote nothing.
+func (w *statusWriter) code() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"KeyValueDB/certs"
+	"KeyValueDB/logging"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testLogger = slog.New(slog.DiscardHandler)
+
+func TestRequestID(t *testing.T) {
+	tt := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "id from the client should be kept", header: "req-1", expected: "req-1"},
+		{name: "missing id should be generated"},
+		{name: "id with control characters should be replaced", header: "a\tb"},
+		{name: "overlong id should be replaced", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var seen, forwarded string
+			h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = logging.RequestID(r.Context())
+				forwarded = r.Header.Get(RequestIDHeader)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/key", nil)
+			if tc.header != "" {
+				r.Header.Set(RequestIDHeader, tc.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if seen == "" || seen != forwarded || seen != w.Header().Get(RequestIDHeader) {
+				t.Errorf("handler saw %q, request header %q, response header %q", seen, forwarded, w.Header().Get(RequestIDHeader))
+			}
+			if tc.expected != "" && seen != tc.expected {
+				t.Errorf("got id %q, expected %q", seen, tc.expected)
+			}
+			if tc.expected == "" && seen == tc.header {
+				t.Errorf("invalid id %q was kept", seen)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	tt := []struct {
+		name     string
+		method   string
+		target   string
+		identity string
+		handler  http.HandlerFunc
+		expected map[string]interface{}
+	}{
+		{
+			name:   "request for a key should be logged with the key",
+			method: http.MethodPut,
+			target: "/user:1",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte("hello"))
+			},
+			expected: map[string]interface{}{"method": "PUT", "key": "user:1", "status": float64(201), "bytes": float64(5), "request_id": "req-1"},
+		},
+		{
+			name:     "handler writing nothing should be logged as 200",
+			method:   http.MethodDelete,
+			target:   "/user:1",
+			handler:  func(w http.ResponseWriter, r *http.Request) {},
+			expected: map[string]interface{}{"method": "DELETE", "key": "user:1", "status": float64(200), "bytes": float64(0)},
+		},
+		{
+			name:   "other endpoints should be logged with their path",
+			method: http.MethodGet,
+			target: "/_stats",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "error - encoding response", http.StatusInternalServerError)
+			},
+			expected: map[string]interface{}{"method": "GET", "path": "/_stats", "status": float64(500)},
+		},
+		{
+			name:     "listing should be logged with its path",
+			method:   http.MethodGet,
+			target:   "/?scan=1",
+			handler:  func(w http.ResponseWriter, r *http.Request) {},
+			expected: map[string]interface{}{"path": "/", "status": float64(200)},
+		},
+		{
+			name:     "client with a certificate should be logged with its identity",
+			method:   http.MethodGet,
+			target:   "/user:1",
+			identity: "alice",
+			handler:  func(w http.ResponseWriter, r *http.Request) {},
+			expected: map[string]interface{}{"key": "user:1", "client": "alice"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := AccessLog(logging.New(&buf, logging.FormatJSON, slog.LevelInfo), tc.handler)
+
+			r := httptest.NewRequest(tc.method, tc.target, nil)
+			r = r.WithContext(logging.WithRequestID(r.Context(), "req-1"))
+			if tc.identity != "" {
+				r = r.WithContext(certs.WithIdentity(r.Context(), certs.Identity{CommonName: tc.identity}))
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			var record map[string]interface{}
+			err := json.Unmarshal(buf.Bytes(), &record)
+			if err != nil {
+				t.Fatalf("record is not JSON: %q", buf.String())
+			}
+			if record["msg"] != "request" || record["latency"] == nil {
+				t.Errorf("got record %v", record)
+			}
+			for k, v := range tc.expected {
+				if record[k] != v {
+					t.Errorf("%s is %v, expected %v", k, record[k], v)
+				}
+			}
+		})
+	}
+
+	t.Run("streaming should still be possible", func(t *testing.T) {
+		var flushed bool
+		h := AccessLog(testLogger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, flushed = w.(http.Flusher)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/_watch", nil))
+
+		if !flushed {
+			t.Error("response writer is not a Flusher")
+		}
+	})
+}
+
+func TestHandlerErrorLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, logging.FormatText, slog.LevelInfo)
+
+	d := &mockDatabase{shouldError: true}
+
+	h := RequestID(IndexHandler(d, logger))
+	r := httptest.NewRequest(http.MethodGet, "/key", nil)
+	r.Header.Set(RequestIDHeader, "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	for _, s := range []string{"level=ERROR", `msg="getting key"`, "key=key", "request_id=req-1"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("log %q does not contain %s", buf.String(), s)
+		}
+	}
+}
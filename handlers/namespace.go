@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"KeyValueDB/rbac"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NamespacePrefix is the path that the keys of a namespace are served under, as /ns/{name}/{key}.
+const NamespacePrefix = "/ns/"
+
+// namespaceSettings are the quota and settings of a namespace as written in requests and responses, with the default TTL as a duration string.
+type namespaceSettings struct {
+	MaxKeys        int64             `json:"maxKeys"`
+	MaxBytes       int64             `json:"maxBytes"`
+	EvictionPolicy db.EvictionPolicy `json:"evictionPolicy"`
+	DefaultTTL     string            `json:"defaultTTL,omitempty"`
+}
+
+type namespaceResponse struct {
+	Name string `json:"name"`
+	namespaceSettings
+	Stats db.Stats `json:"stats"`
+}
+
+// NamespacesHandler administers namespaces: GET /_namespaces lists them, and on /_namespaces/{name}, GET describes a namespace,
+// PUT creates it with the settings in the body, if any, and DELETE drops it along with all of its keys. Errors are logged to logger.
+func NamespacesHandler(ns *db.Namespaces, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/_namespaces"), "/")
+
+		if name == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			list := ns.List()
+			out := make([]namespaceResponse, len(list))
+			for i, info := range list {
+				out[i] = toNamespaceResponse(info)
+			}
+			writeJSON(logger, w, r, http.StatusOK, out)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			info, err := ns.Info(name)
+			if errors.Is(err, db.ErrNamespaceNotFound) {
+				http.Error(w, "error - namespace not found", http.StatusNotFound)
+				return
+			}
+			writeJSON(logger, w, r, http.StatusOK, toNamespaceResponse(info))
+		case http.MethodPut:
+			createNamespace(ns, logger, w, r, name)
+		case http.MethodDelete:
+			err := ns.Drop(name)
+			if errors.Is(err, db.ErrNamespaceNotFound) {
+				http.Error(w, "error - namespace not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "error - dropping namespace", http.StatusInternalServerError)
+				logger.ErrorContext(r.Context(), "dropping namespace", "namespace", name, "err", err)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func createNamespace(ns *db.Namespaces, logger *slog.Logger, w http.ResponseWriter, r *http.Request, name string) {
+	var settings namespaceSettings
+	err := json.NewDecoder(r.Body).Decode(&settings)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "error - invalid namespace settings", http.StatusBadRequest)
+		return
+	}
+
+	cfg := db.NamespaceConfig{
+		MaxKeys:        settings.MaxKeys,
+		MaxBytes:       settings.MaxBytes,
+		EvictionPolicy: settings.EvictionPolicy,
+	}
+	if settings.DefaultTTL != "" {
+		cfg.DefaultTTL, err = parseTTL(settings.DefaultTTL)
+		if err != nil {
+			http.Error(w, "error - invalid defaultTTL", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = ns.Create(name, cfg)
+	if errors.Is(err, db.ErrNamespaceExists) {
+		http.Error(w, "error - namespace already exists", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, db.ErrInvalidNamespace) {
+		http.Error(w, "error - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error - creating namespace", http.StatusInternalServerError)
+		logger.ErrorContext(r.Context(), "creating namespace", "namespace", name, "err", err)
+		return
+	}
+
+	info, err := ns.Info(name)
+	if err != nil {
+		//Dropped again already.
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	writeJSON(logger, w, r, http.StatusCreated, toNamespaceResponse(info))
+}
+
+func toNamespaceResponse(info db.NamespaceInfo) namespaceResponse {
+	out := namespaceResponse{
+		Name: info.Name,
+		namespaceSettings: namespaceSettings{
+			MaxKeys:        info.Config.MaxKeys,
+			MaxBytes:       info.Config.MaxBytes,
+			EvictionPolicy: info.Config.EvictionPolicy,
+		},
+		Stats: info.Stats,
+	}
+	if info.Config.DefaultTTL > 0 {
+		out.DefaultTTL = info.Config.DefaultTTL.String()
+	}
+	return out
+}
+
+func writeJSON(logger *slog.Logger, w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "encoding response", "err", err)
+	}
+}
+
+// NamespaceHandler serves the keys of each namespace under /ns/{name}/ as IndexHandler serves the default keyspace,
+// and transactions on them on POST /ns/{name}/_txn. A namespace that does not exist is 404. Errors are logged to logger.
+// If access control is enabled, grants refer to a namespace's keys by their path, as ns/{name}/{key}.
+func NamespaceHandler(ns *db.Namespaces, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, NamespacePrefix), "/")
+
+		d, ok := ns.Get(name)
+		if !ok {
+			http.Error(w, "error - namespace not found", http.StatusNotFound)
+			return
+		}
+
+		//Served as if the key was requested from the default keyspace.
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/" + key
+		r2.URL.RawPath = ""
+
+		if a, ok := rbac.AccessFrom(r.Context()); ok {
+			r2 = r2.WithContext(rbac.WithAccess(r.Context(), a.Within(strings.TrimPrefix(NamespacePrefix, "/")+name+"/")))
+		}
+
+		if key == "_txn" {
+			TxnHandler(d, logger).ServeHTTP(w, r2)
+			return
+		}
+		IndexHandler(d, logger).ServeHTTP(w, r2)
+	}
+}
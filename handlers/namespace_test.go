@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"KeyValueDB/auth"
+	"KeyValueDB/db"
+	"KeyValueDB/rbac"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestNamespaces(t *testing.T, names ...string) *db.Namespaces {
+	t.Helper()
+
+	ns, err := db.OpenNamespaces()
+	if err != nil {
+		t.Fatalf("OpenNamespaces returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = ns.Close() })
+
+	for _, name := range names {
+		err = ns.Create(name, db.NamespaceConfig{})
+		if err != nil {
+			t.Fatalf("Create returned an error: %s", err)
+		}
+	}
+	return ns
+}
+
+func TestNamespacesHandler(t *testing.T) {
+	tt := []struct {
+		name                 string
+		method               string
+		path                 string
+		body                 string
+		expectedResponseCode int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Should List Namespaces on GET",
+			method:               http.MethodGet,
+			path:                 "/_namespaces",
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: `[{"name":"existing","maxKeys":0,"maxBytes":0,"evictionPolicy":"noeviction","stats":{"keys":0,"bytes":0,"maxKeys":0,"maxBytes":0,"policy":"noeviction","evictions":0,"expired":0}}]` + "\n",
+		},
+		{
+			name:                 "Should Describe a Namespace on GET",
+			method:               http.MethodGet,
+			path:                 "/_namespaces/existing",
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: `{"name":"existing","maxKeys":0,"maxBytes":0,"evictionPolicy":"noeviction","stats":{"keys":0,"bytes":0,"maxKeys":0,"maxBytes":0,"policy":"noeviction","evictions":0,"expired":0}}` + "\n",
+		},
+		{
+			name:                 "Should Return 404 on GET of a Missing Namespace",
+			method:               http.MethodGet,
+			path:                 "/_namespaces/missing",
+			expectedResponseCode: http.StatusNotFound,
+			expectedResponseBody: "error - namespace not found\n",
+		},
+		{
+			name:                 "Should Create a Namespace on PUT",
+			method:               http.MethodPut,
+			path:                 "/_namespaces/team-a",
+			body:                 `{"maxKeys":100,"evictionPolicy":"allkeys-lru","defaultTTL":"1h"}`,
+			expectedResponseCode: http.StatusCreated,
+			expectedResponseBody: `{"name":"team-a","maxKeys":100,"maxBytes":0,"evictionPolicy":"allkeys-lru","defaultTTL":"1h0m0s","stats":{"keys":0,"bytes":0,"maxKeys":100,"maxBytes":0,"policy":"allkeys-lru","evictions":0,"expired":0}}` + "\n",
+		},
+		{
+			name:                 "Should Create a Namespace on PUT Without a Body",
+			method:               http.MethodPut,
+			path:                 "/_namespaces/team-a",
+			expectedResponseCode: http.StatusCreated,
+			expectedResponseBody: `{"name":"team-a","maxKeys":0,"maxBytes":0,"evictionPolicy":"noeviction","stats":{"keys":0,"bytes":0,"maxKeys":0,"maxBytes":0,"policy":"noeviction","evictions":0,"expired":0}}` + "\n",
+		},
+		{
+			name:                 "Should Return 409 on PUT of an Existing Namespace",
+			method:               http.MethodPut,
+			path:                 "/_namespaces/existing",
+			expectedResponseCode: http.StatusConflict,
+			expectedResponseBody: "error - namespace already exists\n",
+		},
+		{
+			name:                 "Should Return 400 on PUT of an Invalid Name",
+			method:               http.MethodPut,
+			path:                 "/_namespaces/Team.A",
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid namespace: name \"Team.A\" must be 1 to 63 lowercase letters, digits, dashes and underscores\n",
+		},
+		{
+			name:                 "Should Return 400 on PUT of Invalid Settings",
+			method:               http.MethodPut,
+			path:                 "/_namespaces/team-a",
+			body:                 `{"evictionPolicy":"fifo"}`,
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid namespace: unknown eviction policy \"fifo\"\n",
+		},
+		{
+			name:                 "Should Return 400 on PUT of an Invalid Default TTL",
+			method:               http.MethodPut,
+			path:                 "/_namespaces/team-a",
+			body:                 `{"defaultTTL":"soon"}`,
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid defaultTTL\n",
+		},
+		{
+			name:                 "Should Return 400 on PUT of a Malformed Body",
+			method:               http.MethodPut,
+			path:                 "/_namespaces/team-a",
+			body:                 `{`,
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid namespace settings\n",
+		},
+		{
+			name:                 "Should Drop a Namespace on DELETE",
+			method:               http.MethodDelete,
+			path:                 "/_namespaces/existing",
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Should Return 404 on DELETE of a Missing Namespace",
+			method:               http.MethodDelete,
+			path:                 "/_namespaces/missing",
+			expectedResponseCode: http.StatusNotFound,
+			expectedResponseBody: "error - namespace not found\n",
+		},
+		{
+			name:                 "Should Return 405 on POST",
+			method:               http.MethodPost,
+			path:                 "/_namespaces",
+			expectedResponseCode: http.StatusMethodNotAllowed,
+			expectedResponseBody: "method not allowed\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ns := newTestNamespaces(t, "existing")
+			w := httptest.NewRecorder()
+			NamespacesHandler(ns, testLogger)(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+
+			if w.Body.String() != tc.expectedResponseBody {
+				t.Errorf("Response body: got %s, want %s", w.Body.String(), tc.expectedResponseBody)
+			}
+		})
+	}
+
+	t.Run("Should Remove the Keys of a Dropped Namespace", func(t *testing.T) {
+		ns := newTestNamespaces(t, "existing")
+		d, _ := ns.Get("existing")
+		_ = d.Set("key", "value")
+
+		h := NamespacesHandler(ns, testLogger)
+		h(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/_namespaces/existing", nil))
+		h(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/_namespaces/existing", nil))
+
+		d, _ = ns.Get("existing")
+		if keys, _ := d.GetAllKeys(); len(keys) != 0 {
+			t.Errorf("recreated namespace has keys %v", keys)
+		}
+	})
+}
+
+func TestNamespaceHandler(t *testing.T) {
+	tt := []struct {
+		name                 string
+		method               string
+		path                 string
+		body                 string
+		expectedResponseCode int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Should Get a Key of the Namespace",
+			method:               http.MethodGet,
+			path:                 "/ns/a/key",
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: "in a",
+		},
+		{
+			name:                 "Should Return 404 on a Key of Another Namespace",
+			method:               http.MethodGet,
+			path:                 "/ns/b/key",
+			expectedResponseCode: http.StatusNotFound,
+		},
+		{
+			name:                 "Should List the Keys of the Namespace",
+			method:               http.MethodGet,
+			path:                 "/ns/a/",
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: "[\"key\"]\n",
+		},
+		{
+			name:                 "Should Put a Key in the Namespace",
+			method:               http.MethodPut,
+			path:                 "/ns/b/key",
+			body:                 "in b",
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Should Apply a Transaction in the Namespace",
+			method:               http.MethodPost,
+			path:                 "/ns/a/_txn",
+			body:                 `{"ops":[{"op":"get","key":"key"}]}`,
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: "{\"results\":[{\"key\":\"key\",\"value\":\"in a\",\"version\":1,\"found\":true}]}\n",
+		},
+		{
+			name:                 "Should Return 404 on a Missing Namespace",
+			method:               http.MethodGet,
+			path:                 "/ns/missing/key",
+			expectedResponseCode: http.StatusNotFound,
+			expectedResponseBody: "error - namespace not found\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ns := newTestNamespaces(t, "a", "b")
+			a, _ := ns.Get("a")
+			_ = a.Set("key", db.Blob{Data: []byte("in a")})
+
+			w := httptest.NewRecorder()
+			NamespaceHandler(ns, testLogger)(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+
+			if w.Body.String() != tc.expectedResponseBody {
+				t.Errorf("Response body: got %s, want %s", w.Body.String(), tc.expectedResponseBody)
+			}
+
+			if tc.method == http.MethodPut {
+				b, _ := ns.Get("b")
+				if v, _ := b.Get("key"); v == nil {
+					t.Error("key was not put in the namespace")
+				}
+				if v, _ := a.Get("key"); string(v.(db.Blob).Data) != "in a" {
+					t.Errorf("another namespace's key was changed to %v", v)
+				}
+			}
+		})
+	}
+}
+
+func TestNamespaceHandlerAccessControl(t *testing.T) {
+	policy := &rbac.Policy{
+		Roles: map[string]rbac.Role{
+			"team-a": {Grants: []rbac.Grant{
+				{Prefix: "ns/a/", Permissions: []rbac.Permission{rbac.Read, rbac.Write, rbac.List}},
+			}},
+		},
+		Bindings: map[string][]string{"api-key:alice": {"team-a"}},
+	}
+	access := policy.Access(auth.Principal{Name: "alice", Method: auth.MethodAPIKey})
+
+	tt := []struct {
+		name                 string
+		method               string
+		path                 string
+		expectedResponseCode int
+	}{
+		{name: "Should Allow Keys of a Granted Namespace", method: http.MethodGet, path: "/ns/a/key", expectedResponseCode: http.StatusOK},
+		{name: "Should Forbid Keys of Another Namespace", method: http.MethodGet, path: "/ns/b/key", expectedResponseCode: http.StatusForbidden},
+		{name: "Should Forbid What the Grant Does Not Give", method: http.MethodDelete, path: "/ns/a/key", expectedResponseCode: http.StatusForbidden},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ns := newTestNamespaces(t, "a", "b")
+			for _, name := range []string{"a", "b"} {
+				d, _ := ns.Get(name)
+				_ = d.Set("key", db.Blob{Data: []byte(name)})
+			}
+
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			r = r.WithContext(rbac.WithAccess(r.Context(), access))
+			w := httptest.NewRecorder()
+			NamespaceHandler(ns, testLogger)(w, r)
+
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+		})
+	}
+}
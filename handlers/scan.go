@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"KeyValueDB/rbac"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultScanLimit = 1000
+	maxScanLimit     = 10000
+)
+
+var scanParams = []string{"prefix", "start", "end", "limit", "cursor"}
+
+type scanResponse struct {
+	Keys   []string `json:"keys"`
+	Cursor string   `json:"cursor,omitempty"`
+}
+
+// isScan reports whether a GET / asks for an ordered, paginated listing rather than every key.
+func isScan(r *http.Request) bool {
+	q := r.URL.Query()
+	for _, p := range scanParams {
+		if q.Has(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanHandler lists keys in lexicographic order, one page at a time, leaving out those the caller may not list.
+// The returned cursor is opaque to clients and is passed back unchanged to fetch the next page.
+func scanHandler(d db.IDatabase, logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	opts := db.ScanOptions{
+		Prefix: q.Get("prefix"),
+		Start:  q.Get("start"),
+		End:    q.Get("end"),
+		Limit:  defaultScanLimit,
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxScanLimit {
+			http.Error(w, fmt.Sprintf("error - limit must be between 1 and %d", maxScanLimit), http.StatusBadRequest)
+			return
+		}
+		opts.Limit = limit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		after, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || len(after) == 0 {
+			http.Error(w, "error - invalid cursor", http.StatusBadRequest)
+			return
+		}
+		opts.After = string(after)
+	}
+
+	page, err := d.Scan(opts)
+	if err != nil {
+		http.Error(w, "error - scanning keys", http.StatusInternalServerError)
+		logger.ErrorContext(r.Context(), "scanning keys", "err", err)
+		return
+	}
+
+	//A page may hold fewer keys than the limit once the keys the caller may not list are left out. The cursor still moves past them.
+	if a, ok := rbac.AccessFrom(r.Context()); ok {
+		page.Keys = a.Filter(rbac.List, page.Keys)
+	}
+
+	resp := scanResponse{Keys: page.Keys}
+	if page.Next != "" {
+		resp.Cursor = base64.RawURLEncoding.EncodeToString([]byte(page.Next))
+	}
+
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		http.Error(w, "error - encoding response", http.StatusInternalServerError)
+		logger.ErrorContext(r.Context(), "encoding response", "err", err)
+		return
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScanHandler(t *testing.T) {
+	tt := []struct {
+		name                    string
+		target                  string
+		expectedScanCount       int
+		expectedGetAllKeysCount int
+		expectedOpts            db.ScanOptions
+		expectedResponseCode    int
+		expectedResponseBody    string
+		isDbEmpty               bool
+		shouldError             bool
+	}{
+		{
+			name:                    "Get With No Query Should Return All Keys",
+			target:                  "/",
+			expectedGetAllKeysCount: 1,
+			expectedResponseCode:    http.StatusOK,
+			expectedResponseBody:    "[\"hello\",\"world\"]\n",
+		},
+		{
+			name:                 "Should Scan With Prefix and Default Limit",
+			target:               "/?prefix=he",
+			expectedScanCount:    1,
+			expectedOpts:         db.ScanOptions{Prefix: "he", Limit: defaultScanLimit},
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: "{\"keys\":[\"hello\",\"world\"],\"cursor\":\"d29ybGQ\"}\n",
+		},
+		{
+			name:                 "Should Pass Range, Limit and Decoded Cursor",
+			target:               "/?start=a&end=m&limit=2&cursor=d29ybGQ",
+			expectedScanCount:    1,
+			expectedOpts:         db.ScanOptions{Start: "a", End: "m", After: "world", Limit: 2},
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: "{\"keys\":[\"hello\",\"world\"],\"cursor\":\"d29ybGQ\"}\n",
+		},
+		{
+			name:                 "Should Omit Cursor on Last Page",
+			target:               "/?limit=10",
+			expectedScanCount:    1,
+			expectedOpts:         db.ScanOptions{Limit: 10},
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: "{\"keys\":[]}\n",
+			isDbEmpty:            true,
+		},
+		{
+			name:                 "Should Return 400 if Limit Invalid",
+			target:               "/?limit=0",
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - limit must be between 1 and 10000\n",
+		},
+		{
+			name:                 "Should Return 400 if Limit Too Large",
+			target:               "/?limit=10001",
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - limit must be between 1 and 10000\n",
+		},
+		{
+			name:                 "Should Return 400 if Cursor Invalid",
+			target:               "/?cursor=***",
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid cursor\n",
+		},
+		{
+			name:                 "Should Return 500 if Scan Fails",
+			target:               "/?prefix=a",
+			expectedScanCount:    1,
+			expectedOpts:         db.ScanOptions{Prefix: "a", Limit: defaultScanLimit},
+			expectedResponseCode: http.StatusInternalServerError,
+			expectedResponseBody: "error - scanning keys\n",
+			shouldError:          true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &mockDatabase{isEmpty: tc.isDbEmpty, shouldError: tc.shouldError}
+			w := httptest.NewRecorder()
+			getHandler(d, testLogger, w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			if d.scanCalledCount != tc.expectedScanCount {
+				t.Errorf("Scan called count: got %d, want %d", d.scanCalledCount, tc.expectedScanCount)
+			}
+
+			if d.getAllKeysCalledCount != tc.expectedGetAllKeysCount {
+				t.Errorf("GetAllKeys called count: got %d, want %d", d.getAllKeysCalledCount, tc.expectedGetAllKeysCount)
+			}
+
+			if d.scanOptsArg != tc.expectedOpts {
+				t.Errorf("Scan called with wrong options: got %+v, want %+v", d.scanOptsArg, tc.expectedOpts)
+			}
+
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+
+			if w.Body.String() != tc.expectedResponseBody {
+				t.Errorf("Response body: got %s, want %s", w.Body.String(), tc.expectedResponseBody)
+			}
+		})
+	}
+}
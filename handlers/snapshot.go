@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// SnapshotHandler takes a snapshot of the database on POST.
+func SnapshotHandler(s db.ISnapshotter, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		info, err := s.Snapshot()
+		if err != nil {
+			if errors.Is(err, db.ErrPersistenceDisabled) {
+				http.Error(w, "error - persistence is not enabled", http.StatusConflict)
+				return
+			}
+			http.Error(w, "error - taking snapshot", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "taking snapshot", "err", err)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(info)
+		if err != nil {
+			http.Error(w, "error - encoding response", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "encoding response", "err", err)
+			return
+		}
+	}
+}
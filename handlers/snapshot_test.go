@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockSnapshotter struct {
+	calledCount int
+	err         error
+}
+
+func (m *mockSnapshotter) Snapshot() (db.SnapshotInfo, error) {
+	m.calledCount++
+	if m.err != nil {
+		return db.SnapshotInfo{}, m.err
+	}
+	return db.SnapshotInfo{Seq: 2, Keys: 3}, nil
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	tt := []struct {
+		name                 string
+		method               string
+		err                  error
+		expectedCalledCount  int
+		expectedResponseCode int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Should Take Snapshot on POST",
+			method:               http.MethodPost,
+			expectedCalledCount:  1,
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: "{\"seq\":2,\"keys\":3,\"bytes\":0,\"duration\":0}\n",
+		},
+		{
+			name:                 "Should Return 405 on GET",
+			method:               http.MethodGet,
+			expectedCalledCount:  0,
+			expectedResponseCode: http.StatusMethodNotAllowed,
+			expectedResponseBody: "method not allowed\n",
+		},
+		{
+			name:                 "Should Return 409 if Persistence Disabled",
+			method:               http.MethodPost,
+			err:                  db.ErrPersistenceDisabled,
+			expectedCalledCount:  1,
+			expectedResponseCode: http.StatusConflict,
+			expectedResponseBody: "error - persistence is not enabled\n",
+		},
+		{
+			name:                 "Should Return 500 if Snapshot Fails",
+			method:               http.MethodPost,
+			err:                  errors.New("error"),
+			expectedCalledCount:  1,
+			expectedResponseCode: http.StatusInternalServerError,
+			expectedResponseBody: "error - taking snapshot\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &mockSnapshotter{err: tc.err}
+			w := httptest.NewRecorder()
+			SnapshotHandler(s, testLogger)(w, httptest.NewRequest(tc.method, "/_snapshot", nil))
+
+			if s.calledCount != tc.expectedCalledCount {
+				t.Errorf("Snapshot called count: got %d, want %d", s.calledCount, tc.expectedCalledCount)
+			}
+
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+
+			if w.Body.String() != tc.expectedResponseBody {
+				t.Errorf("Response body: got %s, want %s", w.Body.String(), tc.expectedResponseBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// StatsHandler reports the size of the database, its limits and how many keys have been evicted on GET.
+func StatsHandler(s db.IStats, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		err := json.NewEncoder(w).Encode(s.Stats())
+		if err != nil {
+			http.Error(w, "error - encoding response", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "encoding response", "err", err)
+			return
+		}
+	}
+}
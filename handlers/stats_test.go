@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockStats struct {
+	calledCount int
+}
+
+func (m *mockStats) Stats() db.Stats {
+	m.calledCount++
+	return db.Stats{Keys: 2, Bytes: 300, MaxBytes: 1024, Policy: db.EvictLRU, Evictions: 5, Expired: 7}
+}
+
+func TestStatsHandler(t *testing.T) {
+	tt := []struct {
+		name                 string
+		method               string
+		expectedCalledCount  int
+		expectedResponseCode int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Should Return Stats on GET",
+			method:               http.MethodGet,
+			expectedCalledCount:  1,
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: "{\"keys\":2,\"bytes\":300,\"maxKeys\":0,\"maxBytes\":1024,\"policy\":\"allkeys-lru\",\"evictions\":5,\"expired\":7}\n",
+		},
+		{
+			name:                 "Should Return 405 on POST",
+			method:               http.MethodPost,
+			expectedCalledCount:  0,
+			expectedResponseCode: http.StatusMethodNotAllowed,
+			expectedResponseBody: "method not allowed\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &mockStats{}
+			w := httptest.NewRecorder()
+			StatsHandler(s, testLogger)(w, httptest.NewRequest(tc.method, "/_stats", nil))
+
+			if s.calledCount != tc.expectedCalledCount {
+				t.Errorf("Stats called count: got %d, want %d", s.calledCount, tc.expectedCalledCount)
+			}
+
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+
+			if w.Body.String() != tc.expectedResponseBody {
+				t.Errorf("Response body: got %s, want %s", w.Body.String(), tc.expectedResponseBody)
+			}
+		})
+	}
+}
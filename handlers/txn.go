@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"KeyValueDB/rbac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type txnRequest struct {
+	Ops []txnOpRequest `json:"ops"`
+}
+
+type txnOpRequest struct {
+	Op        db.TxnOpType `json:"op"`
+	Key       string       `json:"key"`
+	Value     interface{}  `json:"value"`
+	TTL       string       `json:"ttl"`
+	IfVersion *uint64      `json:"ifVersion"`
+}
+
+// txnPermissions is the permission each type of operation needs. Unknown types are rejected by the transaction.
+var txnPermissions = map[db.TxnOpType]rbac.Permission{
+	db.TxnGet:    rbac.Read,
+	db.TxnSet:    rbac.Write,
+	db.TxnDelete: rbac.Delete,
+}
+
+type txnResponse struct {
+	Results []db.TxnResult `json:"results"`
+}
+
+// TxnHandler applies a list of get, set and delete operations atomically on POST.
+// If any operation's ifVersion precondition fails, nothing is applied and 409 is returned.
+// If access control is enabled, the caller needs permission for every operation, or nothing is applied and 403 is returned.
+func TxnHandler(t db.ITransactor, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req txnRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "error - invalid transaction body", http.StatusBadRequest)
+			return
+		}
+
+		ops := make([]db.TxnOp, len(req.Ops))
+		for i, op := range req.Ops {
+			var ttl time.Duration
+			if op.TTL != "" {
+				ttl, err = parseTTL(op.TTL)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("error - invalid ttl on operation %d", i), http.StatusBadRequest)
+					return
+				}
+			}
+
+			if perm, ok := txnPermissions[op.Op]; ok && !rbac.Allowed(r, perm, op.Key) {
+				http.Error(w, fmt.Sprintf("error - forbidden operation %d", i), http.StatusForbidden)
+				return
+			}
+
+			ops[i] = db.TxnOp{
+				Type:      op.Op,
+				Key:       op.Key,
+				Value:     op.Value,
+				TTL:       ttl,
+				IfVersion: op.IfVersion,
+			}
+		}
+
+		results, err := t.Txn(ops)
+		if err != nil {
+			var conflict *db.TxnConflictError
+			switch {
+			case errors.As(err, &conflict):
+				http.Error(w, "error - transaction conflict: "+conflict.Error(), http.StatusConflict)
+			case errors.Is(err, db.ErrInvalidTxn):
+				http.Error(w, "error - "+err.Error(), http.StatusBadRequest)
+			case errors.Is(err, db.ErrQuotaExceeded):
+				http.Error(w, "error - quota exceeded", http.StatusInsufficientStorage)
+			case errors.Is(err, db.ErrOutOfMemory):
+				http.Error(w, "error - database is full", http.StatusInsufficientStorage)
+			default:
+				http.Error(w, "error - applying transaction", http.StatusInternalServerError)
+				logger.ErrorContext(r.Context(), "applying transaction", "err", err)
+			}
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(txnResponse{Results: results})
+		if err != nil {
+			http.Error(w, "error - encoding response", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "encoding response", "err", err)
+			return
+		}
+	}
+}
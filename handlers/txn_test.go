@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockTransactor struct {
+	calledCount int
+	ops         []db.TxnOp
+	err         error
+}
+
+func (m *mockTransactor) Txn(ops []db.TxnOp) ([]db.TxnResult, error) {
+	m.calledCount++
+	m.ops = ops
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	results := make([]db.TxnResult, len(ops))
+	for i, op := range ops {
+		results[i] = db.TxnResult{Key: op.Key, Version: 3, Found: true}
+	}
+	return results, nil
+}
+
+func TestTxnHandler(t *testing.T) {
+	tt := []struct {
+		name                 string
+		method               string
+		body                 string
+		err                  error
+		expectedCalledCount  int
+		expectedResponseCode int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Should Apply Transaction on POST",
+			method:               http.MethodPost,
+			body:                 `{"ops":[{"op":"get","key":"a","ifVersion":2},{"op":"set","key":"b","value":{"x":1},"ttl":"1m"}]}`,
+			expectedCalledCount:  1,
+			expectedResponseCode: http.StatusOK,
+			expectedResponseBody: "{\"results\":[{\"key\":\"a\",\"version\":3,\"found\":true},{\"key\":\"b\",\"version\":3,\"found\":true}]}\n",
+		},
+		{
+			name:                 "Should Return 405 on GET",
+			method:               http.MethodGet,
+			expectedResponseCode: http.StatusMethodNotAllowed,
+			expectedResponseBody: "method not allowed\n",
+		},
+		{
+			name:                 "Should Return 400 if Body Invalid",
+			method:               http.MethodPost,
+			body:                 `not json`,
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid transaction body\n",
+		},
+		{
+			name:                 "Should Return 400 if TTL Invalid",
+			method:               http.MethodPost,
+			body:                 `{"ops":[{"op":"set","key":"a","ttl":"soon"}]}`,
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid ttl on operation 0\n",
+		},
+		{
+			name:                 "Should Return 400 if Transaction Invalid",
+			method:               http.MethodPost,
+			body:                 `{"ops":[]}`,
+			err:                  db.ErrInvalidTxn,
+			expectedCalledCount:  1,
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid transaction\n",
+		},
+		{
+			name:                 "Should Return 409 if Precondition Fails",
+			method:               http.MethodPost,
+			body:                 `{"ops":[{"op":"delete","key":"a","ifVersion":2}]}`,
+			err:                  &db.TxnConflictError{Index: 0, Key: "a", Expected: 2, Actual: 4},
+			expectedCalledCount:  1,
+			expectedResponseCode: http.StatusConflict,
+			expectedResponseBody: "error - transaction conflict: operation 0 on \"a\": expected version 2, found 4\n",
+		},
+		{
+			name:                 "Should Return 500 if Transaction Fails",
+			method:               http.MethodPost,
+			body:                 `{"ops":[{"op":"delete","key":"a"}]}`,
+			err:                  errors.New("error"),
+			expectedCalledCount:  1,
+			expectedResponseCode: http.StatusInternalServerError,
+			expectedResponseBody: "error - applying transaction\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &mockTransactor{err: tc.err}
+			w := httptest.NewRecorder()
+			TxnHandler(m, testLogger)(w, httptest.NewRequest(tc.method, "/_txn", bytes.NewBufferString(tc.body)))
+
+			if m.calledCount != tc.expectedCalledCount {
+				t.Errorf("Txn called count: got %d, want %d", m.calledCount, tc.expectedCalledCount)
+			}
+
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+
+			if w.Body.String() != tc.expectedResponseBody {
+				t.Errorf("Response body: got %s, want %s", w.Body.String(), tc.expectedResponseBody)
+			}
+		})
+	}
+
+	t.Run("Should Pass Operations Through", func(t *testing.T) {
+		m := &mockTransactor{}
+		body := `{"ops":[{"op":"set","key":"b","value":"v","ttl":"30","ifVersion":0}]}`
+		TxnHandler(m, testLogger)(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/_txn", bytes.NewBufferString(body)))
+
+		if len(m.ops) != 1 {
+			t.Fatalf("Txn called with %d ops, want 1", len(m.ops))
+		}
+
+		op := m.ops[0]
+		if op.Type != db.TxnSet || op.Key != "b" || op.Value != "v" || op.TTL != 30*time.Second {
+			t.Errorf("unexpected op: %+v", op)
+		}
+
+		if op.IfVersion == nil || *op.IfVersion != 0 {
+			t.Errorf("ifVersion not passed through: %v", op.IfVersion)
+		}
+	})
+}
+
+func TestTxnHandlerAccessControl(t *testing.T) {
+	tt := []struct {
+		name                 string
+		body                 string
+		expectedCalledCount  int
+		expectedResponseCode int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Should Apply Transaction on Permitted Keys",
+			body:                 `{"ops":[{"op":"get","key":"shared:1"},{"op":"set","key":"team-a/1","value":1},{"op":"delete","key":"team-a/2"}]}`,
+			expectedCalledCount:  1,
+			expectedResponseCode: http.StatusOK,
+		},
+		{
+			name:                 "Should Forbid Transaction if Any Operation is Not Permitted",
+			body:                 `{"ops":[{"op":"set","key":"team-a/1","value":1},{"op":"delete","key":"shared:1"}]}`,
+			expectedResponseCode: http.StatusForbidden,
+			expectedResponseBody: "error - forbidden operation 1\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &mockTransactor{}
+			w := httptest.NewRecorder()
+			TxnHandler(m, testLogger)(w, withAccess(httptest.NewRequest(http.MethodPost, "/_txn", bytes.NewBufferString(tc.body))))
+
+			if m.calledCount != tc.expectedCalledCount {
+				t.Errorf("Txn called count: got %d, want %d", m.calledCount, tc.expectedCalledCount)
+			}
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+			if tc.expectedResponseBody != "" && w.Body.String() != tc.expectedResponseBody {
+				t.Errorf("Response body: got %q, want %q", w.Body.String(), tc.expectedResponseBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// watchHeartbeat is how often an idle stream sends a comment, so that proxies do not time it out.
+var watchHeartbeat = 15 * time.Second
+
+// WatchHandler streams changes to keys with the "prefix" query parameter as Server-Sent Events.
+// Each event's id is its revision; a reconnecting client sends it back as Last-Event-ID, or as the "since" query parameter, to resume without missing changes.
+func WatchHandler(wt db.IWatcher, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "error - streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		opts := db.WatchOptions{Prefix: r.URL.Query().Get("prefix")}
+
+		since := r.Header.Get("Last-Event-ID")
+		if since == "" {
+			since = r.URL.Query().Get("since")
+		}
+		if since != "" {
+			rev, err := strconv.ParseUint(since, 10, 64)
+			if err != nil {
+				http.Error(w, "error - invalid since revision", http.StatusBadRequest)
+				return
+			}
+			opts.Since, opts.Resume = rev, true
+		}
+
+		watch, err := wt.Watch(opts)
+		if errors.Is(err, db.ErrCompacted) {
+			http.Error(w, "error - revision has been compacted", http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, "error - starting watch", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "starting watch", "err", err)
+			return
+		}
+		defer watch.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		//The ready event's id lets a client that disconnects before any change resume from where it started.
+		fmt.Fprintf(w, "event: ready\nid: %d\ndata: {\"revision\":%d}\n\n", watch.Revision(), watch.Revision())
+		flusher.Flush()
+
+		for {
+			ctx, cancel := context.WithTimeout(r.Context(), watchHeartbeat)
+			events, err := watch.Next(ctx)
+			cancel()
+
+			if r.Context().Err() != nil {
+				return
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				fmt.Fprint(w, ": keepalive\n\n")
+				flusher.Flush()
+				continue
+			}
+			if err != nil {
+				fmt.Fprintf(w, "event: error\ndata: {\"error\":%q}\n\n", err.Error())
+				flusher.Flush()
+				return
+			}
+
+			err = writeEvents(w, events)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "writing watch events", "err", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvents writes each event as a message. Only the last event of each revision carries an id, so a client never resumes partway through a transaction.
+func writeEvents(w http.ResponseWriter, events []db.Event) error {
+	for i, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		if i == len(events)-1 || events[i+1].Revision != e.Revision {
+			_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Revision, data)
+		} else {
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readMessages reads n Server-Sent Events messages, returning each as its lines joined by "|".
+func readMessages(t *testing.T, r *bufio.Reader, n int) []string {
+	t.Helper()
+
+	var out []string
+	var lines []string
+	for len(out) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %s (read %v)", err, out)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line != "" {
+			lines = append(lines, line)
+			continue
+		}
+		out = append(out, strings.Join(lines, "|"))
+		lines = nil
+	}
+	return out
+}
+
+func startWatch(t *testing.T, d *db.Database, target string, header http.Header) (*http.Response, *bufio.Reader) {
+	t.Helper()
+
+	srv := httptest.NewServer(WatchHandler(d, testLogger))
+	t.Cleanup(srv.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	return resp, bufio.NewReader(resp.Body)
+}
+
+func TestWatchHandler(t *testing.T) {
+	t.Run("Should Stream Changes with Prefix", func(t *testing.T) {
+		d, _ := db.NewDatabase()
+		defer d.Close()
+
+		resp, r := startWatch(t, d, "/_watch?prefix=user:", nil)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+
+		if got := readMessages(t, r, 1); got[0] != `event: ready|id: 0|data: {"revision":0}` {
+			t.Errorf("ready message: got %q", got[0])
+		}
+
+		_ = d.Set("order:1", "ignored")
+		_, _ = d.Txn([]db.TxnOp{
+			{Type: db.TxnSet, Key: "user:1", Value: db.Blob{ContentType: "application/json", Data: []byte(`{"a":1}`)}},
+			{Type: db.TxnSet, Key: "user:2", Value: "text"},
+		})
+		_ = d.Delete("user:1")
+
+		got := readMessages(t, r, 3)
+		for i, want := range []string{
+			`data: {"revision":2,"type":"set","key":"user:1",`,
+			`id: 2|data: {"revision":2,"type":"set","key":"user:2",`,
+			`id: 3|data: {"revision":3,"type":"delete","key":"user:1",`,
+		} {
+			if !strings.HasPrefix(got[i], want) {
+				t.Errorf("message %d: got %q, want prefix %q", i, got[i], want)
+			}
+		}
+
+		if !strings.Contains(got[0], `"oldVersion":0,"newVersion":2,"value":{"a":1}}`) {
+			t.Errorf("message 0 is missing versions or value: %q", got[0])
+		}
+	})
+
+	t.Run("Should Resume from Last-Event-ID", func(t *testing.T) {
+		d, _ := db.NewDatabase()
+		defer d.Close()
+
+		_ = d.Set("a", "1")
+		_ = d.Set("b", "1")
+
+		_, r := startWatch(t, d, "/_watch?since=0", http.Header{"Last-Event-Id": {"1"}})
+
+		got := readMessages(t, r, 2)
+		if got[0] != `event: ready|id: 1|data: {"revision":1}` || !strings.HasPrefix(got[1], `id: 2|data: {"revision":2,"type":"set","key":"b"`) {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("Should Send Heartbeats", func(t *testing.T) {
+		heartbeat := watchHeartbeat
+		watchHeartbeat = 10 * time.Millisecond
+		defer func() { watchHeartbeat = heartbeat }()
+
+		d, _ := db.NewDatabase()
+		defer d.Close()
+
+		_, r := startWatch(t, d, "/_watch", nil)
+
+		got := readMessages(t, r, 2)
+		if got[1] != ": keepalive" {
+			t.Errorf("got %q, want keepalive", got[1])
+		}
+	})
+
+	t.Run("Should End Stream When Database Closes", func(t *testing.T) {
+		d, _ := db.NewDatabase()
+
+		_, r := startWatch(t, d, "/_watch", nil)
+		readMessages(t, r, 1)
+
+		_ = d.Close()
+
+		got := readMessages(t, r, 1)
+		if got[0] != `event: error|data: {"error":"watch closed"}` {
+			t.Errorf("got %q", got[0])
+		}
+	})
+}
+
+func TestWatchHandlerErrors(t *testing.T) {
+	d, _ := db.NewDatabase(db.WithWatchHistory(1))
+	defer d.Close()
+
+	_ = d.Set("a", "1")
+	_ = d.Set("a", "2")
+
+	tt := []struct {
+		name                 string
+		request              *http.Request
+		expectedResponseCode int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Should Return 405 on POST",
+			request:              httptest.NewRequest(http.MethodPost, "/_watch", nil),
+			expectedResponseCode: http.StatusMethodNotAllowed,
+			expectedResponseBody: "method not allowed\n",
+		},
+		{
+			name:                 "Should Return 400 if Since Invalid",
+			request:              httptest.NewRequest(http.MethodGet, "/_watch?since=yesterday", nil),
+			expectedResponseCode: http.StatusBadRequest,
+			expectedResponseBody: "error - invalid since revision\n",
+		},
+		{
+			name:                 "Should Return 410 if Revision Compacted",
+			request:              httptest.NewRequest(http.MethodGet, "/_watch?since=0", nil),
+			expectedResponseCode: http.StatusGone,
+			expectedResponseBody: "error - revision has been compacted\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			WatchHandler(d, testLogger)(w, tc.request)
+
+			if w.Code != tc.expectedResponseCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedResponseCode)
+			}
+
+			if w.Body.String() != tc.expectedResponseBody {
+				t.Errorf("Response body: got %s, want %s", w.Body.String(), tc.expectedResponseBody)
+			}
+		})
+	}
+}
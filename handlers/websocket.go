@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"KeyValueDB/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	//Messages waiting to be written to one connection. Once it is full, that connection's subscriptions stop reading their watches,
+	//which queue events without blocking writers and are dropped if the browser falls too far behind.
+	wsSendBuffer = 256
+
+	wsMaxMessageSize = 1 << 20
+	wsWriteTimeout   = 10 * time.Second
+	wsPongTimeout    = 60 * time.Second
+	wsPingInterval   = wsPongTimeout * 9 / 10
+)
+
+// ILiveDatabase is a database that can also publish its changes.
+type ILiveDatabase interface {
+	db.IDatabase
+	db.IWatcher
+}
+
+type wsRequest struct {
+	ID      json.RawMessage `json:"id,omitempty"`
+	Op      string          `json:"op"`
+	Key     string          `json:"key"`
+	Pattern string          `json:"pattern"`
+	Since   *uint64         `json:"since"`
+	Value   json.RawMessage `json:"value"`
+	TTL     string          `json:"ttl"`
+}
+
+type wsReply struct {
+	ID       json.RawMessage `json:"id,omitempty"`
+	OK       bool            `json:"ok"`
+	Error    string          `json:"error,omitempty"`
+	Found    *bool           `json:"found,omitempty"`
+	Value    interface{}     `json:"value,omitempty"`
+	Version  uint64          `json:"version,omitempty"`
+	Revision *uint64         `json:"revision,omitempty"`
+}
+
+type wsEvent struct {
+	Subscription string    `json:"subscription"`
+	Event        *db.Event `json:"event,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// WebSocketHandler upgrades to a WebSocket over which a client can issue get, set and delete commands,
+// and subscribe to changes to keys matching glob patterns such as "user:*".
+func WebSocketHandler(d ILiveDatabase, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			//Upgrade has already replied with an error.
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		c := &wsConn{
+			d:      d,
+			logger: logger,
+			conn:   conn,
+			ctx:    ctx,
+			cancel: cancel,
+			send:   make(chan interface{}, wsSendBuffer),
+			subs:   make(map[string]context.CancelFunc),
+		}
+		c.serve()
+	}
+}
+
+type wsConn struct {
+	d      ILiveDatabase
+	logger *slog.Logger
+	conn   *websocket.Conn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	send chan interface{}
+
+	lock sync.Mutex
+	subs map[string]context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+func (c *wsConn) serve() {
+	c.wg.Add(1)
+	go c.writeLoop()
+
+	c.readLoop()
+
+	c.cancel()
+	c.wg.Wait()
+	_ = c.conn.Close()
+}
+
+func (c *wsConn) readLoop() {
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req wsRequest
+		err = json.Unmarshal(msg, &req)
+		if err != nil {
+			if !c.enqueue(wsReply{Error: "invalid message"}) {
+				return
+			}
+			continue
+		}
+
+		if !c.enqueue(c.handle(req)) {
+			return
+		}
+	}
+}
+
+// writeLoop is the only writer to the connection, as the websocket package requires.
+func (c *wsConn) writeLoop() {
+	defer c.wg.Done()
+	defer c.cancel()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case msg := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err := c.conn.WriteJSON(msg)
+			if err != nil {
+				//Unblocks the read loop too.
+				_ = c.conn.Close()
+				return
+			}
+		case <-ping.C:
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			if err != nil {
+				_ = c.conn.Close()
+				return
+			}
+		case <-c.ctx.Done():
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return
+		}
+	}
+}
+
+// enqueue waits for room to send msg, returning false if the connection is closing.
+func (c *wsConn) enqueue(msg interface{}) bool {
+	select {
+	case c.send <- msg:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+func (c *wsConn) handle(req wsRequest) wsReply {
+	reply := wsReply{ID: req.ID}
+
+	var err error
+	switch req.Op {
+	case "get":
+		err = c.get(req, &reply)
+	case "set":
+		err = c.set(req)
+	case "delete":
+		err = c.delete(req)
+	case "subscribe":
+		err = c.subscribe(req, &reply)
+	case "unsubscribe":
+		err = c.unsubscribe(req)
+	default:
+		err = fmt.Errorf("unknown op %q", req.Op)
+	}
+
+	if err != nil {
+		reply.Error = err.Error()
+		return reply
+	}
+	reply.OK = true
+	return reply
+}
+
+func (c *wsConn) get(req wsRequest, reply *wsReply) error {
+	if req.Key == "" {
+		return errors.New("no key provided")
+	}
+
+	v, version, err := c.d.GetWithVersion(req.Key)
+	if err != nil {
+		c.logger.ErrorContext(c.ctx, "getting key", "key", req.Key, "err", err)
+		return errors.New("error getting key")
+	}
+
+	found := v != nil
+	reply.Found = &found
+	if !found {
+		return nil
+	}
+
+	b, err := db.AsBlob(v)
+	if err != nil {
+		return errors.New("error encoding value")
+	}
+	reply.Value = b
+	reply.Version = version
+	return nil
+}
+
+// set stores the JSON value as if it had been PUT with a JSON content type.
+func (c *wsConn) set(req wsRequest) error {
+	if req.Key == "" {
+		return errors.New("no key provided")
+	}
+	if len(req.Value) == 0 {
+		return errors.New("no value provided")
+	}
+
+	value := db.Blob{ContentType: "application/json", Data: req.Value}
+
+	var err error
+	if req.TTL != "" {
+		ttl, ttlErr := parseTTL(req.TTL)
+		if ttlErr != nil {
+			return errors.New("invalid ttl")
+		}
+		err = c.d.SetWithTTL(req.Key, value, ttl)
+	} else {
+		err = c.d.Set(req.Key, value)
+	}
+
+	if errors.Is(err, db.ErrOutOfMemory) {
+		return errors.New("database is full")
+	}
+	if err != nil {
+		c.logger.ErrorContext(c.ctx, "putting kv pair", "key", req.Key, "err", err)
+		return errors.New("error putting kv pair")
+	}
+	return nil
+}
+
+func (c *wsConn) delete(req wsRequest) error {
+	if req.Key == "" {
+		return errors.New("no key provided")
+	}
+
+	err := c.d.Delete(req.Key)
+	if err != nil {
+		c.logger.ErrorContext(c.ctx, "deleting key", "key", req.Key, "err", err)
+		return errors.New("error deleting key")
+	}
+	return nil
+}
+
+// subscribe starts forwarding changes to keys matching the pattern. Giving since resumes from that revision, as for /_watch.
+func (c *wsConn) subscribe(req wsRequest, reply *wsReply) error {
+	if req.Pattern == "" {
+		return errors.New("no pattern provided")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.subs[req.Pattern]; ok {
+		return errors.New("already subscribed")
+	}
+
+	opts := db.WatchOptions{Prefix: util.LiteralPrefix(req.Pattern)}
+	if req.Since != nil {
+		opts.Since, opts.Resume = *req.Since, true
+	}
+
+	watch, err := c.d.Watch(opts)
+	if errors.Is(err, db.ErrCompacted) {
+		return err
+	}
+	if err != nil {
+		c.logger.ErrorContext(c.ctx, "starting watch", "err", err)
+		return errors.New("error starting watch")
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.subs[req.Pattern] = cancel
+
+	c.wg.Add(1)
+	go c.forward(ctx, req.Pattern, watch)
+
+	revision := watch.Revision()
+	reply.Revision = &revision
+	return nil
+}
+
+func (c *wsConn) unsubscribe(req wsRequest) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cancel, ok := c.subs[req.Pattern]
+	if !ok {
+		return errors.New("not subscribed")
+	}
+	cancel()
+	delete(c.subs, req.Pattern)
+	return nil
+}
+
+// forward sends the subscription's events until it is cancelled. While the connection's send buffer is full it stops reading,
+// leaving events queued in the watch; if the browser never catches up the watch ends and the subscription with it.
+func (c *wsConn) forward(ctx context.Context, pattern string, watch *db.Watch) {
+	defer c.wg.Done()
+	defer watch.Close()
+
+	for {
+		events, err := watch.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.lock.Lock()
+				delete(c.subs, pattern)
+				c.lock.Unlock()
+
+				c.enqueue(wsEvent{Subscription: pattern, Error: err.Error()})
+			}
+			return
+		}
+
+		for i := range events {
+			if !util.MatchGlob(pattern, events[i].Key) {
+				continue
+			}
+
+			select {
+			case c.send <- wsEvent{Subscription: pattern, Event: &events[i]}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
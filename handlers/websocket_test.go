@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"KeyValueDB/db"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWebSocket(t *testing.T, d *db.Database) *websocket.Conn {
+	t.Helper()
+
+	srv := httptest.NewServer(WebSocketHandler(d, testLogger))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/_ws", nil)
+	if err != nil {
+		t.Fatalf("Dial returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+// roundTrip sends req and returns the next message as compact JSON.
+func roundTrip(t *testing.T, conn *websocket.Conn, req string) string {
+	t.Helper()
+
+	err := conn.WriteMessage(websocket.TextMessage, []byte(req))
+	if err != nil {
+		t.Fatalf("WriteMessage returned an error: %s", err)
+	}
+	return readMessage(t, conn)
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage returned an error: %s", err)
+	}
+	return strings.TrimSpace(string(msg))
+}
+
+func TestWebSocketCommands(t *testing.T) {
+	d, _ := db.NewDatabase()
+	defer d.Close()
+
+	conn := dialWebSocket(t, d)
+
+	tt := []struct {
+		name     string
+		request  string
+		expected string
+	}{
+		{
+			name:     "Should Set JSON Value",
+			request:  `{"id":1,"op":"set","key":"k","value":{"a":[1,2]}}`,
+			expected: `{"id":1,"ok":true}`,
+		},
+		{
+			name:     "Should Get Value with Version",
+			request:  `{"id":"two","op":"get","key":"k"}`,
+			expected: `{"id":"two","ok":true,"found":true,"value":{"a":[1,2]},"version":1}`,
+		},
+		{
+			name:     "Should Report Missing Key",
+			request:  `{"op":"get","key":"missing"}`,
+			expected: `{"ok":true,"found":false}`,
+		},
+		{
+			name:     "Should Delete Key",
+			request:  `{"id":3,"op":"delete","key":"k"}`,
+			expected: `{"id":3,"ok":true}`,
+		},
+		{
+			name:     "Should Reject Invalid TTL",
+			request:  `{"id":4,"op":"set","key":"k","value":1,"ttl":"soon"}`,
+			expected: `{"id":4,"ok":false,"error":"invalid ttl"}`,
+		},
+		{
+			name:     "Should Reject Unknown Op",
+			request:  `{"id":5,"op":"flush"}`,
+			expected: `{"id":5,"ok":false,"error":"unknown op \"flush\""}`,
+		},
+		{
+			name:     "Should Reject Invalid JSON",
+			request:  `{"id":`,
+			expected: `{"ok":false,"error":"invalid message"}`,
+		},
+		{
+			name:     "Should Reject Unsubscribe Without Subscription",
+			request:  `{"id":6,"op":"unsubscribe","pattern":"x*"}`,
+			expected: `{"id":6,"ok":false,"error":"not subscribed"}`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := roundTrip(t, conn, tc.request); got != tc.expected {
+				t.Errorf("got %s, want %s", got, tc.expected)
+			}
+		})
+	}
+
+	v, _ := d.Get("k")
+	if v != nil {
+		t.Errorf("k should have been deleted, got %v", v)
+	}
+}
+
+func TestWebSocketSubscriptions(t *testing.T) {
+	d, _ := db.NewDatabase()
+	defer d.Close()
+
+	_ = d.Set("user:0", "before")
+
+	conn := dialWebSocket(t, d)
+
+	if got := roundTrip(t, conn, `{"id":1,"op":"subscribe","pattern":"user:?"}`); got != `{"id":1,"ok":true,"revision":1}` {
+		t.Fatalf("subscribe: got %s", got)
+	}
+	if got := roundTrip(t, conn, `{"id":2,"op":"subscribe","pattern":"user:?"}`); got != `{"id":2,"ok":false,"error":"already subscribed"}` {
+		t.Errorf("duplicate subscribe: got %s", got)
+	}
+
+	_ = d.Set("user:10", "ignored by the pattern")
+	_ = d.Set("order:1", "ignored by the prefix")
+	_ = d.Set("user:1", db.Blob{ContentType: "application/json", Data: []byte(`{"name":"a"}`)})
+
+	var msg wsEvent
+	err := json.Unmarshal([]byte(readMessage(t, conn)), &msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subscription != "user:?" || msg.Event == nil || msg.Event.Key != "user:1" || msg.Event.Revision != 4 || msg.Event.Type != db.EventSet {
+		t.Errorf("unexpected event: %+v", msg)
+	}
+
+	if got := roundTrip(t, conn, `{"id":3,"op":"unsubscribe","pattern":"user:?"}`); got != `{"id":3,"ok":true}` {
+		t.Errorf("unsubscribe: got %s", got)
+	}
+
+	_ = d.Set("user:2", "after unsubscribing")
+
+	//Resuming replays what happened while unsubscribed, and nothing from the old subscription arrives in between.
+	if got := roundTrip(t, conn, `{"id":4,"op":"subscribe","pattern":"user:*","since":1}`); got != `{"id":4,"ok":true,"revision":1}` {
+		t.Fatalf("resubscribe: got %s", got)
+	}
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		var msg wsEvent
+		_ = json.Unmarshal([]byte(readMessage(t, conn)), &msg)
+		keys = append(keys, msg.Event.Key)
+	}
+	if strings.Join(keys, ",") != "user:10,user:1,user:2" {
+		t.Errorf("replayed %v", keys)
+	}
+}
+
+func TestWebSocketSubscriptionCompacted(t *testing.T) {
+	d, _ := db.NewDatabase(db.WithWatchHistory(1))
+	defer d.Close()
+
+	_ = d.Set("a", "1")
+	_ = d.Set("a", "2")
+
+	conn := dialWebSocket(t, d)
+
+	if got := roundTrip(t, conn, `{"id":1,"op":"subscribe","pattern":"*","since":0}`); got != `{"id":1,"ok":false,"error":"revision has been compacted"}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestWebSocketSlowConsumer(t *testing.T) {
+	d, _ := db.NewDatabase()
+	defer d.Close()
+
+	conn := dialWebSocket(t, d)
+	roundTrip(t, conn, `{"id":1,"op":"subscribe","pattern":"*"}`)
+
+	//The client reads nothing while this runs, which must not hold up the writes.
+	//The values are large enough that the events overflow the socket buffers, however the kernel sizes them.
+	value := strings.Repeat("v", 1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 25000; i++ {
+			_ = d.Set("key", value)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("writes were stalled by a client that is not reading")
+	}
+
+	for i := 0; i < 25000; i++ {
+		var msg wsEvent
+		_ = json.Unmarshal([]byte(readMessage(t, conn)), &msg)
+		if msg.Error != "" {
+			if msg.Error != "watcher fell too far behind" {
+				t.Errorf("subscription ended with %q", msg.Error)
+			}
+			return
+		}
+	}
+	t.Error("the subscription was not ended after falling behind")
+}
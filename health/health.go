@@ -0,0 +1,172 @@
+// Package health answers an orchestrator's liveness and readiness probes.
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrShuttingDown fails readiness once shutdown has begun.
+var ErrShuttingDown = errors.New("shutting down")
+
+// Check reports why a component is not ready, or nil if it is. Checks are run on every readiness probe, so must be quick.
+type Check func() error
+
+// Health tracks whether the server is ready for traffic, from named checks that must all pass.
+type Health struct {
+	lock   sync.Mutex
+	names  []string
+	checks map[string]Check
+
+	stopping atomic.Bool
+}
+
+func New() *Health {
+	return &Health{checks: make(map[string]Check)}
+}
+
+// Add makes readiness depend on check. Adding a check with a name already in use replaces it.
+func (h *Health) Add(name string, check Check) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// Shutdown fails readiness from now on, so that traffic is moved elsewhere while open requests finish.
+func (h *Health) Shutdown() {
+	h.stopping.Store(true)
+}
+
+// Report is the result of a readiness probe: "ok" or the reason each check failed.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Ready runs every check, reporting whether they all passed.
+func (h *Health) Ready() (bool, Report) {
+	h.lock.Lock()
+	names := append([]string(nil), h.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.lock.Unlock()
+
+	ready := true
+	report := Report{Status: "ok", Checks: make(map[string]string, len(names)+1)}
+	for i, name := range names {
+		err := checks[i]()
+		if err != nil {
+			ready = false
+			report.Checks[name] = err.Error()
+		} else {
+			report.Checks[name] = "ok"
+		}
+	}
+
+	if h.stopping.Load() {
+		ready = false
+		report.Checks["shutdown"] = ErrShuttingDown.Error()
+	}
+
+	if !ready {
+		report.Status = "unavailable"
+	}
+	return ready, report
+}
+
+// LiveHandler reports that the process is alive on GET and HEAD. It answers 200 for as long as the server can answer at all,
+// including while it starts and shuts down; only a process that has stopped responding should be restarted.
+func (h *Health) LiveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeReport(w, http.StatusOK, Report{Status: "ok"})
+	}
+}
+
+// ReadyHandler reports on GET and HEAD whether the server is ready for traffic, with 200, or 503 and the reason each failing check gave.
+func (h *Health) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ready, report := h.Ready()
+		code := http.StatusOK
+		if !ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeReport(w, code, report)
+	}
+}
+
+// Register serves the liveness probe on mux at /healthz and /_healthz, and the readiness probe at /readyz and /_readyz.
+// The paths starting with an underscore cannot be mistaken for a key by the API; the others are the ones orchestrators expect.
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.LiveHandler())
+	mux.HandleFunc("/_healthz", h.LiveHandler())
+	mux.HandleFunc("/readyz", h.ReadyHandler())
+	mux.HandleFunc("/_readyz", h.ReadyHandler())
+}
+
+func writeReport(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// Pending is a check for a component that is still starting: it fails with the reason given until Set gives it the component's own check.
+type Pending struct {
+	reason string
+	check  atomic.Pointer[Check]
+}
+
+func NewPending(reason string) *Pending {
+	return &Pending{reason: reason}
+}
+
+// Set replaces the pending reason with check, once the component has started.
+func (p *Pending) Set(check Check) {
+	p.check.Store(&check)
+}
+
+func (p *Pending) Check() error {
+	if c := p.check.Load(); c != nil {
+		return (*c)()
+	}
+	return errors.New(p.reason)
+}
+
+// Gate answers 503 to every request until Open gives it the handler to pass them on to,
+// so that a server can listen, and answer probes, while it is still starting.
+type Gate struct {
+	next atomic.Pointer[http.Handler]
+}
+
+// Open passes every request from now on to next.
+func (g *Gate) Open(next http.Handler) {
+	g.next.Store(&next)
+}
+
+func (g *Gate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	next := g.next.Load()
+	if next == nil {
+		http.Error(w, "error - server is starting", http.StatusServiceUnavailable)
+		return
+	}
+	(*next).ServeHTTP(w, r)
+}
@@ -0,0 +1,174 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func probe(t *testing.T, h http.Handler, method, target string) (int, Report) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+
+	var report Report
+	if w.Code != http.StatusMethodNotAllowed {
+		err := json.NewDecoder(w.Body).Decode(&report)
+		if err != nil {
+			t.Fatalf("decoding report: %s", err)
+		}
+	}
+	return w.Code, report
+}
+
+func TestReadyHandler(t *testing.T) {
+	failing := errors.New("no raft leader")
+
+	tt := []struct {
+		name           string
+		checks         map[string]Check
+		shutdown       bool
+		method         string
+		expectedCode   int
+		expectedChecks map[string]string
+	}{
+		{
+			name:           "passing checks should be ready",
+			checks:         map[string]Check{"database": func() error { return nil }},
+			method:         http.MethodGet,
+			expectedCode:   http.StatusOK,
+			expectedChecks: map[string]string{"database": "ok"},
+		},
+		{
+			name:           "failing check should not be ready",
+			checks:         map[string]Check{"database": func() error { return nil }, "raft": func() error { return failing }},
+			method:         http.MethodGet,
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"database": "ok", "raft": "no raft leader"},
+		},
+		{
+			name:           "shutting down should not be ready",
+			checks:         map[string]Check{"database": func() error { return nil }},
+			shutdown:       true,
+			method:         http.MethodGet,
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"database": "ok", "shutdown": "shutting down"},
+		},
+		{
+			name:         "no checks should be ready",
+			method:       http.MethodHead,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "post should not be allowed",
+			method:       http.MethodPost,
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h := New()
+			for name, check := range tc.checks {
+				h.Add(name, check)
+			}
+			if tc.shutdown {
+				h.Shutdown()
+			}
+
+			code, report := probe(t, h.ReadyHandler(), tc.method, "/readyz")
+			if code != tc.expectedCode {
+				t.Errorf("got %d, expected %d", code, tc.expectedCode)
+			}
+			for name, expected := range tc.expectedChecks {
+				if report.Checks[name] != expected {
+					t.Errorf("check %s reported %q, expected %q", name, report.Checks[name], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestLiveHandler(t *testing.T) {
+	h := New()
+	h.Add("raft", func() error { return errors.New("no raft leader") })
+	h.Shutdown()
+
+	code, report := probe(t, h.LiveHandler(), http.MethodGet, "/healthz")
+	if code != http.StatusOK || report.Status != "ok" {
+		t.Errorf("got %d %+v, expected a live process whatever its readiness", code, report)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	h := New()
+	h.Add("database", func() error { return errors.New("replaying") })
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	tt := []struct {
+		path         string
+		expectedCode int
+	}{
+		{path: "/healthz", expectedCode: http.StatusOK},
+		{path: "/_healthz", expectedCode: http.StatusOK},
+		{path: "/readyz", expectedCode: http.StatusServiceUnavailable},
+		{path: "/_readyz", expectedCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.path+" should be served", func(t *testing.T) {
+			code, _ := probe(t, mux, http.MethodGet, tc.path)
+			if code != tc.expectedCode {
+				t.Errorf("got %d, expected %d", code, tc.expectedCode)
+			}
+		})
+	}
+}
+
+func TestAddReplaces(t *testing.T) {
+	h := New()
+	h.Add("database", func() error { return errors.New("replaying") })
+	h.Add("database", func() error { return nil })
+
+	ready, report := h.Ready()
+	if !ready || len(report.Checks) != 1 {
+		t.Errorf("got %v %+v, expected the replacement check alone", ready, report)
+	}
+}
+
+func TestPending(t *testing.T) {
+	p := NewPending("replaying persisted data")
+	if err := p.Check(); err == nil || err.Error() != "replaying persisted data" {
+		t.Errorf("pending check returned %v", err)
+	}
+
+	closed := errors.New("database is closed")
+	p.Set(func() error { return closed })
+	if err := p.Check(); err != closed {
+		t.Errorf("check returned %v after Set, expected the component's own result", err)
+	}
+}
+
+func TestGate(t *testing.T) {
+	var g Gate
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/key", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %d before Open, expected 503", w.Code)
+	}
+
+	g.Open(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/key", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("got %d after Open, expected the handler's response", w.Code)
+	}
+}
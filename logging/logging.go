@@ -0,0 +1,87 @@
+// Package logging builds the server's structured logger and carries a request's ID in its context, so that everything logged while serving the request can be tied together.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Format is how log records are written.
+type Format string
+
+const (
+	//key=value pairs, one record per line.
+	FormatText Format = "text"
+
+	//A JSON object per line.
+	FormatJSON Format = "json"
+)
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatText, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown log format %q", s)
+}
+
+// ParseLevel returns the level with the given name: debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(s))
+	if err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return l, nil
+}
+
+// New returns a logger writing records at or above level to w. Records logged with a context carrying a request ID include it as request_id.
+func New(w io.Writer, format Format, level slog.Leveler) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	if format == FormatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+
+	return slog.New(contextHandler{h})
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request it belongs to.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" if it has none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID from the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	tt := []struct {
+		in       string
+		expected Format
+		err      bool
+	}{
+		{in: "text", expected: FormatText},
+		{in: "JSON", expected: FormatJSON},
+		{in: "logfmt", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			f, err := ParseFormat(tc.in)
+			if (err != nil) != tc.err || f != tc.expected {
+				t.Errorf("ParseFormat returned %q, %v", f, err)
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tt := []struct {
+		in       string
+		expected slog.Level
+		err      bool
+	}{
+		{in: "debug", expected: slog.LevelDebug},
+		{in: "INFO", expected: slog.LevelInfo},
+		{in: "warn", expected: slog.LevelWarn},
+		{in: "error", expected: slog.LevelError},
+		{in: "loud", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			l, err := ParseLevel(tc.in)
+			if (err != nil) != tc.err || l != tc.expected {
+				t.Errorf("ParseLevel returned %s, %v", l, err)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Run("json records should include the request id", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := New(&buf, FormatJSON, slog.LevelInfo).With("component", "test")
+
+		logger.InfoContext(WithRequestID(context.Background(), "abc"), "hello", "key", "k")
+
+		var record map[string]interface{}
+		err := json.Unmarshal(buf.Bytes(), &record)
+		if err != nil {
+			t.Fatalf("record is not JSON: %s", buf.String())
+		}
+		if record["msg"] != "hello" || record["key"] != "k" || record["request_id"] != "abc" || record["component"] != "test" {
+			t.Errorf("got record %v", record)
+		}
+	})
+
+	t.Run("text records without a request id should not have one", func(t *testing.T) {
+		var buf bytes.Buffer
+		New(&buf, FormatText, slog.LevelInfo).Info("hello")
+
+		if !strings.Contains(buf.String(), "msg=hello") || strings.Contains(buf.String(), "request_id") {
+			t.Errorf("got record %q", buf.String())
+		}
+	})
+
+	t.Run("records below the level should be dropped", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := New(&buf, FormatText, slog.LevelWarn)
+		logger.Info("quiet")
+		logger.Warn("loud")
+
+		if strings.Contains(buf.String(), "quiet") || !strings.Contains(buf.String(), "loud") {
+			t.Errorf("got records %q", buf.String())
+		}
+	})
+}
@@ -1,56 +1,454 @@
 package main
 
 import (
+	"KeyValueDB/auth"
+	"KeyValueDB/certs"
+	"KeyValueDB/cluster"
+	"KeyValueDB/config"
 	"KeyValueDB/db"
 	"KeyValueDB/handlers"
+	"KeyValueDB/health"
+	"KeyValueDB/metrics"
+	kvdbv1 "KeyValueDB/proto/kvdb/v1"
+	"KeyValueDB/ratelimit"
+	"KeyValueDB/rbac"
+	"KeyValueDB/replication"
+	"KeyValueDB/resp"
+	"KeyValueDB/rpc"
+	"KeyValueDB/sharding"
 	"context"
+	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
+
+	"google.golang.org/grpc"
 )
 
 var Database db.IDatabase
 
+// store is what the APIs are served from: the database itself, a raft node replicating it, or a read-only replica of a primary.
+type store interface {
+	db.IDatabase
+	db.ITransactor
+	db.IExpirer
+	db.IWatcher
+	db.ISnapshotter
+}
+
 func main() {
 	ctx := context.Background()
 
-	Database = db.NewDatabase()
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %s\n", err)
+		os.Exit(1)
+	}
 
-	exit := make(chan os.Signal, 1)
-	signal.Notify(exit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	logger := cfg.Logger(os.Stdout)
+	slog.SetDefault(logger)
 
-	mux := http.ServeMux{}
-	mux.HandleFunc("/", handlers.IndexHandler(Database))
+	//Already validated by Load.
+	peers, _ := cluster.ParsePeers(cfg.Raft.Peers.String())
+	members, _ := sharding.ParseMembers(cfg.Sharding.Peers.String())
+
+	opts := append(cfg.DBOptions(), db.WithLogger(logger))
+	var m *metrics.Metrics
+	if cfg.Metrics.Addr != "" {
+		m = metrics.New()
+	}
+
+	//Requests to other nodes, such as the primary, the raft leader and other shards, use the default transport unless TLS is configured.
+	var reloader *certs.Reloader
+	var peerTransport http.RoundTripper
+	if cfg.TLSEnabled() {
+		reloader, err = certs.NewReloader(cfg.Certs(), logger)
+		if err != nil {
+			logger.Error("loading TLS configuration", "err", err)
+			os.Exit(1)
+		}
+		peerTransport = reloader.Transport()
+	}
+	if cfg.Auth.PeerKey != "" {
+		peerTransport = auth.Transport(cfg.Auth.PeerKey, peerTransport)
+	}
+
+	var authenticator *auth.Authenticator
+	if cfg.AuthEnabled() {
+		authCfg, err := cfg.Authentication()
+		if err != nil {
+			logger.Error("loading authentication keys", "err", err)
+			os.Exit(1)
+		}
+		authenticator = auth.NewAuthenticator(authCfg)
+	}
+
+	var policy *rbac.Policy
+	if cfg.Auth.Policy != "" {
+		policy, err = rbac.LoadPolicy(cfg.Auth.Policy)
+		if err != nil {
+			logger.Error("loading access control policy", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	//The server listens, and answers probes, while the database is replayed and the node joins its cluster.
+	//Every other request is answered with 503 until the API is ready to serve it.
+	h := health.New()
+	storage := health.NewPending("replaying persisted data")
+	h.Add("database", storage.Check)
+
+	var api health.Gate
+	root := http.NewServeMux()
+	h.Register(root)
+	root.Handle("/", &api)
+
+	//Cancelled when shutdown starts, so that open watch streams and WebSockets end instead of holding up the shutdown.
+	baseCtx, cancelBase := context.WithCancel(ctx)
+	defer cancelBase()
+
+	var handler http.Handler = root
+	if cfg.Log.Access {
+		handler = handlers.AccessLog(logger, handler)
+	}
+	handler = certs.Identify(handler)
+	handler = handlers.RequestID(handler)
 
 	server := http.Server{
-		Addr:    ":8080",
-		Handler: &mux,
+		Addr:              cfg.HTTP.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+	server.RegisterOnShutdown(cancelBase)
+
+	if reloader != nil {
+		server.TLSConfig = reloader.ServerConfig(true)
+		if cfg.TLS.ReloadInterval > 0 {
+			go reloader.Run(baseCtx, cfg.TLS.ReloadInterval)
+		}
 	}
 
 	go func() {
-		fmt.Printf("Server is running on port %s\n", server.Addr)
-		err := server.ListenAndServe()
-		if err != nil {
-			fmt.Printf("Server error: %s\n", err)
+		logger.Info("server is running", "addr", server.Addr, "tls", reloader != nil)
+		err := listenAndServe(&server)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("serving HTTP", "err", err)
 		}
 	}()
 
+	var metricsServer *http.Server
+	if m != nil {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", m.Handler())
+		h.Register(metricsMux)
+		metricsServer = &http.Server{
+			Addr:              cfg.Metrics.Addr,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		}
+		//Scrapers and probes are not asked for a client certificate.
+		if reloader != nil {
+			metricsServer.TLSConfig = reloader.ServerConfig(false)
+		}
+		go func() {
+			logger.Info("metrics server is running", "addr", metricsServer.Addr, "tls", reloader != nil)
+			err := listenAndServe(metricsServer)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("serving metrics", "err", err)
+			}
+		}()
+	}
+
+	//Only the default keyspace is counted in the metrics, which namespaces would otherwise add their keys and operations to.
+	dbOpts := opts
+	if m != nil {
+		dbOpts = append(slices.Clip(opts), db.WithMetrics(m))
+	}
+	database, err := db.NewDatabase(dbOpts...)
+	if err != nil {
+		logger.Error("opening database", "err", err)
+		os.Exit(1)
+	}
+
+	//Namespaces are opened with the same options as the database, metrics aside, so they keep their write-ahead logs alongside its own.
+	var namespaces *db.Namespaces
+	if cfg.Features.Namespaces {
+		namespaces, err = db.OpenNamespaces(opts...)
+		if err != nil {
+			logger.Error("opening namespaces", "err", err)
+			os.Exit(1)
+		}
+	}
+	storage.Set(database.Ready)
+	if m != nil {
+		m.Watch(database)
+	}
+
+	var s store = database
+	var node *cluster.Node
+	if cfg.Clustered() {
+		//Raft traffic is carried over mutual TLS if TLS is configured, so that only other nodes can join in.
+		var raftServerTLS, raftClientTLS *tls.Config
+		if reloader != nil {
+			raftServerTLS, raftClientTLS = reloader.PeerServerConfig(), reloader.ClientConfig()
+		}
+		node, err = cluster.NewNode(database, cluster.Config{
+			ID:           cfg.Raft.ID,
+			RaftAddr:     cfg.Raft.Addr,
+			Dir:          cfg.Raft.Dir,
+			Peers:        peers,
+			ApplyTimeout: cfg.Raft.ApplyTimeout,
+			Redirect:     cfg.Raft.Redirect,
+			Transport:    peerTransport,
+			ServerTLS:    raftServerTLS,
+			ClientTLS:    raftClientTLS,
+		}, logger)
+		if err != nil {
+			logger.Error("joining raft cluster", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("raft node is listening", "id", cfg.Raft.ID, "addr", cfg.Raft.Addr)
+		h.Add("raft", node.Ready)
+		s = node
+	}
+
+	var replica *replication.Replica
+	if cfg.Replica() {
+		var client *http.Client
+		if peerTransport != nil {
+			client = &http.Client{Transport: peerTransport}
+		}
+		replica, err = replication.NewReplica(database, cfg.Replication.ReplicaOf, client, logger)
+		if err != nil {
+			logger.Error("loading configuration", "err", err)
+			os.Exit(1)
+		}
+		h.Add("replication", replica.Ready)
+		s = replica
+	}
+
+	var shard *sharding.Node
+	if cfg.Sharded() {
+		var client *http.Client
+		if peerTransport != nil {
+			client = &http.Client{Timeout: sharding.DefaultTimeout, Transport: peerTransport}
+		}
+		shard, err = sharding.NewNode(database, sharding.Config{
+			ID:           cfg.Sharding.ID,
+			Members:      members,
+			VirtualNodes: cfg.Sharding.VirtualNodes,
+			Client:       client,
+			Dir:          cfg.Storage.Dir,
+		}, logger)
+		if err != nil {
+			logger.Error("loading configuration", "err", err)
+			os.Exit(1)
+		}
+	}
+	Database = s
+
+	exit := make(chan os.Signal, 1)
+	signal.Notify(exit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+
+	//Counts and times requests to the API, if metrics are enabled.
+	instrument := func(name string, h http.Handler) http.Handler {
+		if m == nil {
+			return h
+		}
+		return m.Instrument(name, h)
+	}
+
+	//Keeps each client to its budget of reads and writes of keys, if rate limiting is enabled.
+	//Only requests for keys are limited, so that replication, rebalancing and probes are never turned away.
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimited() {
+		limiter = ratelimit.New(cfg.RateLimiter())
+	}
+	limit := func(h http.Handler) http.Handler {
+		if limiter == nil {
+			return h
+		}
+		return limiter.Handler(h)
+	}
+
+	mux := http.ServeMux{}
+	switch {
+	case node != nil:
+		mux.Handle("/", instrument("index", limit(node.Handler(handlers.IndexHandler(node, logger), handlers.IndexHandler(database, logger)))))
+		mux.Handle("/_txn", instrument("txn", limit(node.Handler(handlers.TxnHandler(node, logger), handlers.TxnHandler(database, logger)))))
+	case replica != nil:
+		mux.Handle("/", instrument("index", limit(replica.Handler(handlers.IndexHandler(replica, logger)))))
+		mux.Handle("/_txn", instrument("txn", limit(replica.Handler(handlers.TxnHandler(replica, logger)))))
+		mux.Handle("/_replication", rbac.RequireAdmin(replica.StatusHandler()))
+	case shard != nil:
+		mux.Handle("/", instrument("index", limit(shard.Handler(handlers.IndexHandler(database, logger)))))
+		mux.Handle("/_txn", instrument("txn", limit(shard.Handler(handlers.TxnHandler(database, logger)))))
+		mux.Handle("/_shards", rbac.RequireAdmin(shard.StatusHandler()))
+		mux.Handle("/_shards/topology", rbac.RequireAdmin(shard.TopologyHandler()))
+		mux.Handle("/_shards/transfer", rbac.RequireAdmin(shard.TransferHandler()))
+		mux.Handle("/_shards/release", rbac.RequireAdmin(shard.ReleaseHandler()))
+	default:
+		mux.Handle("/", instrument("index", limit(handlers.IndexHandler(Database, logger))))
+		mux.Handle("/_txn", instrument("txn", limit(handlers.TxnHandler(database, logger))))
+
+		if cfg.Features.Replication {
+			primary := replication.NewPrimary(database, logger)
+			mux.Handle("/_replication", rbac.RequireAdmin(primary.StatusHandler()))
+			mux.Handle("/_replication/snapshot", rbac.RequireAdmin(primary.SnapshotHandler()))
+			mux.Handle("/_replication/stream", rbac.RequireAdmin(primary.StreamHandler()))
+		}
+
+		if namespaces != nil {
+			mux.Handle(handlers.NamespacePrefix, instrument("namespace", limit(handlers.NamespaceHandler(namespaces, logger))))
+			mux.Handle("/_namespaces", rbac.RequireAdmin(handlers.NamespacesHandler(namespaces, logger)))
+			mux.Handle("/_namespaces/", rbac.RequireAdmin(handlers.NamespacesHandler(namespaces, logger)))
+		}
+	}
+	if cfg.Features.Snapshot {
+		mux.Handle("/_snapshot", rbac.RequireAdmin(handlers.SnapshotHandler(s, logger)))
+	}
+	mux.Handle("/_stats", rbac.RequireAdmin(handlers.StatsHandler(database, logger)))
+	if cfg.Features.Watch {
+		mux.Handle("/_watch", rbac.RequireAdmin(handlers.WatchHandler(database, logger)))
+	}
+	//Commands on a WebSocket are not routed to the node owning their key.
+	if cfg.Features.WebSocket && shard == nil {
+		mux.Handle("/_ws", rbac.RequireAdmin(handlers.WebSocketHandler(s, logger)))
+	}
+
+	//Every endpoint of the API requires authentication if it is enabled, the probes excepted.
+	//With a policy, the endpoints that are not about particular keys also need an admin role.
+	var apiHandler http.Handler = &mux
+	if policy != nil {
+		apiHandler = policy.Handler(apiHandler)
+	}
+	if authenticator != nil {
+		apiHandler = authenticator.Handler(apiHandler, logger)
+	}
+	api.Open(apiHandler)
+
+	if replica != nil {
+		logger.Info("replicating", "primary", cfg.Replication.ReplicaOf)
+		go replica.Run(baseCtx)
+	}
+
+	var respServer *resp.Server
+	if cfg.RESP.Addr != "" {
+		respServer = resp.NewServer(s, logger)
+		go func() {
+			logger.Info("RESP server is running", "addr", cfg.RESP.Addr)
+			err := respServer.ListenAndServe(cfg.RESP.Addr)
+			if err != nil && !errors.Is(err, resp.ErrServerClosed) {
+				logger.Error("serving RESP", "err", err)
+			}
+		}()
+	}
+
+	var grpcServer *grpc.Server
+	if cfg.GRPC.Addr != "" {
+		grpcServer = grpc.NewServer()
+		kvdbv1.RegisterKeyValueServer(grpcServer, rpc.NewService(s, logger))
+		go func() {
+			logger.Info("gRPC server is running", "addr", cfg.GRPC.Addr)
+			l, err := net.Listen("tcp", cfg.GRPC.Addr)
+			if err != nil {
+				logger.Error("serving gRPC", "err", err)
+				return
+			}
+			err = grpcServer.Serve(l)
+			if err != nil {
+				logger.Error("serving gRPC", "err", err)
+			}
+		}()
+	}
+
 	<-exit
 
-	fmt.Println("Shutting down server...")
-	cancelCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	//Fail readiness first, so that traffic is moved elsewhere while the server keeps serving for the drain delay.
+	h.Shutdown()
+	logger.Info("shutting down server", "drainDelay", cfg.HTTP.DrainDelay)
+	time.Sleep(cfg.HTTP.DrainDelay)
+
+	cancelCtx, cancel := context.WithTimeout(ctx, cfg.HTTP.ShutdownTimeout)
 	defer cancel()
 
-	err := server.Shutdown(cancelCtx)
+	err = server.Shutdown(cancelCtx)
 	if err != nil {
 		if !errors.Is(err, http.ErrServerClosed) {
-			fmt.Printf("Server error whilst shutting down: %s\n", err)
+			logger.Error("shutting down HTTP server", "err", err)
+		}
+	}
+
+	if metricsServer != nil {
+		err = metricsServer.Shutdown(cancelCtx)
+		if err != nil {
+			logger.Error("shutting down metrics server", "err", err)
 		}
 	}
 
-	fmt.Println("Server is shut down.")
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-cancelCtx.Done():
+			grpcServer.Stop()
+		}
+	}
+
+	if respServer != nil {
+		err = respServer.Close()
+		if err != nil {
+			logger.Error("shutting down RESP server", "err", err)
+		}
+	}
+
+	if shard != nil {
+		shard.Close()
+	}
+
+	if node != nil {
+		err = node.Close()
+		if err != nil {
+			logger.Error("leaving raft cluster", "err", err)
+		}
+	}
+
+	if namespaces != nil {
+		err = namespaces.Close()
+		if err != nil {
+			logger.Error("closing namespaces", "err", err)
+		}
+	}
+
+	err = database.Close()
+	if err != nil {
+		logger.Error("closing database", "err", err)
+	}
+
+	logger.Info("server is shut down")
+}
+
+// listenAndServe serves HTTPS if the server has a TLS configuration, and plain HTTP otherwise.
+func listenAndServe(server *http.Server) error {
+	if server.TLSConfig != nil {
+		//The certificate comes from the TLS configuration.
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
 }
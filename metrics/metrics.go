@@ -0,0 +1,146 @@
+// Package metrics exposes the server's request, database and runtime metrics in the Prometheus text format.
+package metrics
+
+import (
+	"KeyValueDB/db"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes the name of every metric specific to the database.
+const Namespace = "kvdb"
+
+// Metrics holds every metric the server exposes. It implements db.Metrics, so it can be given to db.WithMetrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+
+	operations *prometheus.CounterVec
+	lockWait   *prometheus.HistogramVec
+}
+
+// New returns metrics that also include the Go runtime's and the process'.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by handler, method and status code.",
+		}, []string{"handler", "method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by handler, method and status code.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 9),
+		}, []string{"handler", "method", "code"}),
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "db_operations_total",
+			Help:      "Database operations, by operation and whether they succeeded.",
+		}, []string{"op", "result"}),
+		lockWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "db_lock_wait_seconds",
+			Help:      "Time database operations waited for a shard lock, by operation.",
+			Buckets:   prometheus.ExponentialBuckets(0.000001, 4, 10),
+		}, []string{"op"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.latency,
+		m.operations,
+		m.lockWait,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler serves every metric in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Instrument counts and times the requests next serves, labelled with the handler's name.
+func (m *Metrics) Instrument(handler string, next http.Handler) http.Handler {
+	labels := prometheus.Labels{"handler": handler}
+	return promhttp.InstrumentHandlerDuration(m.latency.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(m.requests.MustCurryWith(labels), next))
+}
+
+// Operation counts a database operation, as "ok", "conflict" for a failed precondition, "full" for a write refused by the database's limits, or "error".
+func (m *Metrics) Operation(op db.Op, err error) {
+	m.operations.WithLabelValues(string(op), result(err)).Inc()
+}
+
+// LockWait records how long a database operation waited for a shard lock.
+func (m *Metrics) LockWait(op db.Op, wait time.Duration) {
+	m.lockWait.WithLabelValues(string(op)).Observe(wait.Seconds())
+}
+
+func result(err error) string {
+	var conflict *db.TxnConflictError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, db.ErrVersionMismatch), errors.As(err, &conflict):
+		return "conflict"
+	case errors.Is(err, db.ErrOutOfMemory):
+		return "full"
+	}
+	return "error"
+}
+
+// Watch reports the size of the database, read from s whenever the metrics are collected.
+// Eviction is only reported if s has an eviction policy.
+func (m *Metrics) Watch(s db.IStats) {
+	m.registry.MustRegister(&statsCollector{s: s, evicts: s.Stats().Policy != db.EvictNone})
+}
+
+var (
+	keysDesc      = prometheus.NewDesc(Namespace+"_keys", "Keys stored, including expired keys not yet removed.", nil, nil)
+	bytesDesc     = prometheus.NewDesc(Namespace+"_memory_bytes", "Approximate memory used by keys and values.", nil, nil)
+	maxKeysDesc   = prometheus.NewDesc(Namespace+"_max_keys", "Most keys that may be stored, or 0 for no limit.", nil, nil)
+	maxBytesDesc  = prometheus.NewDesc(Namespace+"_max_memory_bytes", "Most memory keys and values may use, or 0 for no limit.", nil, nil)
+	expiredDesc   = prometheus.NewDesc(Namespace+"_expired_keys_total", "Keys removed once their TTL had passed.", nil, nil)
+	evictionsDesc = prometheus.NewDesc(Namespace+"_evicted_keys_total", "Keys evicted to make room for writes.", nil, nil)
+)
+
+// statsCollector reads the database's size when metrics are collected, rather than tracking it on every write.
+type statsCollector struct {
+	s      db.IStats
+	evicts bool
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- keysDesc
+	ch <- bytesDesc
+	ch <- maxKeysDesc
+	ch <- maxBytesDesc
+	ch <- expiredDesc
+	if c.evicts {
+		ch <- evictionsDesc
+	}
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	st := c.s.Stats()
+	ch <- prometheus.MustNewConstMetric(keysDesc, prometheus.GaugeValue, float64(st.Keys))
+	ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.GaugeValue, float64(st.Bytes))
+	ch <- prometheus.MustNewConstMetric(maxKeysDesc, prometheus.GaugeValue, float64(st.MaxKeys))
+	ch <- prometheus.MustNewConstMetric(maxBytesDesc, prometheus.GaugeValue, float64(st.MaxBytes))
+	ch <- prometheus.MustNewConstMetric(expiredDesc, prometheus.CounterValue, float64(st.Expired))
+	if c.evicts {
+		ch <- prometheus.MustNewConstMetric(evictionsDesc, prometheus.CounterValue, float64(st.Evictions))
+	}
+}
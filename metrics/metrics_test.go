@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"KeyValueDB/db"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("scrape returned %d", w.Code)
+	}
+	b, _ := io.ReadAll(w.Body)
+	return string(b)
+}
+
+func TestInstrument(t *testing.T) {
+	m := New()
+	h := m.Instrument("index", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusInsufficientStorage)
+		}
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/b", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/a", nil))
+
+	out := scrape(t, m)
+	for _, s := range []string{
+		`kvdb_http_requests_total{code="200",handler="index",method="get"} 2`,
+		`kvdb_http_requests_total{code="507",handler="index",method="put"} 1`,
+		`kvdb_http_request_duration_seconds_count{code="200",handler="index",method="get"} 2`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("metrics do not contain %s", s)
+		}
+	}
+}
+
+func TestOperation(t *testing.T) {
+	tt := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "success should be ok", expected: `kvdb_db_operations_total{op="set",result="ok"} 1`},
+		{name: "version mismatch should be a conflict", err: db.ErrVersionMismatch, expected: `kvdb_db_operations_total{op="set",result="conflict"} 1`},
+		{name: "transaction conflict should be a conflict", err: &db.TxnConflictError{Key: "a"}, expected: `kvdb_db_operations_total{op="set",result="conflict"} 1`},
+		{name: "full database should be full", err: db.ErrOutOfMemory, expected: `kvdb_db_operations_total{op="set",result="full"} 1`},
+		{name: "anything else should be an error", err: errors.New("disk on fire"), expected: `kvdb_db_operations_total{op="set",result="error"} 1`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New()
+			m.Operation(db.OpSet, tc.err)
+
+			if out := scrape(t, m); !strings.Contains(out, tc.expected) {
+				t.Errorf("metrics do not contain %s", tc.expected)
+			}
+		})
+	}
+}
+
+func TestDatabaseMetrics(t *testing.T) {
+	tt := []struct {
+		name       string
+		opts       []db.Option
+		expected   []string
+		unexpected []string
+	}{
+		{
+			name: "size and expiry should be reported",
+			expected: []string{
+				"kvdb_keys 2",
+				"kvdb_memory_bytes ",
+				"kvdb_expired_keys_total 0",
+				`kvdb_db_operations_total{op="set",result="ok"} 2`,
+				`kvdb_db_lock_wait_seconds_count{op="set"} 2`,
+				"go_goroutines ",
+			},
+			unexpected: []string{"kvdb_evicted_keys_total"},
+		},
+		{
+			name:     "eviction should be reported with an eviction policy",
+			opts:     []db.Option{db.WithMaxKeys(10), db.WithEvictionPolicy(db.EvictLRU)},
+			expected: []string{"kvdb_max_keys 10", "kvdb_evicted_keys_total 0"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New()
+			d, err := db.NewDatabase(append(tc.opts, db.WithMetrics(m), db.WithExpiryInterval(time.Hour))...)
+			if err != nil {
+				t.Fatalf("NewDatabase returned an error: %s", err)
+			}
+			defer d.Close()
+			m.Watch(d)
+
+			_ = d.Set("a", "1")
+			_ = d.Set("b", "2")
+
+			out := scrape(t, m)
+			for _, s := range tc.expected {
+				if !strings.Contains(out, s) {
+					t.Errorf("metrics do not contain %s", s)
+				}
+			}
+			for _, s := range tc.unexpected {
+				if strings.Contains(out, s) {
+					t.Errorf("metrics contain %s", s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: kvdb/v1/kvdb.proto
+
+package kvdbv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	KeyValue_Get_FullMethodName         = "/kvdb.v1.KeyValue/Get"
+	KeyValue_Set_FullMethodName         = "/kvdb.v1.KeyValue/Set"
+	KeyValue_Delete_FullMethodName      = "/kvdb.v1.KeyValue/Delete"
+	KeyValue_ListKeys_FullMethodName    = "/kvdb.v1.KeyValue/ListKeys"
+	KeyValue_BatchGet_FullMethodName    = "/kvdb.v1.KeyValue/BatchGet"
+	KeyValue_BatchSet_FullMethodName    = "/kvdb.v1.KeyValue/BatchSet"
+	KeyValue_BatchDelete_FullMethodName = "/kvdb.v1.KeyValue/BatchDelete"
+)
+
+// KeyValueClient is the client API for KeyValue service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// KeyValue mirrors the HTTP API: the same keys, values and versions are visible through both.
+type KeyValueClient interface {
+	// Get returns the value and version of a key.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// Set stores a value, optionally expiring it after a TTL.
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	// Delete removes a key. Deleting a key that does not exist is not an error.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// ListKeys streams keys in lexicographic order, one page per message.
+	ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListKeysResponse], error)
+	// BatchGet returns several keys in one call. Keys are read independently, not as a snapshot.
+	BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*BatchGetResponse, error)
+	// BatchSet stores several values atomically.
+	BatchSet(ctx context.Context, in *BatchSetRequest, opts ...grpc.CallOption) (*BatchSetResponse, error)
+	// BatchDelete removes several keys atomically.
+	BatchDelete(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchDeleteResponse, error)
+}
+
+type keyValueClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKeyValueClient(cc grpc.ClientConnInterface) KeyValueClient {
+	return &keyValueClient{cc}
+}
+
+func (c *keyValueClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, KeyValue_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyValueClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, KeyValue_Set_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyValueClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, KeyValue_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyValueClient) ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListKeysResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &KeyValue_ServiceDesc.Streams[0], KeyValue_ListKeys_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListKeysRequest, ListKeysResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type KeyValue_ListKeysClient = grpc.ServerStreamingClient[ListKeysResponse]
+
+func (c *keyValueClient) BatchGet(ctx context.Context, in *BatchGetRequest, opts ...grpc.CallOption) (*BatchGetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchGetResponse)
+	err := c.cc.Invoke(ctx, KeyValue_BatchGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyValueClient) BatchSet(ctx context.Context, in *BatchSetRequest, opts ...grpc.CallOption) (*BatchSetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchSetResponse)
+	err := c.cc.Invoke(ctx, KeyValue_BatchSet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyValueClient) BatchDelete(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchDeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchDeleteResponse)
+	err := c.cc.Invoke(ctx, KeyValue_BatchDelete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// KeyValueServer is the server API for KeyValue service.
+// All implementations must embed UnimplementedKeyValueServer
+// for forward compatibility.
+//
+// KeyValue mirrors the HTTP API: the same keys, values and versions are visible through both.
+type KeyValueServer interface {
+	// Get returns the value and version of a key.
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// Set stores a value, optionally expiring it after a TTL.
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	// Delete removes a key. Deleting a key that does not exist is not an error.
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// ListKeys streams keys in lexicographic order, one page per message.
+	ListKeys(*ListKeysRequest, grpc.ServerStreamingServer[ListKeysResponse]) error
+	// BatchGet returns several keys in one call. Keys are read independently, not as a snapshot.
+	BatchGet(context.Context, *BatchGetRequest) (*BatchGetResponse, error)
+	// BatchSet stores several values atomically.
+	BatchSet(context.Context, *BatchSetRequest) (*BatchSetResponse, error)
+	// BatchDelete removes several keys atomically.
+	BatchDelete(context.Context, *BatchDeleteRequest) (*BatchDeleteResponse, error)
+	mustEmbedUnimplementedKeyValueServer()
+}
+
+// UnimplementedKeyValueServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedKeyValueServer struct{}
+
+func (UnimplementedKeyValueServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedKeyValueServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedKeyValueServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedKeyValueServer) ListKeys(*ListKeysRequest, grpc.ServerStreamingServer[ListKeysResponse]) error {
+	return status.Error(codes.Unimplemented, "method ListKeys not implemented")
+}
+func (UnimplementedKeyValueServer) BatchGet(context.Context, *BatchGetRequest) (*BatchGetResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method BatchGet not implemented")
+}
+func (UnimplementedKeyValueServer) BatchSet(context.Context, *BatchSetRequest) (*BatchSetResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method BatchSet not implemented")
+}
+func (UnimplementedKeyValueServer) BatchDelete(context.Context, *BatchDeleteRequest) (*BatchDeleteResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method BatchDelete not implemented")
+}
+func (UnimplementedKeyValueServer) mustEmbedUnimplementedKeyValueServer() {}
+func (UnimplementedKeyValueServer) testEmbeddedByValue()                  {}
+
+// UnsafeKeyValueServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KeyValueServer will
+// result in compilation errors.
+type UnsafeKeyValueServer interface {
+	mustEmbedUnimplementedKeyValueServer()
+}
+
+func RegisterKeyValueServer(s grpc.ServiceRegistrar, srv KeyValueServer) {
+	// If the following call panics, it indicates UnimplementedKeyValueServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&KeyValue_ServiceDesc, srv)
+}
+
+func _KeyValue_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyValueServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KeyValue_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyValueServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyValue_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyValueServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KeyValue_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyValueServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyValue_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyValueServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KeyValue_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyValueServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyValue_ListKeys_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListKeysRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KeyValueServer).ListKeys(m, &grpc.GenericServerStream[ListKeysRequest, ListKeysResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type KeyValue_ListKeysServer = grpc.ServerStreamingServer[ListKeysResponse]
+
+func _KeyValue_BatchGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyValueServer).BatchGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KeyValue_BatchGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyValueServer).BatchGet(ctx, req.(*BatchGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyValue_BatchSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyValueServer).BatchSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KeyValue_BatchSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyValueServer).BatchSet(ctx, req.(*BatchSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyValue_BatchDelete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchDeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyValueServer).BatchDelete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KeyValue_BatchDelete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyValueServer).BatchDelete(ctx, req.(*BatchDeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// KeyValue_ServiceDesc is the grpc.ServiceDesc for KeyValue service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var KeyValue_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kvdb.v1.KeyValue",
+	HandlerType: (*KeyValueServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _KeyValue_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _KeyValue_Set_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _KeyValue_Delete_Handler,
+		},
+		{
+			MethodName: "BatchGet",
+			Handler:    _KeyValue_BatchGet_Handler,
+		},
+		{
+			MethodName: "BatchSet",
+			Handler:    _KeyValue_BatchSet_Handler,
+		},
+		{
+			MethodName: "BatchDelete",
+			Handler:    _KeyValue_BatchDelete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListKeys",
+			Handler:       _KeyValue_ListKeys_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "kvdb/v1/kvdb.proto",
+}
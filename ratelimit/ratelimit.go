@@ -0,0 +1,220 @@
+// Package ratelimit keeps each client of the HTTP API to a budget of requests, with token buckets.
+package ratelimit
+
+import (
+	"KeyValueDB/auth"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryAfterHeader tells a client that has run out of budget how many seconds to wait before its next request will be served.
+const RetryAfterHeader = "Retry-After"
+
+// How often buckets that have filled up again are forgotten, so that clients that have gone away do not hold memory.
+const sweepInterval = time.Minute
+
+// Config is the budget of every client. Reads and writes are budgeted separately, so that a client writing heavily can still read.
+type Config struct {
+	//Requests per second a client may make on average. 0 leaves them unlimited.
+	ReadRate  int
+	WriteRate int
+
+	//Requests a client may make at once after being idle. Defaults to the rate.
+	ReadBurst  int
+	WriteBurst int
+
+	//Proxies, such as load balancers and other nodes, trusted to name the client in X-Forwarded-For when they forward its request.
+	TrustedProxies []*net.IPNet
+}
+
+// Limiter tracks the budget left to each client.
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	lock    sync.Mutex
+	buckets map[bucketKey]*bucket
+	swept   time.Time
+}
+
+type bucketKey struct {
+	client string
+	write  bool
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New returns a limiter giving every client the budget in cfg.
+func New(cfg Config) *Limiter {
+	if cfg.ReadBurst <= 0 {
+		cfg.ReadBurst = cfg.ReadRate
+	}
+	if cfg.WriteBurst <= 0 {
+		cfg.WriteBurst = cfg.WriteRate
+	}
+
+	return &Limiter{
+		cfg:     cfg,
+		now:     time.Now,
+		buckets: make(map[bucketKey]*bucket),
+	}
+}
+
+// Allow spends one of client's reads or writes, reporting whether it had one left, and if not, how long until it will.
+func (l *Limiter) Allow(client string, write bool) (bool, time.Duration) {
+	rate, burst := l.budget(write)
+	if rate <= 0 {
+		return true, 0
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	k := bucketKey{client: client, write: write}
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		l.buckets[k] = b
+	}
+	b.refill(now, rate, burst)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / float64(rate) * float64(time.Second))
+}
+
+// Handler serves requests with next while their client has budget left, and answers 429 with a Retry-After header otherwise.
+// GET, HEAD and OPTIONS requests are reads, and every other request a write.
+// It must be wrapped by auth's handler, if authentication is enabled, for clients to be told apart by their principal rather than their address.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.Allow(l.Client(r), isWrite(r))
+		if !ok {
+			//Rounded up, so that a client waiting as long as it is told is served.
+			secs := int((wait + time.Second - 1) / time.Second)
+			w.Header().Set(RetryAfterHeader, strconv.Itoa(max(secs, 1)))
+			http.Error(w, "error - too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Client names who a request is from: its authenticated principal, such as the name of its API key, or else its IP address.
+func (l *Limiter) Client(r *http.Request) string {
+	if p, ok := auth.PrincipalFrom(r.Context()); ok {
+		return "principal:" + p.Name
+	}
+	return "ip:" + l.clientIP(r)
+}
+
+// clientIP returns the address a request came from, or if that is a trusted proxy, the address the proxies name in X-Forwarded-For:
+// the last one that is not itself a trusted proxy, since a client can put anything at the start of the header.
+func (l *Limiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !l.trusted(ip) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !l.trusted(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+func (l *Limiter) trusted(ip net.IP) bool {
+	for _, n := range l.cfg.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Limiter) budget(write bool) (int, int) {
+	if write {
+		return l.cfg.WriteRate, l.cfg.WriteBurst
+	}
+	return l.cfg.ReadRate, l.cfg.ReadBurst
+}
+
+// sweep forgets the buckets that have filled up again, at most once per sweepInterval. Must be called with the lock held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+
+	for k, b := range l.buckets {
+		rate, burst := l.budget(k.write)
+		b.refill(now, rate, burst)
+		if b.tokens >= float64(burst) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+func (b *bucket) refill(now time.Time, rate int, burst int) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(float64(burst), b.tokens+elapsed.Seconds()*float64(rate))
+	}
+	b.updated = now
+}
+
+func isWrite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// ParseCIDRs parses a list of trusted proxies, each a CIDR such as 10.0.0.0/8 or a single address.
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	out := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: s}
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			s += "/" + strconv.Itoa(bits)
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
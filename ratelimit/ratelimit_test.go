@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"KeyValueDB/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func testLimiter(t *testing.T, cfg Config) (*Limiter, *fakeClock) {
+	t.Helper()
+
+	l := New(cfg)
+	c := &fakeClock{now: time.Unix(1000, 0)}
+	l.now = c.Now
+	return l, c
+}
+
+func TestAllow(t *testing.T) {
+	t.Run("burst should be allowed, then refilled at the rate", func(t *testing.T) {
+		l, c := testLimiter(t, Config{WriteRate: 2, WriteBurst: 3})
+
+		for i := 0; i < 3; i++ {
+			if ok, _ := l.Allow("a", true); !ok {
+				t.Fatalf("write %d of the burst was not allowed", i)
+			}
+		}
+
+		ok, wait := l.Allow("a", true)
+		if ok || wait != 500*time.Millisecond {
+			t.Errorf("Allow over the burst returned %t, %s, expected false, 500ms", ok, wait)
+		}
+
+		c.now = c.now.Add(500 * time.Millisecond)
+		if ok, _ := l.Allow("a", true); !ok {
+			t.Error("write was not allowed once refilled")
+		}
+	})
+
+	t.Run("clients should have budgets of their own", func(t *testing.T) {
+		l, _ := testLimiter(t, Config{WriteRate: 1})
+
+		_, _ = l.Allow("a", true)
+		if ok, _ := l.Allow("b", true); !ok {
+			t.Error("another client's write was not allowed")
+		}
+	})
+
+	t.Run("reads and writes should have budgets of their own", func(t *testing.T) {
+		l, _ := testLimiter(t, Config{ReadRate: 1, WriteRate: 1})
+
+		_, _ = l.Allow("a", true)
+		if ok, _ := l.Allow("a", false); !ok {
+			t.Error("read was not allowed after a write")
+		}
+		if ok, _ := l.Allow("a", false); ok {
+			t.Error("second read was allowed")
+		}
+	})
+
+	t.Run("rate of 0 should be unlimited", func(t *testing.T) {
+		l, _ := testLimiter(t, Config{WriteRate: 1})
+
+		for i := 0; i < 100; i++ {
+			if ok, _ := l.Allow("a", false); !ok {
+				t.Fatal("read was not allowed")
+			}
+		}
+	})
+
+	t.Run("full buckets should be forgotten", func(t *testing.T) {
+		l, c := testLimiter(t, Config{ReadRate: 10})
+
+		_, _ = l.Allow("a", false)
+		c.now = c.now.Add(sweepInterval)
+		_, _ = l.Allow("b", false)
+
+		if len(l.buckets) != 1 {
+			t.Errorf("%d buckets are kept, expected only b's", len(l.buckets))
+		}
+	})
+}
+
+func TestHandler(t *testing.T) {
+	proxies, err := ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name       string
+		method     string
+		remoteAddr string
+		forwarded  string
+		principal  string
+		expected   string
+	}{
+		{name: "client should be its address", method: http.MethodGet, remoteAddr: "203.0.113.7:5000", expected: "ip:203.0.113.7"},
+		{name: "client should be its principal if authenticated", method: http.MethodGet, remoteAddr: "203.0.113.7:5000", principal: "deploy-bot", expected: "principal:deploy-bot"},
+		{name: "untrusted address should not be replaced", method: http.MethodGet, remoteAddr: "203.0.113.7:5000", forwarded: "198.51.100.1", expected: "ip:203.0.113.7"},
+		{name: "trusted proxy should name the client", method: http.MethodGet, remoteAddr: "10.1.2.3:5000", forwarded: "198.51.100.1", expected: "ip:198.51.100.1"},
+		{
+			name:       "client should be the last address not of a trusted proxy",
+			method:     http.MethodPut,
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  "1.1.1.1, 198.51.100.1, 192.168.1.1",
+			expected:   "ip:198.51.100.1",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			l, _ := testLimiter(t, Config{ReadRate: 1, WriteRate: 1, TrustedProxies: proxies})
+			h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			request := func() *httptest.ResponseRecorder {
+				r := httptest.NewRequest(tc.method, "/key", nil)
+				r.RemoteAddr = tc.remoteAddr
+				if tc.forwarded != "" {
+					r.Header.Set("X-Forwarded-For", tc.forwarded)
+				}
+				if tc.principal != "" {
+					r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Name: tc.principal}))
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				return w
+			}
+
+			if w := request(); w.Code != http.StatusOK {
+				t.Fatalf("Response code: got %d, want %d", w.Code, http.StatusOK)
+			}
+
+			w := request()
+			if w.Code != http.StatusTooManyRequests {
+				t.Errorf("Response code: got %d, want %d", w.Code, http.StatusTooManyRequests)
+			}
+			if w.Header().Get(RetryAfterHeader) != "1" {
+				t.Errorf("Retry-After: got %q, want 1", w.Header().Get(RetryAfterHeader))
+			}
+			if w.Body.String() != "error - too many requests\n" {
+				t.Errorf("Response body: got %q", w.Body.String())
+			}
+
+			if _, ok := l.buckets[bucketKey{client: tc.expected, write: tc.method != http.MethodGet}]; !ok {
+				t.Errorf("no bucket for %s in %v", tc.expected, l.buckets)
+			}
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	tt := []struct {
+		name  string
+		in    []string
+		count int
+		err   bool
+	}{
+		{name: "CIDRs and addresses should parse", in: []string{"10.0.0.0/8", "192.168.1.1", "::1"}, count: 3},
+		{name: "malformed address should be an error", in: []string{"10.0.0"}, err: true},
+		{name: "malformed CIDR should be an error", in: []string{"10.0.0.0/40"}, err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseCIDRs(tc.in)
+			if (err != nil) != tc.err {
+				t.Fatalf("ParseCIDRs returned %v", err)
+			}
+			if len(got) != tc.count {
+				t.Errorf("got %d networks, expected %d", len(got), tc.count)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package rbac
+
+import (
+	"KeyValueDB/auth"
+	"context"
+	"net/http"
+)
+
+type accessKey struct{}
+
+// WithAccess returns a copy of ctx carrying what the caller may do.
+func WithAccess(ctx context.Context, a *Access) context.Context {
+	return context.WithValue(ctx, accessKey{}, a)
+}
+
+// AccessFrom returns what the caller of a request may do. It is not found if access control is not enabled.
+func AccessFrom(ctx context.Context) (*Access, bool) {
+	a, ok := ctx.Value(accessKey{}).(*Access)
+	return a, ok
+}
+
+// Allowed reports whether the caller of a request may do perm on key. Everything is allowed if access control is not enabled.
+func Allowed(r *http.Request, perm Permission, key string) bool {
+	a, ok := AccessFrom(r.Context())
+	return !ok || a.Allows(perm, key)
+}
+
+// Handler puts what the caller may do in the request context, where the handlers check it, and serves the request with next.
+// It must be wrapped by auth's handler, which authenticates the caller; a request without a principal is allowed nothing.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := &Access{}
+		if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+			a = p.Access(principal)
+		}
+		next.ServeHTTP(w, r.WithContext(WithAccess(r.Context(), a)))
+	})
+}
+
+// RequireAdmin serves requests with next only for callers holding an admin role, and answers 403 otherwise.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a, ok := AccessFrom(r.Context()); ok && !a.Admin() {
+			http.Error(w, "error - forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,86 @@
+package rbac
+
+import (
+	"KeyValueDB/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	p := testPolicyFile(t)
+
+	tt := []struct {
+		name      string
+		principal *auth.Principal
+		expected  bool
+	}{
+		{name: "caller's grants should be in the context", principal: &auth.Principal{Name: "alice", Method: auth.MethodAPIKey}, expected: true},
+		{name: "unbound caller should be allowed nothing", principal: &auth.Principal{Name: "mallory", Method: auth.MethodAPIKey}},
+		{name: "request without a principal should be allowed nothing"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var allowed, found bool
+			h := p.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, found = AccessFrom(r.Context())
+				allowed = Allowed(r, Read, "team-a/config")
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/team-a/config", nil)
+			if tc.principal != nil {
+				r = r.WithContext(auth.WithPrincipal(r.Context(), *tc.principal))
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if !found {
+				t.Fatal("no access in the request context")
+			}
+			if allowed != tc.expected {
+				t.Errorf("allowed is %v, expected %v", allowed, tc.expected)
+			}
+		})
+	}
+
+	t.Run("everything should be allowed without access control", func(t *testing.T) {
+		if !Allowed(httptest.NewRequest(http.MethodGet, "/key", nil), Delete, "key") {
+			t.Error("not allowed")
+		}
+	})
+}
+
+func TestRequireAdmin(t *testing.T) {
+	p := testPolicyFile(t)
+	h := p.Handler(RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tt := []struct {
+		name         string
+		principal    auth.Principal
+		expectedCode int
+	}{
+		{name: "admin should be served", principal: auth.Principal{Name: "n2", Method: auth.MethodCertificate}, expectedCode: http.StatusOK},
+		{name: "caller without an admin role should be forbidden", principal: auth.Principal{Name: "alice", Method: auth.MethodAPIKey}, expectedCode: http.StatusForbidden},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/_snapshot", nil)
+			r = r.WithContext(auth.WithPrincipal(r.Context(), tc.principal))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.expectedCode {
+				t.Errorf("Response code: got %d, want %d", w.Code, tc.expectedCode)
+			}
+		})
+	}
+
+	t.Run("everything should be allowed without access control", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_snapshot", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Response code: got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,241 @@
+package rbac
+
+import (
+	"KeyValueDB/auth"
+	"KeyValueDB/util"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RolesClaim is the JWT claim listing roles held by the token's subject, in addition to those it is bound to by the policy.
+const RolesClaim = "roles"
+
+// Permission is something a role may do to the keys a grant covers.
+type Permission string
+
+const (
+	// Read allows getting a key's value.
+	Read Permission = "read"
+	// Write allows setting a key.
+	Write Permission = "write"
+	// Delete allows deleting a key.
+	Delete Permission = "delete"
+	// List allows seeing a key's name in listings and scans.
+	List Permission = "list"
+)
+
+var permissions = []Permission{Read, Write, Delete, List}
+
+var methods = []auth.Method{auth.MethodAPIKey, auth.MethodJWT, auth.MethodCertificate}
+
+// Grant gives permissions on the keys starting with Prefix, or matching the glob Pattern. Exactly one of them is set.
+type Grant struct {
+	Prefix      string       `yaml:"prefix"`
+	Pattern     string       `yaml:"pattern"`
+	Permissions []Permission `yaml:"permissions"`
+}
+
+// Role is a set of grants.
+type Role struct {
+	//Allows the endpoints that are not about particular keys, and so could reveal or change any key:
+	//snapshots, watching, WebSockets, replication and moving keys between shards.
+	Admin  bool    `yaml:"admin"`
+	Grants []Grant `yaml:"grants"`
+}
+
+// Policy assigns roles to principals.
+type Policy struct {
+	Roles map[string]Role `yaml:"roles"`
+
+	//Roles held by each principal, by how it authenticated and its name, such as "api-key:alice", "jwt:alice" or "certificate:n2",
+	//so that a caller cannot take the roles of a namesake that authenticates another way.
+	Bindings map[string][]string `yaml:"bindings"`
+}
+
+// LoadPolicy reads a policy from a YAML file, such as
+//
+//	roles:
+//	  team-a:
+//	    grants:
+//	      - prefix: "team-a/"
+//	        permissions: [read, write, delete, list]
+//	      - pattern: "shared:*"
+//	        permissions: [read, list]
+//	bindings:
+//	  api-key:alice: [team-a]
+//
+// Unknown fields, permissions and roles are an error.
+func LoadPolicy(file string) (*Policy, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("loading policy: %w", err)
+	}
+
+	var p Policy
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	err = d.Decode(&p)
+	if err != nil {
+		return nil, fmt.Errorf("loading policy: %w", err)
+	}
+
+	err = p.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("loading policy: %w", err)
+	}
+	return &p, nil
+}
+
+// Validate checks every role and binding, returning all of the problems found.
+func (p *Policy) Validate() error {
+	errs := make([]error, 0)
+
+	for _, name := range sortedKeys(p.Roles) {
+		for i, g := range p.Roles[name].Grants {
+			if (g.Prefix == "") == (g.Pattern == "") {
+				errs = append(errs, fmt.Errorf("role %s, grant %d: exactly one of prefix and pattern must be given", name, i))
+			}
+			if len(g.Permissions) == 0 {
+				errs = append(errs, fmt.Errorf("role %s, grant %d: no permissions given", name, i))
+			}
+			for _, perm := range g.Permissions {
+				if !known(perm) {
+					errs = append(errs, fmt.Errorf("role %s, grant %d: unknown permission %q", name, i, perm))
+				}
+			}
+		}
+	}
+
+	for _, principal := range sortedKeys(p.Bindings) {
+		method, name, _ := strings.Cut(principal, ":")
+		if name == "" || !knownMethod(auth.Method(method)) {
+			errs = append(errs, fmt.Errorf("binding %q must be a method and a name, such as api-key:alice; the methods are api-key, jwt and certificate", principal))
+		}
+		for _, role := range p.Bindings[principal] {
+			if _, ok := p.Roles[role]; !ok {
+				errs = append(errs, fmt.Errorf("%s is bound to unknown role %q", principal, role))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Access returns what the principal may do: what is granted by the roles it is bound to, and by any roles listed in its token's roles claim.
+// Roles in the claim that the policy does not define grant nothing.
+func (p *Policy) Access(principal auth.Principal) *Access {
+	a := &Access{}
+	add := func(name string) {
+		role, ok := p.Roles[name]
+		if !ok {
+			return
+		}
+		a.admin = a.admin || role.Admin
+		a.grants = append(a.grants, role.Grants...)
+	}
+
+	for _, name := range p.Bindings[string(principal.Method)+":"+principal.Name] {
+		add(name)
+	}
+	if principal.Method == auth.MethodJWT {
+		if roles, ok := principal.Claims[RolesClaim].([]interface{}); ok {
+			for _, r := range roles {
+				if name, ok := r.(string); ok {
+					add(name)
+				}
+			}
+		}
+	}
+	return a
+}
+
+// Access is what a caller may do. The zero value allows nothing.
+type Access struct {
+	admin  bool
+	grants []Grant
+
+	//Prefixed to keys before they are checked against the grants.
+	scope string
+}
+
+// Allows reports whether any grant gives perm on key.
+func (a *Access) Allows(perm Permission, key string) bool {
+	key = a.scope + key
+	for _, g := range a.grants {
+		if g.covers(key) && g.has(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Admin reports whether the caller may use the endpoints that are not about particular keys.
+func (a *Access) Admin() bool {
+	return a.admin
+}
+
+// Within returns what the caller may do to keys that are named by prefix followed by the key, such as the keys of a namespace,
+// which grants refer to as "ns/{name}/{key}".
+func (a *Access) Within(prefix string) *Access {
+	return &Access{admin: a.admin, grants: a.grants, scope: a.scope + prefix}
+}
+
+// Filter returns the keys that perm is allowed on, in the same order.
+func (a *Access) Filter(perm Permission, keys []string) []string {
+	allowed := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if a.Allows(perm, k) {
+			allowed = append(allowed, k)
+		}
+	}
+	return allowed
+}
+
+func (g Grant) covers(key string) bool {
+	if g.Pattern != "" {
+		return util.MatchGlob(g.Pattern, key)
+	}
+	return strings.HasPrefix(key, g.Prefix)
+}
+
+func (g Grant) has(perm Permission) bool {
+	for _, p := range g.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func known(perm Permission) bool {
+	for _, p := range permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func knownMethod(method auth.Method) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,154 @@
+package rbac
+
+import (
+	"KeyValueDB/auth"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+roles:
+  team-a:
+    grants:
+      - prefix: "team-a/"
+        permissions: [read, write, delete, list]
+      - pattern: "shared:*"
+        permissions: [read, list]
+  auditor:
+    grants:
+      - pattern: "*"
+        permissions: [list]
+  node:
+    admin: true
+bindings:
+  api-key:alice: [team-a]
+  api-key:deploy-bot: [team-a, auditor]
+  certificate:n2: [node]
+`
+
+func writePolicy(t *testing.T, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	err := os.WriteFile(file, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func testPolicyFile(t *testing.T) *Policy {
+	t.Helper()
+
+	p, err := LoadPolicy(writePolicy(t, testPolicy))
+	if err != nil {
+		t.Fatalf("LoadPolicy returned an error: %s", err)
+	}
+	return p
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tt := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "valid policy should load", content: testPolicy},
+		{name: "grant without a prefix or pattern should be an error", content: "roles: {a: {grants: [{permissions: [read]}]}}", err: "role a, grant 0: exactly one of prefix and pattern"},
+		{name: "grant with a prefix and a pattern should be an error", content: "roles: {a: {grants: [{prefix: x, pattern: 'x*', permissions: [read]}]}}", err: "exactly one of prefix and pattern"},
+		{name: "grant without permissions should be an error", content: "roles: {a: {grants: [{prefix: x}]}}", err: "no permissions given"},
+		{name: "unknown permission should be an error", content: "roles: {a: {grants: [{prefix: x, permissions: [execute]}]}}", err: `unknown permission "execute"`},
+		{name: "binding to an unknown role should be an error", content: "bindings: {api-key:alice: [team-b]}", err: `api-key:alice is bound to unknown role "team-b"`},
+		{name: "binding without a method should be an error", content: "roles: {a: {}}\nbindings: {alice: [a]}", err: `binding "alice" must be a method and a name`},
+		{name: "binding with an unknown method should be an error", content: "roles: {a: {}}\nbindings: {password:alice: [a]}", err: `binding "password:alice" must be a method and a name`},
+		{name: "unknown field should be an error", content: "roles: {a: {grant: []}}", err: "field grant not found"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadPolicy(writePolicy(t, tc.content))
+			if tc.err == "" && err != nil {
+				t.Errorf("LoadPolicy returned an error: %s", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("got error %v, expected one containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestAccess(t *testing.T) {
+	p := testPolicyFile(t)
+
+	tt := []struct {
+		name      string
+		principal auth.Principal
+		perm      Permission
+		key       string
+		expected  bool
+	}{
+		{name: "prefix grant should allow its keys", principal: auth.Principal{Name: "alice", Method: auth.MethodAPIKey}, perm: Delete, key: "team-a/config", expected: true},
+		{name: "prefix grant should not allow other keys", principal: auth.Principal{Name: "alice", Method: auth.MethodAPIKey}, perm: Read, key: "team-b/config"},
+		{name: "pattern grant should allow matching keys", principal: auth.Principal{Name: "alice", Method: auth.MethodAPIKey}, perm: Read, key: "shared:flags", expected: true},
+		{name: "pattern grant should only allow its permissions", principal: auth.Principal{Name: "alice", Method: auth.MethodAPIKey}, perm: Write, key: "shared:flags"},
+		{name: "grants of every bound role should apply", principal: auth.Principal{Name: "deploy-bot", Method: auth.MethodAPIKey}, perm: List, key: "team-b/config", expected: true},
+		{name: "unbound principal should be allowed nothing", principal: auth.Principal{Name: "mallory", Method: auth.MethodAPIKey}, perm: List, key: "team-a/config"},
+		{name: "namesake authenticated another way should be allowed nothing", principal: auth.Principal{Name: "alice", Method: auth.MethodCertificate}, perm: Read, key: "team-a/config"},
+		{
+			name:      "roles claim of a token should grant its roles",
+			principal: auth.Principal{Name: "bob", Method: auth.MethodJWT, Claims: map[string]interface{}{"roles": []interface{}{"unknown", "team-a"}}},
+			perm:      Write,
+			key:       "team-a/x",
+			expected:  true,
+		},
+		{
+			name:      "roles claim should be ignored for API keys",
+			principal: auth.Principal{Name: "bob", Method: auth.MethodAPIKey, Claims: map[string]interface{}{"roles": []interface{}{"team-a"}}},
+			perm:      Write,
+			key:       "team-a/x",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := p.Access(tc.principal).Allows(tc.perm, tc.key); got != tc.expected {
+				t.Errorf("got %v, expected %v", got, tc.expected)
+			}
+		})
+	}
+
+	if p.Access(auth.Principal{Name: "alice", Method: auth.MethodAPIKey}).Admin() || !p.Access(auth.Principal{Name: "n2", Method: auth.MethodCertificate}).Admin() {
+		t.Error("only the node should be an admin")
+	}
+	if p.Access(auth.Principal{Name: "n2", Method: auth.MethodCertificate}).Allows(Read, "team-a/config") {
+		t.Error("an admin role should not grant permissions on keys")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	a := testPolicyFile(t).Access(auth.Principal{Name: "alice", Method: auth.MethodAPIKey})
+
+	got := a.Filter(List, []string{"team-b/1", "team-a/1", "shared:1", "team-a/2", "other"})
+	if !reflect.DeepEqual(got, []string{"team-a/1", "shared:1", "team-a/2"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestWithin(t *testing.T) {
+	a := testPolicyFile(t).Access(auth.Principal{Name: "alice", Method: auth.MethodAPIKey})
+
+	if !a.Within("team-a/").Allows(Write, "config") {
+		t.Error("grant on the prefix should allow its keys")
+	}
+	if !a.Allows(Read, "shared:flags") || a.Within("team-b/").Allows(Read, "shared:flags") {
+		t.Error("keys should be checked with the prefix")
+	}
+
+	got := a.Within("team-a/").Filter(List, []string{"config", "secrets"})
+	if !reflect.DeepEqual(got, []string{"config", "secrets"}) {
+		t.Errorf("got %v, expected the keys without the prefix", got)
+	}
+}
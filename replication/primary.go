@@ -0,0 +1,266 @@
+package replication
+
+import (
+	"KeyValueDB/db"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// heartbeat is how often an idle stream tells replicas the primary's revision, so they can report their lag and notice a dead connection.
+var heartbeat = time.Second
+
+// message is one line of the stream: the changes the primary made at a revision or, without changes,
+// a heartbeat carrying a revision that the replica has been sent every change up to.
+type message struct {
+	Revision uint64 `json:"revision"`
+
+	//The primary's latest revision when the message was sent, which the replica is behind until it reaches.
+	Head uint64 `json:"head"`
+
+	//When the primary made the changes, or sent the heartbeat.
+	Time time.Time `json:"time"`
+
+	Changes []change `json:"changes,omitempty"`
+}
+
+type change struct {
+	Type db.EventType `json:"type"`
+	Key  string       `json:"key"`
+	db.EncodedValue
+
+	//Absolute expiry as Unix nanoseconds, or 0 if the key does not expire.
+	ExpiresAt int64 `json:"exp,omitempty"`
+}
+
+// newMessage encodes the events of one revision.
+func newMessage(events []db.Event) message {
+	m := message{Revision: events[0].Revision, Time: events[0].Time, Changes: make([]change, len(events))}
+	for i, e := range events {
+		m.Changes[i] = change{Type: e.Type, Key: e.Key, EncodedValue: db.EncodeValue(e.Value)}
+		if !e.ExpiresAt.IsZero() {
+			m.Changes[i].ExpiresAt = e.ExpiresAt.UnixNano()
+		}
+	}
+	return m
+}
+
+func (m message) events() []db.Event {
+	events := make([]db.Event, len(m.Changes))
+	for i, c := range m.Changes {
+		events[i] = db.Event{Revision: m.Revision, Type: c.Type, Key: c.Key, Time: m.Time, Value: c.EncodedValue.Decode()}
+		if c.ExpiresAt != 0 {
+			events[i].ExpiresAt = time.Unix(0, c.ExpiresAt)
+		}
+	}
+	return events
+}
+
+// PrimaryStatus describes a primary and the replicas streaming from it.
+type PrimaryStatus struct {
+	Role     string         `json:"role"`
+	Revision uint64         `json:"revision"`
+	Replicas []ReplicaState `json:"replicas"`
+}
+
+// ReplicaState is how far the primary has streamed to a connected replica.
+type ReplicaState struct {
+	Addr      string    `json:"addr"`
+	Connected time.Time `json:"connected"`
+	Revision  uint64    `json:"revision"`
+	Lag       uint64    `json:"lag"`
+}
+
+// Primary serves the database to replicas: a snapshot to bootstrap from, then a stream of every change after it.
+type Primary struct {
+	database *db.Database
+	logger   *slog.Logger
+
+	lock    sync.Mutex
+	streams map[*stream]struct{}
+}
+
+type stream struct {
+	addr      string
+	connected time.Time
+	revision  atomic.Uint64
+}
+
+// NewPrimary serves database to replicas, logging errors to logger.
+func NewPrimary(database *db.Database, logger *slog.Logger) *Primary {
+	return &Primary{
+		database: database,
+		logger:   logger,
+		streams:  make(map[*stream]struct{}),
+	}
+}
+
+// SnapshotHandler serves the full contents of the database on GET, in the snapshot format, with the revision it reflects in the X-Revision header.
+func (p *Primary) SnapshotHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var buf bytes.Buffer
+		rev, err := p.database.DumpSnapshot(&buf)
+		if err != nil {
+			http.Error(w, "error - taking snapshot", http.StatusInternalServerError)
+			p.logger.ErrorContext(r.Context(), "taking replication snapshot", "err", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Revision", strconv.FormatUint(rev, 10))
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// StreamHandler streams every change after the "since" revision on GET, as newline-delimited JSON with a line per revision, and heartbeats while idle.
+// Returns 410 if the changes after since are no longer retained, or if the replica is ahead of the primary, in which case it must bootstrap again from a snapshot.
+func (p *Primary) StreamHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "error - streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		since, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+		if err != nil {
+			http.Error(w, "error - invalid since revision", http.StatusBadRequest)
+			return
+		}
+
+		if since > p.database.Revision() {
+			http.Error(w, "error - replica is ahead of the primary", http.StatusGone)
+			return
+		}
+
+		watch, err := p.database.Watch(db.WatchOptions{Since: since, Resume: true})
+		if errors.Is(err, db.ErrCompacted) {
+			http.Error(w, "error - revision has been compacted", http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, "error - starting replication stream", http.StatusInternalServerError)
+			p.logger.ErrorContext(r.Context(), "starting replication stream", "err", err)
+			return
+		}
+		defer watch.Close()
+
+		s := &stream{addr: r.RemoteAddr, connected: time.Now()}
+		s.revision.Store(since)
+		p.lock.Lock()
+		p.streams[s] = struct{}{}
+		p.lock.Unlock()
+		defer func() {
+			p.lock.Lock()
+			delete(p.streams, s)
+			p.lock.Unlock()
+		}()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		enc := json.NewEncoder(w)
+		flusher.Flush()
+
+		for {
+			//Everything up to rev has already been queued on the watch, so if nothing arrives, the replica has it all.
+			rev := p.database.Revision()
+
+			ctx, cancel := context.WithTimeout(r.Context(), heartbeat)
+			events, err := watch.Next(ctx)
+			cancel()
+
+			if r.Context().Err() != nil {
+				return
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = enc.Encode(message{Revision: rev, Head: rev, Time: time.Now()})
+				if err != nil {
+					return
+				}
+				s.revision.Store(rev)
+				flusher.Flush()
+				continue
+			}
+			if err != nil {
+				//Ending the stream makes the replica reconnect and resume, or bootstrap again if it fell too far behind.
+				p.logger.WarnContext(r.Context(), "ending replication stream", "replica", r.RemoteAddr, "err", err)
+				return
+			}
+
+			head := p.database.Revision()
+			for start := 0; start < len(events); {
+				end := start + 1
+				for end < len(events) && events[end].Revision == events[start].Revision {
+					end++
+				}
+
+				m := newMessage(events[start:end])
+				m.Head = head
+				err = enc.Encode(m)
+				if err != nil {
+					return
+				}
+				s.revision.Store(events[start].Revision)
+				start = end
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Status describes the replicas currently streaming from the primary.
+func (p *Primary) Status() PrimaryStatus {
+	rev := p.database.Revision()
+	status := PrimaryStatus{Role: "primary", Revision: rev, Replicas: make([]ReplicaState, 0)}
+
+	p.lock.Lock()
+	for s := range p.streams {
+		sent := s.revision.Load()
+		status.Replicas = append(status.Replicas, ReplicaState{
+			Addr:      s.addr,
+			Connected: s.connected,
+			Revision:  sent,
+			Lag:       rev - min(sent, rev),
+		})
+	}
+	p.lock.Unlock()
+
+	sort.Slice(status.Replicas, func(i, j int) bool { return status.Replicas[i].Addr < status.Replicas[j].Addr })
+	return status
+}
+
+// StatusHandler reports the primary's revision and its replicas on GET.
+func (p *Primary) StatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(p.Status())
+		if err != nil {
+			p.logger.ErrorContext(r.Context(), "writing replication status", "err", err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package replication
+
+import (
+	"KeyValueDB/db"
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.DiscardHandler)
+
+func init() {
+	heartbeat = 50 * time.Millisecond
+	retryInterval = 10 * time.Millisecond
+}
+
+func newPrimaryServer(t *testing.T, opts ...db.Option) (*db.Database, *Primary, *httptest.Server) {
+	t.Helper()
+
+	database, err := db.NewDatabase(opts...)
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	primary := NewPrimary(database, testLogger)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_replication", primary.StatusHandler())
+	mux.HandleFunc("/_replication/snapshot", primary.SnapshotHandler())
+	mux.HandleFunc("/_replication/stream", primary.StreamHandler())
+	server := httptest.NewServer(mux)
+
+	t.Cleanup(func() {
+		server.Close()
+		database.Close()
+	})
+
+	return database, primary, server
+}
+
+func TestMessageEncoding(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	events := []db.Event{
+		{Revision: 3, Type: db.EventSet, Key: "blob", Time: at, Value: db.Blob{ContentType: "image/png", Data: []byte{0xff, 0x00}}},
+		{Revision: 3, Type: db.EventSet, Key: "ttl", Time: at, Value: "v", ExpiresAt: at.Add(time.Hour)},
+		{Revision: 3, Type: db.EventSet, Key: "json", Time: at, Value: map[string]interface{}{"x": 1.0}},
+		{Revision: 3, Type: db.EventDelete, Key: "gone", Time: at},
+	}
+
+	b, err := json.Marshal(newMessage(events))
+	if err != nil {
+		t.Fatalf("Marshal returned an error: %s", err)
+	}
+
+	var m message
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		t.Fatalf("Unmarshal returned an error: %s", err)
+	}
+
+	got := m.events()
+	for i := range got {
+		if !got[i].Time.Equal(events[i].Time) || !got[i].ExpiresAt.Equal(events[i].ExpiresAt) {
+			t.Errorf("%s: got times %s and %s, want %s and %s", events[i].Key, got[i].Time, got[i].ExpiresAt, events[i].Time, events[i].ExpiresAt)
+		}
+		got[i].Time, got[i].ExpiresAt = events[i].Time, events[i].ExpiresAt
+	}
+	if !reflect.DeepEqual(got, events) {
+		t.Errorf("got %+v, want %+v", got, events)
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	t.Run("stream should send each revision after since, then heartbeats", func(t *testing.T) {
+		database, primary, server := newPrimaryServer(t)
+
+		_ = database.Set("a", "1")
+		_ = database.Set("b", "1")
+		_, _ = database.Txn([]db.TxnOp{
+			{Type: db.TxnSet, Key: "c", Value: "1"},
+			{Type: db.TxnDelete, Key: "a"},
+		})
+
+		res, err := http.Get(server.URL + "/_replication/stream?since=1")
+		if err != nil {
+			t.Fatalf("GET stream: %s", err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("GET stream returned %d, expected 200", res.StatusCode)
+		}
+
+		dec := json.NewDecoder(bufio.NewReader(res.Body))
+		read := func() message {
+			var m message
+			err := dec.Decode(&m)
+			if err != nil {
+				t.Fatalf("reading stream: %s", err)
+			}
+			return m
+		}
+
+		m := read()
+		if m.Revision != 2 || m.Head != 3 || len(m.Changes) != 1 || m.Changes[0].Key != "b" {
+			t.Errorf("first message is %+v, expected b at revision 2", m)
+		}
+
+		m = read()
+		if m.Revision != 3 || len(m.Changes) != 2 {
+			t.Errorf("second message is %+v, expected both changes of the transaction at revision 3", m)
+		}
+
+		m = read()
+		if m.Revision != 3 || m.Head != 3 || len(m.Changes) != 0 {
+			t.Errorf("third message is %+v, expected a heartbeat at revision 3", m)
+		}
+
+		status := primary.Status()
+		if len(status.Replicas) != 1 || status.Replicas[0].Revision != 3 || status.Replicas[0].Lag != 0 {
+			t.Errorf("status is %+v, expected one replica at revision 3", status)
+		}
+	})
+
+	tt := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{name: "missing since should be rejected", query: "", expected: http.StatusBadRequest},
+		{name: "since ahead of the primary should be gone", query: "?since=100", expected: http.StatusGone},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, server := newPrimaryServer(t)
+
+			res, err := http.Get(server.URL + "/_replication/stream" + tc.query)
+			if err != nil {
+				t.Fatalf("GET stream: %s", err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tc.expected {
+				t.Errorf("GET stream returned %d, expected %d", res.StatusCode, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	database, _, server := newPrimaryServer(t)
+	_ = database.Set("a", "1")
+	_ = database.Set("b", "1")
+
+	res, err := http.Get(server.URL + "/_replication/snapshot")
+	if err != nil {
+		t.Fatalf("GET snapshot: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("X-Revision") != "2" {
+		t.Fatalf("GET snapshot returned %d with revision %q, expected 200 with revision 2", res.StatusCode, res.Header.Get("X-Revision"))
+	}
+
+	replica, _ := db.NewDatabase()
+	defer replica.Close()
+
+	err = replica.LoadSnapshot(res.Body)
+	if err != nil {
+		t.Fatalf("LoadSnapshot returned an error: %s", err)
+	}
+	if replica.Revision() != 2 {
+		t.Errorf("loaded revision %d, expected 2", replica.Revision())
+	}
+}
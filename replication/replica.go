@@ -0,0 +1,379 @@
+package replication
+
+import (
+	"KeyValueDB/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrReadOnly is returned by writes to a replica. Writes must be sent to the primary.
+	ErrReadOnly = errors.New("replica is read-only")
+
+	// errResync ends a stream whose changes are no longer available, so the replica bootstraps again from a snapshot.
+	errResync = errors.New("primary requires a new snapshot")
+)
+
+// retryInterval is how long a replica waits before reconnecting to the primary.
+var retryInterval = time.Second
+
+// ReplicaStatus describes how far a replica is behind its primary.
+type ReplicaStatus struct {
+	Role      string `json:"role"`
+	Primary   string `json:"primary"`
+	Connected bool   `json:"connected"`
+
+	//Every change up to Revision has been applied, out of the PrimaryRevision changes the primary was last known to have made.
+	Revision        uint64 `json:"revision"`
+	PrimaryRevision uint64 `json:"primaryRevision"`
+
+	//Revisions behind the primary.
+	Lag uint64 `json:"lag"`
+
+	//How long the replica has been behind the primary, or out of contact with it. 0 when it is known to be up to date.
+	LagSeconds float64 `json:"lagSeconds"`
+
+	LastContact time.Time `json:"lastContact,omitzero"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Replica keeps a read-only copy of a primary's database: it bootstraps from a snapshot, then applies the primary's changes as they are streamed.
+// It serves reads from the copy and implements the same interfaces as db.Database, returning ErrReadOnly from writes.
+type Replica struct {
+	database *db.Database
+	primary  *url.URL
+	client   *http.Client
+	logger   *slog.Logger
+
+	lock sync.Mutex
+
+	//Whether the database holds a copy that can be brought up to date from the stream.
+	bootstrapped bool
+
+	connected       bool
+	revision        uint64
+	primaryRevision uint64
+	behindSince     time.Time
+	lastContact     time.Time
+	err             error
+}
+
+// NewReplica creates a replica of the primary at the base URL primary. database must be empty and must not have a write-ahead log.
+// Requests to the primary are made with client, or a default client if it is nil. Replication starts when Run is called, and its progress
+// and errors are logged to logger.
+func NewReplica(database *db.Database, primary string, client *http.Client, logger *slog.Logger) (*Replica, error) {
+	u, err := url.Parse(primary)
+	if err != nil {
+		return nil, fmt.Errorf("parsing primary address: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("primary address %q must be a URL such as http://primary:8080", primary)
+	}
+
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Replica{
+		database: database,
+		primary:  u,
+		client:   client,
+		logger:   logger,
+	}, nil
+}
+
+// Run replicates from the primary until ctx is done, reconnecting whenever the stream is interrupted.
+func (r *Replica) Run(ctx context.Context) {
+	for {
+		err := r.sync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		r.lock.Lock()
+		r.connected = false
+		r.err = err
+		if errors.Is(err, errResync) {
+			r.bootstrapped = false
+		}
+		r.lock.Unlock()
+		r.logger.WarnContext(ctx, "replicating", "primary", r.primary.String(), "err", err)
+
+		select {
+		case <-time.After(retryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sync bootstraps the replica if it needs to, then applies changes from the stream until it ends.
+func (r *Replica) sync(ctx context.Context) error {
+	r.lock.Lock()
+	bootstrapped, since := r.bootstrapped, r.revision
+	r.lock.Unlock()
+
+	if !bootstrapped {
+		rev, err := r.bootstrap(ctx)
+		if err != nil {
+			return err
+		}
+		since = rev
+	}
+
+	//Closing the connection is the only way to interrupt a read from a primary that has gone quiet.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchdog := time.AfterFunc(3*heartbeat, cancel)
+	defer watchdog.Stop()
+
+	res, err := r.get(ctx, "/_replication/stream", "since="+strconv.FormatUint(since, 10))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusGone {
+		return errResync
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("streaming from primary: %s", res.Status)
+	}
+
+	r.lock.Lock()
+	r.connected, r.err = true, nil
+	r.lastContact = time.Now()
+	r.lock.Unlock()
+
+	dec := json.NewDecoder(res.Body)
+	for {
+		var m message
+		err = dec.Decode(&m)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("primary sent nothing for %s", 3*heartbeat)
+			}
+			return fmt.Errorf("reading from primary: %w", err)
+		}
+		watchdog.Reset(3 * heartbeat)
+
+		if len(m.Changes) > 0 {
+			err = r.database.Replicate(m.events())
+			if err != nil && !errors.Is(err, db.ErrStaleRevision) {
+				return fmt.Errorf("applying revision %d: %w", m.Revision, err)
+			}
+		}
+
+		r.advance(m.Revision, m.Head)
+	}
+}
+
+// bootstrap replaces the database with a snapshot of the primary and returns the revision it reflects.
+func (r *Replica) bootstrap(ctx context.Context) (uint64, error) {
+	res, err := r.get(ctx, "/_replication/snapshot", "")
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("fetching snapshot from primary: %s", res.Status)
+	}
+
+	err = r.database.LoadSnapshot(res.Body)
+	if err != nil {
+		return 0, fmt.Errorf("loading snapshot from primary: %w", err)
+	}
+	rev := r.database.Revision()
+
+	r.lock.Lock()
+	r.bootstrapped = true
+	r.revision, r.primaryRevision = 0, 0
+	r.lock.Unlock()
+
+	r.advance(rev, rev)
+	r.logger.InfoContext(ctx, "bootstrapped replica", "primary", r.primary.String(), "revision", rev)
+
+	return rev, nil
+}
+
+func (r *Replica) get(ctx context.Context, path, query string) (*http.Response, error) {
+	u := r.primary.JoinPath(path)
+	u.RawQuery = query
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to primary: %w", err)
+	}
+	return res, nil
+}
+
+// advance records that every change up to rev has been applied, and that the primary had reached head.
+func (r *Replica) advance(rev, head uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	r.lastContact = now
+	r.revision = max(r.revision, rev)
+	r.primaryRevision = max(r.primaryRevision, head, rev)
+
+	switch {
+	case r.revision >= r.primaryRevision:
+		r.behindSince = time.Time{}
+	case r.behindSince.IsZero():
+		r.behindSince = now
+	}
+}
+
+// Status reports how far the replica is behind the primary.
+func (r *Replica) Status() ReplicaStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	status := ReplicaStatus{
+		Role:            "replica",
+		Primary:         r.primary.String(),
+		Connected:       r.connected,
+		Revision:        r.revision,
+		PrimaryRevision: r.primaryRevision,
+		Lag:             r.primaryRevision - min(r.revision, r.primaryRevision),
+		LastContact:     r.lastContact,
+	}
+	if r.err != nil {
+		status.Error = r.err.Error()
+	}
+
+	since := r.behindSince
+	if !r.connected {
+		since = r.lastContact
+	}
+	if !since.IsZero() {
+		status.LagSeconds = time.Since(since).Seconds()
+	}
+
+	return status
+}
+
+// Ready reports why the replica cannot serve reads yet, or nil if it can. It is ready once it has bootstrapped from the primary,
+// and stays ready if it loses contact with the primary afterwards, serving what it has while Status reports its lag.
+// It is not ready again while it bootstraps anew after falling too far behind.
+func (r *Replica) Ready() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.bootstrapped {
+		if r.err != nil {
+			return fmt.Errorf("bootstrapping from the primary: %w", r.err)
+		}
+		return errors.New("bootstrapping from the primary")
+	}
+	return nil
+}
+
+// StatusHandler reports the replica's lag on GET.
+func (r *Replica) StatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(r.Status())
+		if err != nil {
+			r.logger.ErrorContext(req.Context(), "writing replication status", "err", err)
+		}
+	}
+}
+
+// Handler serves GET and HEAD requests with h, which should be backed by the replica, and redirects every other request to the primary with a 307.
+func (r *Replica) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		u := r.primary.JoinPath(req.URL.Path)
+		u.RawQuery = req.URL.RawQuery
+		http.Redirect(w, req, u.String(), http.StatusTemporaryRedirect)
+	})
+}
+
+func (r *Replica) GetAllKeys() ([]string, error) {
+	return r.database.GetAllKeys()
+}
+
+func (r *Replica) Scan(opts db.ScanOptions) (db.ScanPage, error) {
+	return r.database.Scan(opts)
+}
+
+func (r *Replica) Get(key string) (interface{}, error) {
+	return r.database.Get(key)
+}
+
+func (r *Replica) GetWithVersion(key string) (interface{}, uint64, error) {
+	return r.database.GetWithVersion(key)
+}
+
+func (r *Replica) Set(string, interface{}) error {
+	return ErrReadOnly
+}
+
+func (r *Replica) SetWithTTL(string, interface{}, time.Duration) error {
+	return ErrReadOnly
+}
+
+func (r *Replica) Delete(string) error {
+	return ErrReadOnly
+}
+
+func (r *Replica) CompareAndSet(string, uint64, interface{}, time.Duration) (uint64, error) {
+	return 0, ErrReadOnly
+}
+
+func (r *Replica) CompareAndDelete(string, uint64) error {
+	return ErrReadOnly
+}
+
+// Txn applies transactions that only read.
+func (r *Replica) Txn(ops []db.TxnOp) ([]db.TxnResult, error) {
+	for _, op := range ops {
+		if op.Type != db.TxnGet {
+			return nil, ErrReadOnly
+		}
+	}
+	return r.database.Txn(ops)
+}
+
+func (r *Replica) Expire(string, time.Duration) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (r *Replica) TTL(key string) (time.Duration, bool, error) {
+	return r.database.TTL(key)
+}
+
+// Watch watches the replica's copy, which changes as the primary's changes are applied.
+func (r *Replica) Watch(opts db.WatchOptions) (*db.Watch, error) {
+	return r.database.Watch(opts)
+}
+
+// Snapshot fails with db.ErrPersistenceDisabled: a replica keeps nothing on disk, and bootstraps from the primary when it restarts.
+func (r *Replica) Snapshot() (db.SnapshotInfo, error) {
+	return r.database.Snapshot()
+}
@@ -0,0 +1,253 @@
+package replication
+
+import (
+	"KeyValueDB/db"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startReplica runs replica until the test ends, or until the returned function is called.
+func startReplica(t *testing.T, replica *Replica) (stop func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		replica.Run(ctx)
+		close(done)
+	}()
+
+	stop = func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func newReplica(t *testing.T, url string) *Replica {
+	t.Helper()
+
+	database, err := db.NewDatabase()
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	replica, err := NewReplica(database, url, nil, testLogger)
+	if err != nil {
+		t.Fatalf("NewReplica returned an error: %s", err)
+	}
+	return replica
+}
+
+func caughtUp(primary *db.Database, replica *Replica) func() bool {
+	return func() bool {
+		status := replica.Status()
+		return status.Connected && status.Revision == primary.Revision()
+	}
+}
+
+func TestReplica(t *testing.T) {
+	t.Run("replica should bootstrap from a snapshot then tail changes", func(t *testing.T) {
+		primary, _, server := newPrimaryServer(t)
+
+		_ = primary.Set("before", "value")
+		_ = primary.SetWithTTL("ttl", "value", time.Hour)
+		_ = primary.Set("deleted", "value")
+
+		replica := newReplica(t, server.URL)
+		startReplica(t, replica)
+		eventually(t, "the replica to bootstrap", caughtUp(primary, replica))
+
+		_ = primary.Set("after", db.Blob{ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}})
+		_ = primary.Delete("deleted")
+		_, _ = primary.Txn([]db.TxnOp{
+			{Type: db.TxnSet, Key: "before", Value: map[string]interface{}{"x": 1.0}},
+			{Type: db.TxnSet, Key: "txn", Value: "value"},
+		})
+		eventually(t, "the replica to catch up", caughtUp(primary, replica))
+
+		for _, key := range []string{"before", "ttl", "deleted", "after", "txn"} {
+			pv, pver, perr := primary.GetWithVersion(key)
+			rv, rver, rerr := replica.GetWithVersion(key)
+			if !reflect.DeepEqual(pv, rv) || pver != rver || !errors.Is(rerr, perr) {
+				t.Errorf("%s: replica has %v at version %d (%v), primary %v at version %d (%v)", key, rv, rver, rerr, pv, pver, perr)
+			}
+		}
+
+		ttl, ok, _ := replica.TTL("ttl")
+		if !ok || ttl <= 0 || ttl > time.Hour {
+			t.Errorf("ttl has TTL %s on the replica, expected up to an hour", ttl)
+		}
+
+		status := replica.Status()
+		if status.Lag != 0 || status.LagSeconds != 0 || status.Error != "" {
+			t.Errorf("status is %+v, expected no lag", status)
+		}
+	})
+
+	t.Run("replica should bootstrap again when the primary no longer has the changes it missed", func(t *testing.T) {
+		primary, _, server := newPrimaryServer(t, db.WithWatchHistory(2))
+		_ = primary.Set("a", "1")
+
+		replica := newReplica(t, server.URL)
+		stop := startReplica(t, replica)
+		eventually(t, "the replica to bootstrap", caughtUp(primary, replica))
+		stop()
+
+		for _, key := range []string{"b", "c", "d", "e"} {
+			_ = primary.Set(key, "1")
+		}
+
+		startReplica(t, replica)
+		eventually(t, "the replica to bootstrap again", caughtUp(primary, replica))
+
+		keys, _ := replica.GetAllKeys()
+		if len(keys) != 5 {
+			t.Errorf("replica has keys %v, expected a to e", keys)
+		}
+	})
+
+	t.Run("replica should report lag while the primary is unreachable", func(t *testing.T) {
+		primary, _, server := newPrimaryServer(t)
+		_ = primary.Set("a", "1")
+
+		replica := newReplica(t, server.URL)
+		startReplica(t, replica)
+		eventually(t, "the replica to bootstrap", caughtUp(primary, replica))
+
+		server.CloseClientConnections()
+		server.Close()
+
+		eventually(t, "the replica to disconnect", func() bool { return !replica.Status().Connected })
+		time.Sleep(20 * time.Millisecond)
+
+		status := replica.Status()
+		if status.LagSeconds <= 0 || status.Error == "" {
+			t.Errorf("status is %+v, expected lag and an error", status)
+		}
+
+		//Reads are still served from the copy.
+		if v, _ := replica.Get("a"); v != "1" {
+			t.Errorf("a is %v on the replica, expected 1", v)
+		}
+		if err := replica.Ready(); err != nil {
+			t.Errorf("replica is not ready after losing its primary: %s", err)
+		}
+	})
+}
+
+func TestReplicaReady(t *testing.T) {
+	primary, _, server := newPrimaryServer(t)
+	_ = primary.Set("a", "1")
+
+	replica := newReplica(t, server.URL)
+	if err := replica.Ready(); err == nil {
+		t.Error("replica is ready before bootstrapping")
+	}
+
+	startReplica(t, replica)
+	eventually(t, "the replica to bootstrap", caughtUp(primary, replica))
+
+	if err := replica.Ready(); err != nil {
+		t.Errorf("replica is not ready after bootstrapping: %s", err)
+	}
+}
+
+func TestReplicaNotReadyWithoutPrimary(t *testing.T) {
+	replica := newReplica(t, "http://127.0.0.1:1")
+	startReplica(t, replica)
+
+	eventually(t, "the replica to fail to connect", func() bool { return replica.Status().Error != "" })
+	if err := replica.Ready(); err == nil {
+		t.Error("replica is ready without ever reaching its primary")
+	}
+}
+
+func TestReplicaRejectsWrites(t *testing.T) {
+	replica := newReplica(t, "http://primary:8080")
+
+	tt := []struct {
+		name  string
+		write func() error
+	}{
+		{name: "Set", write: func() error { return replica.Set("k", "v") }},
+		{name: "SetWithTTL", write: func() error { return replica.SetWithTTL("k", "v", time.Hour) }},
+		{name: "Delete", write: func() error { return replica.Delete("k") }},
+		{name: "CompareAndSet", write: func() error { _, err := replica.CompareAndSet("k", 0, "v", 0); return err }},
+		{name: "CompareAndDelete", write: func() error { return replica.CompareAndDelete("k", 1) }},
+		{name: "Expire", write: func() error { _, err := replica.Expire("k", time.Hour); return err }},
+		{name: "Txn", write: func() error {
+			_, err := replica.Txn([]db.TxnOp{{Type: db.TxnGet, Key: "k"}, {Type: db.TxnSet, Key: "k", Value: "v"}})
+			return err
+		}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name+" should return ErrReadOnly", func(t *testing.T) {
+			if err := tc.write(); !errors.Is(err, ErrReadOnly) {
+				t.Errorf("returned %v, expected ErrReadOnly", err)
+			}
+		})
+	}
+
+	t.Run("Txn with only gets should be applied", func(t *testing.T) {
+		results, err := replica.Txn([]db.TxnOp{{Type: db.TxnGet, Key: "k"}})
+		if err != nil || len(results) != 1 {
+			t.Errorf("returned %v, %v", results, err)
+		}
+	})
+}
+
+func TestReplicaHandler(t *testing.T) {
+	replica := newReplica(t, "http://primary:8080/base")
+	h := replica.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tt := []struct {
+		name     string
+		method   string
+		target   string
+		expected int
+		location string
+	}{
+		{name: "GET should be served locally", method: http.MethodGet, target: "/key", expected: http.StatusTeapot},
+		{name: "HEAD should be served locally", method: http.MethodHead, target: "/key", expected: http.StatusTeapot},
+		{name: "PUT should redirect to the primary", method: http.MethodPut, target: "/key?ttl=10s", expected: http.StatusTemporaryRedirect, location: "http://primary:8080/base/key?ttl=10s"},
+		{name: "DELETE should redirect to the primary", method: http.MethodDelete, target: "/key", expected: http.StatusTemporaryRedirect, location: "http://primary:8080/base/key"},
+		{name: "POST should redirect to the primary", method: http.MethodPost, target: "/_txn", expected: http.StatusTemporaryRedirect, location: "http://primary:8080/base/_txn"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.target, nil))
+
+			if w.Code != tc.expected {
+				t.Errorf("returned %d, expected %d", w.Code, tc.expected)
+			}
+			if location := w.Header().Get("Location"); location != tc.location {
+				t.Errorf("redirected to %q, expected %q", location, tc.location)
+			}
+		})
+	}
+}
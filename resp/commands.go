@@ -0,0 +1,618 @@
+package resp
+
+import (
+	"KeyValueDB/db"
+	"KeyValueDB/util"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultScanCount = 10
+
+	//Page size KEYS reads the keyspace in.
+	keysPageSize = 1000
+
+	//Cursors are numeric for client libraries, so each connection maps them to the key to resume after.
+	maxCursors = 64
+
+	//Bounds the retries of read-modify-write commands that keep losing races.
+	maxCASAttempts = 100
+)
+
+const (
+	errSyntax      = "ERR syntax error"
+	errNotInteger  = "ERR value is not an integer or out of range"
+	errOutOfMemory = "OOM command not allowed when used memory > 'maxmemory'."
+)
+
+// conn holds the state of one client connection.
+type conn struct {
+	store  Store
+	r      *reader
+	w      *writer
+	logger *slog.Logger
+
+	cursors    map[uint64]string
+	nextCursor uint64
+
+	quit bool
+}
+
+func newConn(store Store, r io.Reader, w io.Writer, logger *slog.Logger) *conn {
+	return &conn{
+		store:   store,
+		r:       newReader(r),
+		w:       newWriter(w),
+		logger:  logger,
+		cursors: make(map[uint64]string),
+	}
+}
+
+type command struct {
+	//Number of arguments including the command name. Negative means at least -arity.
+	arity int
+	run   func(c *conn, args [][]byte)
+}
+
+var commands = map[string]command{
+	"ping":    {-1, (*conn).ping},
+	"echo":    {2, (*conn).echo},
+	"hello":   {-1, (*conn).hello},
+	"quit":    {1, (*conn).quitCmd},
+	"select":  {2, (*conn).selectCmd},
+	"client":  {-2, (*conn).client},
+	"command": {-1, (*conn).commandCmd},
+	"get":     {2, (*conn).get},
+	"set":     {-3, (*conn).set},
+	"del":     {-2, (*conn).del},
+	"exists":  {-2, (*conn).exists},
+	"keys":    {2, (*conn).keys},
+	"scan":    {-2, (*conn).scan},
+	"expire":  {3, (*conn).expire},
+	"ttl":     {2, (*conn).ttl},
+	"incr":    {2, (*conn).incr},
+	"mget":    {-2, (*conn).mget},
+	"mset":    {-3, (*conn).mset},
+}
+
+func (c *conn) exec(args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.error(fmt.Sprintf("ERR unknown command '%s', with args beginning with: ", sanitize(args[0])))
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+
+	cmd.run(c, args)
+}
+
+// sanitize makes client input safe to echo in an error reply, which cannot contain line breaks.
+func sanitize(b []byte) string {
+	if len(b) > 128 {
+		b = b[:128]
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, string(b))
+}
+
+// dbError replies with err, logging anything that is not the client's fault.
+func (c *conn) dbError(cmd string, err error) {
+	if errors.Is(err, db.ErrOutOfMemory) {
+		c.w.error(errOutOfMemory)
+		return
+	}
+
+	c.w.error("ERR " + err.Error())
+	c.logger.Error("running command", "command", cmd, "err", err)
+}
+
+func (c *conn) ping(args [][]byte) {
+	switch len(args) {
+	case 1:
+		c.w.simple("PONG")
+	case 2:
+		c.w.bulk(args[1])
+	default:
+		c.w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (c *conn) echo(args [][]byte) {
+	c.w.bulk(args[1])
+}
+
+// hello switches protocol version and describes the server. AUTH and SETNAME are accepted and ignored.
+func (c *conn) hello(args [][]byte) {
+	if len(args) > 1 {
+		proto, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			c.w.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if proto != 2 && proto != 3 {
+			c.w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		c.w.proto = proto
+	}
+
+	c.w.mapHeader(6)
+	c.w.bulkString("server")
+	c.w.bulkString("kvdb")
+	c.w.bulkString("version")
+	c.w.bulkString("7.0.0")
+	c.w.bulkString("proto")
+	c.w.integer(int64(c.w.proto))
+	c.w.bulkString("mode")
+	c.w.bulkString("standalone")
+	c.w.bulkString("role")
+	c.w.bulkString("master")
+	c.w.bulkString("modules")
+	c.w.array(0)
+}
+
+func (c *conn) quitCmd(args [][]byte) {
+	c.w.simple("OK")
+	c.quit = true
+}
+
+// selectCmd accepts database 0, the only one there is.
+func (c *conn) selectCmd(args [][]byte) {
+	if string(args[1]) != "0" {
+		c.w.error("ERR DB index is out of range")
+		return
+	}
+	c.w.simple("OK")
+}
+
+// client accepts the CLIENT subcommands client libraries send on connect, such as SETNAME and SETINFO.
+func (c *conn) client(args [][]byte) {
+	c.w.simple("OK")
+}
+
+// commandCmd replies with no command documentation, which redis-cli and client libraries accept.
+func (c *conn) commandCmd(args [][]byte) {
+	c.w.array(0)
+}
+
+func (c *conn) get(args [][]byte) {
+	v, err := c.store.Get(string(args[1]))
+	if err != nil {
+		c.dbError("get", err)
+		return
+	}
+
+	c.value(v)
+}
+
+// value replies with v as a bulk string, or null if the key was absent.
+func (c *conn) value(v interface{}) {
+	if v == nil {
+		c.w.null()
+		return
+	}
+
+	b, err := db.AsBlob(v)
+	if err != nil {
+		c.dbError("encoding value", err)
+		return
+	}
+	c.w.bulk(b.Data)
+}
+
+func blob(b []byte) db.Blob {
+	return db.Blob{Data: b}
+}
+
+// set implements SET key value [NX | XX] [EX seconds | PX milliseconds].
+func (c *conn) set(args [][]byte) {
+	key, value := string(args[1]), blob(args[2])
+
+	var nx, xx bool
+	var ttl time.Duration
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if ttl != 0 || i+1 == len(args) {
+				c.w.error(errSyntax)
+				return
+			}
+
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				c.w.error(errNotInteger)
+				return
+			}
+			if n <= 0 {
+				c.w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+
+			unit := time.Second
+			if strings.ToLower(string(args[i])) == "px" {
+				unit = time.Millisecond
+			}
+			if n > math.MaxInt64/int64(unit) {
+				c.w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = time.Duration(n) * unit
+			i++
+		default:
+			c.w.error(errSyntax)
+			return
+		}
+	}
+
+	if nx && xx {
+		c.w.error(errSyntax)
+		return
+	}
+
+	var err error
+	switch {
+	case nx:
+		_, err = c.store.CompareAndSet(key, 0, value, ttl)
+	case xx:
+		err = c.setExisting(key, value, ttl)
+	case ttl > 0:
+		err = c.store.SetWithTTL(key, value, ttl)
+	default:
+		err = c.store.Set(key, value)
+	}
+
+	if errors.Is(err, db.ErrVersionMismatch) {
+		c.w.null()
+		return
+	}
+	if err != nil {
+		c.dbError("set", err)
+		return
+	}
+	c.w.simple("OK")
+}
+
+// setExisting sets key only if it already exists, returning ErrVersionMismatch if it does not.
+func (c *conn) setExisting(key string, value interface{}, ttl time.Duration) error {
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		v, version, err := c.store.GetWithVersion(key)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return db.ErrVersionMismatch
+		}
+
+		_, err = c.store.CompareAndSet(key, version, value, ttl)
+		if !errors.Is(err, db.ErrVersionMismatch) {
+			return err
+		}
+	}
+	return errors.New("too much contention")
+}
+
+func (c *conn) del(args [][]byte) {
+	var n int64
+	for _, arg := range args[1:] {
+		deleted, err := c.deleteKey(string(arg))
+		if err != nil {
+			c.dbError("del", err)
+			return
+		}
+		if deleted {
+			n++
+		}
+	}
+	c.w.integer(n)
+}
+
+// deleteKey deletes key, reporting whether it existed.
+func (c *conn) deleteKey(key string) (bool, error) {
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		v, version, err := c.store.GetWithVersion(key)
+		if err != nil || v == nil {
+			return false, err
+		}
+
+		err = c.store.CompareAndDelete(key, version)
+		if !errors.Is(err, db.ErrVersionMismatch) {
+			return err == nil, err
+		}
+	}
+	return false, errors.New("too much contention")
+}
+
+func (c *conn) exists(args [][]byte) {
+	var n int64
+	for _, arg := range args[1:] {
+		v, err := c.store.Get(string(arg))
+		if err != nil {
+			c.dbError("exists", err)
+			return
+		}
+		if v != nil {
+			n++
+		}
+	}
+	c.w.integer(n)
+}
+
+func (c *conn) keys(args [][]byte) {
+	pattern := string(args[1])
+
+	var out []string
+	opts := db.ScanOptions{Prefix: util.LiteralPrefix(pattern), Limit: keysPageSize}
+	for {
+		page, err := c.store.Scan(opts)
+		if err != nil {
+			c.dbError("keys", err)
+			return
+		}
+
+		for _, k := range page.Keys {
+			if util.MatchGlob(pattern, k) {
+				out = append(out, k)
+			}
+		}
+
+		if page.Next == "" {
+			break
+		}
+		opts.After = page.Next
+	}
+
+	c.w.array(len(out))
+	for _, k := range out {
+		c.w.bulkString(k)
+	}
+}
+
+// scan implements SCAN cursor [MATCH pattern] [COUNT count]. Keys are returned in order, so unlike Redis no key is returned twice.
+func (c *conn) scan(args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		c.w.error("ERR invalid cursor")
+		return
+	}
+
+	pattern := "*"
+	count := defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			c.w.error(errSyntax)
+			return
+		}
+
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = string(args[i+1])
+		case "count":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 1 {
+				c.w.error(errNotInteger)
+				return
+			}
+		default:
+			c.w.error(errSyntax)
+			return
+		}
+	}
+
+	opts := db.ScanOptions{Prefix: util.LiteralPrefix(pattern), Limit: count}
+	if cursor != 0 {
+		after, ok := c.cursors[cursor]
+		if !ok {
+			//Expired or never issued, so there is nothing left to return.
+			c.scanReply(0, nil)
+			return
+		}
+		delete(c.cursors, cursor)
+		opts.After = after
+	}
+
+	page, err := c.store.Scan(opts)
+	if err != nil {
+		c.dbError("scan", err)
+		return
+	}
+
+	var keys []string
+	for _, k := range page.Keys {
+		if util.MatchGlob(pattern, k) {
+			keys = append(keys, k)
+		}
+	}
+
+	var next uint64
+	if page.Next != "" {
+		next = c.saveCursor(page.Next)
+	}
+	c.scanReply(next, keys)
+}
+
+func (c *conn) saveCursor(after string) uint64 {
+	c.nextCursor++
+	c.cursors[c.nextCursor] = after
+
+	//Cursors are issued in order, so the oldest is the lowest.
+	delete(c.cursors, c.nextCursor-maxCursors)
+
+	return c.nextCursor
+}
+
+func (c *conn) scanReply(cursor uint64, keys []string) {
+	c.w.array(2)
+	c.w.bulkString(strconv.FormatUint(cursor, 10))
+	c.w.array(len(keys))
+	for _, k := range keys {
+		c.w.bulkString(k)
+	}
+}
+
+// expire implements EXPIRE key seconds. A non-positive timeout deletes the key, as in Redis.
+func (c *conn) expire(args [][]byte) {
+	key := string(args[1])
+
+	secs, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.error(errNotInteger)
+		return
+	}
+	if secs > math.MaxInt64/int64(time.Second) {
+		c.w.error("ERR invalid expire time in 'expire' command")
+		return
+	}
+
+	var ok bool
+	if secs <= 0 {
+		ok, err = c.deleteKey(key)
+	} else {
+		ok, err = c.store.Expire(key, time.Duration(secs)*time.Second)
+	}
+	if err != nil {
+		c.dbError("expire", err)
+		return
+	}
+
+	if ok {
+		c.w.integer(1)
+		return
+	}
+	c.w.integer(0)
+}
+
+// ttl replies with the seconds key has left to live, -1 if it does not expire or -2 if it does not exist.
+func (c *conn) ttl(args [][]byte) {
+	ttl, ok, err := c.store.TTL(string(args[1]))
+	if err != nil {
+		c.dbError("ttl", err)
+		return
+	}
+
+	switch {
+	case !ok:
+		c.w.integer(-2)
+	case ttl == 0:
+		c.w.integer(-1)
+	default:
+		c.w.integer(int64((ttl + time.Second/2) / time.Second))
+	}
+}
+
+// incr adds one to the integer stored under key, treating an absent key as 0. The key keeps its TTL.
+func (c *conn) incr(args [][]byte) {
+	key := string(args[1])
+
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		v, version, err := c.store.GetWithVersion(key)
+		if err != nil {
+			c.dbError("incr", err)
+			return
+		}
+
+		var n int64
+		if v != nil {
+			b, err := db.AsBlob(v)
+			if err != nil {
+				c.w.error(errNotInteger)
+				return
+			}
+			n, err = strconv.ParseInt(string(b.Data), 10, 64)
+			if err != nil {
+				c.w.error(errNotInteger)
+				return
+			}
+		}
+
+		if n == math.MaxInt64 {
+			c.w.error("ERR increment or decrement would overflow")
+			return
+		}
+		n++
+
+		var ttl time.Duration
+		if v != nil {
+			ttl, _, err = c.store.TTL(key)
+			if err != nil {
+				c.dbError("incr", err)
+				return
+			}
+		}
+
+		_, err = c.store.CompareAndSet(key, version, blob([]byte(strconv.FormatInt(n, 10))), ttl)
+		if errors.Is(err, db.ErrVersionMismatch) {
+			continue
+		}
+		if err != nil {
+			c.dbError("incr", err)
+			return
+		}
+
+		c.w.integer(n)
+		return
+	}
+
+	c.w.error("ERR too much contention on key")
+}
+
+func (c *conn) mget(args [][]byte) {
+	values := make([]interface{}, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		v, err := c.store.Get(string(arg))
+		if err != nil {
+			c.dbError("mget", err)
+			return
+		}
+		values = append(values, v)
+	}
+
+	c.w.array(len(values))
+	for _, v := range values {
+		c.value(v)
+	}
+}
+
+// mset sets every pair in a single transaction, so other clients see all of them or none.
+func (c *conn) mset(args [][]byte) {
+	if len(args)%2 != 1 {
+		c.w.error("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+
+	ops := make([]db.TxnOp, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		ops = append(ops, db.TxnOp{Type: db.TxnSet, Key: string(args[i]), Value: blob(args[i+1])})
+	}
+
+	_, err := c.store.Txn(ops)
+	if errors.Is(err, db.ErrInvalidTxn) {
+		c.w.error("ERR " + err.Error())
+		return
+	}
+	if err != nil {
+		c.dbError("mset", err)
+		return
+	}
+	c.w.simple("OK")
+}
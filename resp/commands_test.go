@@ -0,0 +1,208 @@
+package resp
+
+import (
+	"KeyValueDB/db"
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+type step struct {
+	cmd      []string
+	expected string
+}
+
+func newTestConn(t *testing.T, opts ...db.Option) (*conn, *bytes.Buffer, *db.Database) {
+	d, err := db.NewDatabase(opts...)
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+
+	var buf bytes.Buffer
+	return newConn(d, &bytes.Buffer{}, &buf, slog.New(slog.DiscardHandler)), &buf, d
+}
+
+func run(t *testing.T, c *conn, buf *bytes.Buffer, steps []step) {
+	t.Helper()
+
+	for _, s := range steps {
+		args := make([][]byte, len(s.cmd))
+		for i, a := range s.cmd {
+			args[i] = []byte(a)
+		}
+
+		c.exec(args)
+		_ = c.w.flush()
+
+		if buf.String() != s.expected {
+			t.Errorf("%q: got %q, want %q", s.cmd, buf.String(), s.expected)
+		}
+		buf.Reset()
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tt := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "PING and ECHO",
+			steps: []step{
+				{[]string{"PING"}, "+PONG\r\n"},
+				{[]string{"ping", "hi"}, "$2\r\nhi\r\n"},
+				{[]string{"ECHO", "hello"}, "$5\r\nhello\r\n"},
+			},
+		},
+		{
+			name: "Unknown Command and Wrong Arity",
+			steps: []step{
+				{[]string{"FLUSHALL"}, "-ERR unknown command 'FLUSHALL', with args beginning with: \r\n"},
+				{[]string{"BAD\r\nCMD"}, "-ERR unknown command 'BAD  CMD', with args beginning with: \r\n"},
+				{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command\r\n"},
+				{[]string{"MSET", "a", "1", "b"}, "-ERR wrong number of arguments for 'mset' command\r\n"},
+			},
+		},
+		{
+			name: "GET and SET",
+			steps: []step{
+				{[]string{"GET", "key"}, "$-1\r\n"},
+				{[]string{"SET", "key", "value"}, "+OK\r\n"},
+				{[]string{"GET", "key"}, "$5\r\nvalue\r\n"},
+				{[]string{"SET", "key", "value", "BOGUS"}, "-ERR syntax error\r\n"},
+			},
+		},
+		{
+			name: "SET NX and XX",
+			steps: []step{
+				{[]string{"SET", "key", "1", "XX"}, "$-1\r\n"},
+				{[]string{"SET", "key", "1", "NX"}, "+OK\r\n"},
+				{[]string{"SET", "key", "2", "NX"}, "$-1\r\n"},
+				{[]string{"SET", "key", "3", "XX"}, "+OK\r\n"},
+				{[]string{"GET", "key"}, "$1\r\n3\r\n"},
+				{[]string{"SET", "key", "4", "NX", "XX"}, "-ERR syntax error\r\n"},
+			},
+		},
+		{
+			name: "SET EX, EXPIRE and TTL",
+			steps: []step{
+				{[]string{"TTL", "key"}, ":-2\r\n"},
+				{[]string{"SET", "key", "value"}, "+OK\r\n"},
+				{[]string{"TTL", "key"}, ":-1\r\n"},
+				{[]string{"SET", "key", "value", "EX", "100"}, "+OK\r\n"},
+				{[]string{"TTL", "key"}, ":100\r\n"},
+				{[]string{"SET", "key", "value", "PX", "5000"}, "+OK\r\n"},
+				{[]string{"TTL", "key"}, ":5\r\n"},
+				{[]string{"EXPIRE", "key", "50"}, ":1\r\n"},
+				{[]string{"TTL", "key"}, ":50\r\n"},
+				{[]string{"EXPIRE", "missing", "50"}, ":0\r\n"},
+				{[]string{"SET", "key", "value", "EX", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+				{[]string{"SET", "key", "value", "EX", "soon"}, "-ERR value is not an integer or out of range\r\n"},
+				{[]string{"EXPIRE", "key", "0"}, ":1\r\n"},
+				{[]string{"GET", "key"}, "$-1\r\n"},
+			},
+		},
+		{
+			name: "DEL and EXISTS",
+			steps: []step{
+				{[]string{"MSET", "a", "1", "b", "2"}, "+OK\r\n"},
+				{[]string{"EXISTS", "a", "b", "c", "a"}, ":3\r\n"},
+				{[]string{"DEL", "a", "c"}, ":1\r\n"},
+				{[]string{"EXISTS", "a"}, ":0\r\n"},
+			},
+		},
+		{
+			name: "INCR",
+			steps: []step{
+				{[]string{"INCR", "n"}, ":1\r\n"},
+				{[]string{"INCR", "n"}, ":2\r\n"},
+				{[]string{"GET", "n"}, "$1\r\n2\r\n"},
+				{[]string{"SET", "n", "9223372036854775807"}, "+OK\r\n"},
+				{[]string{"INCR", "n"}, "-ERR increment or decrement would overflow\r\n"},
+				{[]string{"SET", "n", "abc"}, "+OK\r\n"},
+				{[]string{"INCR", "n"}, "-ERR value is not an integer or out of range\r\n"},
+				{[]string{"SET", "t", "1", "EX", "100"}, "+OK\r\n"},
+				{[]string{"INCR", "t"}, ":2\r\n"},
+				{[]string{"TTL", "t"}, ":100\r\n"},
+			},
+		},
+		{
+			name: "MGET and MSET",
+			steps: []step{
+				{[]string{"MSET", "a", "1", "b", "2"}, "+OK\r\n"},
+				{[]string{"MGET", "a", "missing", "b"}, "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n2\r\n"},
+			},
+		},
+		{
+			name: "KEYS",
+			steps: []step{
+				{[]string{"MSET", "user:1", "a", "user:2", "b", "user:10", "c", "order:1", "d"}, "+OK\r\n"},
+				{[]string{"KEYS", "user:?"}, "*2\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n"},
+				{[]string{"KEYS", "*:1"}, "*2\r\n$7\r\norder:1\r\n$6\r\nuser:1\r\n"},
+				{[]string{"KEYS", "nothing*"}, "*0\r\n"},
+			},
+		},
+		{
+			name: "SCAN",
+			steps: []step{
+				{[]string{"MSET", "a", "1", "b", "2", "c", "3"}, "+OK\r\n"},
+				{[]string{"SCAN", "0", "COUNT", "2"}, "*2\r\n$1\r\n1\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+				{[]string{"SCAN", "1", "COUNT", "2"}, "*2\r\n$1\r\n0\r\n*1\r\n$1\r\nc\r\n"},
+				{[]string{"SCAN", "0", "MATCH", "[bc]"}, "*2\r\n$1\r\n0\r\n*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+				{[]string{"SCAN", "42"}, "*2\r\n$1\r\n0\r\n*0\r\n"},
+				{[]string{"SCAN", "x"}, "-ERR invalid cursor\r\n"},
+				{[]string{"SCAN", "0", "COUNT"}, "-ERR syntax error\r\n"},
+			},
+		},
+		{
+			name: "HELLO should switch protocol",
+			steps: []step{
+				{[]string{"HELLO", "4"}, "-NOPROTO unsupported protocol version\r\n"},
+				{[]string{"HELLO", "3"}, "%6\r\n$6\r\nserver\r\n$4\r\nkvdb\r\n$7\r\nversion\r\n$5\r\n7.0.0\r\n$5\r\nproto\r\n:3\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n"},
+				{[]string{"GET", "missing"}, "_\r\n"},
+			},
+		},
+		{
+			name: "SELECT only accepts database 0",
+			steps: []step{
+				{[]string{"SELECT", "0"}, "+OK\r\n"},
+				{[]string{"SELECT", "1"}, "-ERR DB index is out of range\r\n"},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c, buf, _ := newTestConn(t)
+			run(t, c, buf, tc.steps)
+		})
+	}
+}
+
+func TestCommandsShareDatabaseWithHTTP(t *testing.T) {
+	c, buf, d := newTestConn(t)
+
+	_ = d.Set("json", db.Blob{ContentType: "application/json", Data: []byte(`{"a":1}`)})
+	_, _ = d.Txn([]db.TxnOp{{Type: db.TxnSet, Key: "txn", Value: map[string]interface{}{"b": true}}})
+
+	run(t, c, buf, []step{
+		{[]string{"GET", "json"}, "$7\r\n{\"a\":1}\r\n"},
+		{[]string{"GET", "txn"}, "$10\r\n{\"b\":true}\r\n"},
+		{[]string{"SET", "raw", "\x00\xff"}, "+OK\r\n"},
+	})
+
+	v, _ := d.Get("raw")
+	if b, ok := v.(db.Blob); !ok || string(b.Data) != "\x00\xff" {
+		t.Errorf("SET stored %#v, expected the raw bytes", v)
+	}
+}
+
+func TestCommandsOutOfMemory(t *testing.T) {
+	c, buf, _ := newTestConn(t, db.WithMaxKeys(1))
+
+	run(t, c, buf, []step{
+		{[]string{"SET", "a", "1"}, "+OK\r\n"},
+		{[]string{"SET", "b", "1"}, "-OOM command not allowed when used memory > 'maxmemory'.\r\n"},
+	})
+}
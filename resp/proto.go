@@ -0,0 +1,202 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	//Limits taken from Redis' proto-max-bulk-len and the most arguments a single command may have.
+	maxBulkLen = 512 << 20
+	maxArgs    = 1 << 20
+
+	maxInlineLen = 64 << 10
+)
+
+// errProtocol is returned for malformed input, after which the connection is closed.
+var errProtocol = errors.New("Protocol error")
+
+// reader parses client commands, either as arrays of bulk strings or as inline commands typed into a terminal.
+type reader struct {
+	br *bufio.Reader
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{br: bufio.NewReader(r)}
+}
+
+// buffered reports whether another command has already been received, so replies to a pipeline can be flushed together.
+func (r *reader) buffered() bool {
+	return r.br.Buffered() > 0
+}
+
+// readCommand returns the arguments of the next command, including its name. Empty inline lines are skipped.
+func (r *reader) readCommand() ([][]byte, error) {
+	for {
+		b, err := r.br.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+
+		if b[0] == '*' {
+			return r.readArray()
+		}
+
+		args, err := r.readInline()
+		if err != nil || len(args) > 0 {
+			return args, err
+		}
+	}
+}
+
+func (r *reader) readArray() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		line, err = r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", errProtocol, printable(line))
+		}
+
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+
+		arg := make([]byte, size+2)
+		_, err = io.ReadFull(r.br, arg)
+		if err != nil {
+			return nil, err
+		}
+		if arg[size] != '\r' || arg[size+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", errProtocol)
+		}
+
+		args = append(args, arg[:size])
+	}
+
+	return args, nil
+}
+
+func (r *reader) readInline() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.Fields(line), nil
+}
+
+// readLine returns the next line without its line ending, which may be CRLF or a bare LF.
+func (r *reader) readLine() ([]byte, error) {
+	line, err := r.br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: too big inline request", errProtocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) > maxInlineLen {
+		return nil, fmt.Errorf("%w: too big inline request", errProtocol)
+	}
+
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'})
+
+	//ReadSlice's buffer is reused by the next read.
+	return append([]byte(nil), line...), nil
+}
+
+func printable(b []byte) string {
+	if len(b) > 32 {
+		b = b[:32]
+	}
+	return strconv.Quote(string(b))
+}
+
+// writer encodes replies in the protocol version the client negotiated with HELLO.
+type writer struct {
+	bw    *bufio.Writer
+	proto int
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{bw: bufio.NewWriter(w), proto: 2}
+}
+
+func (w *writer) flush() error {
+	return w.bw.Flush()
+}
+
+func (w *writer) simple(s string) {
+	w.bw.WriteByte('+')
+	w.bw.WriteString(s)
+	w.bw.WriteString("\r\n")
+}
+
+// error writes an error reply. msg should start with an error code such as ERR or WRONGTYPE.
+func (w *writer) error(msg string) {
+	w.bw.WriteByte('-')
+	w.bw.WriteString(msg)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.bw.WriteByte(':')
+	w.bw.WriteString(strconv.FormatInt(n, 10))
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) bulk(b []byte) {
+	w.bw.WriteByte('$')
+	w.bw.WriteString(strconv.Itoa(len(b)))
+	w.bw.WriteString("\r\n")
+	w.bw.Write(b)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) bulkString(s string) {
+	w.bulk([]byte(s))
+}
+
+// null writes the null reply, which RESP2 spells as a null bulk string.
+func (w *writer) null() {
+	if w.proto == 3 {
+		w.bw.WriteString("_\r\n")
+		return
+	}
+	w.bw.WriteString("$-1\r\n")
+}
+
+// array writes the header of an array of n elements, which the caller then writes.
+func (w *writer) array(n int) {
+	w.bw.WriteByte('*')
+	w.bw.WriteString(strconv.Itoa(n))
+	w.bw.WriteString("\r\n")
+}
+
+// mapHeader writes the header of a map of n pairs. RESP2 has no maps, so it is sent as a flat array.
+func (w *writer) mapHeader(n int) {
+	if w.proto == 3 {
+		w.bw.WriteByte('%')
+		w.bw.WriteString(strconv.Itoa(n))
+		w.bw.WriteString("\r\n")
+		return
+	}
+	w.array(n * 2)
+}
@@ -0,0 +1,167 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		expected [][]string
+		err      error
+	}{
+		{
+			name:     "Should Read Array of Bulk Strings",
+			input:    "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nva\r\nl\r\n",
+			expected: [][]string{{"SET", "key", "va\r\nl"}},
+			err:      io.EOF,
+		},
+		{
+			name:     "Should Read Pipelined Commands",
+			input:    "*1\r\n$4\r\nPING\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\n",
+			expected: [][]string{{"PING"}, {"GET", "k"}},
+			err:      io.EOF,
+		},
+		{
+			name:     "Should Read Inline Commands and Skip Blank Lines",
+			input:    "\r\n  GET   key \nPING\r\n",
+			expected: [][]string{{"GET", "key"}, {"PING"}},
+			err:      io.EOF,
+		},
+		{
+			name:     "Should Read Empty Bulk String",
+			input:    "*2\r\n$4\r\nECHO\r\n$0\r\n\r\n",
+			expected: [][]string{{"ECHO", ""}},
+			err:      io.EOF,
+		},
+		{
+			name:  "Should Reject Invalid Multibulk Length",
+			input: "*x\r\n",
+			err:   errProtocol,
+		},
+		{
+			name:  "Should Reject Missing Bulk Header",
+			input: "*1\r\n:1\r\n",
+			err:   errProtocol,
+		},
+		{
+			name:  "Should Reject Unterminated Bulk String",
+			input: "*1\r\n$2\r\nabcd\r\n",
+			err:   errProtocol,
+		},
+		{
+			name:  "Should Return Unexpected EOF on Truncated Bulk String",
+			input: "*1\r\n$10\r\nabc",
+			err:   io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newReader(strings.NewReader(tc.input))
+
+			var got [][]string
+			var err error
+			for {
+				var args [][]byte
+				args, err = r.readCommand()
+				if err != nil {
+					break
+				}
+
+				cmd := make([]string, len(args))
+				for i, a := range args {
+					cmd[i] = string(a)
+				}
+				got = append(got, cmd)
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Commands: got %q, want %q", got, tc.expected)
+			}
+
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Error: got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tt := []struct {
+		name     string
+		proto    int
+		write    func(w *writer)
+		expected string
+	}{
+		{
+			name:     "Should Write Simple String",
+			proto:    2,
+			write:    func(w *writer) { w.simple("OK") },
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "Should Write Error",
+			proto:    2,
+			write:    func(w *writer) { w.error("ERR bad") },
+			expected: "-ERR bad\r\n",
+		},
+		{
+			name:     "Should Write Integer",
+			proto:    2,
+			write:    func(w *writer) { w.integer(-2) },
+			expected: ":-2\r\n",
+		},
+		{
+			name:     "Should Write Binary Bulk String",
+			proto:    2,
+			write:    func(w *writer) { w.bulk([]byte{0, '\r', '\n'}) },
+			expected: "$3\r\n\x00\r\n\r\n",
+		},
+		{
+			name:     "Should Write RESP2 Null as Null Bulk String",
+			proto:    2,
+			write:    func(w *writer) { w.null() },
+			expected: "$-1\r\n",
+		},
+		{
+			name:     "Should Write RESP3 Null",
+			proto:    3,
+			write:    func(w *writer) { w.null() },
+			expected: "_\r\n",
+		},
+		{
+			name:     "Should Write RESP2 Map as Flat Array",
+			proto:    2,
+			write:    func(w *writer) { w.mapHeader(2) },
+			expected: "*4\r\n",
+		},
+		{
+			name:     "Should Write RESP3 Map",
+			proto:    3,
+			write:    func(w *writer) { w.mapHeader(2) },
+			expected: "%2\r\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newWriter(&buf)
+			w.proto = tc.proto
+
+			tc.write(w)
+			_ = w.flush()
+
+			if buf.String() != tc.expected {
+				t.Errorf("got %q, want %q", buf.String(), tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Package resp serves the database over the Redis serialization protocol, so that redis-cli and Redis client libraries can be used against it.
+package resp
+
+import (
+	"KeyValueDB/db"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// ErrServerClosed is returned by Serve once Close has been called.
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Store is the database the server runs commands against.
+type Store interface {
+	db.IDatabase
+	db.ITransactor
+	db.IExpirer
+}
+
+// Server accepts RESP2 and RESP3 connections. Clients start on RESP2 and may switch with HELLO 3.
+type Server struct {
+	store  Store
+	logger *slog.Logger
+
+	lock     sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer serves store. Errors that are not the client's fault are logged to logger.
+func NewServer(store Store, logger *slog.Logger) *Server {
+	return &Server{
+		store:  store,
+		logger: logger,
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections until Close is called.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l, serving each on its own goroutine, until Close is called.
+func (s *Server) Serve(l net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.lock.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		if !s.track(nc) {
+			_ = nc.Close()
+			return ErrServerClosed
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(nc)
+			s.serveConn(nc)
+		}()
+	}
+}
+
+// Close stops accepting connections, closes open ones and waits for their commands to finish.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	s.closed = true
+
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for nc := range s.conns {
+		_ = nc.Close()
+	}
+	s.lock.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) track(nc net.Conn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.conns[nc] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(nc net.Conn) {
+	s.lock.Lock()
+	delete(s.conns, nc)
+	s.lock.Unlock()
+
+	_ = nc.Close()
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	c := newConn(s.store, nc, nc, s.logger.With("client", nc.RemoteAddr().String()))
+
+	for {
+		args, err := c.r.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.w.error("ERR " + err.Error())
+				_ = c.w.flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				c.logger.Error("reading command", "err", err)
+			}
+			return
+		}
+
+		c.exec(args)
+
+		if c.r.buffered() && !c.quit {
+			continue
+		}
+
+		err = c.w.flush()
+		if err != nil || c.quit {
+			return
+		}
+	}
+}
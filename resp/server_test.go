@@ -0,0 +1,106 @@
+package resp
+
+import (
+	"KeyValueDB/db"
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+func startTestServer(t *testing.T) (*Server, string, chan error) {
+	d, err := db.NewDatabase()
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(d, slog.New(slog.DiscardHandler))
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+
+	return s, l.Addr().String(), served
+}
+
+func TestServer(t *testing.T) {
+	s, addr, served := startTestServer(t)
+	defer s.Close()
+
+	t.Run("Should Answer Pipelined Commands in Order", func(t *testing.T) {
+		nc, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer nc.Close()
+
+		_, _ = nc.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\nPING\r\nQUIT\r\n"))
+
+		_ = nc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		got, err := io.ReadAll(nc)
+		if err != nil {
+			t.Fatalf("reading replies: %s", err)
+		}
+
+		expected := "+OK\r\n$1\r\nv\r\n+PONG\r\n+OK\r\n"
+		if string(got) != expected {
+			t.Errorf("got %q, want %q", got, expected)
+		}
+	})
+
+	t.Run("Should Close Connection on Protocol Error", func(t *testing.T) {
+		nc, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer nc.Close()
+
+		_, _ = nc.Write([]byte("*1\r\n:1\r\n"))
+
+		_ = nc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		line, _ := bufio.NewReader(nc).ReadString('\n')
+		if line != "-ERR Protocol error: expected '$', got '\":1\"'\r\n" {
+			t.Errorf("got %q", line)
+		}
+	})
+
+	t.Run("Close Should Stop Serving and Close Connections", func(t *testing.T) {
+		nc, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer nc.Close()
+
+		//Make sure the connection has been accepted before closing.
+		_, _ = nc.Write([]byte("PING\r\n"))
+		_ = nc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		r := bufio.NewReader(nc)
+		_, _ = r.ReadString('\n')
+
+		err = s.Close()
+		if err != nil {
+			t.Fatalf("Close returned an error: %s", err)
+		}
+
+		select {
+		case err = <-served:
+			if !errors.Is(err, ErrServerClosed) {
+				t.Errorf("Serve returned %v, expected ErrServerClosed", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Serve did not return after Close")
+		}
+
+		_, err = r.ReadString('\n')
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("reading from a closed server returned %v, expected EOF", err)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+// Package rpc serves the database over gRPC using the kvdb.v1.KeyValue service.
+package rpc
+
+import (
+	"KeyValueDB/cluster"
+	"KeyValueDB/db"
+	kvdbv1 "KeyValueDB/proto/kvdb/v1"
+	"KeyValueDB/replication"
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultPageSize = 1000
+	maxPageSize     = 10000
+)
+
+// Store is the database the service runs against.
+type Store interface {
+	db.IDatabase
+	db.ITransactor
+}
+
+// Service implements kvdbv1.KeyValueServer.
+type Service struct {
+	kvdbv1.UnimplementedKeyValueServer
+
+	store  Store
+	logger *slog.Logger
+}
+
+// NewService serves store. Errors that are not the client's fault are logged to logger.
+func NewService(store Store, logger *slog.Logger) *Service {
+	return &Service{store: store, logger: logger}
+}
+
+func (s *Service) Get(ctx context.Context, req *kvdbv1.GetRequest) (*kvdbv1.GetResponse, error) {
+	if req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "no key provided")
+	}
+
+	return s.get(ctx, req.GetKey())
+}
+
+func (s *Service) get(ctx context.Context, key string) (*kvdbv1.GetResponse, error) {
+	v, version, err := s.store.GetWithVersion(key)
+	if err != nil {
+		return nil, s.storeError(ctx, "getting key", err)
+	}
+
+	resp := &kvdbv1.GetResponse{Key: key}
+	if v == nil {
+		return resp, nil
+	}
+
+	b, err := db.AsBlob(v)
+	if err != nil {
+		return nil, s.storeError(ctx, "encoding value", err)
+	}
+
+	resp.Found = true
+	resp.Version = version
+	resp.Value = &kvdbv1.Value{Data: b.Data, ContentType: b.ContentType}
+	return resp, nil
+}
+
+func (s *Service) Set(ctx context.Context, req *kvdbv1.SetRequest) (*kvdbv1.SetResponse, error) {
+	key, value, ttl, err := setArgs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl > 0 {
+		err = s.store.SetWithTTL(key, value, ttl)
+	} else {
+		err = s.store.Set(key, value)
+	}
+	if err != nil {
+		return nil, s.storeError(ctx, "putting kv pair", err)
+	}
+
+	return &kvdbv1.SetResponse{}, nil
+}
+
+func setArgs(req *kvdbv1.SetRequest) (string, db.Blob, time.Duration, error) {
+	if req.GetKey() == "" {
+		return "", db.Blob{}, 0, status.Error(codes.InvalidArgument, "no key provided")
+	}
+	if req.GetTtlMs() < 0 {
+		return "", db.Blob{}, 0, status.Error(codes.InvalidArgument, "ttl must not be negative")
+	}
+	//Any longer would overflow a time.Duration.
+	if req.GetTtlMs() > math.MaxInt64/int64(time.Millisecond) {
+		return "", db.Blob{}, 0, status.Error(codes.InvalidArgument, "ttl is out of range")
+	}
+
+	value := db.Blob{Data: req.GetValue().GetData(), ContentType: req.GetValue().GetContentType()}
+	return req.GetKey(), value, time.Duration(req.GetTtlMs()) * time.Millisecond, nil
+}
+
+func (s *Service) Delete(ctx context.Context, req *kvdbv1.DeleteRequest) (*kvdbv1.DeleteResponse, error) {
+	if req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "no key provided")
+	}
+
+	err := s.store.Delete(req.GetKey())
+	if err != nil {
+		return nil, s.storeError(ctx, "deleting key", err)
+	}
+
+	return &kvdbv1.DeleteResponse{}, nil
+}
+
+// ListKeys sends a page of keys at a time until the range is exhausted or the client goes away.
+func (s *Service) ListKeys(req *kvdbv1.ListKeysRequest, stream kvdbv1.KeyValue_ListKeysServer) error {
+	size := int(req.GetPageSize())
+	if size < 0 || size > maxPageSize {
+		return status.Errorf(codes.InvalidArgument, "page_size must be between 0 and %d", maxPageSize)
+	}
+	if size == 0 {
+		size = defaultPageSize
+	}
+
+	opts := db.ScanOptions{Prefix: req.GetPrefix(), Start: req.GetStart(), End: req.GetEnd(), Limit: size}
+	for {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		page, err := s.store.Scan(opts)
+		if err != nil {
+			return s.storeError(stream.Context(), "scanning keys", err)
+		}
+
+		if len(page.Keys) > 0 {
+			err = stream.Send(&kvdbv1.ListKeysResponse{Keys: page.Keys})
+			if err != nil {
+				return err
+			}
+		}
+
+		if page.Next == "" {
+			return nil
+		}
+		opts.After = page.Next
+	}
+}
+
+func (s *Service) BatchGet(ctx context.Context, req *kvdbv1.BatchGetRequest) (*kvdbv1.BatchGetResponse, error) {
+	if len(req.GetKeys()) > db.MaxTxnOps {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d keys may be read at once", db.MaxTxnOps)
+	}
+
+	resp := &kvdbv1.BatchGetResponse{Results: make([]*kvdbv1.GetResponse, 0, len(req.GetKeys()))}
+	for _, key := range req.GetKeys() {
+		if key == "" {
+			return nil, status.Error(codes.InvalidArgument, "no key provided")
+		}
+
+		result, err := s.get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	return resp, nil
+}
+
+func (s *Service) BatchSet(ctx context.Context, req *kvdbv1.BatchSetRequest) (*kvdbv1.BatchSetResponse, error) {
+	ops := make([]db.TxnOp, 0, len(req.GetItems()))
+	for _, item := range req.GetItems() {
+		key, value, ttl, err := setArgs(item)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, db.TxnOp{Type: db.TxnSet, Key: key, Value: value, TTL: ttl})
+	}
+
+	_, err := s.store.Txn(ops)
+	if err != nil {
+		return nil, s.storeError(ctx, "applying batch", err)
+	}
+
+	return &kvdbv1.BatchSetResponse{}, nil
+}
+
+func (s *Service) BatchDelete(ctx context.Context, req *kvdbv1.BatchDeleteRequest) (*kvdbv1.BatchDeleteResponse, error) {
+	ops := make([]db.TxnOp, 0, len(req.GetKeys()))
+	for _, key := range req.GetKeys() {
+		ops = append(ops, db.TxnOp{Type: db.TxnDelete, Key: key})
+	}
+
+	_, err := s.store.Txn(ops)
+	if err != nil {
+		return nil, s.storeError(ctx, "applying batch", err)
+	}
+
+	return &kvdbv1.BatchDeleteResponse{}, nil
+}
+
+// storeError maps database errors to status codes, logging anything that is not the client's fault.
+func (s *Service) storeError(ctx context.Context, action string, err error) error {
+	switch {
+	case errors.Is(err, db.ErrOutOfMemory):
+		return status.Error(codes.ResourceExhausted, "database is full")
+	case errors.Is(err, db.ErrInvalidTxn), errors.Is(err, db.ErrInvalidTTL), errors.Is(err, db.ErrInvalidScan):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, cluster.ErrNotLeader):
+		//Retryable: against the leader, or here once this node is elected.
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, replication.ErrReadOnly):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	s.logger.ErrorContext(ctx, action, "err", err)
+	return status.Errorf(codes.Internal, "error - %s", action)
+}
@@ -0,0 +1,252 @@
+package rpc
+
+import (
+	"KeyValueDB/cluster"
+	"KeyValueDB/db"
+	kvdbv1 "KeyValueDB/proto/kvdb/v1"
+	"KeyValueDB/replication"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, opts ...db.Option) (kvdbv1.KeyValueClient, *db.Database) {
+	d, err := db.NewDatabase(opts...)
+	if err != nil {
+		t.Fatalf("NewDatabase returned an error: %s", err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+
+	l := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	kvdbv1.RegisterKeyValueServer(s, NewService(d, slog.New(slog.DiscardHandler)))
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return kvdbv1.NewKeyValueClient(conn), d
+}
+
+func TestGetSetDelete(t *testing.T) {
+	c, d := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := c.Set(ctx, &kvdbv1.SetRequest{Key: "key", Value: &kvdbv1.Value{Data: []byte{0x00, 0xff}, ContentType: "application/octet-stream"}})
+	if err != nil {
+		t.Fatalf("Set returned an error: %s", err)
+	}
+
+	resp, err := c.Get(ctx, &kvdbv1.GetRequest{Key: "key"})
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err)
+	}
+
+	_, version, _ := d.GetWithVersion("key")
+	if !resp.GetFound() || resp.GetVersion() != version || string(resp.GetValue().GetData()) != "\x00\xff" || resp.GetValue().GetContentType() != "application/octet-stream" {
+		t.Errorf("Get returned %v", resp)
+	}
+
+	_, err = c.Delete(ctx, &kvdbv1.DeleteRequest{Key: "key"})
+	if err != nil {
+		t.Fatalf("Delete returned an error: %s", err)
+	}
+
+	resp, err = c.Get(ctx, &kvdbv1.GetRequest{Key: "key"})
+	if err != nil || resp.GetFound() || resp.GetValue() != nil {
+		t.Errorf("Get after Delete returned %v, %v", resp, err)
+	}
+
+	_, err = c.Set(ctx, &kvdbv1.SetRequest{Key: "ttl", TtlMs: 60000})
+	if err != nil {
+		t.Fatalf("Set with ttl returned an error: %s", err)
+	}
+	if ttl, ok, _ := d.TTL("ttl"); !ok || ttl <= 0 {
+		t.Errorf("Set with ttl left a ttl of %s", ttl)
+	}
+}
+
+func TestGetValueWrittenOverHTTP(t *testing.T) {
+	c, d := newTestClient(t)
+
+	_, _ = d.Txn([]db.TxnOp{{Type: db.TxnSet, Key: "json", Value: map[string]interface{}{"a": 1.0}}})
+
+	resp, err := c.Get(context.Background(), &kvdbv1.GetRequest{Key: "json"})
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err)
+	}
+
+	if string(resp.GetValue().GetData()) != `{"a":1}` || resp.GetValue().GetContentType() != "application/json" {
+		t.Errorf("Get returned %v", resp.GetValue())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c, _ := newTestClient(t, db.WithMaxKeys(1))
+	ctx := context.Background()
+
+	_, _ = c.Set(ctx, &kvdbv1.SetRequest{Key: "a"})
+
+	tt := []struct {
+		name     string
+		call     func() error
+		expected codes.Code
+	}{
+		{
+			name:     "Get without a key",
+			call:     func() error { _, err := c.Get(ctx, &kvdbv1.GetRequest{}); return err },
+			expected: codes.InvalidArgument,
+		},
+		{
+			name:     "Set with a negative ttl",
+			call:     func() error { _, err := c.Set(ctx, &kvdbv1.SetRequest{Key: "a", TtlMs: -1}); return err },
+			expected: codes.InvalidArgument,
+		},
+		{
+			name:     "Set with a ttl too large for a duration",
+			call:     func() error { _, err := c.Set(ctx, &kvdbv1.SetRequest{Key: "a", TtlMs: math.MaxInt64}); return err },
+			expected: codes.InvalidArgument,
+		},
+		{
+			name:     "Set when the database is full",
+			call:     func() error { _, err := c.Set(ctx, &kvdbv1.SetRequest{Key: "b"}); return err },
+			expected: codes.ResourceExhausted,
+		},
+		{
+			name:     "Empty BatchSet",
+			call:     func() error { _, err := c.BatchSet(ctx, &kvdbv1.BatchSetRequest{}); return err },
+			expected: codes.InvalidArgument,
+		},
+		{
+			name: "ListKeys with too large a page",
+			call: func() error {
+				stream, err := c.ListKeys(ctx, &kvdbv1.ListKeysRequest{PageSize: maxPageSize + 1})
+				if err != nil {
+					return err
+				}
+				_, err = stream.Recv()
+				return err
+			},
+			expected: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := status.Code(tc.call()); code != tc.expected {
+				t.Errorf("got %s, want %s", code, tc.expected)
+			}
+		})
+	}
+}
+
+func TestStoreError(t *testing.T) {
+	tt := []struct {
+		name     string
+		err      error
+		expected codes.Code
+	}{
+		{name: "full database should be resource exhausted", err: db.ErrOutOfMemory, expected: codes.ResourceExhausted},
+		{name: "follower should be unavailable", err: cluster.ErrNotLeader, expected: codes.Unavailable},
+		{name: "replica should fail its precondition", err: replication.ErrReadOnly, expected: codes.FailedPrecondition},
+		{name: "anything else should be internal", err: errors.New("disk on fire"), expected: codes.Internal},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := status.Code(NewService(nil, slog.New(slog.DiscardHandler)).storeError(context.Background(), "putting kv pair", tc.err)); code != tc.expected {
+				t.Errorf("got %s, want %s", code, tc.expected)
+			}
+		})
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	c, d := newTestClient(t)
+
+	for i := 0; i < 25; i++ {
+		_ = d.Set("user:"+strconv.Itoa(100+i), "value")
+	}
+	_ = d.Set("order:1", "value")
+
+	stream, err := c.ListKeys(context.Background(), &kvdbv1.ListKeysRequest{Prefix: "user:", PageSize: 10})
+	if err != nil {
+		t.Fatalf("ListKeys returned an error: %s", err)
+	}
+
+	var pages []int
+	var keys []string
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv returned an error: %s", err)
+		}
+		pages = append(pages, len(resp.GetKeys()))
+		keys = append(keys, resp.GetKeys()...)
+	}
+
+	if !reflect.DeepEqual(pages, []int{10, 10, 5}) {
+		t.Errorf("got pages of %v, want [10 10 5]", pages)
+	}
+
+	if len(keys) != 25 || keys[0] != "user:100" || keys[24] != "user:124" {
+		t.Errorf("got keys %v", keys)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	c, d := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := c.BatchSet(ctx, &kvdbv1.BatchSetRequest{Items: []*kvdbv1.SetRequest{
+		{Key: "a", Value: &kvdbv1.Value{Data: []byte("1")}},
+		{Key: "b", Value: &kvdbv1.Value{Data: []byte("2")}},
+	}})
+	if err != nil {
+		t.Fatalf("BatchSet returned an error: %s", err)
+	}
+
+	resp, err := c.BatchGet(ctx, &kvdbv1.BatchGetRequest{Keys: []string{"b", "missing", "a"}})
+	if err != nil {
+		t.Fatalf("BatchGet returned an error: %s", err)
+	}
+
+	var got []string
+	for _, r := range resp.GetResults() {
+		got = append(got, r.GetKey()+"="+string(r.GetValue().GetData()))
+	}
+	if !reflect.DeepEqual(got, []string{"b=2", "missing=", "a=1"}) {
+		t.Errorf("BatchGet returned %v", got)
+	}
+
+	_, err = c.BatchDelete(ctx, &kvdbv1.BatchDeleteRequest{Keys: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("BatchDelete returned an error: %s", err)
+	}
+
+	if keys, _ := d.GetAllKeys(); len(keys) != 0 {
+		t.Errorf("BatchDelete left %v", keys)
+	}
+}
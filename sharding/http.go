@@ -0,0 +1,488 @@
+package sharding
+
+import (
+	"KeyValueDB/auth"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	// forwardedHeader marks a request forwarded from another member, which is never forwarded again. It does not make a member serve keys
+	// it does not own, since a client could send it too: a member that disagrees with the sender about the owner answers 503 instead.
+	forwardedHeader = "X-Forwarded-By-Node"
+
+	//Scan page size when none is given, as in the handlers package.
+	defaultScanLimit = 1000
+)
+
+// Handler serves the key-value API from h, which should be backed by this node's database, forwarding requests for keys owned by other members to them.
+// GET / is sent to every member and the listings are merged. A transaction is forwarded to the member owning its keys, and rejected if they belong to several.
+func (n *Node) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys, err := requestKeys(r)
+		if err != nil {
+			http.Error(w, "error - invalid transaction body", http.StatusBadRequest)
+			return
+		}
+
+		forwarded := r.Header.Get(forwardedHeader) != ""
+		if forwarded && len(keys) == 0 {
+			n.serveLocal(h, w, r, keys)
+			return
+		}
+
+		if r.URL.Path == "/" {
+			if r.Method == http.MethodGet {
+				if !auth.Forwardable(r) {
+					http.Error(w, "error - listing every shard needs an API key or token", http.StatusForbidden)
+					return
+				}
+				n.fanOut(h, w, r)
+				return
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var owner Member
+		for i, k := range keys {
+			m, _ := n.Owner(k)
+			if i > 0 && m.ID != owner.ID {
+				http.Error(w, "error - transaction keys belong to different shards", http.StatusBadRequest)
+				return
+			}
+			owner = m
+		}
+
+		if len(keys) == 0 || owner.ID == n.cfg.ID {
+			n.serveLocal(h, w, r, keys)
+			return
+		}
+		if forwarded {
+			http.Error(w, "error - members disagree about the owner, try again", http.StatusServiceUnavailable)
+			return
+		}
+
+		n.forward(w, r, owner)
+	})
+}
+
+// requestKeys returns the keys a request reads or writes: the key in its path, or those of a transaction's operations.
+// The body of a transaction is read and replaced, so it can still be served or forwarded.
+func requestKeys(r *http.Request) ([]string, error) {
+	if r.URL.Path != "/_txn" {
+		if r.URL.Path == "/" {
+			return []string{}, nil
+		}
+		return []string{r.URL.Path[1:]}, nil
+	}
+
+	if r.Method != http.MethodPost {
+		return []string{}, nil
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+
+	var txn struct {
+		Ops []struct {
+			Key string `json:"key"`
+		} `json:"ops"`
+	}
+	err = json.Unmarshal(b, &txn)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(txn.Ops))
+	for i, op := range txn.Ops {
+		keys[i] = op.Key
+	}
+	return keys, nil
+}
+
+// serveLocal serves r from this node's database, first pulling in any of keys that are still on their previous owner.
+func (n *Node) serveLocal(h http.Handler, w http.ResponseWriter, r *http.Request, keys []string) {
+	err := n.prepare(r.Context(), keys)
+	if err != nil {
+		http.Error(w, "error - rebalancing, try again", http.StatusServiceUnavailable)
+		n.logger.ErrorContext(r.Context(), "fetching keys from their previous owner", "err", err)
+		return
+	}
+
+	h.ServeHTTP(w, r)
+}
+
+// forward proxies r to the member that owns its keys, or redirects a client that the owner must authenticate by its certificate.
+func (n *Node) forward(w http.ResponseWriter, r *http.Request, owner Member) {
+	target, err := url.Parse(owner.Addr)
+	if err != nil {
+		http.Error(w, "error - forwarding to owner", http.StatusBadGateway)
+		n.logger.ErrorContext(r.Context(), "parsing owner address", "owner", owner.ID, "err", err)
+		return
+	}
+
+	if !auth.Forwardable(r) {
+		u := *target
+		u.Path, u.RawPath, u.RawQuery = r.URL.Path, r.URL.RawPath, r.URL.RawQuery
+		http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set(forwardedHeader, n.cfg.ID)
+		},
+		Transport: n.client.Transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, "error - forwarding to owner", http.StatusBadGateway)
+			n.logger.ErrorContext(r.Context(), "forwarding to owner", "owner", owner.ID, "err", err)
+		},
+	}
+	proxy.ServeHTTP(w, r.WithContext(auth.Proxied(r.Context())))
+}
+
+type scanResponse struct {
+	Keys   []string `json:"keys"`
+	Cursor string   `json:"cursor,omitempty"`
+}
+
+// listing is one member's answer to GET /.
+type listing struct {
+	member Member
+	status int
+	body   []byte
+	err    error
+}
+
+// fanOut sends GET / to every member and merges their keys. Each member holds a disjoint share, so the merged listing is sorted and de-duplicated
+// only to hide keys that are briefly on two members while they move. A scan is merged into a single page that continues after the last key it returns.
+func (n *Node) fanOut(h http.Handler, w http.ResponseWriter, r *http.Request) {
+	members := n.Topology().Members
+
+	listings := make([]listing, len(members))
+	var wg sync.WaitGroup
+	for i, m := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if m.ID == n.cfg.ID {
+				listings[i] = n.listLocal(h, r, m)
+				return
+			}
+			listings[i] = n.listRemote(r, m)
+		}()
+	}
+	wg.Wait()
+
+	for _, l := range listings {
+		if l.err != nil {
+			http.Error(w, "error - listing keys on "+l.member.ID, http.StatusBadGateway)
+			n.logger.ErrorContext(r.Context(), "listing keys", "member", l.member.ID, "err", l.err)
+			return
+		}
+		//Every member validates the query the same way, so a client error is passed on as is.
+		if l.status != http.StatusOK {
+			w.WriteHeader(l.status)
+			_, _ = w.Write(l.body)
+			return
+		}
+	}
+
+	var resp interface{}
+	var err error
+	if isScan(r) {
+		resp, err = mergeScans(r, listings)
+	} else {
+		resp, err = mergeKeys(listings)
+	}
+	if err != nil {
+		http.Error(w, "error - merging listings", http.StatusBadGateway)
+		n.logger.ErrorContext(r.Context(), "merging listings", "err", err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		http.Error(w, "error - encoding response", http.StatusInternalServerError)
+		n.logger.ErrorContext(r.Context(), "encoding response", "err", err)
+		return
+	}
+}
+
+func (n *Node) listLocal(h http.Handler, r *http.Request, m Member) listing {
+	rec := &recorder{header: make(http.Header), status: http.StatusOK}
+	h.ServeHTTP(rec, r)
+	return listing{member: m, status: rec.status, body: rec.body.Bytes()}
+}
+
+func (n *Node) listRemote(r *http.Request, m Member) listing {
+	req, err := http.NewRequestWithContext(auth.Proxied(r.Context()), http.MethodGet, memberURL(m, "/", r.URL.RawQuery), nil)
+	if err != nil {
+		return listing{member: m, err: err}
+	}
+	//Sent with the client's headers, so that the member authenticates the client rather than this node, and lists only the keys the client may see.
+	req.Header = r.Header.Clone()
+	req.Header.Set(forwardedHeader, n.cfg.ID)
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return listing{member: m, err: err}
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	return listing{member: m, status: res.StatusCode, body: b, err: err}
+}
+
+func mergeKeys(listings []listing) ([]string, error) {
+	seen := make(map[string]struct{})
+	keys := make([]string, 0)
+	for _, l := range listings {
+		var ks []string
+		err := json.Unmarshal(l.body, &ks)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", l.member.ID, err)
+		}
+		for _, k := range ks {
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// mergeScans merges the members' pages of a scan. A member with more keys may have unreturned keys before the last key of another member's page,
+// so the merged page stops at the earliest last key among them, and continues from there.
+func mergeScans(r *http.Request, listings []listing) (scanResponse, error) {
+	limit := defaultScanLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, _ = strconv.Atoi(v)
+	}
+
+	seen := make(map[string]struct{})
+	keys := make([]string, 0)
+	more := false
+	cutoff := ""
+	for _, l := range listings {
+		var page scanResponse
+		err := json.Unmarshal(l.body, &page)
+		if err != nil {
+			return scanResponse{}, fmt.Errorf("%s: %w", l.member.ID, err)
+		}
+
+		for _, k := range page.Keys {
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				keys = append(keys, k)
+			}
+		}
+
+		if page.Cursor != "" && len(page.Keys) > 0 {
+			last := page.Keys[len(page.Keys)-1]
+			if !more || last < cutoff {
+				cutoff = last
+			}
+			more = true
+		}
+	}
+	sort.Strings(keys)
+
+	if more {
+		i := sort.SearchStrings(keys, cutoff)
+		keys = keys[:i+1]
+	}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		more = true
+	}
+
+	resp := scanResponse{Keys: keys}
+	if more {
+		resp.Cursor = base64.RawURLEncoding.EncodeToString([]byte(keys[len(keys)-1]))
+	}
+	return resp, nil
+}
+
+// isScan reports whether a GET / asks for a page of keys rather than every key, as in the handlers package.
+func isScan(r *http.Request) bool {
+	q := r.URL.Query()
+	for _, p := range []string{"prefix", "start", "end", "limit", "cursor"} {
+		if q.Has(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// recorder buffers the response to a request served locally as part of a fan-out.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header         { return rec.header }
+func (rec *recorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
+func (rec *recorder) WriteHeader(status int)      { rec.status = status }
+
+// StatusHandler reports the node's status on GET, and changes the members on PUT with a body such as {"members": [{"id": "n1", "addr": "http://10.0.0.1:8080"}]}.
+func (n *Node) StatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			status, err := n.Status()
+			if err != nil {
+				http.Error(w, "error - getting status", http.StatusInternalServerError)
+				n.logger.ErrorContext(r.Context(), "getting shard status", "err", err)
+				return
+			}
+			n.writeJSON(w, r, status)
+		case http.MethodPut:
+			var req struct {
+				Members []Member `json:"members"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, "error - invalid members", http.StatusBadRequest)
+				return
+			}
+
+			t, err := n.SetMembers(r.Context(), req.Members)
+			if errors.Is(err, ErrInvalidMember) {
+				http.Error(w, "error - "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "error - sending topology: "+err.Error(), http.StatusBadGateway)
+				n.logger.ErrorContext(r.Context(), "sending topology", "err", err)
+				return
+			}
+			n.writeJSON(w, r, t)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// TopologyHandler adopts a topology sent by another member's SetMembers on PUT.
+func (n *Node) TopologyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var change topologyChange
+		err := json.NewDecoder(r.Body).Decode(&change)
+		if err != nil {
+			http.Error(w, "error - invalid topology", http.StatusBadRequest)
+			return
+		}
+
+		err = n.adopt(change)
+		if errors.Is(err, ErrStaleTopology) {
+			http.Error(w, "error - "+err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "error - "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+}
+
+// TransferHandler sends the keys held here that another member has gained, on GET, for the to member and epoch given in the query.
+// With key parameters only those keys are sent; otherwise a page of keys after the after parameter.
+// Returns 409 if this node's topology is not at epoch.
+func (n *Node) TransferHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		epoch, err := strconv.ParseUint(q.Get("epoch"), 10, 64)
+		if err != nil || q.Get("to") == "" {
+			http.Error(w, "error - to and epoch are required", http.StatusBadRequest)
+			return
+		}
+
+		var keys []string
+		if q.Has("key") {
+			keys = q["key"]
+		}
+
+		page, err := n.export(q.Get("to"), epoch, keys, q.Get("after"))
+		if errors.Is(err, ErrStaleTopology) {
+			http.Error(w, "error - "+err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "error - reading keys", http.StatusInternalServerError)
+			n.logger.ErrorContext(r.Context(), "exporting keys", "err", err)
+			return
+		}
+
+		n.writeJSON(w, r, page)
+	}
+}
+
+// ReleaseHandler deletes the keys held here that another member has finished pulling, on POST, for the to member and epoch given in the query.
+// Returns 409 if this node's topology is not at epoch.
+func (n *Node) ReleaseHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		epoch, err := strconv.ParseUint(q.Get("epoch"), 10, 64)
+		if err != nil || q.Get("to") == "" {
+			http.Error(w, "error - to and epoch are required", http.StatusBadRequest)
+			return
+		}
+
+		dropped, err := n.drop(q.Get("to"), epoch)
+		if errors.Is(err, ErrStaleTopology) {
+			http.Error(w, "error - "+err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "error - deleting keys", http.StatusInternalServerError)
+			n.logger.ErrorContext(r.Context(), "releasing keys", "err", err)
+			return
+		}
+
+		n.logger.InfoContext(r.Context(), "released pulled keys", "to", q.Get("to"), "keys", dropped)
+	}
+}
+
+func (n *Node) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		n.logger.ErrorContext(r.Context(), "encoding response", "err", err)
+	}
+}
@@ -0,0 +1,403 @@
+package sharding
+
+import (
+	"KeyValueDB/auth"
+	"KeyValueDB/certs"
+	"KeyValueDB/rbac"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %s", url, err)
+	}
+	defer res.Body.Close()
+
+	b, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(b)
+}
+
+func TestHandlerForwardsToOwner(t *testing.T) {
+	nodes := newTestDeployment(t, nil, []string{"n1", "n2", "n3"})
+	keys := testKeys(30)
+
+	for i, k := range keys {
+		put(t, nodes[[]string{"n1", "n2", "n3"}[i%3]].server.URL+"/"+k, "v-"+k)
+	}
+
+	for _, k := range keys {
+		owner, _ := nodes["n1"].node.Owner(k)
+		if ids := holders(nodes)[k]; !reflect.DeepEqual(ids, []string{owner.ID}) {
+			t.Errorf("%s is held by %v, expected only its owner %s", k, ids, owner.ID)
+		}
+
+		for id, tn := range nodes {
+			status, body := get(t, tn.server.URL+"/"+k)
+			if status != http.StatusOK || body != "v-"+k {
+				t.Errorf("GET %s through %s returned %d %q", k, id, status, body)
+			}
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, nodes["n1"].server.URL+"/"+keys[0], nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE returned %v, %v", res, err)
+	}
+	res.Body.Close()
+
+	if status, _ := get(t, nodes["n2"].server.URL+"/"+keys[0]); status != http.StatusNotFound {
+		t.Errorf("GET of a deleted key returned %d, expected 404", status)
+	}
+}
+
+func TestHandlerIgnoresClientForwardedHeader(t *testing.T) {
+	nodes := newTestDeployment(t, nil, []string{"n1", "n2"})
+
+	var key string
+	for _, k := range testKeys(100) {
+		if owner, _ := nodes["n1"].node.Owner(k); owner.ID == "n2" {
+			key = k
+			break
+		}
+	}
+
+	//A client claiming the request was forwarded must not have it stored on a member that does not own the key.
+	req, _ := http.NewRequest(http.MethodPut, nodes["n1"].server.URL+"/"+key, strings.NewReader("value"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set(forwardedHeader, "n2")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("PUT with a forged %s returned %d, expected 503", forwardedHeader, res.StatusCode)
+	}
+	if ids := holders(nodes)[key]; len(ids) != 0 {
+		t.Errorf("%s was stored on %v, expected nowhere", key, ids)
+	}
+}
+
+func TestHandlerListsEveryMember(t *testing.T) {
+	nodes := newTestDeployment(t, nil, []string{"n1", "n2", "n3"})
+	keys := testKeys(50)
+	for _, k := range keys {
+		put(t, nodes["n1"].server.URL+"/"+k, "v")
+	}
+	sort.Strings(keys)
+
+	t.Run("GET / should return every key", func(t *testing.T) {
+		status, body := get(t, nodes["n2"].server.URL+"/")
+		var got []string
+		_ = json.Unmarshal([]byte(body), &got)
+		if status != http.StatusOK || !reflect.DeepEqual(got, keys) {
+			t.Errorf("GET / returned %d %v, expected every key in order", status, got)
+		}
+	})
+
+	t.Run("scan should page through every key once, in order", func(t *testing.T) {
+		got := make([]string, 0)
+		cursor := ""
+		for pages := 0; pages < 50; pages++ {
+			url := nodes["n3"].server.URL + "/?limit=7"
+			if cursor != "" {
+				url += "&cursor=" + cursor
+			}
+			status, body := get(t, url)
+			if status != http.StatusOK {
+				t.Fatalf("GET %s returned %d %s", url, status, body)
+			}
+
+			var page scanResponse
+			_ = json.Unmarshal([]byte(body), &page)
+			if len(page.Keys) == 0 || len(page.Keys) > 7 {
+				t.Fatalf("page has %d keys, expected 1 to 7", len(page.Keys))
+			}
+			got = append(got, page.Keys...)
+
+			cursor = page.Cursor
+			if cursor == "" {
+				break
+			}
+		}
+
+		if !reflect.DeepEqual(got, keys) {
+			t.Errorf("scan returned %v, expected %v", got, keys)
+		}
+	})
+
+	t.Run("scan prefix should be applied on every member", func(t *testing.T) {
+		status, body := get(t, nodes["n1"].server.URL+"/?prefix=user:1")
+		var page scanResponse
+		_ = json.Unmarshal([]byte(body), &page)
+
+		expected := make([]string, 0)
+		for _, k := range keys {
+			if strings.HasPrefix(k, "user:1") {
+				expected = append(expected, k)
+			}
+		}
+		if status != http.StatusOK || !reflect.DeepEqual(page.Keys, expected) || page.Cursor != "" {
+			t.Errorf("GET /?prefix=user:1 returned %d %+v, expected %v", status, page, expected)
+		}
+	})
+
+	t.Run("invalid scan should be rejected", func(t *testing.T) {
+		if status, _ := get(t, nodes["n1"].server.URL+"/?limit=0"); status != http.StatusBadRequest {
+			t.Errorf("GET /?limit=0 returned %d, expected 400", status)
+		}
+	})
+}
+
+// headerRecorder records the headers of the listings a member sends to the others.
+type headerRecorder struct {
+	lock    sync.Mutex
+	headers []http.Header
+}
+
+func (hr *headerRecorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Path == "/" {
+		hr.lock.Lock()
+		hr.headers = append(hr.headers, r.Header.Clone())
+		hr.lock.Unlock()
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestHandlerListsWithClientHeaders(t *testing.T) {
+	recorder := &headerRecorder{}
+	nodes := newTestDeployment(t, recorder, []string{"n1", "n2", "n3"})
+
+	req, _ := http.NewRequest(http.MethodGet, nodes["n1"].server.URL+"/", nil)
+	req.Header.Set("X-API-Key", "client-key")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if len(recorder.headers) != 2 {
+		t.Fatalf("%d listings were sent, expected one to each other member", len(recorder.headers))
+	}
+	for _, h := range recorder.headers {
+		//So that each member lists the keys the client may see, rather than this node.
+		if h.Get("X-API-Key") != "client-key" || h.Get(forwardedHeader) != "n1" {
+			t.Errorf("listing was sent with headers %v", h)
+		}
+	}
+}
+
+// certificateHeader stands in for the certificate a client presents over TLS, from which a member takes the client's identity.
+const certificateHeader = "X-Test-Certificate"
+
+// nodeCertificate presents the node's own certificate on every request a member sends, as the TLS transport between members does.
+type nodeCertificate struct{}
+
+func (nodeCertificate) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(certificateHeader, "node")
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestHandlerCertificateClients(t *testing.T) {
+	authenticator := auth.NewAuthenticator(auth.Config{
+		APIKeys:      auth.APIKeys{auth.HashAPIKey("peer-key"): "peer", auth.HashAPIKey("writer-key"): "writer"},
+		Certificates: true,
+	})
+	all := []rbac.Permission{rbac.Read, rbac.Write, rbac.Delete, rbac.List}
+	policy := &rbac.Policy{
+		Roles: map[string]rbac.Role{
+			"reader": {Grants: []rbac.Grant{{Pattern: "*", Permissions: []rbac.Permission{rbac.Read}}}},
+			"writer": {Grants: []rbac.Grant{{Pattern: "*", Permissions: all}}},
+			"node":   {Admin: true, Grants: []rbac.Grant{{Pattern: "*", Permissions: all}}},
+		},
+		Bindings: map[string][]string{
+			"certificate:reader": {"reader"},
+			"api-key:writer":     {"writer"},
+			"api-key:peer":       {"node"},
+			"certificate:node":   {"node"},
+		},
+	}
+	wrap := func(h http.Handler) http.Handler {
+		h = authenticator.Handler(policy.Handler(h), slog.New(slog.DiscardHandler))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id := r.Header.Get(certificateHeader); id != "" {
+				r = r.WithContext(certs.WithIdentity(r.Context(), certs.Identity{CommonName: id}))
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+	nodes := newWrappedTestDeployment(t, auth.Transport("peer-key", nodeCertificate{}), wrap, []string{"n1", "n2"})
+
+	//Keys owned by n2, sent to n1.
+	var keys []string
+	for _, k := range testKeys(100) {
+		if owner, _ := nodes["n1"].node.Owner(k); owner.ID == "n2" {
+			keys = append(keys, k)
+		}
+	}
+	readerKey, writerKey := keys[0], keys[1]
+	n1, n2 := nodes["n1"].server.URL, nodes["n2"].server.URL
+
+	reader := map[string]string{certificateHeader: "reader"}
+	tt := []struct {
+		name             string
+		method           string
+		url              string
+		body             string
+		header           map[string]string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name:             "write by a certificate client should be redirected to the owner",
+			method:           http.MethodPut,
+			url:              n1 + "/" + readerKey,
+			body:             "value",
+			header:           reader,
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: n2 + "/" + readerKey,
+		},
+		{
+			name:             "transaction by a certificate client should be redirected to the owner",
+			method:           http.MethodPost,
+			url:              n1 + "/_txn",
+			body:             `{"ops":[{"op":"set","key":"` + readerKey + `","value":1}]}`,
+			header:           reader,
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: n2 + "/_txn",
+		},
+		{
+			name:           "write by a certificate client should be refused by the owner",
+			method:         http.MethodPut,
+			url:            n2 + "/" + readerKey,
+			body:           "value",
+			header:         reader,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "listing by a certificate client should be refused",
+			method:         http.MethodGet,
+			url:            n1 + "/",
+			header:         reader,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "write with an API key should be forwarded to the owner",
+			method:         http.MethodPut,
+			url:            n1 + "/" + writerKey,
+			body:           "value",
+			header:         map[string]string{auth.APIKeyHeader: "writer-key"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "text/plain")
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tc.expectedStatus {
+				t.Errorf("returned %d, expected %d", res.StatusCode, tc.expectedStatus)
+			}
+			if loc := res.Header.Get("Location"); loc != tc.expectedLocation {
+				t.Errorf("redirected to %q, expected %q", loc, tc.expectedLocation)
+			}
+		})
+	}
+
+	if ids := holders(nodes)[readerKey]; len(ids) != 0 {
+		t.Errorf("%s was written to %v by a client that may only read", readerKey, ids)
+	}
+	if ids := holders(nodes)[writerKey]; !reflect.DeepEqual(ids, []string{"n2"}) {
+		t.Errorf("%s is held by %v, expected only its owner n2", writerKey, ids)
+	}
+}
+
+func TestHandlerRoutesTransactions(t *testing.T) {
+	nodes := newTestDeployment(t, nil, []string{"n1", "n2"})
+
+	//Two keys on n2, and one on n1.
+	var same []string
+	var other string
+	for _, k := range testKeys(100) {
+		owner, _ := nodes["n1"].node.Owner(k)
+		if owner.ID == "n2" && len(same) < 2 {
+			same = append(same, k)
+		}
+		if owner.ID == "n1" && other == "" {
+			other = k
+		}
+	}
+
+	txn := func(keys ...string) int {
+		ops := make([]string, len(keys))
+		for i, k := range keys {
+			ops[i] = `{"op":"set","key":"` + k + `","value":1}`
+		}
+		res, err := http.Post(nodes["n1"].server.URL+"/_txn", "application/json", strings.NewReader(`{"ops":[`+strings.Join(ops, ",")+`]}`))
+		if err != nil {
+			t.Fatalf("POST /_txn: %s", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if status := txn(same...); status != http.StatusOK {
+		t.Errorf("transaction on one shard returned %d, expected 200", status)
+	}
+	if v, _ := nodes["n2"].database.Get(same[0]); v != 1.0 {
+		t.Errorf("%s is %v on its owner, expected 1", same[0], v)
+	}
+
+	if status := txn(same[0], other); status != http.StatusBadRequest {
+		t.Errorf("transaction across shards returned %d, expected 400", status)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	nodes := newTestDeployment(t, nil, []string{"n1", "n2"})
+
+	status, body := get(t, nodes["n1"].server.URL+"/_shards")
+	var s Status
+	_ = json.Unmarshal([]byte(body), &s)
+	if status != http.StatusOK || s.ID != "n1" || len(s.Members) != 2 || s.Rebalancing {
+		t.Errorf("GET /_shards returned %d %+v", status, s)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, nodes["n1"].server.URL+"/_shards", strings.NewReader(`{"members":[]}`))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /_shards: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("PUT /_shards with no members returned %d, expected 400", res.StatusCode)
+	}
+}
@@ -0,0 +1,726 @@
+package sharding
+
+import (
+	"KeyValueDB/db"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//Keys sent per request when moving keys between nodes.
+	transferBatch = 500
+)
+
+// DefaultTimeout bounds each request of the default client that nodes forward requests and move keys with.
+const DefaultTimeout = 30 * time.Second
+
+// retryInterval is how long a rebalance waits before retrying a node that could not be reached, or that has not yet adopted the new topology.
+var retryInterval = time.Second
+
+var (
+	// ErrInvalidMember is returned, wrapped, by ParseMembers and SetMembers for a malformed member.
+	ErrInvalidMember = errors.New("invalid member")
+	// ErrStaleTopology is returned, wrapped, when a node is sent a topology older than its own, or asked to move keys for a topology it does not have.
+	ErrStaleTopology = errors.New("stale topology")
+)
+
+// Topology is the members that keys are partitioned across. Each change increases Epoch, and a node only adopts a topology newer than its own.
+type Topology struct {
+	Epoch   uint64   `json:"epoch"`
+	Members []Member `json:"members"`
+}
+
+// topologyChange is sent to every member by SetMembers. It carries the members before the change, which a member that is joining
+// does not know but needs in order to work out which keys it gains.
+type topologyChange struct {
+	Topology
+	Previous []Member `json:"previous"`
+}
+
+// Config configures a Node.
+type Config struct {
+	ID string
+
+	//Every member that the keys are partitioned across, including this node. Every member must start with the same members,
+	//except that a member being added to an existing deployment starts with only itself, and is then added with SetMembers.
+	Members []Member
+
+	//Points each member has on the ring. Defaults to DefaultVirtualNodes, and must be the same on every member.
+	VirtualNodes int
+
+	//Used to forward requests and move keys between members. Defaults to a client with DefaultTimeout.
+	Client *http.Client
+
+	//Directory the topology is kept in, so that changes to the members survive a restart. Once a topology has been saved there,
+	//Members is only checked for this node. Nothing is kept if empty.
+	Dir string
+}
+
+// ParseMembers parses a comma separated list of members in the form id=httpaddr, such as n1=http://10.0.0.1:8080.
+// An HTTP address without a scheme is taken to be http.
+func ParseMembers(s string) ([]Member, error) {
+	members := make([]Member, 0)
+	if strings.TrimSpace(s) == "" {
+		return members, nil
+	}
+
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		id, addr, ok := strings.Cut(m, "=")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("%w: %q must be id=httpaddr", ErrInvalidMember, m)
+		}
+		if !strings.Contains(addr, "://") {
+			addr = "http://" + addr
+		}
+
+		members = append(members, Member{ID: id, Addr: addr})
+	}
+
+	return members, nil
+}
+
+func validateMembers(members []Member) error {
+	if len(members) == 0 {
+		return fmt.Errorf("%w: at least one member is required", ErrInvalidMember)
+	}
+
+	seen := make(map[string]bool, len(members))
+	for _, m := range members {
+		if m.ID == "" {
+			return fmt.Errorf("%w: member with no id", ErrInvalidMember)
+		}
+		if seen[m.ID] {
+			return fmt.Errorf("%w: %s is listed twice", ErrInvalidMember, m.ID)
+		}
+		seen[m.ID] = true
+
+		u, err := url.Parse(m.Addr)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%w: %s has address %q, which is not a URL", ErrInvalidMember, m.ID, m.Addr)
+		}
+	}
+	return nil
+}
+
+// Node is a member of a deployment that partitions keys across its members by consistent hashing, each member storing its share in its own database.
+// Requests for a key are served by the member that owns it, and any member forwards them there. Listings fan out to every member.
+//
+// When the members change, each member pulls the keys it has gained from their previous owners, and only those: keys whose owner is unchanged stay where they are.
+// Until it has them all, a member fetches each key it is asked for from the previous owner before serving it, so clients see no gap while keys move.
+type Node struct {
+	cfg      Config
+	database *db.Database
+	client   *http.Client
+	logger   *slog.Logger
+
+	lock     sync.RWMutex
+	topology Topology
+	ring     *Ring
+
+	//While rebalancing: the ring before the change, the previous owners still to pull keys from,
+	//and the keys that have already been pulled or written here, which must not be overwritten by a late pull.
+	prev    *Ring
+	sources map[string]Member
+	claimed map[string]struct{}
+
+	//Cancels the running rebalance.
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewNode serves database's share of the keys partitioned across cfg.Members. Errors and rebalancing are logged to logger.
+func NewNode(database *db.Database, cfg Config, logger *slog.Logger) (*Node, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("node id is required")
+	}
+
+	err := validateMembers(cfg.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := NewRing(cfg.Members, cfg.VirtualNodes)
+	if _, ok := ring.Member(cfg.ID); !ok {
+		return nil, fmt.Errorf("%w: %s is not one of the members", ErrInvalidMember, cfg.ID)
+	}
+
+	saved, err := loadState(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	n := &Node{
+		cfg:      cfg,
+		database: database,
+		client:   client,
+		logger:   logger,
+		topology: Topology{Members: ring.Members()},
+		ring:     ring,
+	}
+	if saved.Epoch > 0 {
+		n.restore(saved)
+	}
+	return n, nil
+}
+
+// restore switches to the topology saved before a restart, and resumes any rebalance that had not finished.
+func (n *Node) restore(s state) {
+	n.ring = NewRing(s.Members, n.cfg.VirtualNodes)
+	n.topology = Topology{Epoch: s.Epoch, Members: n.ring.Members()}
+	n.logger.Info("restored topology", "epoch", s.Epoch, "members", len(s.Members), "sources", len(s.Sources))
+	if len(s.Previous) == 0 || len(s.Sources) == 0 {
+		return
+	}
+
+	n.prev = NewRing(s.Previous, n.cfg.VirtualNodes)
+	n.sources = make(map[string]Member, len(s.Sources))
+	n.claimed = make(map[string]struct{})
+	for _, m := range s.Sources {
+		n.sources[m.ID] = m
+	}
+	n.startRebalance(s.Epoch)
+}
+
+// Close stops any rebalance in progress.
+func (n *Node) Close() {
+	n.lock.Lock()
+	if n.cancel != nil {
+		n.cancel()
+	}
+	n.lock.Unlock()
+
+	n.wg.Wait()
+}
+
+func (n *Node) ID() string {
+	return n.cfg.ID
+}
+
+// Topology returns the members the keys are currently partitioned across.
+func (n *Node) Topology() Topology {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.topology
+}
+
+// Owner returns the member that owns key, and whether that is this node.
+func (n *Node) Owner(key string) (Member, bool) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	m, _ := n.ring.Owner(key)
+	return m, m.ID == n.cfg.ID
+}
+
+// SetMembers changes the members that keys are partitioned across, sending the new topology to every old and new member, which then rebalance.
+// It fails if any member could not be reached, in which case calling it again with the same members sends the topology again.
+func (n *Node) SetMembers(ctx context.Context, members []Member) (Topology, error) {
+	err := validateMembers(members)
+	if err != nil {
+		return Topology{}, err
+	}
+
+	n.lock.RLock()
+	current := n.topology
+	n.lock.RUnlock()
+
+	t := Topology{Epoch: current.Epoch + 1, Members: NewRing(members, 1).Members()}
+
+	//Members that are leaving are told too, so they stop serving keys they no longer own.
+	notify := make(map[string]Member)
+	for _, m := range current.Members {
+		notify[m.ID] = m
+	}
+	for _, m := range t.Members {
+		notify[m.ID] = m
+	}
+
+	errs := make([]error, 0)
+	change := topologyChange{Topology: t, Previous: current.Members}
+	for _, m := range notify {
+		if m.ID == n.cfg.ID {
+			continue
+		}
+		err := n.sendTopology(ctx, m, change)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.ID, err))
+		}
+	}
+
+	//Adopted last, so that this node's own epoch only moves on once the others have it and it can be retried.
+	if len(errs) > 0 {
+		return t, errors.Join(errs...)
+	}
+	return t, n.adopt(change)
+}
+
+func (n *Node) sendTopology(ctx context.Context, m Member, change topologyChange) error {
+	body, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, memberURL(m, "/_shards/topology", ""), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("sending topology: %s", res.Status)
+	}
+	return nil
+}
+
+// adopt switches to the changed topology if it is newer than the current one, and starts pulling in the keys this node has gained.
+// Adopting the current topology again is a no-op. An older topology fails with ErrStaleTopology.
+func (n *Node) adopt(change topologyChange) error {
+	t := change.Topology
+	err := validateMembers(t.Members)
+	if err != nil {
+		return err
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if t.Epoch < n.topology.Epoch {
+		return fmt.Errorf("%w: epoch %d is older than %d", ErrStaleTopology, t.Epoch, n.topology.Epoch)
+	}
+	if t.Epoch == n.topology.Epoch {
+		return nil
+	}
+
+	ring := NewRing(t.Members, n.cfg.VirtualNodes)
+	prev := n.ring
+	if len(change.Previous) > 0 {
+		prev = NewRing(change.Previous, n.cfg.VirtualNodes)
+	}
+
+	//Keys may still be waiting on the owners of an unfinished rebalance, so those are pulled from as well.
+	sources := make(map[string]Member, len(n.sources))
+	for id, m := range n.sources {
+		sources[id] = m
+	}
+	for _, id := range gained(prev, ring, n.cfg.ID) {
+		m, _ := prev.Member(id)
+		sources[id] = m
+	}
+
+	//Saved before it is adopted, so that a node never goes back to an older topology when it restarts.
+	topology := Topology{Epoch: t.Epoch, Members: ring.Members()}
+	err = saveState(n.cfg.Dir, state{Topology: topology, Previous: prev.Members(), Sources: sortedMembers(sources)})
+	if err != nil {
+		return err
+	}
+
+	if n.cancel != nil {
+		n.cancel()
+	}
+	if n.claimed == nil {
+		n.claimed = make(map[string]struct{})
+	}
+	n.prev, n.ring, n.topology, n.sources = prev, ring, topology, sources
+	n.logger.Info("adopted topology", "epoch", t.Epoch, "members", len(t.Members), "sources", len(n.sources))
+
+	n.startRebalance(t.Epoch)
+	return nil
+}
+
+// startRebalance starts pulling in the keys gained at epoch. It must be called with the lock held.
+func (n *Node) startRebalance(epoch uint64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+	n.wg.Add(1)
+	go n.rebalance(ctx, epoch)
+}
+
+// rebalance pulls the keys this node gained at epoch from each of their previous owners, retrying until it has them all or the topology changes again.
+func (n *Node) rebalance(ctx context.Context, epoch uint64) {
+	defer n.wg.Done()
+
+	for {
+		n.lock.RLock()
+		sources := sortedMembers(n.sources)
+		n.lock.RUnlock()
+
+		for _, m := range sources {
+			err := n.pull(ctx, m, epoch)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				n.logger.WarnContext(ctx, "pulling keys", "member", m.ID, "err", err)
+				continue
+			}
+
+			n.lock.Lock()
+			delete(n.sources, m.ID)
+			n.lock.Unlock()
+		}
+
+		n.lock.Lock()
+		if len(n.sources) == 0 && ctx.Err() == nil {
+			n.prev, n.sources, n.claimed = nil, nil, nil
+			err := saveState(n.cfg.Dir, state{Topology: n.topology})
+			n.lock.Unlock()
+			if err != nil {
+				n.logger.ErrorContext(ctx, "saving topology", "err", err)
+			}
+			n.logger.InfoContext(ctx, "rebalanced", "epoch", epoch)
+			return
+		}
+		n.lock.Unlock()
+
+		select {
+		case <-time.After(retryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pull copies every key that m holds for this node, then has m delete them.
+func (n *Node) pull(ctx context.Context, m Member, epoch uint64) error {
+	after := ""
+	for {
+		page, err := n.fetch(ctx, m, epoch, url.Values{"after": {after}})
+		if err != nil {
+			return err
+		}
+
+		n.claim(page.Records, nil)
+
+		if page.Next == "" {
+			break
+		}
+		after = page.Next
+	}
+
+	return n.release(ctx, m, epoch)
+}
+
+// fetch requests a page of the keys that m holds for this node.
+func (n *Node) fetch(ctx context.Context, m Member, epoch uint64, q url.Values) (transferPage, error) {
+	q.Set("to", n.cfg.ID)
+	q.Set("epoch", strconv.FormatUint(epoch, 10))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, memberURL(m, "/_shards/transfer", q.Encode()), nil)
+	if err != nil {
+		return transferPage{}, err
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return transferPage{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusConflict {
+		return transferPage{}, fmt.Errorf("%w: %s has not adopted topology %d", ErrStaleTopology, m.ID, epoch)
+	}
+	if res.StatusCode != http.StatusOK {
+		return transferPage{}, fmt.Errorf("fetching keys: %s", res.Status)
+	}
+
+	var page transferPage
+	err = json.NewDecoder(res.Body).Decode(&page)
+	if err != nil {
+		return transferPage{}, fmt.Errorf("decoding keys: %w", err)
+	}
+	return page, nil
+}
+
+// release has m delete the keys it holds for this node, which this node now has.
+func (n *Node) release(ctx context.Context, m Member, epoch uint64) error {
+	q := url.Values{"to": {n.cfg.ID}, "epoch": {strconv.FormatUint(epoch, 10)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, memberURL(m, "/_shards/release", q.Encode()), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("releasing keys: %s", res.Status)
+	}
+	return nil
+}
+
+// claim stores the pulled records whose keys have not already been claimed, then marks them and keys as claimed.
+// Claimed keys are never overwritten by a later pull, so a value written here while rebalancing wins over the one being moved.
+func (n *Node) claim(records []record, keys []string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.claimed == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, rec := range records {
+		if _, ok := n.claimed[rec.Key]; ok {
+			continue
+		}
+		n.claimed[rec.Key] = struct{}{}
+
+		var ttl time.Duration
+		if rec.ExpiresAt != 0 {
+			ttl = time.Unix(0, rec.ExpiresAt).Sub(now)
+			if ttl <= 0 {
+				continue
+			}
+		}
+
+		//A version of 0 only stores the key if it does not exist here.
+		_, err := n.database.CompareAndSet(rec.Key, 0, rec.Decode(), ttl)
+		if err != nil && !errors.Is(err, db.ErrVersionMismatch) {
+			n.logger.Error("storing pulled key", "key", rec.Key, "err", err)
+		}
+	}
+
+	for _, k := range keys {
+		n.claimed[k] = struct{}{}
+	}
+}
+
+// prepare makes sure that this node has the current values of keys before it serves a request for them.
+// While rebalancing, keys that have not been claimed yet are pulled from their previous owners first.
+func (n *Node) prepare(ctx context.Context, keys []string) error {
+	n.lock.RLock()
+	if n.claimed == nil {
+		n.lock.RUnlock()
+		return nil
+	}
+	epoch, prev := n.topology.Epoch, n.prev
+	pending := make(map[string][]string)
+	for _, k := range keys {
+		if _, ok := n.claimed[k]; ok {
+			continue
+		}
+		m, _ := prev.Owner(k)
+		if m.ID != n.cfg.ID {
+			pending[m.ID] = append(pending[m.ID], k)
+		}
+	}
+	n.lock.RUnlock()
+
+	records := make([]record, 0)
+	for id, ks := range pending {
+		m, _ := prev.Member(id)
+		page, err := n.fetch(ctx, m, epoch, url.Values{"key": ks})
+		if err != nil {
+			return err
+		}
+		records = append(records, page.Records...)
+	}
+
+	n.claim(records, keys)
+	return nil
+}
+
+// record is a key being moved to another member.
+type record struct {
+	Key string `json:"key"`
+	db.EncodedValue
+
+	//Absolute expiry as Unix nanoseconds, or 0 if the key does not expire.
+	ExpiresAt int64 `json:"exp,omitempty"`
+}
+
+// transferPage is a page of the keys being moved to a member. Next is the key to continue after, or empty on the last page.
+type transferPage struct {
+	Records []record `json:"records"`
+	Next    string   `json:"next,omitempty"`
+}
+
+// export returns the keys held here that belong to member to at epoch: the given keys, or a page of every such key after after.
+func (n *Node) export(to string, epoch uint64, keys []string, after string) (transferPage, error) {
+	n.lock.RLock()
+	current, ring := n.topology.Epoch, n.ring
+	n.lock.RUnlock()
+
+	if epoch != current {
+		return transferPage{}, fmt.Errorf("%w: asked for epoch %d at %d", ErrStaleTopology, epoch, current)
+	}
+
+	owned := func(k string) bool {
+		m, _ := ring.Owner(k)
+		return m.ID == to
+	}
+
+	page := transferPage{Records: make([]record, 0)}
+	if keys != nil {
+		for _, k := range keys {
+			if !owned(k) {
+				continue
+			}
+			rec, ok, err := n.record(k)
+			if err != nil {
+				return transferPage{}, err
+			}
+			if ok {
+				page.Records = append(page.Records, rec)
+			}
+		}
+		return page, nil
+	}
+
+	for {
+		scan, err := n.database.Scan(db.ScanOptions{After: after, Limit: transferBatch})
+		if err != nil {
+			return transferPage{}, err
+		}
+
+		for _, k := range scan.Keys {
+			after = k
+			if !owned(k) {
+				continue
+			}
+			rec, ok, err := n.record(k)
+			if err != nil {
+				return transferPage{}, err
+			}
+			if ok {
+				page.Records = append(page.Records, rec)
+			}
+			if len(page.Records) == transferBatch {
+				page.Next = k
+				return page, nil
+			}
+		}
+
+		if scan.Next == "" {
+			return page, nil
+		}
+	}
+}
+
+func (n *Node) record(key string) (record, bool, error) {
+	v, _, err := n.database.GetWithVersion(key)
+	if err != nil || v == nil {
+		return record{}, false, err
+	}
+	ttl, _, err := n.database.TTL(key)
+	if err != nil {
+		return record{}, false, err
+	}
+
+	rec := record{Key: key, EncodedValue: db.EncodeValue(v)}
+	if ttl > 0 {
+		rec.ExpiresAt = time.Now().Add(ttl).UnixNano()
+	}
+	return rec, true, nil
+}
+
+// drop deletes every key held here that belongs to member to at epoch, once to has pulled them.
+func (n *Node) drop(to string, epoch uint64) (int, error) {
+	n.lock.RLock()
+	current, ring := n.topology.Epoch, n.ring
+	n.lock.RUnlock()
+
+	if epoch != current {
+		return 0, fmt.Errorf("%w: asked for epoch %d at %d", ErrStaleTopology, epoch, current)
+	}
+
+	dropped := 0
+	after := ""
+	for {
+		scan, err := n.database.Scan(db.ScanOptions{After: after, Limit: transferBatch})
+		if err != nil {
+			return dropped, err
+		}
+
+		for _, k := range scan.Keys {
+			if m, _ := ring.Owner(k); m.ID != to {
+				continue
+			}
+			err = n.database.Delete(k)
+			if err != nil {
+				return dropped, err
+			}
+			dropped++
+		}
+
+		if scan.Next == "" {
+			return dropped, nil
+		}
+		after = scan.Next
+	}
+}
+
+// Status describes the node's place in the deployment.
+type Status struct {
+	ID      string   `json:"id"`
+	Epoch   uint64   `json:"epoch"`
+	Members []Member `json:"members"`
+
+	//Keys held by this node, including any that other members are still pulling from it.
+	Keys int `json:"keys"`
+
+	Rebalancing bool     `json:"rebalancing"`
+	PullingFrom []string `json:"pullingFrom,omitempty"`
+}
+
+// Status reports the topology, how many keys this node holds, and which members it is still pulling keys from.
+func (n *Node) Status() (Status, error) {
+	keys, err := n.database.GetAllKeys()
+	if err != nil {
+		return Status{}, err
+	}
+
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	status := Status{
+		ID:          n.cfg.ID,
+		Epoch:       n.topology.Epoch,
+		Members:     n.topology.Members,
+		Keys:        len(keys),
+		Rebalancing: n.sources != nil,
+	}
+	for id := range n.sources {
+		status.PullingFrom = append(status.PullingFrom, id)
+	}
+	sort.Strings(status.PullingFrom)
+
+	return status, nil
+}
+
+// memberURL returns the URL of path on m's HTTP API.
+func memberURL(m Member, path, query string) string {
+	u, err := url.Parse(m.Addr)
+	if err != nil {
+		return m.Addr + path
+	}
+	u = u.JoinPath(path)
+	u.RawQuery = query
+	return u.String()
+}
@@ -0,0 +1,422 @@
+package sharding
+
+import (
+	"KeyValueDB/db"
+	"KeyValueDB/handlers"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	retryInterval = 10 * time.Millisecond
+}
+
+type testNode struct {
+	node     *Node
+	database *db.Database
+	server   *httptest.Server
+}
+
+// blockingTransport fails bulk key transfers while blocked, so that a rebalance cannot finish.
+type blockingTransport struct {
+	blocked atomic.Bool
+}
+
+func (b *blockingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if b.blocked.Load() && r.URL.Path == "/_shards/transfer" && !r.URL.Query().Has("key") {
+		return nil, errors.New("blocked")
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// newTestDeployment starts one member per id. Members listed in joining start alone, ready to be added with SetMembers.
+func newTestDeployment(t *testing.T, transport http.RoundTripper, ids []string, joining ...string) map[string]*testNode {
+	t.Helper()
+	return newWrappedTestDeployment(t, transport, nil, ids, joining...)
+}
+
+// newWrappedTestDeployment starts a deployment like newTestDeployment, with each member's API served through wrap if it is not nil.
+func newWrappedTestDeployment(t *testing.T, transport http.RoundTripper, wrap func(http.Handler) http.Handler, ids []string, joining ...string) map[string]*testNode {
+	t.Helper()
+
+	nodes := make(map[string]*testNode)
+	all := make([]Member, 0)
+	for _, id := range append(ids, joining...) {
+		tn := &testNode{server: httptest.NewUnstartedServer(nil)}
+		nodes[id] = tn
+		all = append(all, Member{ID: id, Addr: "http://" + tn.server.Listener.Addr().String()})
+	}
+
+	for _, m := range all {
+		tn := nodes[m.ID]
+
+		initial := make([]Member, 0)
+		for _, o := range all {
+			if o.ID == m.ID || !contains(joining, o.ID) && !contains(joining, m.ID) {
+				initial = append(initial, o)
+			}
+		}
+
+		database, err := db.NewDatabase()
+		if err != nil {
+			t.Fatalf("NewDatabase returned an error: %s", err)
+		}
+		node, err := NewNode(database, Config{ID: m.ID, Members: initial, Client: &http.Client{Transport: transport}}, slog.New(slog.DiscardHandler))
+		if err != nil {
+			t.Fatalf("NewNode returned an error: %s", err)
+		}
+		tn.node, tn.database = node, database
+
+		mux := http.NewServeMux()
+		mux.Handle("/", node.Handler(handlers.IndexHandler(database, slog.New(slog.DiscardHandler))))
+		mux.Handle("/_txn", node.Handler(handlers.TxnHandler(database, slog.New(slog.DiscardHandler))))
+		mux.HandleFunc("/_shards", node.StatusHandler())
+		mux.HandleFunc("/_shards/topology", node.TopologyHandler())
+		mux.HandleFunc("/_shards/transfer", node.TransferHandler())
+		mux.HandleFunc("/_shards/release", node.ReleaseHandler())
+		tn.server.Config.Handler = mux
+		if wrap != nil {
+			tn.server.Config.Handler = wrap(mux)
+		}
+		tn.server.Start()
+	}
+
+	t.Cleanup(func() {
+		for _, tn := range nodes {
+			tn.server.Close()
+			tn.node.Close()
+			tn.database.Close()
+		}
+	})
+
+	return nodes
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func rebalanced(nodes map[string]*testNode) func() bool {
+	return func() bool {
+		for _, tn := range nodes {
+			status, _ := tn.node.Status()
+			if status.Rebalancing {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// holders returns the members whose databases hold each key.
+func holders(nodes map[string]*testNode) map[string][]string {
+	out := make(map[string][]string)
+	for id, tn := range nodes {
+		keys, _ := tn.database.GetAllKeys()
+		for _, k := range keys {
+			out[k] = append(out[k], id)
+		}
+	}
+	return out
+}
+
+func put(t *testing.T, url, value string) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPut, url, strings.NewReader(value))
+	req.Header.Set("Content-Type", "text/plain")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT %s: %s", url, err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("PUT %s returned %d", url, res.StatusCode)
+	}
+}
+
+func TestNewNode(t *testing.T) {
+	database, _ := db.NewDatabase()
+	defer database.Close()
+
+	tt := []struct {
+		name    string
+		cfg     Config
+		invalid bool
+	}{
+		{name: "node should be one of the members", cfg: Config{ID: "n4", Members: members("n1", "n2")}, invalid: true},
+		{name: "members should not be listed twice", cfg: Config{ID: "n1", Members: members("n1", "n1")}, invalid: true},
+		{name: "addresses should be URLs", cfg: Config{ID: "n1", Members: []Member{{ID: "n1", Addr: "n1:8080"}}}, invalid: true},
+		{name: "valid members should be accepted", cfg: Config{ID: "n1", Members: members("n1", "n2")}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewNode(database, tc.cfg, slog.New(slog.DiscardHandler))
+			if tc.invalid != errors.Is(err, ErrInvalidMember) {
+				t.Errorf("NewNode returned %v", err)
+			}
+		})
+	}
+}
+
+func TestParseMembers(t *testing.T) {
+	got, err := ParseMembers("n1=10.0.0.1:8080, n2=https://10.0.0.2:8443")
+	expected := []Member{{ID: "n1", Addr: "http://10.0.0.1:8080"}, {ID: "n2", Addr: "https://10.0.0.2:8443"}}
+	if err != nil || !reflect.DeepEqual(got, expected) {
+		t.Errorf("ParseMembers returned %v, %v, expected %v", got, err, expected)
+	}
+
+	_, err = ParseMembers("n1")
+	if !errors.Is(err, ErrInvalidMember) {
+		t.Errorf("ParseMembers returned %v for a member without an address, expected ErrInvalidMember", err)
+	}
+}
+
+func TestNodeKeepsTopology(t *testing.T) {
+	database, _ := db.NewDatabase()
+	defer database.Close()
+
+	//Nothing listens on these, so a rebalance pulling from n1 never finishes.
+	before := []Member{{ID: "n1", Addr: "http://127.0.0.1:1"}}
+	after := []Member{{ID: "n1", Addr: "http://127.0.0.1:1"}, {ID: "n2", Addr: "http://127.0.0.1:2"}}
+
+	tt := []struct {
+		name                string
+		self                Member
+		expectedRebalancing bool
+	}{
+		{name: "finished rebalance should not be resumed", self: after[0]},
+		{name: "unfinished rebalance should be resumed", self: after[1], expectedRebalancing: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Config{ID: tc.self.ID, Members: []Member{tc.self}, Dir: t.TempDir()}
+
+			node, err := NewNode(database, cfg, slog.New(slog.DiscardHandler))
+			if err != nil {
+				t.Fatalf("NewNode returned an error: %s", err)
+			}
+			err = node.adopt(topologyChange{Topology: Topology{Epoch: 2, Members: after}, Previous: before})
+			if err != nil {
+				t.Fatalf("adopt returned an error: %s", err)
+			}
+			if !tc.expectedRebalancing {
+				eventually(t, "the rebalance to finish", func() bool {
+					status, _ := node.Status()
+					return !status.Rebalancing
+				})
+			}
+			node.Close()
+
+			//Restarted with the members it was first started with.
+			node, err = NewNode(database, cfg, slog.New(slog.DiscardHandler))
+			if err != nil {
+				t.Fatalf("NewNode returned an error after a restart: %s", err)
+			}
+			defer node.Close()
+
+			status, _ := node.Status()
+			if status.Epoch != 2 || !reflect.DeepEqual(status.Members, after) {
+				t.Errorf("restarted with epoch %d and members %v, expected epoch 2 and %v", status.Epoch, status.Members, after)
+			}
+			if status.Rebalancing != tc.expectedRebalancing {
+				t.Errorf("restarted rebalancing: %t, expected %t", status.Rebalancing, tc.expectedRebalancing)
+			}
+			if tc.expectedRebalancing && !reflect.DeepEqual(status.PullingFrom, []string{"n1"}) {
+				t.Errorf("restarted pulling from %v, expected n1", status.PullingFrom)
+			}
+
+			err = node.adopt(topologyChange{Topology: Topology{Epoch: 1, Members: before}})
+			if !errors.Is(err, ErrStaleTopology) {
+				t.Errorf("adopting an older topology after a restart returned %v, expected ErrStaleTopology", err)
+			}
+		})
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	t.Run("adding a member should move only the keys it now owns", func(t *testing.T) {
+		nodes := newTestDeployment(t, nil, []string{"n1", "n2", "n3"}, "n4")
+		keys := testKeys(200)
+		for _, k := range keys {
+			put(t, nodes["n1"].server.URL+"/"+k, "v-"+k)
+		}
+		put(t, nodes["n2"].server.URL+"/expiring?ttl=1h", "v")
+		before := holders(nodes)
+
+		members := append(nodes["n1"].node.Topology().Members, Member{ID: "n4", Addr: nodes["n4"].server.URL})
+		topology, err := nodes["n2"].node.SetMembers(context.Background(), members)
+		if err != nil {
+			t.Fatalf("SetMembers returned an error: %s", err)
+		}
+		if topology.Epoch != 1 || len(topology.Members) != 4 {
+			t.Errorf("SetMembers returned %+v, expected 4 members at epoch 1", topology)
+		}
+		eventually(t, "the rebalance to finish", rebalanced(nodes))
+
+		after := holders(nodes)
+		moved := 0
+		for k, ids := range after {
+			owner, _ := nodes["n1"].node.Owner(k)
+			if !reflect.DeepEqual(ids, []string{owner.ID}) {
+				t.Errorf("%s is held by %v, expected only its owner %s", k, ids, owner.ID)
+			}
+			if owner.ID != "n4" && !reflect.DeepEqual(ids, before[k]) {
+				t.Errorf("%s moved from %v to %v", k, before[k], ids)
+			}
+			if owner.ID == "n4" {
+				moved++
+			}
+		}
+		if moved == 0 {
+			t.Error("no keys moved to the new member")
+		}
+		if len(after) != len(before) {
+			t.Errorf("%d keys after rebalancing, expected %d", len(after), len(before))
+		}
+
+		owner, _ := nodes["n1"].node.Owner("expiring")
+		if ttl, _, _ := nodes[owner.ID].database.TTL("expiring"); ttl <= 0 || ttl > time.Hour {
+			t.Errorf("expiring has TTL %s on its owner, expected up to an hour", ttl)
+		}
+
+		for _, tn := range nodes {
+			if tn.node.Topology().Epoch != 1 {
+				t.Errorf("%s is at epoch %d, expected 1", tn.node.ID(), tn.node.Topology().Epoch)
+			}
+		}
+	})
+
+	t.Run("removing a member should move its keys to the others", func(t *testing.T) {
+		nodes := newTestDeployment(t, nil, []string{"n1", "n2", "n3"})
+		for _, k := range testKeys(200) {
+			put(t, nodes["n1"].server.URL+"/"+k, "v-"+k)
+		}
+
+		remaining := make([]Member, 0)
+		for _, m := range nodes["n1"].node.Topology().Members {
+			if m.ID != "n3" {
+				remaining = append(remaining, m)
+			}
+		}
+		_, err := nodes["n1"].node.SetMembers(context.Background(), remaining)
+		if err != nil {
+			t.Fatalf("SetMembers returned an error: %s", err)
+		}
+		eventually(t, "the rebalance to finish", rebalanced(nodes))
+
+		if status, _ := nodes["n3"].node.Status(); status.Keys != 0 {
+			t.Errorf("removed member still holds %d keys", status.Keys)
+		}
+		if got := len(holders(nodes)); got != 200 {
+			t.Errorf("%d keys after rebalancing, expected 200", got)
+		}
+	})
+
+	t.Run("keys should be served while they move, and writes should not be undone by the move", func(t *testing.T) {
+		transport := &blockingTransport{}
+		transport.blocked.Store(true)
+		nodes := newTestDeployment(t, transport, []string{"n1", "n2"}, "n3")
+		keys := testKeys(100)
+		for _, k := range keys {
+			put(t, nodes["n1"].server.URL+"/"+k, "old")
+		}
+
+		members := append(nodes["n1"].node.Topology().Members, Member{ID: "n3", Addr: nodes["n3"].server.URL})
+		_, err := nodes["n1"].node.SetMembers(context.Background(), members)
+		if err != nil {
+			t.Fatalf("SetMembers returned an error: %s", err)
+		}
+
+		moving := make([]string, 0)
+		for _, k := range keys {
+			if owner, _ := nodes["n1"].node.Owner(k); owner.ID == "n3" {
+				moving = append(moving, k)
+			}
+		}
+		if len(moving) < 3 {
+			t.Fatalf("only %d keys are moving", len(moving))
+		}
+
+		for _, k := range moving {
+			res, err := http.Get(nodes["n1"].server.URL + "/" + k)
+			if err != nil || res.StatusCode != http.StatusOK {
+				t.Fatalf("GET %s while it moves returned %v, %v", k, res, err)
+			}
+			res.Body.Close()
+		}
+
+		//One key is overwritten and another deleted through the new owner before the bulk move reaches them.
+		put(t, nodes["n2"].server.URL+"/"+moving[1], "new")
+		req, _ := http.NewRequest(http.MethodDelete, nodes["n2"].server.URL+"/"+moving[2], nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil || res.StatusCode != http.StatusOK {
+			t.Fatalf("DELETE %s while it moves returned %v, %v", moving[2], res, err)
+		}
+		res.Body.Close()
+
+		transport.blocked.Store(false)
+		eventually(t, "the rebalance to finish", rebalanced(nodes))
+
+		n3 := nodes["n3"].database
+		if v, _ := n3.Get(moving[0]); !reflect.DeepEqual(v, db.Blob{ContentType: "text/plain", Data: []byte("old")}) {
+			t.Errorf("%s is %v, expected old", moving[0], v)
+		}
+		if v, _ := n3.Get(moving[1]); !reflect.DeepEqual(v, db.Blob{ContentType: "text/plain", Data: []byte("new")}) {
+			t.Errorf("%s is %v, expected the value written while it moved", moving[1], v)
+		}
+		if v, _ := n3.Get(moving[2]); v != nil {
+			t.Errorf("%s is %v, expected it to stay deleted", moving[2], v)
+		}
+		if ids := holders(nodes)[moving[0]]; !reflect.DeepEqual(ids, []string{"n3"}) {
+			t.Errorf("%s is held by %v, expected only n3", moving[0], ids)
+		}
+	})
+
+	t.Run("stale topology should be rejected", func(t *testing.T) {
+		nodes := newTestDeployment(t, nil, []string{"n1"})
+		node := nodes["n1"].node
+
+		_, err := node.SetMembers(context.Background(), node.Topology().Members)
+		if err != nil {
+			t.Fatalf("SetMembers returned an error: %s", err)
+		}
+
+		err = node.adopt(topologyChange{Topology: Topology{Epoch: 0, Members: node.Topology().Members}})
+		if !errors.Is(err, ErrStaleTopology) {
+			t.Errorf("adopting epoch 0 at epoch 1 returned %v, expected ErrStaleTopology", err)
+		}
+
+		_, err = node.export("n1", 0, nil, "")
+		if !errors.Is(err, ErrStaleTopology) {
+			t.Errorf("exporting for epoch 0 at epoch 1 returned %v, expected ErrStaleTopology", err)
+		}
+	})
+}
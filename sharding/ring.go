@@ -0,0 +1,142 @@
+package sharding
+
+import (
+	"sort"
+	"strconv"
+)
+
+// DefaultVirtualNodes is how many points each member has on the ring, so that keys are spread evenly and a member's share is taken from every other member when it leaves.
+const DefaultVirtualNodes = 128
+
+// Member is a node that owns a share of the keys.
+type Member struct {
+	ID string `json:"id"`
+
+	//Base URL of the member's HTTP API.
+	Addr string `json:"addr"`
+}
+
+// Ring assigns each key to a member by consistent hashing: members are hashed to many points on a circle, and a key belongs to the first point at or after its own hash.
+// Adding or removing a member only moves the keys between its points and the points before them. A Ring is immutable.
+type Ring struct {
+	points  []point
+	members map[string]Member
+}
+
+type point struct {
+	hash uint64
+	id   string
+}
+
+// NewRing places each member at vnodes points on the ring. Members are identified by ID; a later duplicate replaces an earlier one.
+func NewRing(members []Member, vnodes int) *Ring {
+	if vnodes <= 0 {
+		vnodes = DefaultVirtualNodes
+	}
+
+	r := &Ring{members: make(map[string]Member, len(members))}
+	for _, m := range members {
+		r.members[m.ID] = m
+	}
+
+	r.points = make([]point, 0, len(r.members)*vnodes)
+	for id := range r.members {
+		for i := 0; i < vnodes; i++ {
+			r.points = append(r.points, point{hash: hash(id + "#" + strconv.Itoa(i)), id: id})
+		}
+	}
+
+	//Ties are broken by id so that every node builds the same ring.
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash != r.points[j].hash {
+			return r.points[i].hash < r.points[j].hash
+		}
+		return r.points[i].id < r.points[j].id
+	})
+
+	return r
+}
+
+// Owner returns the member that owns key, or false if the ring has no members.
+func (r *Ring) Owner(key string) (Member, bool) {
+	if len(r.points) == 0 {
+		return Member{}, false
+	}
+	return r.members[r.ownerAt(hash(key))], true
+}
+
+// ownerAt returns the id of the member owning hash h.
+func (r *Ring) ownerAt(h uint64) string {
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].id
+}
+
+// Member returns the member with the given id.
+func (r *Ring) Member(id string) (Member, bool) {
+	m, ok := r.members[id]
+	return m, ok
+}
+
+// Members returns every member, ordered by id.
+func (r *Ring) Members() []Member {
+	members := make([]Member, 0, len(r.members))
+	for _, m := range r.members {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members
+}
+
+// gained returns the ids of the members that owned, on from, the ranges that id owns on to but did not own on from.
+// These are the only members that id needs keys from when the ring changes from from to to.
+func gained(from, to *Ring, id string) []string {
+	if len(from.points) == 0 {
+		return []string{}
+	}
+
+	//Every boundary on either ring. Between two consecutive boundaries, ownership on both rings is constant,
+	//and is that of the range's end.
+	bounds := make([]uint64, 0, len(from.points)+len(to.points))
+	for _, p := range from.points {
+		bounds = append(bounds, p.hash)
+	}
+	for _, p := range to.points {
+		bounds = append(bounds, p.hash)
+	}
+
+	owners := make(map[string]struct{})
+	for _, b := range bounds {
+		if to.ownerAt(b) != id {
+			continue
+		}
+		if prev := from.ownerAt(b); prev != id {
+			owners[prev] = struct{}{}
+		}
+	}
+
+	ids := make([]string, 0, len(owners))
+	for o := range owners {
+		ids = append(ids, o)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// hash is 64-bit FNV-1a, followed by a finalizer that spreads similar keys, such as "user:1" and "user:2", across the whole ring.
+func hash(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb3f99e3fe7a9
+	h ^= h >> 33
+	return h
+}
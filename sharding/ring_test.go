@@ -0,0 +1,121 @@
+package sharding
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func members(ids ...string) []Member {
+	ms := make([]Member, len(ids))
+	for i, id := range ids {
+		ms[i] = Member{ID: id, Addr: "http://" + id}
+	}
+	return ms
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user:%d", i)
+	}
+	return keys
+}
+
+func owners(r *Ring, keys []string) map[string]string {
+	out := make(map[string]string, len(keys))
+	for _, k := range keys {
+		m, _ := r.Owner(k)
+		out[k] = m.ID
+	}
+	return out
+}
+
+func TestRing(t *testing.T) {
+	keys := testKeys(30000)
+
+	t.Run("keys should be spread evenly across members", func(t *testing.T) {
+		counts := make(map[string]int)
+		for _, id := range owners(NewRing(members("n1", "n2", "n3"), 0), keys) {
+			counts[id]++
+		}
+
+		for id, c := range counts {
+			if c < 8000 || c > 12000 {
+				t.Errorf("%s owns %d of %d keys, expected about a third", id, c, len(keys))
+			}
+		}
+	})
+
+	t.Run("every node should build the same ring", func(t *testing.T) {
+		a := owners(NewRing(members("n1", "n2", "n3"), 0), keys)
+		b := owners(NewRing(members("n3", "n1", "n2"), 0), keys)
+		if !reflect.DeepEqual(a, b) {
+			t.Error("rings built from the same members in a different order disagree")
+		}
+	})
+
+	t.Run("adding a member should only move keys to it", func(t *testing.T) {
+		before := owners(NewRing(members("n1", "n2", "n3"), 0), keys)
+		after := owners(NewRing(members("n1", "n2", "n3", "n4"), 0), keys)
+
+		moved := 0
+		for k, id := range after {
+			if id == before[k] {
+				continue
+			}
+			moved++
+			if id != "n4" {
+				t.Fatalf("%s moved from %s to %s", k, before[k], id)
+			}
+		}
+		if moved < 6000 || moved > 9000 {
+			t.Errorf("%d of %d keys moved, expected about a quarter", moved, len(keys))
+		}
+	})
+
+	t.Run("removing a member should only move its keys", func(t *testing.T) {
+		before := owners(NewRing(members("n1", "n2", "n3"), 0), keys)
+		after := owners(NewRing(members("n1", "n3"), 0), keys)
+
+		for k, id := range before {
+			if id != "n2" && after[k] != id {
+				t.Fatalf("%s moved from %s to %s", k, id, after[k])
+			}
+		}
+	})
+
+	t.Run("empty ring should have no owner", func(t *testing.T) {
+		if _, ok := NewRing(nil, 0).Owner("key"); ok {
+			t.Error("Owner returned a member of an empty ring")
+		}
+	})
+}
+
+func TestGained(t *testing.T) {
+	three := NewRing(members("n1", "n2", "n3"), 0)
+	four := NewRing(members("n1", "n2", "n3", "n4"), 0)
+	two := NewRing(members("n1", "n3"), 0)
+
+	tt := []struct {
+		name     string
+		from, to *Ring
+		id       string
+		expected []string
+	}{
+		{name: "a new member should gain from every member", from: three, to: four, id: "n4", expected: []string{"n1", "n2", "n3"}},
+		{name: "existing members should gain nothing when one is added", from: three, to: four, id: "n1", expected: []string{}},
+		{name: "remaining members should gain from the one removed", from: three, to: two, id: "n1", expected: []string{"n2"}},
+		{name: "a removed member should gain nothing", from: three, to: two, id: "n2", expected: []string{}},
+		{name: "an unchanged ring should gain nothing", from: three, to: three, id: "n1", expected: []string{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := gained(tc.from, tc.to, tc.id)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %v, expected %v", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package sharding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// stateFile is the file in Config.Dir that a node keeps its topology in.
+const stateFile = "topology.json"
+
+// state is what a node keeps across restarts: its topology, and while it is rebalancing, the members before the change
+// and the previous owners it still has to pull keys from.
+type state struct {
+	Topology
+	Previous []Member `json:"previous,omitempty"`
+	Sources  []Member `json:"sources,omitempty"`
+}
+
+// loadState returns the state saved in dir, which has epoch 0 if there is none.
+func loadState(dir string) (state, error) {
+	var s state
+	if dir == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("loading topology: %w", err)
+	}
+
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return s, fmt.Errorf("loading topology: %w", err)
+	}
+	err = validateMembers(s.Members)
+	if err != nil {
+		return s, fmt.Errorf("loading topology: %w", err)
+	}
+	return s, nil
+}
+
+// saveState atomically replaces the state saved in dir. Nothing is saved if dir is empty.
+func saveState(dir string, s state) error {
+	if dir == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, stateFile)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("saving topology: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("saving topology: %w", err)
+	}
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("saving topology: %w", err)
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return fmt.Errorf("saving topology: %w", err)
+	}
+
+	//So that the rename itself survives a crash.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// sortedMembers returns the members of m ordered by id.
+func sortedMembers(m map[string]Member) []Member {
+	members := make([]Member, 0, len(m))
+	for _, member := range m {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members
+}
@@ -0,0 +1,112 @@
+package util
+
+import "strings"
+
+// MatchGlob reports whether s matches a Redis glob pattern, which supports *, ?, character classes such as [a-z] or [^abc], and escaping with a backslash.
+// It takes time proportional to the product of their lengths at worst, however many stars the pattern has.
+func MatchGlob(pattern, s string) bool {
+	p, i := 0, 0
+
+	//Where the pattern continues after the last star seen, and the position in s that the star was last tried up to.
+	star, starI := -1, 0
+
+	for i < len(s) {
+		if p < len(pattern) && pattern[p] == '*' {
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+			if p == len(pattern) {
+				return true
+			}
+			star, starI = p, i
+			continue
+		}
+
+		if next, ok := matchOne(pattern, p, s[i]); ok {
+			p, i = next, i+1
+			continue
+		}
+
+		//A mismatch after a star lets the star take one more character, and the rest of the pattern is tried again from there.
+		//Only the last star needs backtracking: whatever earlier stars took, the last one can make up for it.
+		if star < 0 {
+			return false
+		}
+		starI++
+		p, i = star, starI
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchOne matches c against the single character, class or escape at pattern[p], which is not a star,
+// and returns where the pattern continues after it.
+func matchOne(pattern string, p int, c byte) (int, bool) {
+	if p == len(pattern) {
+		return p, false
+	}
+
+	switch pattern[p] {
+	case '?':
+		return p + 1, true
+
+	case '[':
+		matched, rest := matchClass(pattern[p+1:], c)
+		return len(pattern) - len(rest), matched
+
+	default:
+		if pattern[p] == '\\' && p+1 < len(pattern) {
+			p++
+		}
+		return p + 1, pattern[p] == c
+	}
+}
+
+// matchClass matches c against the class at the start of pattern, which follows the opening bracket, and returns the pattern after the class.
+func matchClass(pattern string, c byte) (bool, string) {
+	negate := false
+	if len(pattern) > 0 && (pattern[0] == '^' || pattern[0] == '!') {
+		negate = true
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		lo := pattern[0]
+		if lo == '\\' && len(pattern) > 1 {
+			pattern = pattern[1:]
+			lo = pattern[0]
+		}
+		pattern = pattern[1:]
+
+		hi := lo
+		if len(pattern) > 1 && pattern[0] == '-' && pattern[1] != ']' {
+			hi = pattern[1]
+			pattern = pattern[2:]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+		}
+
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+
+	//An unterminated class runs to the end of the pattern, as in Redis.
+	pattern = strings.TrimPrefix(pattern, "]")
+
+	return matched != negate, pattern
+}
+
+// LiteralPrefix returns the part of pattern before its first special character, which every matching key starts with.
+func LiteralPrefix(pattern string) string {
+	i := strings.IndexAny(pattern, `*?[\`)
+	if i < 0 {
+		return pattern
+	}
+	return pattern[:i]
+}
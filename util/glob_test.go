@@ -0,0 +1,89 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tt := []struct {
+		pattern  string
+		s        string
+		expected bool
+	}{
+		{pattern: "*", s: "", expected: true},
+		{pattern: "*", s: "user/1", expected: true},
+		{pattern: "user:*", s: "user:1", expected: true},
+		{pattern: "user:*", s: "users:1", expected: false},
+		{pattern: "*:1", s: "user:1", expected: true},
+		{pattern: "h?llo", s: "hello", expected: true},
+		{pattern: "h?llo", s: "hllo", expected: false},
+		{pattern: "h*llo", s: "heeeello", expected: true},
+		{pattern: "h[ae]llo", s: "hallo", expected: true},
+		{pattern: "h[ae]llo", s: "hillo", expected: false},
+		{pattern: "h[^e]llo", s: "hallo", expected: true},
+		{pattern: "h[^e]llo", s: "hello", expected: false},
+		{pattern: "h[a-c]llo", s: "hbllo", expected: true},
+		{pattern: "h[c-a]llo", s: "hbllo", expected: true},
+		{pattern: "h[a-c]llo", s: "hdllo", expected: false},
+		{pattern: `h\*llo`, s: "h*llo", expected: true},
+		{pattern: `h\*llo`, s: "hello", expected: false},
+		{pattern: `[\]]`, s: "]", expected: true},
+		{pattern: "a*b*c", s: "aXbYbZc", expected: true},
+		{pattern: "a*b*c", s: "aXbYbZ", expected: false},
+		{pattern: "*a", s: "aaa", expected: true},
+		{pattern: "a*", s: "", expected: false},
+		{pattern: "**", s: "", expected: true},
+		{pattern: "*?", s: "", expected: false},
+		{pattern: "*[ab]", s: "xxb", expected: true},
+		{pattern: `*\*`, s: "x*", expected: true},
+		{pattern: `a\`, s: `a\`, expected: true},
+		{pattern: "h[a", s: "ha", expected: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.pattern+" "+tc.s, func(t *testing.T) {
+			if got := MatchGlob(tc.pattern, tc.s); got != tc.expected {
+				t.Errorf("MatchGlob(%q, %q): got %t, want %t", tc.pattern, tc.s, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMatchGlobPathological(t *testing.T) {
+	//Backtracking into every star would try each way of splitting s between them, which never finishes for these.
+	pattern := strings.Repeat("*a", 30) + "b"
+	s := strings.Repeat("a", 10000)
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- MatchGlob(pattern, s)
+	}()
+
+	select {
+	case matched := <-done:
+		if matched {
+			t.Errorf("MatchGlob(%q, %q) matched", pattern, s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("MatchGlob did not finish")
+	}
+}
+
+func TestLiteralPrefix(t *testing.T) {
+	tt := map[string]string{
+		"user:*":  "user:",
+		"user:?1": "user:",
+		"h[ae]":   "h",
+		`a\*`:     "a",
+		"exact":   "exact",
+		"*":       "",
+	}
+
+	for pattern, expected := range tt {
+		if got := LiteralPrefix(pattern); got != expected {
+			t.Errorf("LiteralPrefix(%q): got %q, want %q", pattern, got, expected)
+		}
+	}
+}